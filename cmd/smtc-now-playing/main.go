@@ -18,10 +18,15 @@ import (
 
 	"github.com/rodrigocfd/windigo/co"
 	"github.com/rodrigocfd/windigo/win"
+	"smtc-now-playing/internal/artfallback"
+	"smtc-now-playing/internal/bitmapfont"
+	"smtc-now-playing/internal/bookmarks"
 	"smtc-now-playing/internal/config"
+	"smtc-now-playing/internal/domain"
 	"smtc-now-playing/internal/gui"
 	"smtc-now-playing/internal/server"
 	"smtc-now-playing/internal/smtc"
+	"smtc-now-playing/internal/thumbnail"
 	"smtc-now-playing/internal/version"
 )
 
@@ -113,16 +118,98 @@ func main() {
 	os.Exit(exitCode)
 }
 
+// openBookmarks loads the bookmark store next to the config file. It returns
+// nil, leaving the server's in-memory store in place, when there is no config
+// directory or the file cannot be read.
+func openBookmarks() *bookmarks.Store {
+	path, err := config.DataPath("bookmarks.json")
+	if err != nil || path == "" {
+		slog.Warn("bookmark path resolution failed, bookmarks will not be saved", "err", err)
+		return nil
+	}
+	store, err := bookmarks.Open(path)
+	if err != nil {
+		slog.Warn("failed to load bookmarks, bookmarks will not be saved", "err", err)
+		return nil
+	}
+	return store
+}
+
+// enableAlbumArtDiskCache points the server's album art cache at an albumArt
+// folder next to the config file. Failures leave the cache memory-only.
+func enableAlbumArtDiskCache(srv *server.Server) {
+	dir, err := config.DataPath("albumArt")
+	if err != nil || dir == "" {
+		slog.Warn("album art cache path resolution failed, album art will not be cached on disk", "err", err)
+		return
+	}
+	if err := srv.SetAlbumArtDir(dir); err != nil {
+		slog.Warn("failed to open album art cache, album art will not be cached on disk", "err", err)
+	}
+}
+
+// fallbackArt returns the resolver for tracks without album art, looking for
+// images in a fallbackArt folder next to the config file unless the config
+// names another folder.
+func fallbackArt(cfg config.AlbumArtFallbackConfig) func(*domain.InfoData) bool {
+	if cfg.Dir == "" {
+		dir, err := config.DataPath("fallbackArt")
+		if err != nil {
+			slog.Warn("fallback art path resolution failed, only app defaults and generated art will be used", "err", err)
+		}
+		cfg.Dir = dir
+	}
+	return artfallback.New(cfg).Fill
+}
+
+// loadCardFonts gives the server the BDF fonts for card images, from a fonts
+// folder next to the config file unless the config names another folder.
+// Fonts that fail to load are logged; cards fall back to the built-in font.
+func loadCardFonts(srv *server.Server, cfg config.CardConfig) {
+	dir := cfg.FontDir
+	if dir == "" {
+		var err error
+		if dir, err = config.DataPath("fonts"); err != nil || dir == "" {
+			slog.Warn("card font path resolution failed, cards will use the built-in font", "err", err)
+			return
+		}
+	}
+	fonts, err := bitmapfont.LoadDir(dir)
+	if err != nil {
+		slog.Warn("failed to load some card fonts", "dir", dir, "err", err)
+	}
+	if len(fonts) > 0 {
+		srv.SetCardFonts(fonts)
+	}
+}
+
 // runApp builds the appropriate mode (headless or GUI) and runs until done.
 // Split out so main() can clean up the single-instance mutex before os.Exit.
 func runApp(cfg *config.Config, headless bool) int {
-	smtcSvc := smtc.New(smtc.Options{InitialDevice: cfg.SMTC.SelectedDevice})
+	opts := smtc.Options{
+		InitialDevice: cfg.SMTC.SelectedDevice,
+		ThumbnailLimits: thumbnail.Limits{
+			MaxBytes:     cfg.AlbumArt.MaxBytes,
+			MaxDimension: cfg.AlbumArt.MaxDimension,
+		},
+	}
+	if cfg.AlbumArt.Fallback.Enabled {
+		opts.FallbackArt = fallbackArt(cfg.AlbumArt.Fallback)
+	}
+	smtcSvc := smtc.New(opts)
 
 	srv, err := server.New(cfg, smtcSvc)
 	if err != nil {
 		slog.Error("failed to create server", "err", err)
 		return 1
 	}
+	if store := openBookmarks(); store != nil {
+		srv.SetBookmarkStore(store)
+	}
+	if cfg.AlbumArt.DiskCache {
+		enableAlbumArtDiskCache(srv)
+	}
+	loadCardFonts(srv, cfg.Card)
 
 	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer cancel()
@@ -9,7 +9,9 @@ require (
 	github.com/rodrigocfd/windigo v0.2.5
 	github.com/saltosystems/winrt-go v0.0.0-20260317170058-9c2fec580d96
 	github.com/soarqin/go-webview2 v0.0.0-20260121113243-bca354a1deab
+	golang.org/x/image v0.36.0
 	golang.org/x/sys v0.43.0
+	golang.org/x/text v0.34.0
 )
 
 require (
@@ -212,7 +214,6 @@ require (
 	golang.org/x/mod v0.35.0 // indirect
 	golang.org/x/sync v0.20.0 // indirect
 	golang.org/x/telemetry v0.0.0-20260421165255-392afab6f40e // indirect
-	golang.org/x/text v0.34.0 // indirect
 	golang.org/x/tools v0.44.0 // indirect
 	golang.org/x/vuln v1.3.0 // indirect
 	google.golang.org/protobuf v1.36.8 // indirect
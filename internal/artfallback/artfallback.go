@@ -0,0 +1,209 @@
+// Package artfallback finds album art for tracks whose player publishes none.
+package artfallback
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"smtc-now-playing/internal/config"
+	"smtc-now-playing/internal/domain"
+)
+
+var log = slog.With("subsystem", "artfallback")
+
+// maxImageSize bounds the user images read from disk.
+const maxImageSize = 16 << 20
+
+// imageTypes maps the file extensions looked up in the user's folder to
+// their content types. Only formats the standard library decodes are
+// accepted, so the art can be size-limited and rendered like a player's.
+var imageTypes = map[string]string{
+	".png":  "image/png",
+	".jpg":  "image/jpeg",
+	".jpeg": "image/jpeg",
+	".gif":  "image/gif",
+}
+
+// Resolver tries, in order, the user's folder, the source app's default art
+// and a generated tile. It is safe for concurrent use.
+type Resolver struct {
+	dir      string
+	patterns []string
+	apps     []appArt
+	generate bool
+	tiles    tileCache
+}
+
+// appArt is the default image of the apps matching pattern.
+type appArt struct {
+	pattern string // lower case
+	path    string
+}
+
+// New returns a resolver for cfg.
+func New(cfg config.AlbumArtFallbackConfig) *Resolver {
+	r := &Resolver{dir: cfg.Dir, patterns: cfg.Patterns, generate: cfg.Generate}
+	for pattern, image := range cfg.Apps {
+		if !filepath.IsAbs(image) && cfg.Dir != "" {
+			image = filepath.Join(cfg.Dir, image)
+		}
+		r.apps = append(r.apps, appArt{pattern: strings.ToLower(pattern), path: image})
+	}
+	// Map order is random; sort so overlapping patterns match the same way
+	// on every run.
+	slices.SortFunc(r.apps, func(a, b appArt) int { return strings.Compare(a.pattern, b.pattern) })
+	return r
+}
+
+// Fill sets the thumbnail of info from the first source with art for it and
+// reports whether one had any. info is left untouched otherwise.
+func (r *Resolver) Fill(info *domain.InfoData) bool {
+	if ct, data, ok := r.fromFolder(*info); ok {
+		setArt(info, ct, data, domain.ArtSourceFolder)
+		return true
+	}
+	if ct, data, ok := r.fromApp(info.SourceApp); ok {
+		setArt(info, ct, data, domain.ArtSourceApp)
+		return true
+	}
+	if r.generate {
+		data, err := r.tiles.get(*info)
+		if err != nil {
+			log.Debug("failed to generate album art", "err", err)
+			return false
+		}
+		setArt(info, "image/png", data, domain.ArtSourceGenerated)
+		return true
+	}
+	return false
+}
+
+func setArt(info *domain.InfoData, contentType string, data []byte, source string) {
+	info.ThumbnailContentType = contentType
+	info.ThumbnailData = data
+	info.ThumbnailSource = source
+}
+
+// fromFolder returns the first image in the user's folder whose name matches
+// a pattern expanded for info. Names are compared case-insensitively.
+func (r *Resolver) fromFolder(info domain.InfoData) (string, []byte, bool) {
+	if r.dir == "" || len(r.patterns) == 0 {
+		return "", nil, false
+	}
+	entries, err := os.ReadDir(r.dir)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Debug("failed to read fallback art folder", "err", err)
+		}
+		return "", nil, false
+	}
+	files := make(map[string]string, len(entries))
+	for _, e := range entries {
+		ext := strings.ToLower(filepath.Ext(e.Name()))
+		if e.IsDir() || imageTypes[ext] == "" {
+			continue
+		}
+		stem := strings.ToLower(strings.TrimSuffix(e.Name(), filepath.Ext(e.Name())))
+		if _, dup := files[stem]; !dup {
+			files[stem] = e.Name()
+		}
+	}
+	for _, pattern := range r.patterns {
+		name, ok := expand(pattern, info)
+		if !ok {
+			continue
+		}
+		file, ok := files[strings.ToLower(name)]
+		if !ok {
+			continue
+		}
+		if ct, data, ok := readImage(filepath.Join(r.dir, file)); ok {
+			return ct, data, true
+		}
+	}
+	return "", nil, false
+}
+
+// fromApp returns the default image of the first app pattern matching appID.
+func (r *Resolver) fromApp(appID string) (string, []byte, bool) {
+	if appID == "" {
+		return "", nil, false
+	}
+	id := strings.ToLower(appID)
+	for _, app := range r.apps {
+		if ok, _ := path.Match(app.pattern, id); ok {
+			return readImage(app.path)
+		}
+	}
+	return "", nil, false
+}
+
+// readImage reads an image file no larger than maxImageSize.
+func readImage(name string) (string, []byte, bool) {
+	ct := imageTypes[strings.ToLower(filepath.Ext(name))]
+	if ct == "" {
+		log.Debug("fallback art is not a supported image", "file", name)
+		return "", nil, false
+	}
+	data, err := readLimited(name)
+	if err != nil {
+		log.Debug("failed to read fallback art", "file", name, "err", err)
+		return "", nil, false
+	}
+	return ct, data, true
+}
+
+func readLimited(name string) ([]byte, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	data, err := io.ReadAll(io.LimitReader(f, maxImageSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxImageSize {
+		return nil, fmt.Errorf("larger than %d bytes", maxImageSize)
+	}
+	if len(data) == 0 {
+		return nil, fmt.Errorf("empty file")
+	}
+	return data, nil
+}
+
+// fileNameReplacer replaces the characters Windows does not allow in file
+// names.
+var fileNameReplacer = strings.NewReplacer(
+	"<", "_", ">", "_", ":", "_", `"`, "_", "/", "_", `\`, "_", "|", "_", "?", "_", "*", "_",
+)
+
+// expand fills the placeholders of pattern from info. It reports false when
+// the pattern uses a field info does not have.
+func expand(pattern string, info domain.InfoData) (string, bool) {
+	fields := []struct{ key, value string }{
+		{"{artist}", info.Artist},
+		{"{album}", info.AlbumTitle},
+		{"{albumArtist}", info.AlbumArtist},
+		{"{title}", info.Title},
+	}
+	var pairs []string
+	for _, f := range fields {
+		if !strings.Contains(pattern, f.key) {
+			continue
+		}
+		value := strings.Trim(fileNameReplacer.Replace(strings.TrimSpace(f.value)), " .")
+		if value == "" {
+			return "", false
+		}
+		pairs = append(pairs, f.key, value)
+	}
+	name := strings.NewReplacer(pairs...).Replace(pattern)
+	return name, name != ""
+}
@@ -0,0 +1,154 @@
+package artfallback
+
+import (
+	"bytes"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"smtc-now-playing/internal/config"
+	"smtc-now-playing/internal/domain"
+)
+
+func writeFile(t *testing.T, name, data string) {
+	t.Helper()
+	if err := os.WriteFile(name, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func testResolver(t *testing.T) (*Resolver, string) {
+	t.Helper()
+	cfg := config.DefaultConfig().AlbumArt.Fallback
+	cfg.Dir = t.TempDir()
+	cfg.Apps = map[string]string{"spotify*": "spotify.png"}
+	return New(cfg), cfg.Dir
+}
+
+func TestFill_Folder(t *testing.T) {
+	r, dir := testResolver(t)
+	writeFile(t, filepath.Join(dir, "artist - album.JPG"), "album")
+	writeFile(t, filepath.Join(dir, "Artist.png"), "artist")
+	writeFile(t, filepath.Join(dir, "Artist - Other.txt"), "not an image")
+
+	tests := []struct {
+		name string
+		info domain.InfoData
+		want string
+	}{
+		{"artist and album, any case", domain.InfoData{Artist: "Artist", AlbumTitle: "Album", Title: "Song"}, "album"},
+		{"falls through to artist", domain.InfoData{Artist: "Artist", AlbumTitle: "Other", Title: "Song"}, "artist"},
+		{"skips patterns with empty fields", domain.InfoData{Artist: "Artist", Title: "Song"}, "artist"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info := tt.info
+			if !r.Fill(&info) {
+				t.Fatal("Fill found no art")
+			}
+			if string(info.ThumbnailData) != tt.want || info.ThumbnailSource != domain.ArtSourceFolder {
+				t.Fatalf("got %q from %q, want %q from the folder", info.ThumbnailData, info.ThumbnailSource, tt.want)
+			}
+		})
+	}
+
+	info := domain.InfoData{Artist: "Artist", AlbumTitle: "Album"}
+	r.Fill(&info)
+	if info.ThumbnailContentType != "image/jpeg" {
+		t.Fatalf("content type = %q, want image/jpeg", info.ThumbnailContentType)
+	}
+}
+
+func TestFill_SanitisesFileNames(t *testing.T) {
+	r, dir := testResolver(t)
+	writeFile(t, filepath.Join(dir, "AC_DC - Back in Black.png"), "acdc")
+
+	info := domain.InfoData{Artist: "AC/DC", AlbumTitle: "Back in Black"}
+	if !r.Fill(&info) || string(info.ThumbnailData) != "acdc" {
+		t.Fatalf("got %q from %q, want the sanitised file", info.ThumbnailData, info.ThumbnailSource)
+	}
+}
+
+func TestFill_App(t *testing.T) {
+	r, dir := testResolver(t)
+	writeFile(t, filepath.Join(dir, "spotify.png"), "spotify")
+
+	info := domain.InfoData{Artist: "Nobody", Title: "Song", SourceApp: "Spotify.exe"}
+	if !r.Fill(&info) || string(info.ThumbnailData) != "spotify" || info.ThumbnailSource != domain.ArtSourceApp {
+		t.Fatalf("got %q from %q, want the app default", info.ThumbnailData, info.ThumbnailSource)
+	}
+}
+
+func TestFill_Generated(t *testing.T) {
+	r, _ := testResolver(t)
+
+	info := domain.InfoData{Artist: "Nobody", Title: "Song", SourceApp: "Other.exe"}
+	if !r.Fill(&info) || info.ThumbnailSource != domain.ArtSourceGenerated || info.ThumbnailContentType != "image/png" {
+		t.Fatalf("got %q from %q, want a generated PNG", info.ThumbnailContentType, info.ThumbnailSource)
+	}
+	img, err := png.Decode(bytes.NewReader(info.ThumbnailData))
+	if err != nil {
+		t.Fatalf("decode tile: %v", err)
+	}
+	if b := img.Bounds(); b.Dx() != tileSize || b.Dy() != tileSize {
+		t.Fatalf("tile is %v, want %dx%d", b, tileSize, tileSize)
+	}
+
+	again := domain.InfoData{Artist: "Nobody", Title: "Other song"}
+	r.Fill(&again)
+	if !bytes.Equal(again.ThumbnailData, info.ThumbnailData) {
+		t.Fatal("tiles differ for the same artist and album")
+	}
+}
+
+func TestFill_ReusesTiles(t *testing.T) {
+	r, _ := testResolver(t)
+	first := domain.InfoData{Artist: "Nobody", AlbumTitle: "Album", Title: "Song"}
+	second := domain.InfoData{Artist: "Nobody", AlbumTitle: "Album", Title: "Next song"}
+	r.Fill(&first)
+	r.Fill(&second)
+	if &first.ThumbnailData[0] != &second.ThumbnailData[0] {
+		t.Fatal("the same tile was generated twice")
+	}
+}
+
+func TestFill_SkipsUndecodableFormats(t *testing.T) {
+	r, dir := testResolver(t)
+	r.generate = false
+	writeFile(t, filepath.Join(dir, "Artist.webp"), "webp")
+
+	info := domain.InfoData{Artist: "Artist", Title: "Song"}
+	if r.Fill(&info) {
+		t.Fatalf("Fill used %q, want WebP files skipped", info.ThumbnailData)
+	}
+}
+
+func TestFill_NothingWithoutGenerate(t *testing.T) {
+	r, _ := testResolver(t)
+	r.generate = false
+
+	info := domain.InfoData{Artist: "Nobody", Title: "Song"}
+	if r.Fill(&info) || info.ThumbnailData != nil || info.ThumbnailSource != "" {
+		t.Fatalf("Fill = %+v, want info untouched", info)
+	}
+}
+
+func TestInitials(t *testing.T) {
+	tests := []struct {
+		info domain.InfoData
+		want string
+	}{
+		{domain.InfoData{Artist: "daft punk"}, "DP"},
+		{domain.InfoData{Artist: "The Rolling Stones"}, "TR"},
+		{domain.InfoData{Artist: "(Sandy) Alex G"}, "SA"},
+		{domain.InfoData{Artist: "  ", Title: "2 Minutes"}, "2M"},
+		{domain.InfoData{Artist: "Björk"}, "B"},
+		{domain.InfoData{Artist: "坂本龍一"}, ""},
+	}
+	for _, tt := range tests {
+		if got := initials(tt.info); got != tt.want {
+			t.Errorf("initials(%q, %q) = %q, want %q", tt.info.Artist, tt.info.Title, got, tt.want)
+		}
+	}
+}
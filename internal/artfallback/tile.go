@@ -0,0 +1,142 @@
+package artfallback
+
+import (
+	"bytes"
+	"hash/fnv"
+	"image"
+	"image/color"
+	"image/png"
+	"strings"
+	"sync"
+	"unicode"
+
+	"smtc-now-playing/internal/bitmapfont"
+	"smtc-now-playing/internal/domain"
+)
+
+// tileSize is the edge of generated tiles in pixels.
+const tileSize = 512
+
+// maxCachedTiles bounds the generated tiles kept for reuse.
+const maxCachedTiles = 32
+
+// tileColors are the gradient pairs of generated tiles, picked by a hash of
+// the artist and album so every track of an album looks the same.
+var tileColors = [][2]color.RGBA{
+	{{0x3a, 0x1c, 0x71, 0xff}, {0xd7, 0x6d, 0x77, 0xff}},
+	{{0x13, 0x4e, 0x5e, 0xff}, {0x71, 0xb2, 0x80, 0xff}},
+	{{0x1f, 0x40, 0x37, 0xff}, {0x99, 0xf2, 0xc8, 0xff}},
+	{{0x42, 0x27, 0x5a, 0xff}, {0x73, 0x4b, 0x6d, 0xff}},
+	{{0x14, 0x1e, 0x30, 0xff}, {0x24, 0x3b, 0x55, 0xff}},
+	{{0x8e, 0x2d, 0xe2, 0xff}, {0x4a, 0x00, 0xe0, 0xff}},
+	{{0xc0, 0x39, 0x2b, 0xff}, {0x8e, 0x44, 0xad, 0xff}},
+	{{0xe6, 0x5c, 0x00, 0xff}, {0xf9, 0xd4, 0x23, 0xff}},
+}
+
+// font is the built-in font, used to tell which initials tiles can draw.
+var font = bitmapfont.Default()
+
+// initials returns up to two initials of the artist, or of the title when
+// there is no artist. Letters the built-in font cannot draw are skipped.
+func initials(info domain.InfoData) string {
+	name := info.Artist
+	if strings.TrimSpace(name) == "" {
+		name = info.Title
+	}
+	var out []rune
+	for _, word := range strings.Fields(name) {
+		for _, r := range word {
+			if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+				continue
+			}
+			r = unicode.ToUpper(r)
+			if _, ok := font.Glyph(r); ok {
+				out = append(out, r)
+			}
+			break
+		}
+		if len(out) == 2 {
+			break
+		}
+	}
+	return string(out)
+}
+
+// tileKey is what a generated tile looks like: its gradient and its text.
+type tileKey struct {
+	colors int // index into tileColors
+	text   string
+}
+
+// tileKeyFor picks the gradient from the artist and album and the text from
+// the track's initials.
+func tileKeyFor(info domain.InfoData) tileKey {
+	h := fnv.New32a()
+	h.Write([]byte(info.Artist + "\x00" + info.AlbumTitle))
+	text := initials(info)
+	if text == "" {
+		text = "♪"
+	}
+	return tileKey{colors: int(h.Sum32() % uint32(len(tileColors))), text: text}
+}
+
+// tileCache keeps generated tiles, so the tracks of an album share one
+// instead of each drawing and encoding it again. It is emptied when full.
+type tileCache struct {
+	mu    sync.Mutex
+	tiles map[tileKey][]byte
+}
+
+// get returns the tile of info, generating it on a miss.
+func (c *tileCache) get(info domain.InfoData) ([]byte, error) {
+	key := tileKeyFor(info)
+	c.mu.Lock()
+	data, ok := c.tiles[key]
+	c.mu.Unlock()
+	if ok {
+		return data, nil
+	}
+	data, err := tile(key)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	if c.tiles == nil || len(c.tiles) >= maxCachedTiles {
+		c.tiles = make(map[tileKey][]byte)
+	}
+	c.tiles[key] = data
+	c.mu.Unlock()
+	return data, nil
+}
+
+// tile draws a square PNG with the gradient of key and its text in white.
+func tile(key tileKey) ([]byte, error) {
+	pair := tileColors[key.colors]
+
+	img := image.NewRGBA(image.Rect(0, 0, tileSize, tileSize))
+	for y := 0; y < tileSize; y++ {
+		for x := 0; x < tileSize; x++ {
+			t := float64(x+y) / float64(2*(tileSize-1))
+			img.SetRGBA(x, y, lerp(pair[0], pair[1], t))
+		}
+	}
+
+	text := key.text
+	face := bitmapfont.NewFace(tileSize / 3)
+	// The width includes the gap after the last glyph; centre on the ink.
+	gap := face.Width(" ") / 6
+	x := (tileSize - face.Width(text) + gap) / 2
+	y := (tileSize + face.Ascent()) / 2
+	face.Draw(img, x, y, text, color.White)
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func lerp(a, b color.RGBA, t float64) color.RGBA {
+	mix := func(x, y uint8) uint8 { return uint8(float64(x) + (float64(y)-float64(x))*t + 0.5) }
+	return color.RGBA{mix(a.R, b.R), mix(a.G, b.G), mix(a.B, b.B), 0xff}
+}
@@ -0,0 +1,221 @@
+package bitmapfont
+
+import (
+	"bufio"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// maxFontFile bounds the BDF files read by LoadDir. GNU Unifont, which
+// covers the whole Basic Multilingual Plane, is about 10 MiB.
+const maxFontFile = 32 << 20
+
+// LoadDir loads the .bdf fonts in dir, sorted by file name. Files that fail
+// to parse are skipped and reported in the error, alongside the fonts that
+// loaded. A missing dir loads nothing.
+func LoadDir(dir string) ([]*Font, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var names []string
+	for _, e := range entries {
+		if !e.IsDir() && strings.EqualFold(filepath.Ext(e.Name()), ".bdf") {
+			names = append(names, e.Name())
+		}
+	}
+	slices.Sort(names)
+
+	var fonts []*Font
+	var errs []error
+	for _, name := range names {
+		f, err := loadFile(filepath.Join(dir, name))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+			continue
+		}
+		fonts = append(fonts, f)
+	}
+	return fonts, errors.Join(errs...)
+}
+
+func loadFile(path string) (*Font, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	f, err := ParseBDF(io.LimitReader(file, maxFontFile))
+	if err != nil {
+		return nil, err
+	}
+	f.Name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	return f, nil
+}
+
+// ParseBDF reads a font in the Glyph Bitmap Distribution Format. Only the
+// properties needed to draw horizontal text are used.
+func ParseBDF(r io.Reader) (*Font, error) {
+	f := &Font{glyphs: make(map[rune]Glyph)}
+	var (
+		bbox      [4]int // font bounding box: w, h, x, y
+		haveBBox  bool
+		ascent    = -1
+		descent   = -1
+		defAdv    = 0 // DWIDTH before the first glyph
+		inChar    bool
+		enc       = -1
+		g         Glyph
+		gbox      [4]int
+		bitmapRow = -1 // next row of the glyph bitmap, -1 outside BITMAP
+	)
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 4096), 1<<16)
+	line := 0
+	for sc.Scan() {
+		line++
+		fields := strings.Fields(sc.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if bitmapRow >= 0 {
+			if fields[0] == "ENDCHAR" {
+				if enc >= 0 {
+					f.glyphs[rune(enc)] = g
+				}
+				bitmapRow, inChar = -1, false
+				continue
+			}
+			if bitmapRow < gbox[1] {
+				if err := setRow(g.Mask, bitmapRow, fields[0], gbox[0]); err != nil {
+					return nil, fmt.Errorf("line %d: %w", line, err)
+				}
+			}
+			bitmapRow++
+			continue
+		}
+
+		var err error
+		switch fields[0] {
+		case "FONTBOUNDINGBOX":
+			err = ints(fields[1:], bbox[:])
+			haveBBox = err == nil
+		case "FONT_ASCENT":
+			ascent, err = atoi(fields[1:])
+		case "FONT_DESCENT":
+			descent, err = atoi(fields[1:])
+		case "DWIDTH":
+			var adv int
+			if adv, err = atoi(fields[1:]); inChar {
+				g.Advance = adv
+			} else {
+				defAdv = adv
+			}
+		case "STARTCHAR":
+			g = Glyph{Advance: defAdv}
+			enc, inChar = -1, true
+		case "ENDCHAR":
+			inChar = false // a glyph without a bitmap draws nothing
+			if enc >= 0 {
+				f.glyphs[rune(enc)] = g
+			}
+		case "ENCODING":
+			enc, err = atoi(fields[1:])
+			if err == nil && enc > 0x10ffff {
+				enc = -1 // not in Unicode; parsed but not kept
+			}
+		case "BBX":
+			if err = ints(fields[1:], gbox[:]); err == nil {
+				if gbox[0] < 0 || gbox[1] < 0 || gbox[0] > 1024 || gbox[1] > 1024 {
+					err = fmt.Errorf("glyph size %dx%d out of range", gbox[0], gbox[1])
+				}
+			}
+		case "BITMAP":
+			g.Mask = image.NewAlpha(image.Rect(0, 0, gbox[0], gbox[1]))
+			g.Origin = image.Pt(gbox[2], -(gbox[3] + gbox[1]))
+			if g.Advance == 0 {
+				g.Advance = gbox[0] + gbox[2]
+			}
+			bitmapRow = 0
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s: %w", line, fields[0], err)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if len(f.glyphs) == 0 {
+		return nil, errors.New("no glyphs")
+	}
+	if ascent < 0 || descent < 0 {
+		if !haveBBox {
+			return nil, errors.New("no FONT_ASCENT, FONT_DESCENT or FONTBOUNDINGBOX")
+		}
+		ascent, descent = bbox[1]+bbox[3], -bbox[3]
+	}
+	f.Ascent, f.Descent = max(ascent, 0), max(descent, 0)
+	for r, g := range f.glyphs {
+		if g.Mask != nil && isBlank(g.Mask) {
+			g.Mask = nil
+			f.glyphs[r] = g
+		}
+	}
+	return f, nil
+}
+
+// setRow fills row y of mask from a BDF hex row, most significant bit first.
+func setRow(mask *image.Alpha, y int, hexRow string, width int) error {
+	bits, err := hex.DecodeString(hexRow)
+	if err != nil {
+		return fmt.Errorf("bitmap row: %w", err)
+	}
+	for x := 0; x < width && x/8 < len(bits); x++ {
+		if bits[x/8]&(0x80>>(x%8)) != 0 {
+			mask.SetAlpha(x, y, color.Alpha{A: 0xff})
+		}
+	}
+	return nil
+}
+
+func isBlank(mask *image.Alpha) bool {
+	for _, a := range mask.Pix {
+		if a != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func atoi(fields []string) (int, error) {
+	if len(fields) == 0 {
+		return 0, errors.New("missing value")
+	}
+	return strconv.Atoi(fields[0])
+}
+
+func ints(fields []string, out []int) error {
+	if len(fields) < len(out) {
+		return fmt.Errorf("want %d values, got %d", len(out), len(fields))
+	}
+	for i := range out {
+		n, err := strconv.Atoi(fields[i])
+		if err != nil {
+			return err
+		}
+		out[i] = n
+	}
+	return nil
+}
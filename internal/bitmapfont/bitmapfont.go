@@ -0,0 +1,182 @@
+// Package bitmapfont draws text with bitmap fonts: a built-in ASCII font and
+// BDF fonts loaded from disk. It needs nothing beyond the standard library,
+// which has no TrueType rasterizer.
+package bitmapfont
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Glyph is one character of a font.
+type Glyph struct {
+	Mask    *image.Alpha // nil for blank glyphs such as space
+	Origin  image.Point  // top-left of Mask relative to the pen on the baseline
+	Advance int          // pen movement after drawing
+}
+
+// Font is a bitmap font. Ascent and Descent are the pixels above and below
+// the baseline of a line of text.
+type Font struct {
+	Name    string
+	Ascent  int
+	Descent int
+	glyphs  map[rune]Glyph
+}
+
+// Glyph returns the glyph of r, if the font has one.
+func (f *Font) Glyph(r rune) (Glyph, bool) {
+	g, ok := f.glyphs[r]
+	return g, ok
+}
+
+// Height is the line height of the font in pixels.
+func (f *Font) Height() int { return f.Ascent + f.Descent }
+
+// Default returns the built-in 5×7 font. It covers printable ASCII and '♪',
+// with descenders below the baseline; faces draw other characters as a box.
+var Default = sync.OnceValue(func() *Font {
+	f := &Font{Name: "builtin", Ascent: builtinAscent, Descent: builtinDescent, glyphs: make(map[rune]Glyph, len(builtinGlyphs))}
+	for r, rows := range builtinGlyphs {
+		f.glyphs[r] = builtinGlyph(rows)
+	}
+	return f
+})
+
+// builtinGlyph converts rows of '#' and '.' into a glyph. Rows start at the
+// top of the ascent; glyphs without descenders list fewer rows.
+func builtinGlyph(rows []string) Glyph {
+	g := Glyph{Origin: image.Pt(0, -builtinAscent), Advance: builtinWidth + 1}
+	mask := image.NewAlpha(image.Rect(0, 0, builtinWidth, len(rows)))
+	blank := true
+	for y, row := range rows {
+		for x, c := range row {
+			if c == '#' {
+				mask.SetAlpha(x, y, color.Alpha{A: 0xff})
+				blank = false
+			}
+		}
+	}
+	if !blank {
+		g.Mask = mask
+	}
+	return g
+}
+
+// Face draws text in a list of fonts at a pixel size. Each character comes
+// from the first font that has it, the built-in font last; fonts are scaled
+// by whole pixels to about the requested line height.
+type Face struct {
+	fonts   []*Font
+	scales  []int
+	ascent  int
+	descent int
+}
+
+// NewFace returns a face about size pixels tall drawing from fonts, then
+// from the built-in font.
+func NewFace(size int, fonts ...*Font) *Face {
+	face := &Face{fonts: append(append([]*Font(nil), fonts...), Default())}
+	for _, f := range face.fonts {
+		scale := max(1, (size+f.Height()/2)/max(1, f.Height()))
+		face.scales = append(face.scales, scale)
+		face.ascent = max(face.ascent, f.Ascent*scale)
+		face.descent = max(face.descent, f.Descent*scale)
+	}
+	return face
+}
+
+// Ascent is how far the face reaches above the baseline, in pixels.
+func (f *Face) Ascent() int { return f.ascent }
+
+// Height is the line height of the face in pixels.
+func (f *Face) Height() int { return f.ascent + f.descent }
+
+// glyph returns the glyph for r and the scale of the font it came from.
+// Characters no font has get the built-in box.
+func (f *Face) glyph(r rune) (Glyph, int) {
+	for i, font := range f.fonts {
+		if g, ok := font.Glyph(r); ok {
+			return g, f.scales[i]
+		}
+	}
+	last := len(f.fonts) - 1
+	return builtinMissing(), f.scales[last]
+}
+
+var builtinMissing = sync.OnceValue(func() Glyph { return builtinGlyph(missingGlyph) })
+
+// Missing returns the characters of s that none of the face's fonts have,
+// each once, in order. The face draws them as a box.
+func (f *Face) Missing(s string) []rune {
+	var missing []rune
+	for _, r := range s {
+		if slices.Contains(missing, r) || slices.ContainsFunc(f.fonts, func(font *Font) bool {
+			_, ok := font.Glyph(r)
+			return ok
+		}) {
+			continue
+		}
+		missing = append(missing, r)
+	}
+	return missing
+}
+
+// Width is the advance of s in pixels.
+func (f *Face) Width(s string) int {
+	w := 0
+	for _, r := range s {
+		g, scale := f.glyph(r)
+		w += g.Advance * scale
+	}
+	return w
+}
+
+// Truncate shortens s to fit in width pixels, ending it with "..." when
+// anything was cut.
+func (f *Face) Truncate(s string, width int) string {
+	if f.Width(s) <= width {
+		return s
+	}
+	const ellipsis = "..."
+	budget := width - f.Width(ellipsis)
+	var b strings.Builder
+	w := 0
+	for _, r := range s {
+		g, scale := f.glyph(r)
+		if w+g.Advance*scale > budget {
+			break
+		}
+		w += g.Advance * scale
+		b.WriteRune(r)
+	}
+	return strings.TrimRight(b.String(), " ") + ellipsis
+}
+
+// Draw draws s onto dst with its baseline at y, starting at x, in colour c.
+// It returns the x after the last character.
+func (f *Face) Draw(dst draw.Image, x, y int, s string, c color.Color) int {
+	src := image.NewUniform(c)
+	for _, r := range s {
+		g, scale := f.glyph(r)
+		if g.Mask != nil {
+			b := g.Mask.Bounds()
+			for gy := b.Min.Y; gy < b.Max.Y; gy++ {
+				for gx := b.Min.X; gx < b.Max.X; gx++ {
+					if g.Mask.AlphaAt(gx, gy).A == 0 {
+						continue
+					}
+					px := x + (g.Origin.X+gx-b.Min.X)*scale
+					py := y + (g.Origin.Y+gy-b.Min.Y)*scale
+					draw.Draw(dst, image.Rect(px, py, px+scale, py+scale), src, image.Point{}, draw.Over)
+				}
+			}
+		}
+		x += g.Advance * scale
+	}
+	return x
+}
@@ -0,0 +1,170 @@
+package bitmapfont
+
+import (
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testBDF is an 8×8 font with a solid block for 'A', a one-pixel 'B' placed
+// with a glyph offset, and a glyph outside Unicode.
+const testBDF = `STARTFONT 2.1
+FONT -test-block-medium-r-normal--8-80-75-75-c-80-iso10646-1
+SIZE 8 75 75
+FONTBOUNDINGBOX 8 8 0 -2
+STARTPROPERTIES 2
+FONT_ASCENT 6
+FONT_DESCENT 2
+ENDPROPERTIES
+CHARS 3
+STARTCHAR A
+ENCODING 65
+DWIDTH 8 0
+BBX 8 8 0 -2
+BITMAP
+FF
+FF
+FF
+FF
+FF
+FF
+FF
+FF
+ENDCHAR
+STARTCHAR B
+ENCODING 66
+DWIDTH 4 0
+BBX 1 1 2 3
+BITMAP
+80
+ENDCHAR
+STARTCHAR unmapped
+ENCODING -1 200
+DWIDTH 8 0
+BBX 8 8 0 -2
+BITMAP
+FF
+FF
+FF
+FF
+FF
+FF
+FF
+FF
+ENDCHAR
+ENDFONT
+`
+
+func TestBuiltinGlyphsAreWellFormed(t *testing.T) {
+	for r, rows := range builtinGlyphs {
+		if len(rows) > builtinAscent+builtinDescent {
+			t.Errorf("glyph %q has %d rows, want at most %d", r, len(rows), builtinAscent+builtinDescent)
+		}
+		for _, row := range rows {
+			if len(row) != builtinWidth {
+				t.Errorf("glyph %q has a %d-cell row, want %d", r, len(row), builtinWidth)
+			}
+		}
+	}
+	for r := rune(0x20); r < 0x7f; r++ {
+		if _, ok := Default().Glyph(r); !ok {
+			t.Errorf("built-in font lacks %q", r)
+		}
+	}
+}
+
+func TestParseBDF(t *testing.T) {
+	f, err := ParseBDF(strings.NewReader(testBDF))
+	if err != nil {
+		t.Fatalf("ParseBDF: %v", err)
+	}
+	if f.Ascent != 6 || f.Descent != 2 {
+		t.Fatalf("metrics = %d/%d, want 6/2", f.Ascent, f.Descent)
+	}
+	a, ok := f.Glyph('A')
+	if !ok || a.Advance != 8 || a.Origin != image.Pt(0, -6) || a.Mask.AlphaAt(7, 7).A == 0 {
+		t.Fatalf("A = %+v, want a solid 8x8 block from 6 above the baseline", a)
+	}
+	b, ok := f.Glyph('B')
+	if !ok || b.Advance != 4 || b.Origin != image.Pt(2, -4) {
+		t.Fatalf("B = %+v, want one pixel at (2, -4)", b)
+	}
+	if len(f.glyphs) != 2 {
+		t.Fatalf("font has %d glyphs, want the unmapped one dropped", len(f.glyphs))
+	}
+
+	if _, err := ParseBDF(strings.NewReader("STARTFONT 2.1\nENDFONT\n")); err == nil {
+		t.Fatal("ParseBDF accepted a font without glyphs")
+	}
+	broken := strings.Replace(testBDF, "BBX 1 1 2 3", "BBX 1 x 2 3", 1)
+	if _, err := ParseBDF(strings.NewReader(broken)); err == nil {
+		t.Fatal("ParseBDF accepted a malformed BBX")
+	}
+}
+
+func TestLoadDir(t *testing.T) {
+	dir := t.TempDir()
+	for name, data := range map[string]string{
+		"b-block.bdf":  testBDF,
+		"a-broken.bdf": "STARTFONT 2.1\n",
+		"notes.txt":    "not a font",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fonts, err := LoadDir(dir)
+	if err == nil || !strings.Contains(err.Error(), "a-broken.bdf") {
+		t.Fatalf("err = %v, want the broken font reported", err)
+	}
+	if len(fonts) != 1 || fonts[0].Name != "b-block" {
+		t.Fatalf("fonts = %v, want only b-block", fonts)
+	}
+
+	if fonts, err := LoadDir(filepath.Join(dir, "missing")); fonts != nil || err != nil {
+		t.Fatalf("missing dir: got %v, %v; want nothing", fonts, err)
+	}
+}
+
+func TestFace(t *testing.T) {
+	block, err := ParseBDF(strings.NewReader(testBDF))
+	if err != nil {
+		t.Fatal(err)
+	}
+	face := NewFace(16, block)
+
+	// 'A' comes from the block font at 2x, 'x' from the built-in font at 2x.
+	if got := face.Width("Ax"); got != 8*2+6*2 {
+		t.Fatalf("Width = %d, want %d", got, 8*2+6*2)
+	}
+	if got := face.Truncate("AAAA", 60); got != "A..." {
+		t.Fatalf("Truncate = %q, want %q", got, "A...")
+	}
+	if got := face.Truncate("AA", 40); got != "AA" {
+		t.Fatalf("Truncate = %q, want it unchanged", got)
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, 40, 40))
+	white := color.RGBA{0xff, 0xff, 0xff, 0xff}
+	if x := face.Draw(img, 0, 20, "A", white); x != 16 {
+		t.Fatalf("Draw returned x = %d, want 16", x)
+	}
+	if img.RGBAAt(0, 20-12) != white || img.RGBAAt(15, 20+3) != white {
+		t.Fatal("block glyph not drawn from 12 above to 4 below the baseline")
+	}
+	if img.RGBAAt(0, 20-13) == white || img.RGBAAt(16, 20) == white {
+		t.Fatal("block glyph drawn outside its box")
+	}
+
+	// Characters no font has are drawn as the built-in box.
+	missing := NewFace(9)
+	if got := missing.Width("語"); got != 6 {
+		t.Fatalf("Width of a missing glyph = %d, want the box's 6", got)
+	}
+	if got := string(face.Missing("Ax語é語")); got != "語é" {
+		t.Fatalf("Missing = %q, want %q", got, "語é")
+	}
+}
@@ -0,0 +1,217 @@
+// Package bookmarks stores named playback positions per track.
+package bookmarks
+
+import (
+	"cmp"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"smtc-now-playing/internal/config"
+	"smtc-now-playing/internal/domain"
+)
+
+var log = slog.With("subsystem", "bookmarks")
+
+// Sentinel errors for bookmark operations.
+var (
+	ErrNotFound = errors.New("bookmarks: bookmark not found")
+	ErrInvalid  = errors.New("bookmarks: invalid bookmark")
+)
+
+// TrackKey identifies a track across sessions and restarts. Keys are
+// compared with SameTrack, so Duration is recorded but does not tell tracks
+// apart.
+type TrackKey struct {
+	SourceApp string `json:"sourceApp"`
+	Artist    string `json:"artist"`
+	Title     string `json:"title"`
+	Album     string `json:"album"`
+	Duration  int    `json:"duration"` // seconds
+}
+
+// KeyFor builds the key of the track described by info and progress.
+func KeyFor(info domain.InfoData, progress domain.ProgressData) TrackKey {
+	return TrackKey{
+		SourceApp: info.SourceApp,
+		Artist:    info.Artist,
+		Title:     info.Title,
+		Album:     info.AlbumTitle,
+		Duration:  progress.Duration,
+	}
+}
+
+// SameTrack reports whether k and other name the same track, ignoring
+// Duration: players may report it late, as 0, or revise it mid-track.
+func (k TrackKey) SameTrack(other TrackKey) bool {
+	k.Duration, other.Duration = 0, 0
+	return k == other
+}
+
+// Bookmark is a named position within a track.
+type Bookmark struct {
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	PositionMs int64  `json:"positionMs"`
+	CreatedAt  int64  `json:"createdAt"` // Unix milliseconds
+}
+
+// track is the on-disk record of one track's bookmarks.
+type track struct {
+	Key       TrackKey   `json:"track"`
+	Bookmarks []Bookmark `json:"bookmarks"`
+}
+
+// file is the on-disk layout of the store.
+type file struct {
+	Tracks []track `json:"tracks"`
+}
+
+// Store holds bookmarks and persists every change to its file. A Store with
+// an empty path keeps bookmarks in memory only.
+type Store struct {
+	mu     sync.Mutex
+	path   string
+	tracks []track
+}
+
+// NewMemory returns a Store that is not persisted.
+func NewMemory() *Store {
+	return &Store{}
+}
+
+// Open loads the store at path. A missing file yields an empty store.
+func Open(path string) (*Store, error) {
+	s := &Store{path: path}
+	if path == "" {
+		return s, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read bookmarks %q: %w", path, err)
+	}
+	var f file
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("parse bookmarks %q: %w", path, err)
+	}
+	s.tracks = f.Tracks
+	return s, nil
+}
+
+// List returns the bookmarks of key ordered by position.
+func (s *Store) List(key TrackKey) []Bookmark {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t := s.find(key)
+	if t == nil {
+		return []Bookmark{}
+	}
+	return slices.Clone(t.Bookmarks)
+}
+
+// Get returns the bookmark of key with the given id.
+func (s *Store) Get(key TrackKey, id string) (Bookmark, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if t := s.find(key); t != nil {
+		for _, b := range t.Bookmarks {
+			if b.ID == id {
+				return b, nil
+			}
+		}
+	}
+	return Bookmark{}, ErrNotFound
+}
+
+// Add stores a new bookmark for key and saves the store.
+func (s *Store) Add(key TrackKey, name string, positionMs int64) (Bookmark, error) {
+	if name == "" {
+		return Bookmark{}, fmt.Errorf("%w: name is required", ErrInvalid)
+	}
+	if positionMs < 0 {
+		return Bookmark{}, fmt.Errorf("%w: position must not be negative", ErrInvalid)
+	}
+	b := Bookmark{
+		ID:         newID(),
+		Name:       name,
+		PositionMs: positionMs,
+		CreatedAt:  time.Now().UnixMilli(),
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t := s.find(key)
+	if t == nil {
+		s.tracks = append(s.tracks, track{Key: key})
+		t = &s.tracks[len(s.tracks)-1]
+	}
+	t.Bookmarks = append(t.Bookmarks, b)
+	slices.SortStableFunc(t.Bookmarks, func(a, b Bookmark) int { return cmp.Compare(a.PositionMs, b.PositionMs) })
+	return b, s.save()
+}
+
+// Delete removes the bookmark of key with the given id and saves the store.
+func (s *Store) Delete(key TrackKey, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.tracks {
+		t := &s.tracks[i]
+		if !t.Key.SameTrack(key) {
+			continue
+		}
+		for j, b := range t.Bookmarks {
+			if b.ID != id {
+				continue
+			}
+			t.Bookmarks = slices.Delete(t.Bookmarks, j, j+1)
+			if len(t.Bookmarks) == 0 {
+				s.tracks = slices.Delete(s.tracks, i, i+1)
+			}
+			return s.save()
+		}
+	}
+	return ErrNotFound
+}
+
+// find returns the record of key, or nil. Must be called with mu held.
+func (s *Store) find(key TrackKey) *track {
+	for i := range s.tracks {
+		if s.tracks[i].Key.SameTrack(key) {
+			return &s.tracks[i]
+		}
+	}
+	return nil
+}
+
+// save writes the store to its file. Must be called with mu held.
+func (s *Store) save() error {
+	if s.path == "" {
+		return nil
+	}
+	tracks := s.tracks
+	if tracks == nil {
+		tracks = []track{}
+	}
+	if err := config.WriteJSONFile(s.path, file{Tracks: tracks}); err != nil {
+		log.Warn("failed to save bookmarks", "path", s.path, "err", err)
+		return err
+	}
+	return nil
+}
+
+// newID returns a random bookmark ID.
+func newID() string {
+	var b [8]byte
+	_, _ = rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
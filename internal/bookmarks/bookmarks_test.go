@@ -0,0 +1,108 @@
+package bookmarks
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestStore_PersistsAcrossOpen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bookmarks.json")
+	key := TrackKey{SourceApp: "Spotify.exe", Artist: "Artist", Title: "Title", Album: "Album", Duration: 240}
+
+	s, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	chorus, err := s.Add(key, "chorus", 60000)
+	if err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	if _, err := s.Add(key, "intro", 0); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+
+	reopened, err := Open(path)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	got := reopened.List(key)
+	if len(got) != 2 || got[0].Name != "intro" || got[1].ID != chorus.ID {
+		t.Fatalf("List = %+v, want intro then chorus", got)
+	}
+	if b, err := reopened.Get(key, chorus.ID); err != nil || b.PositionMs != 60000 {
+		t.Fatalf("Get = %+v, %v", b, err)
+	}
+}
+
+func TestStore_DurationChangeKeepsBookmarks(t *testing.T) {
+	s := NewMemory()
+	key := TrackKey{Artist: "Artist", Title: "Title"}
+	b, err := s.Add(key, "solo", 1000)
+	if err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	// The player reports the duration only after the bookmark was added.
+	revised := key
+	revised.Duration = 240
+	if got := s.List(revised); len(got) != 1 || got[0].ID != b.ID {
+		t.Fatalf("List(revised) = %+v, want the bookmark", got)
+	}
+	if _, err := s.Get(revised, b.ID); err != nil {
+		t.Fatalf("Get(revised) = %v", err)
+	}
+	if err := s.Delete(revised, b.ID); err != nil {
+		t.Fatalf("Delete(revised) = %v", err)
+	}
+	if got := s.List(key); len(got) != 0 {
+		t.Fatalf("List after Delete = %+v, want none", got)
+	}
+	other := key
+	other.Album = "Other"
+	if _, err := s.Add(key, "solo", 1000); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	if got := s.List(other); len(got) != 0 {
+		t.Fatalf("List(other album) = %+v, want none", got)
+	}
+}
+
+func TestTrackKey_SameTrack(t *testing.T) {
+	key := TrackKey{SourceApp: "app", Artist: "Artist", Title: "Title", Album: "Album", Duration: 240}
+	revised := key
+	revised.Duration = 0
+	if !key.SameTrack(revised) {
+		t.Fatal("SameTrack = false for a duration change")
+	}
+	other := key
+	other.Title = "Other"
+	if key.SameTrack(other) {
+		t.Fatal("SameTrack = true for a different title")
+	}
+}
+
+func TestStore_Delete(t *testing.T) {
+	s := NewMemory()
+	key := TrackKey{Title: "Title"}
+	b, _ := s.Add(key, "mark", 1000)
+
+	if err := s.Delete(key, b.ID); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if err := s.Delete(key, b.ID); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("second Delete = %v, want ErrNotFound", err)
+	}
+	if got := s.List(key); len(got) != 0 {
+		t.Fatalf("List = %+v, want none", got)
+	}
+}
+
+func TestStore_AddValidates(t *testing.T) {
+	s := NewMemory()
+	if _, err := s.Add(TrackKey{}, "", 0); !errors.Is(err, ErrInvalid) {
+		t.Fatalf("empty name: got %v, want ErrInvalid", err)
+	}
+	if _, err := s.Add(TrackKey{}, "x", -1); !errors.Is(err, ErrInvalid) {
+		t.Fatalf("negative position: got %v, want ErrInvalid", err)
+	}
+}
@@ -6,7 +6,10 @@ import (
 	"fmt"
 	"log/slog"
 	"os"
+	"path"
 	"path/filepath"
+	"slices"
+	"strings"
 )
 
 var log = slog.With("subsystem", "config")
@@ -48,6 +51,9 @@ type UIConfig struct {
 // SMTCConfig holds System Media Transport Controls settings.
 type SMTCConfig struct {
 	SelectedDevice string `json:"selectedDevice"`
+	// IgnoreCapabilities sends every control to the player even when it
+	// reports the control as disabled, for players that misreport.
+	IgnoreCapabilities bool `json:"ignoreCapabilities"`
 }
 
 // LoggingConfig holds logging settings.
@@ -56,12 +62,139 @@ type LoggingConfig struct {
 	Debug bool   `json:"debug"`
 }
 
+// MetadataConfig controls how track metadata strings are cleaned before they
+// are stored and sent to clients.
+type MetadataConfig struct {
+	NormalizeNFC   bool `json:"normalizeNFC"`
+	StripControl   bool `json:"stripControl"`
+	StripZeroWidth bool `json:"stripZeroWidth"`
+	// LegacyEscape re-applies the old backslash escaping of backslashes and
+	// control characters to strings sent to clients, for themes that still
+	// unescape them. It turns StripControl off so the escaped output
+	// matches older versions.
+	LegacyEscape bool `json:"legacyEscape"`
+}
+
+// PolicyConfig holds automatic playback policies. All are off by default.
+type PolicyConfig struct {
+	ExclusivePlayback ExclusivePlaybackConfig `json:"exclusivePlayback"`
+}
+
+// ExclusivePlaybackConfig pauses the other playing sessions when a session
+// starts playing.
+type ExclusivePlaybackConfig struct {
+	Enabled bool `json:"enabled"`
+	// Exceptions are AppID patterns in path.Match syntax, matched
+	// case-insensitively. Matching sessions neither pause others nor get
+	// paused.
+	Exceptions []string `json:"exceptions"`
+	// AutoResume resumes the sessions paused by an interrupter once it
+	// pauses, stops or closes.
+	AutoResume bool `json:"autoResume"`
+}
+
+// VotesConfig controls chat-driven vote-to-skip. The track is skipped once
+// the number of unique voters reaches Threshold, or ThresholdPercent of the
+// active voters when that is set; with both set the larger count applies.
+type VotesConfig struct {
+	Enabled          bool `json:"enabled"`
+	Threshold        int  `json:"threshold"`
+	ThresholdPercent int  `json:"thresholdPercent"`
+	// Window is how long a vote counts, in seconds.
+	Window int `json:"window"`
+	// ActiveWindow is how long a voter counts as active after their last
+	// vote on any track, in seconds.
+	ActiveWindow int `json:"activeWindow"`
+}
+
+// PresenceConfig sets when the displayed session counts as idle, so every
+// overlay and integration hides at the same moment. Thresholds are in
+// seconds; 0 never goes idle from that state.
+type PresenceConfig struct {
+	IdleAfterStopped int `json:"idleAfterStopped"`
+	IdleAfterPaused  int `json:"idleAfterPaused"`
+}
+
+// AlbumArtConfig controls how much recent album art the server keeps, so
+// clients still loading the previous track's art do not get a 404.
+type AlbumArtConfig struct {
+	// History is how many images are kept in memory, including the current
+	// one; 0 keeps only the current one.
+	History int `json:"history"`
+	// DiskCache also writes album art to an albumArt folder next to the
+	// config file, keeping up to DiskHistory images across restarts.
+	DiskCache   bool `json:"diskCache"`
+	DiskHistory int  `json:"diskHistory"`
+	// MaxBytes and MaxDimension bound the art published by players: larger
+	// images are downscaled once, as they are read. 0 means no limit.
+	MaxBytes     int `json:"maxBytes"`
+	MaxDimension int `json:"maxDimension"`
+	// Fallback supplies art for tracks whose player publishes none.
+	Fallback AlbumArtFallbackConfig `json:"fallback"`
+}
+
+// AlbumArtFallbackConfig lists the sources tried, in order, for tracks that
+// still have no album art once the player's thumbnail retries run out.
+type AlbumArtFallbackConfig struct {
+	Enabled bool `json:"enabled"`
+	// Dir holds the user's images. Empty uses a fallbackArt folder next to
+	// the config file.
+	Dir string `json:"dir"`
+	// Patterns are image file names without extension, tried in order.
+	// {artist}, {album}, {albumArtist} and {title} are replaced with the
+	// track's metadata; a pattern is skipped when a field it uses is empty.
+	Patterns []string `json:"patterns"`
+	// Apps maps AppID patterns in path.Match syntax, matched
+	// case-insensitively, to an image used for every track of that app.
+	// Relative paths are resolved against Dir.
+	Apps map[string]string `json:"apps"`
+	// Generate draws a tile with the artist's initials when nothing else
+	// matches.
+	Generate bool `json:"generate"`
+}
+
+// CardConfig configures the now-playing card images served by
+// GET /api/card.png.
+type CardConfig struct {
+	// FontDir holds BDF fonts used for card text before the built-in ASCII
+	// font, in file name order. Empty uses a fonts folder next to the config
+	// file.
+	FontDir string `json:"fontDir"`
+}
+
+// ControlActions are the control actions the server runs, for clients,
+// timers and macros alike.
+var ControlActions = []string{
+	"play", "pause", "stop", "toggle", "next", "previous",
+	"seek", "forward", "backward", "bookmark", "shuffle", "repeat", "rate",
+}
+
+// MacroStep is one control of a macro. It has the same fields as a step of
+// a batch sent to POST /api/control/batch.
+type MacroStep struct {
+	Action       string          `json:"action"`
+	Args         json.RawMessage `json:"args,omitempty"`
+	Delay        int             `json:"delay,omitempty"` // milliseconds
+	Wait         bool            `json:"wait,omitempty"`
+	Timeout      int             `json:"timeout,omitempty"` // milliseconds
+	IfCapability string          `json:"ifCapability,omitempty"`
+	IfStatus     string          `json:"ifStatus,omitempty"`
+}
+
 // Config is the application configuration.
 type Config struct {
-	Server  ServerConfig  `json:"server"`
-	UI      UIConfig      `json:"ui"`
-	SMTC    SMTCConfig    `json:"smtc"`
-	Logging LoggingConfig `json:"logging"`
+	Server   ServerConfig   `json:"server"`
+	UI       UIConfig       `json:"ui"`
+	SMTC     SMTCConfig     `json:"smtc"`
+	Logging  LoggingConfig  `json:"logging"`
+	Metadata MetadataConfig `json:"metadata"`
+	Policy   PolicyConfig   `json:"policy"`
+	Votes    VotesConfig    `json:"votes"`
+	Presence PresenceConfig `json:"presence"`
+	AlbumArt AlbumArtConfig `json:"albumArt"`
+	Card     CardConfig     `json:"card"`
+	// Macros maps a macro name to its steps, run in order.
+	Macros map[string][]MacroStep `json:"macros"`
 }
 
 // DefaultConfig returns a Config populated with application defaults.
@@ -77,6 +210,29 @@ func DefaultConfig() *Config {
 		Logging: LoggingConfig{
 			Level: "info",
 		},
+		Metadata: MetadataConfig{
+			NormalizeNFC:   true,
+			StripControl:   true,
+			StripZeroWidth: true,
+		},
+		Votes: VotesConfig{
+			Threshold:    3,
+			Window:       120,
+			ActiveWindow: 600,
+		},
+		Presence: PresenceConfig{
+			IdleAfterStopped: 5,
+		},
+		AlbumArt: AlbumArtConfig{
+			History:      20,
+			DiskHistory:  200,
+			MaxBytes:     1 << 20,
+			MaxDimension: 1024,
+			Fallback: AlbumArtFallbackConfig{
+				Patterns: []string{"{artist} - {album}", "{album}", "{artist} - {title}", "{artist}"},
+				Generate: true,
+			},
+		},
 	}
 }
 
@@ -98,6 +254,16 @@ func ResolvePath() (string, error) {
 	return appDataPath, nil
 }
 
+// DataPath returns the path of a data file named name stored next to the
+// config file, or "" when there is no config directory.
+func DataPath(name string) (string, error) {
+	cfgPath, err := ResolvePath()
+	if err != nil || cfgPath == "" {
+		return "", err
+	}
+	return filepath.Join(filepath.Dir(cfgPath), name), nil
+}
+
 // Load reads config from path, migrating v1 flat JSON to the current nested
 // format if needed. Missing fields are filled from DefaultConfig. If the file
 // does not exist, Load returns DefaultConfig with a nil error.
@@ -142,6 +308,52 @@ func (c *Config) Validate() error {
 	default:
 		return fmt.Errorf("logging level %q must be one of: debug, info, warn, error", c.Logging.Level)
 	}
+	for _, pattern := range c.Policy.ExclusivePlayback.Exceptions {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("exclusive playback exception %q: %w", pattern, err)
+		}
+	}
+	if v := c.Votes; v.Enabled {
+		if v.Threshold < 0 || v.ThresholdPercent < 0 || v.ThresholdPercent > 100 {
+			return fmt.Errorf("votes threshold %d / %d%% out of range", v.Threshold, v.ThresholdPercent)
+		}
+		if v.Threshold == 0 && v.ThresholdPercent == 0 {
+			return errors.New("votes need a threshold or thresholdPercent")
+		}
+		if v.Window < 1 || v.ActiveWindow < 1 {
+			return errors.New("votes window and activeWindow must be at least 1 second")
+		}
+	}
+	if c.Presence.IdleAfterStopped < 0 || c.Presence.IdleAfterPaused < 0 {
+		return errors.New("presence idle thresholds must not be negative")
+	}
+	if c.AlbumArt.History < 0 || c.AlbumArt.DiskHistory < 0 {
+		return errors.New("album art history sizes must not be negative")
+	}
+	if c.AlbumArt.MaxBytes < 0 || c.AlbumArt.MaxDimension < 0 {
+		return errors.New("album art size limits must not be negative")
+	}
+	for pattern := range c.AlbumArt.Fallback.Apps {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("album art fallback app %q: %w", pattern, err)
+		}
+	}
+	for name, steps := range c.Macros {
+		if name == "" || len(steps) == 0 {
+			return fmt.Errorf("macro %q must have a name and at least one step", name)
+		}
+		for i, step := range steps {
+			if step.Action == "" {
+				return fmt.Errorf("macro %q step %d: action is required", name, i+1)
+			}
+			if !slices.Contains(ControlActions, step.Action) {
+				return fmt.Errorf("macro %q step %d: unknown action %q", name, i+1, step.Action)
+			}
+			if step.Delay < 0 || step.Timeout < 0 {
+				return fmt.Errorf("macro %q step %d: delay and timeout must not be negative", name, i+1)
+			}
+		}
+	}
 	return nil
 }
 
@@ -201,15 +413,21 @@ func appDataConfigFile() string {
 	return filepath.Join(appData, "soarqin", "smtc-now-playing", "config.json")
 }
 
-// saveConfigToFile writes cfg to path atomically: serialize to a sibling
-// temp file, fsync it, then rename over the target. This guarantees the
-// config file is never left partially-written even if the process is
-// killed mid-save.
+// saveConfigToFile writes cfg to path atomically via WriteJSONFile.
 func saveConfigToFile(path string, cfg *Config) error {
+	return WriteJSONFile(path, cfg)
+}
+
+// WriteJSONFile writes v as indented JSON to path atomically: serialize to a
+// sibling temp file, fsync it, then rename over the target. This guarantees
+// the file is never left partially-written even if the process is killed
+// mid-save.
+func WriteJSONFile(path string, v any) error {
 	dir := filepath.Dir(path)
-	tmp, err := os.CreateTemp(dir, ".config-*.json.tmp")
+	base := filepath.Base(path)
+	tmp, err := os.CreateTemp(dir, "."+strings.TrimSuffix(base, filepath.Ext(base))+"-*.json.tmp")
 	if err != nil {
-		return fmt.Errorf("create temp config file: %w", err)
+		return fmt.Errorf("create temp file for %q: %w", base, err)
 	}
 	tmpPath := tmp.Name()
 	// Ensure the temp file is cleaned up on any failure path.
@@ -222,21 +440,21 @@ func saveConfigToFile(path string, cfg *Config) error {
 
 	encoder := json.NewEncoder(tmp)
 	encoder.SetIndent("", "  ")
-	if err := encoder.Encode(cfg); err != nil {
+	if err := encoder.Encode(v); err != nil {
 		_ = tmp.Close()
-		return fmt.Errorf("encode config: %w", err)
+		return fmt.Errorf("encode %q: %w", base, err)
 	}
 	if err := tmp.Sync(); err != nil {
 		_ = tmp.Close()
-		return fmt.Errorf("sync config: %w", err)
+		return fmt.Errorf("sync %q: %w", base, err)
 	}
 	if err := tmp.Close(); err != nil {
-		return fmt.Errorf("close temp config: %w", err)
+		return fmt.Errorf("close temp file for %q: %w", base, err)
 	}
 	// os.Rename is atomic on Windows when source and target are on the
-	// same volume (which they are — both live in the APPDATA dir).
+	// same volume (which they are — both live in the same directory).
 	if err := os.Rename(tmpPath, path); err != nil {
-		return fmt.Errorf("rename temp config to %q: %w", path, err)
+		return fmt.Errorf("rename temp file to %q: %w", path, err)
 	}
 	cleanup = false
 	return nil
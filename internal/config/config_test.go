@@ -40,6 +40,30 @@ func TestDefaultConfig(t *testing.T) {
 	if cfg.Logging.Debug {
 		t.Error("Logging.Debug: got true, want false")
 	}
+	if !cfg.Metadata.NormalizeNFC || !cfg.Metadata.StripControl || !cfg.Metadata.StripZeroWidth {
+		t.Errorf("Metadata cleanup: got %+v, want all enabled", cfg.Metadata)
+	}
+	if cfg.Metadata.LegacyEscape {
+		t.Error("Metadata.LegacyEscape: got true, want false")
+	}
+	if cfg.Policy.ExclusivePlayback.Enabled {
+		t.Error("Policy.ExclusivePlayback.Enabled: got true, want false")
+	}
+	if cfg.Votes.Enabled || cfg.Votes.Threshold != 3 || cfg.Votes.Window != 120 || cfg.Votes.ActiveWindow != 600 {
+		t.Errorf("Votes: got %+v, want disabled with threshold 3, window 120, activeWindow 600", cfg.Votes)
+	}
+	if cfg.Presence.IdleAfterStopped != 5 || cfg.Presence.IdleAfterPaused != 0 {
+		t.Errorf("Presence: got %+v, want idle 5s after stopping and never while paused", cfg.Presence)
+	}
+	if cfg.AlbumArt.History != 20 || cfg.AlbumArt.DiskCache || cfg.AlbumArt.DiskHistory != 200 {
+		t.Errorf("AlbumArt: got %+v, want 20 in memory and the disk cache off", cfg.AlbumArt)
+	}
+	if cfg.AlbumArt.MaxBytes != 1<<20 || cfg.AlbumArt.MaxDimension != 1024 {
+		t.Errorf("AlbumArt limits: got %d bytes and %dpx, want 1 MiB and 1024px", cfg.AlbumArt.MaxBytes, cfg.AlbumArt.MaxDimension)
+	}
+	if fb := cfg.AlbumArt.Fallback; fb.Enabled || !fb.Generate || len(fb.Patterns) != 4 {
+		t.Errorf("AlbumArt.Fallback: got %+v, want disabled with four patterns and generated tiles", fb)
+	}
 }
 
 // TestLoad_EmptyJSON verifies that Load with an empty JSON object {} returns
@@ -299,3 +323,100 @@ func TestValidate_BadLevel(t *testing.T) {
 		t.Error("expected error for level=\"verbose\", got nil")
 	}
 }
+
+// TestValidate_BadExclusivePlaybackException verifies that a malformed AppID
+// pattern fails validation.
+func TestValidate_BadExclusivePlaybackException(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Policy.ExclusivePlayback.Exceptions = []string{"Spotify*", "[unclosed"}
+	if err := cfg.Validate(); err == nil {
+		t.Error("expected error for pattern \"[unclosed\", got nil")
+	}
+}
+
+// TestValidate_Votes verifies the vote-to-skip thresholds and windows.
+func TestValidate_Votes(t *testing.T) {
+	tests := []struct {
+		name    string
+		edit    func(v *VotesConfig)
+		wantErr bool
+	}{
+		{"defaults", func(v *VotesConfig) {}, false},
+		{"percent_only", func(v *VotesConfig) { v.Threshold, v.ThresholdPercent = 0, 50 }, false},
+		{"no_threshold", func(v *VotesConfig) { v.Threshold = 0 }, true},
+		{"percent_over_100", func(v *VotesConfig) { v.ThresholdPercent = 150 }, true},
+		{"zero_window", func(v *VotesConfig) { v.Window = 0 }, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			cfg.Votes.Enabled = true
+			tt.edit(&cfg.Votes)
+			if err := cfg.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// TestValidate_Presence verifies that idle thresholds are not negative.
+func TestValidate_Presence(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Presence.IdleAfterPaused = 30
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate() = %v", err)
+	}
+	cfg.Presence.IdleAfterStopped = -1
+	if err := cfg.Validate(); err == nil {
+		t.Fatal("Validate() accepted a negative threshold")
+	}
+}
+
+// TestValidate_AlbumArt verifies that history sizes and size limits are not
+// negative.
+func TestValidate_AlbumArt(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.AlbumArt.History = -1
+	if err := cfg.Validate(); err == nil {
+		t.Fatal("Validate() accepted a negative history")
+	}
+	cfg.AlbumArt.History = 0
+	cfg.AlbumArt.DiskHistory = -1
+	if err := cfg.Validate(); err == nil {
+		t.Fatal("Validate() accepted a negative disk history")
+	}
+	cfg.AlbumArt.DiskHistory = 0
+	cfg.AlbumArt.MaxDimension = -1
+	if err := cfg.Validate(); err == nil {
+		t.Fatal("Validate() accepted a negative max dimension")
+	}
+	cfg.AlbumArt.MaxDimension = 0
+	cfg.AlbumArt.Fallback.Apps = map[string]string{"[chrome.exe": "chrome.png"}
+	if err := cfg.Validate(); err == nil {
+		t.Fatal("Validate() accepted a malformed app pattern")
+	}
+}
+
+// TestValidate_Macros verifies that macros need steps with actions.
+func TestValidate_Macros(t *testing.T) {
+	tests := []struct {
+		name    string
+		macros  map[string][]MacroStep
+		wantErr bool
+	}{
+		{"valid", map[string][]MacroStep{"restart": {{Action: "previous", Wait: true}, {Action: "play"}}}, false},
+		{"no_steps", map[string][]MacroStep{"empty": nil}, true},
+		{"no_action", map[string][]MacroStep{"broken": {{Delay: 100}}}, true},
+		{"unknown_action", map[string][]MacroStep{"broken": {{Action: "play"}, {Action: "rewind"}}}, true},
+		{"negative_delay", map[string][]MacroStep{"broken": {{Action: "play", Delay: -1}}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			cfg.Macros = tt.macros
+			if err := cfg.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -1,6 +1,13 @@
 // Package domain contains shared data types used across smtc-now-playing packages.
 package domain
 
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
 // PlaybackStatus represents the SMTC playback state
 type PlaybackStatus int
 
@@ -32,16 +39,30 @@ const (
 	AutoRepeatList  AutoRepeatMode = 2
 )
 
+// Album art sources, reported in InfoData.ThumbnailSource.
+const (
+	ArtSourcePlayer    = "player"    // published by the player
+	ArtSourceFolder    = "folder"    // matched in the user's fallback folder
+	ArtSourceApp       = "app"       // default art of the source app
+	ArtSourceGenerated = "generated" // tile generated from the track metadata
+)
+
 // InfoData holds media info for the current session
 type InfoData struct {
 	Artist               string
 	Title                string
 	ThumbnailContentType string
-	ThumbnailData        []byte
+	ThumbnailData        []byte // shared between events and state; never modify it
+	ThumbnailSource      string // one of the ArtSource constants; "" means ArtSourcePlayer
+	ThumbnailOriginal    int    // bytes the player published when ThumbnailData was downscaled; 0 otherwise
 	AlbumTitle           string
 	AlbumArtist          string
 	PlaybackType         int
 	SourceApp            string
+	Subtitle             string
+	Genres               []string
+	TrackNumber          int // 0 when the player doesn't report one
+	AlbumTrackCount      int // 0 when the player doesn't report one
 }
 
 // Equal compares two InfoData structs for equality
@@ -53,21 +74,43 @@ func (i *InfoData) Equal(other *InfoData) bool {
 		i.Title == other.Title &&
 		i.ThumbnailContentType == other.ThumbnailContentType &&
 		len(i.ThumbnailData) == len(other.ThumbnailData) &&
+		i.ThumbnailSource == other.ThumbnailSource &&
 		i.AlbumTitle == other.AlbumTitle &&
 		i.AlbumArtist == other.AlbumArtist &&
 		i.PlaybackType == other.PlaybackType &&
-		i.SourceApp == other.SourceApp
+		i.SourceApp == other.SourceApp &&
+		i.Subtitle == other.Subtitle &&
+		stringsEqual(i.Genres, other.Genres) &&
+		i.TrackNumber == other.TrackNumber &&
+		i.AlbumTrackCount == other.AlbumTrackCount
+}
+
+// stringsEqual reports whether a and b hold the same strings in the same order.
+// A nil slice and an empty slice are considered equal.
+func stringsEqual(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
 }
 
 // ProgressData holds playback progress for the current session
 type ProgressData struct {
 	Position        int
+	PositionMs      int64 // Position in milliseconds; 0 from sources that only report seconds
 	Duration        int
 	Status          int
 	PlaybackRate    float64
 	IsShuffleActive *bool
 	AutoRepeatMode  int
 	LastUpdatedTime int64
+	MinSeekTime     int // seconds; earliest seekable position
+	MaxSeekTime     int // seconds; latest seekable position, 0 when unknown
 }
 
 // Equal compares two ProgressData structs for equality
@@ -78,12 +121,15 @@ func (p *ProgressData) Equal(other *ProgressData) bool {
 	shuffleEqual := (p.IsShuffleActive == nil && other.IsShuffleActive == nil) ||
 		(p.IsShuffleActive != nil && other.IsShuffleActive != nil && *p.IsShuffleActive == *other.IsShuffleActive)
 	return p.Position == other.Position &&
+		p.PositionMs == other.PositionMs &&
 		p.Duration == other.Duration &&
 		p.Status == other.Status &&
 		p.PlaybackRate == other.PlaybackRate &&
 		shuffleEqual &&
 		p.AutoRepeatMode == other.AutoRepeatMode &&
-		p.LastUpdatedTime == other.LastUpdatedTime
+		p.LastUpdatedTime == other.LastUpdatedTime &&
+		p.MinSeekTime == other.MinSeekTime &&
+		p.MaxSeekTime == other.MaxSeekTime
 }
 
 // SessionInfo holds metadata about an available SMTC session
@@ -95,14 +141,88 @@ type SessionInfo struct {
 
 // ControlCapabilities reports which media controls the current session supports
 type ControlCapabilities struct {
-	IsPlayEnabled     bool `json:"isPlayEnabled"`
-	IsPauseEnabled    bool `json:"isPauseEnabled"`
-	IsStopEnabled     bool `json:"isStopEnabled"`
-	IsNextEnabled     bool `json:"isNextEnabled"`
-	IsPreviousEnabled bool `json:"isPreviousEnabled"`
-	IsSeekEnabled     bool `json:"isSeekEnabled"`
-	IsShuffleEnabled  bool `json:"isShuffleEnabled"`
-	IsRepeatEnabled   bool `json:"isRepeatEnabled"`
+	IsPlayEnabled         bool `json:"isPlayEnabled"`
+	IsPauseEnabled        bool `json:"isPauseEnabled"`
+	IsStopEnabled         bool `json:"isStopEnabled"`
+	IsNextEnabled         bool `json:"isNextEnabled"`
+	IsPreviousEnabled     bool `json:"isPreviousEnabled"`
+	IsSeekEnabled         bool `json:"isSeekEnabled"`
+	IsShuffleEnabled      bool `json:"isShuffleEnabled"`
+	IsRepeatEnabled       bool `json:"isRepeatEnabled"`
+	IsPlaybackRateEnabled bool `json:"isPlaybackRateEnabled"`
+}
+
+// TextOptions controls how CleanText normalizes metadata strings reported by players.
+type TextOptions struct {
+	NormalizeNFC   bool // compose to Unicode Normalization Form C
+	StripControl   bool // drop C0/C1 control characters; whitespace controls become a space
+	StripZeroWidth bool // drop invisible zero-width characters (joiners are kept)
+}
+
+// CleanText applies opts to s. The result is still a raw Unicode string —
+// no escaping is performed.
+func CleanText(s string, opts TextOptions) string {
+	if opts.StripControl || opts.StripZeroWidth {
+		s = strings.Map(func(r rune) rune {
+			if opts.StripControl && unicode.IsControl(r) {
+				if unicode.IsSpace(r) {
+					return ' '
+				}
+				return -1
+			}
+			if opts.StripZeroWidth && isZeroWidth(r) {
+				return -1
+			}
+			return r
+		}, s)
+	}
+	if opts.NormalizeNFC {
+		s = norm.NFC.String(s)
+	}
+	return s
+}
+
+// isZeroWidth reports whether r is an invisible zero-width character that
+// players sometimes leave in titles. ZWJ (U+200D) and ZWNJ (U+200C) are not
+// included: they are part of emoji sequences and required by some scripts.
+func isZeroWidth(r rune) bool {
+	switch r {
+	case '\u200B', // zero width space
+		'\u2060', // word joiner
+		'\uFEFF', // zero width no-break space / BOM
+		'\u180E': // mongolian vowel separator
+		return true
+	}
+	return false
+}
+
+// Cleaned returns a copy of i with every text field passed through CleanText.
+func (i *InfoData) Cleaned(opts TextOptions) InfoData {
+	return i.mapText(func(s string) string { return CleanText(s, opts) })
+}
+
+// Escaped returns a copy of i with every text field passed through Escape.
+// Used only for the legacy escaping mode expected by pre-v2 themes.
+func (i *InfoData) Escaped() InfoData {
+	return i.mapText(Escape)
+}
+
+// mapText returns a copy of i with fn applied to each user-visible text field.
+// SourceApp and ThumbnailContentType are identifiers and are left untouched.
+func (i *InfoData) mapText(fn func(string) string) InfoData {
+	out := *i
+	out.Artist = fn(i.Artist)
+	out.Title = fn(i.Title)
+	out.AlbumTitle = fn(i.AlbumTitle)
+	out.AlbumArtist = fn(i.AlbumArtist)
+	out.Subtitle = fn(i.Subtitle)
+	if i.Genres != nil {
+		out.Genres = make([]string, len(i.Genres))
+		for idx, genre := range i.Genres {
+			out.Genres[idx] = fn(genre)
+		}
+	}
+	return out
 }
 
 // Escape replicates C++ escape() — escapes special characters in artist/title strings
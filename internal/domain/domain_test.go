@@ -36,3 +36,104 @@ func TestEscape(t *testing.T) {
 		})
 	}
 }
+
+// TestInfoDataEqual_ExtendedFields verifies that Equal takes the extended
+// track metadata into account, including genre order.
+func TestInfoDataEqual_ExtendedFields(t *testing.T) {
+	base := InfoData{
+		Artist:          "Artist",
+		Title:           "Title",
+		Subtitle:        "Live",
+		Genres:          []string{"Rock", "Blues"},
+		TrackNumber:     3,
+		AlbumTrackCount: 12,
+	}
+
+	tests := []struct {
+		name   string
+		mutate func(d *InfoData)
+		want   bool
+	}{
+		{name: "identical", mutate: func(d *InfoData) {}, want: true},
+		{name: "subtitle differs", mutate: func(d *InfoData) { d.Subtitle = "Studio" }, want: false},
+		{name: "genre added", mutate: func(d *InfoData) { d.Genres = append(d.Genres, "Jazz") }, want: false},
+		{name: "genre order differs", mutate: func(d *InfoData) { d.Genres = []string{"Blues", "Rock"} }, want: false},
+		{name: "track number differs", mutate: func(d *InfoData) { d.TrackNumber = 4 }, want: false},
+		{name: "album track count differs", mutate: func(d *InfoData) { d.AlbumTrackCount = 10 }, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			other := base
+			other.Genres = append([]string(nil), base.Genres...)
+			tt.mutate(&other)
+			if got := base.Equal(&other); got != tt.want {
+				t.Errorf("Equal() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestInfoDataEqual_NilAndEmptyGenres verifies that a nil genre list and an
+// empty one are treated as equal.
+func TestInfoDataEqual_NilAndEmptyGenres(t *testing.T) {
+	a := InfoData{Title: "Title"}
+	b := InfoData{Title: "Title", Genres: []string{}}
+	if !a.Equal(&b) {
+		t.Error("nil and empty Genres should compare equal")
+	}
+}
+
+func TestCleanText(t *testing.T) {
+	all := TextOptions{NormalizeNFC: true, StripControl: true, StripZeroWidth: true}
+	tests := []struct {
+		name  string
+		input string
+		opts  TextOptions
+		want  string
+	}{
+		{"nfc", "Beyonce\u0301", all, "Beyonc\u00e9"},
+		{"nfc_disabled", "e\u0301", TextOptions{}, "e\u0301"},
+		{"control_dropped", "a\x00b\x1bc\u009bd", all, "abcd"},
+		{"whitespace_control_to_space", "line1\nline2\tend", all, "line1 line2 end"},
+		{"zero_width_dropped", "\ufeffti\u200btle\u2060", all, "title"},
+		{"joiners_kept", "\U0001F468\u200d\U0001F469", all, "\U0001F468\u200d\U0001F469"},
+		{"backslash_and_quotes_raw", `AC\DC "live"`, all, `AC\DC "live"`},
+		{"disabled_passthrough", "a\x00\u200bb", TextOptions{}, "a\x00\u200bb"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := CleanText(tt.input, tt.opts); got != tt.want {
+				t.Errorf("CleanText(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInfoDataCleanedAndEscaped(t *testing.T) {
+	info := InfoData{
+		Artist:    `AC\DC`,
+		Title:     "Title\u200b",
+		SourceApp: "App\u200b.exe",
+		Genres:    []string{"Rock\n"},
+	}
+
+	cleaned := info.Cleaned(TextOptions{StripControl: true, StripZeroWidth: true})
+	if cleaned.Artist != `AC\DC` || cleaned.Title != "Title" || cleaned.Genres[0] != "Rock " {
+		t.Errorf("unexpected cleaned info: %+v", cleaned)
+	}
+	if cleaned.SourceApp != info.SourceApp {
+		t.Errorf("SourceApp changed: got %q, want %q", cleaned.SourceApp, info.SourceApp)
+	}
+
+	escaped := info.Escaped()
+	if escaped.Artist != `AC\\DC` || escaped.Genres[0] != `Rock\n` {
+		t.Errorf("unexpected escaped info: %+v", escaped)
+	}
+
+	// The original must not be modified through the shared genres slice.
+	if info.Genres[0] != "Rock\n" {
+		t.Errorf("original genres modified: %q", info.Genres[0])
+	}
+}
@@ -54,11 +54,18 @@ type Gui struct {
 
 var notifyIcon *NotifyIcon
 
+// sleepTimerMinutes are the delays offered in the tray's sleep timer menu.
+var sleepTimerMinutes = []int{15, 30, 45, 60}
+
 const (
 	SYSTRAY_MENU_SHOW_HIDE  = 1001
 	SYSTRAY_MENU_START_STOP = 1002
 	SYSTRAY_MENU_EXIT       = 1003
 
+	SYSTRAY_MENU_TIMER_TRACK  = 1004
+	SYSTRAY_MENU_TIMER_CANCEL = 1005
+	SYSTRAY_MENU_TIMER_BASE   = 1010 // "pause in N minutes" items, indexed into sleepTimerMinutes
+
 	// wmSessionsChanged and wmDeviceChanged use offsets +2 and +3 because
 	// NotifyIconMsg (systray.go) already occupies WM_APP+1.
 	wmSessionsChanged        = co.WM_APP + 2
@@ -402,6 +409,9 @@ func (me *Gui) events() {
 						}
 					}
 				}
+				if me.insertTimerMenu(popup, nextPos) {
+					nextPos++
+				}
 			}
 
 			mii = &win.MENUITEMINFO{
@@ -458,7 +468,16 @@ func (me *Gui) events() {
 				}
 			case SYSTRAY_MENU_EXIT:
 				me.wnd.Hwnd().DestroyWindow()
+			case SYSTRAY_MENU_TIMER_TRACK:
+				me.scheduleTimer(server.TimerRequest{Action: "pause", Tracks: 1})
+			case SYSTRAY_MENU_TIMER_CANCEL:
+				for _, t := range me.srv.Timers() {
+					_ = me.srv.CancelTimer(t.ID)
+				}
 			default:
+				if idx := int(res) - SYSTRAY_MENU_TIMER_BASE; idx >= 0 && idx < len(sleepTimerMinutes) {
+					me.scheduleTimer(server.TimerRequest{Action: "pause", After: sleepTimerMinutes[idx] * 60})
+				}
 				if res >= SYSTRAY_MENU_DEVICE_BASE {
 					idx := int(res) - SYSTRAY_MENU_DEVICE_BASE
 					sessions := me.srv.GetSessions()
@@ -607,6 +626,62 @@ func (me *Gui) events() {
 	})
 }
 
+// insertTimerMenu inserts the "Sleep Timer" submenu into popup at pos and
+// reports whether it was attached.
+func (me *Gui) insertTimerMenu(popup win.HMENU, pos int) bool {
+	timerMenu, err := win.CreatePopupMenu()
+	if err != nil {
+		return false
+	}
+	labels := []string{"Pause after this &track"}
+	ids := []uint32{SYSTRAY_MENU_TIMER_TRACK}
+	for i, minutes := range sleepTimerMinutes {
+		labels = append(labels, fmt.Sprintf("Pause in %d minutes", minutes))
+		ids = append(ids, uint32(SYSTRAY_MENU_TIMER_BASE+i))
+	}
+	if n := len(me.srv.Timers()); n > 0 {
+		labels = append(labels, fmt.Sprintf("&Cancel timers (%d)", n))
+		ids = append(ids, SYSTRAY_MENU_TIMER_CANCEL)
+	}
+	for i, label := range labels {
+		itemPtr, err := syscall.UTF16PtrFromString(label)
+		if err != nil {
+			continue
+		}
+		tmi := &win.MENUITEMINFO{
+			FMask:      co.MIIM_STRING | co.MIIM_ID,
+			FType:      co.MFT_STRING,
+			WId:        ids[i],
+			DwTypeData: itemPtr,
+		}
+		tmi.SetCbSize()
+		timerMenu.InsertMenuItemByPos(i, tmi)
+	}
+
+	subLabelPtr, err := syscall.UTF16PtrFromString("Sleep &Timer")
+	if err != nil {
+		// Not attached, so popup.DestroyMenu would not free it.
+		timerMenu.DestroyMenu()
+		return false
+	}
+	mii := &win.MENUITEMINFO{
+		FMask:      co.MIIM_STRING | co.MIIM_SUBMENU,
+		FType:      co.MFT_STRING,
+		HSubMenu:   timerMenu,
+		DwTypeData: subLabelPtr,
+	}
+	mii.SetCbSize()
+	popup.InsertMenuItemByPos(pos, mii)
+	return true
+}
+
+// scheduleTimer schedules a timer chosen from the tray menu.
+func (me *Gui) scheduleTimer(req server.TimerRequest) {
+	if _, err := me.srv.ScheduleTimer(req); err != nil {
+		slog.Warn("failed to schedule timer", "err", err)
+	}
+}
+
 func (me *Gui) syncConfig() {
 	port, err := strconv.Atoi(me.portEdit.Text())
 	if err == nil {
@@ -0,0 +1,227 @@
+// Package palette picks theme colours from album art.
+package palette
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+)
+
+// maxSamples bounds the pixels read from an image; larger images are
+// sampled on a grid.
+const maxSamples = 10000
+
+// achromatic is the saturation below which a colour counts as grey.
+const achromatic = 0.1
+
+// Palette holds the colours picked from an image. Swatches follow the usual
+// vibrant/muted split with light and dark variants; a swatch the image has
+// no colour for is derived from the dominant colour. Text is black or white,
+// whichever reads better on Dominant, and TextContrast is its WCAG contrast
+// ratio against Dominant.
+type Palette struct {
+	Dominant     color.RGBA
+	Vibrant      color.RGBA
+	Muted        color.RGBA
+	LightVibrant color.RGBA
+	DarkVibrant  color.RGBA
+	LightMuted   color.RGBA
+	DarkMuted    color.RGBA
+	Text         color.RGBA
+	TextContrast float64
+}
+
+// bin accumulates the pixels of one quantized colour.
+type bin struct {
+	r, g, b, n int
+}
+
+func (b bin) color() color.RGBA {
+	return color.RGBA{R: uint8(b.r / b.n), G: uint8(b.g / b.n), B: uint8(b.b / b.n), A: 255}
+}
+
+// swatchTarget describes the saturation and lightness a swatch looks for.
+type swatchTarget struct {
+	minSat, maxSat       float64
+	minLum, maxLum       float64
+	targetSat, targetLum float64
+}
+
+var (
+	vibrantTarget      = swatchTarget{0.35, 1, 0.3, 0.7, 1, 0.5}
+	lightVibrantTarget = swatchTarget{0.35, 1, 0.55, 1, 1, 0.74}
+	darkVibrantTarget  = swatchTarget{0.35, 1, 0, 0.45, 1, 0.26}
+	mutedTarget        = swatchTarget{0, 0.4, 0.3, 0.7, 0.3, 0.5}
+	lightMutedTarget   = swatchTarget{0, 0.4, 0.55, 1, 0.3, 0.74}
+	darkMutedTarget    = swatchTarget{0, 0.4, 0, 0.45, 0.3, 0.26}
+)
+
+// Extract computes the palette of img. Transparent pixels are ignored; an
+// image with no opaque pixels yields a black palette with white text.
+func Extract(img image.Image) Palette {
+	bins := make(map[int]*bin)
+	b := img.Bounds()
+	step := max(1, int(math.Sqrt(float64(b.Dx()*b.Dy())/maxSamples)))
+	total := 0
+	for y := b.Min.Y; y < b.Max.Y; y += step {
+		for x := b.Min.X; x < b.Max.X; x += step {
+			r, g, bl, a := img.At(x, y).RGBA()
+			if a < 0x8000 {
+				continue
+			}
+			r8, g8, b8 := int(r>>8), int(g>>8), int(bl>>8)
+			key := (r8>>4)<<8 | (g8>>4)<<4 | b8>>4
+			bn, ok := bins[key]
+			if !ok {
+				bn = &bin{}
+				bins[key] = bn
+			}
+			bn.r += r8
+			bn.g += g8
+			bn.b += b8
+			bn.n++
+			total++
+		}
+	}
+
+	var dominant *bin
+	for _, bn := range bins {
+		if dominant == nil || bn.n > dominant.n || (bn.n == dominant.n && lessBin(bn, dominant)) {
+			dominant = bn
+		}
+	}
+	p := Palette{Dominant: color.RGBA{A: 255}}
+	if dominant != nil {
+		p.Dominant = dominant.color()
+	}
+	pick := func(t swatchTarget) color.RGBA {
+		var best *bin
+		bestScore := -1.0
+		for _, bn := range bins {
+			_, s, l := toHSL(bn.color())
+			if s < t.minSat || s > t.maxSat || l < t.minLum || l > t.maxLum {
+				continue
+			}
+			score := 3*(1-math.Abs(s-t.targetSat)) + 6*(1-math.Abs(l-t.targetLum)) + float64(bn.n)/float64(total)
+			if score > bestScore || (score == bestScore && lessBin(bn, best)) {
+				best, bestScore = bn, score
+			}
+		}
+		if best != nil {
+			return best.color()
+		}
+		// Greyscale art keeps grey swatches rather than gaining a hue.
+		h, s, _ := toHSL(p.Dominant)
+		if s >= achromatic {
+			s = clamp(s, t.minSat, t.maxSat)
+		}
+		return fromHSL(h, s, t.targetLum)
+	}
+	p.Vibrant = pick(vibrantTarget)
+	p.LightVibrant = pick(lightVibrantTarget)
+	p.DarkVibrant = pick(darkVibrantTarget)
+	p.Muted = pick(mutedTarget)
+	p.LightMuted = pick(lightMutedTarget)
+	p.DarkMuted = pick(darkMutedTarget)
+
+	black := color.RGBA{A: 255}
+	white := color.RGBA{R: 255, G: 255, B: 255, A: 255}
+	onBlack, onWhite := Contrast(black, p.Dominant), Contrast(white, p.Dominant)
+	if onBlack > onWhite {
+		p.Text, p.TextContrast = black, onBlack
+	} else {
+		p.Text, p.TextContrast = white, onWhite
+	}
+	p.TextContrast = math.Round(p.TextContrast*100) / 100
+	return p
+}
+
+// lessBin orders bins of equal rank so map iteration order does not leak
+// into the palette.
+func lessBin(a, b *bin) bool {
+	if b == nil {
+		return true
+	}
+	ca, cb := a.color(), b.color()
+	return uint32(ca.R)<<16|uint32(ca.G)<<8|uint32(ca.B) < uint32(cb.R)<<16|uint32(cb.G)<<8|uint32(cb.B)
+}
+
+// Hex formats c as #rrggbb.
+func Hex(c color.RGBA) string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
+
+// Contrast returns the WCAG 2 contrast ratio of a and b, from 1 to 21.
+func Contrast(a, b color.RGBA) float64 {
+	la, lb := luminance(a), luminance(b)
+	if la < lb {
+		la, lb = lb, la
+	}
+	return (la + 0.05) / (lb + 0.05)
+}
+
+// luminance returns the WCAG relative luminance of c.
+func luminance(c color.RGBA) float64 {
+	channel := func(v uint8) float64 {
+		f := float64(v) / 255
+		if f <= 0.03928 {
+			return f / 12.92
+		}
+		return math.Pow((f+0.055)/1.055, 2.4)
+	}
+	return 0.2126*channel(c.R) + 0.7152*channel(c.G) + 0.0722*channel(c.B)
+}
+
+// toHSL converts c to hue in degrees, saturation and lightness in [0, 1].
+func toHSL(c color.RGBA) (h, s, l float64) {
+	r, g, b := float64(c.R)/255, float64(c.G)/255, float64(c.B)/255
+	hi, lo := max(r, g, b), min(r, g, b)
+	l = (hi + lo) / 2
+	if hi == lo {
+		return 0, 0, l
+	}
+	d := hi - lo
+	if l > 0.5 {
+		s = d / (2 - hi - lo)
+	} else {
+		s = d / (hi + lo)
+	}
+	switch hi {
+	case r:
+		h = math.Mod((g-b)/d+6, 6)
+	case g:
+		h = (b-r)/d + 2
+	default:
+		h = (r-g)/d + 4
+	}
+	return h * 60, s, l
+}
+
+// fromHSL converts hue in degrees, saturation and lightness to a colour.
+func fromHSL(h, s, l float64) color.RGBA {
+	c := (1 - math.Abs(2*l-1)) * s
+	x := c * (1 - math.Abs(math.Mod(h/60, 2)-1))
+	m := l - c/2
+	var r, g, b float64
+	switch {
+	case h < 60:
+		r, g = c, x
+	case h < 120:
+		r, g = x, c
+	case h < 180:
+		g, b = c, x
+	case h < 240:
+		g, b = x, c
+	case h < 300:
+		r, b = x, c
+	default:
+		r, b = c, x
+	}
+	to8 := func(v float64) uint8 { return uint8(math.Round((v + m) * 255)) }
+	return color.RGBA{R: to8(r), G: to8(g), B: to8(b), A: 255}
+}
+
+func clamp(v, lo, hi float64) float64 {
+	return math.Max(lo, math.Min(v, hi))
+}
@@ -0,0 +1,85 @@
+package palette
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+)
+
+func fill(img *image.RGBA, r image.Rectangle, c color.RGBA) {
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			img.SetRGBA(x, y, c)
+		}
+	}
+}
+
+func TestExtract_PicksSwatches(t *testing.T) {
+	navy := color.RGBA{R: 20, G: 30, B: 90, A: 255}
+	orange := color.RGBA{R: 240, G: 120, B: 20, A: 255}
+	beige := color.RGBA{R: 200, G: 190, B: 170, A: 255}
+	img := image.NewRGBA(image.Rect(0, 0, 100, 100))
+	fill(img, image.Rect(0, 0, 100, 60), navy)
+	fill(img, image.Rect(0, 60, 100, 80), orange)
+	fill(img, image.Rect(0, 80, 100, 100), beige)
+
+	p := Extract(img)
+	if p.Dominant != navy {
+		t.Errorf("Dominant = %s, want %s", Hex(p.Dominant), Hex(navy))
+	}
+	if p.Vibrant != orange {
+		t.Errorf("Vibrant = %s, want %s", Hex(p.Vibrant), Hex(orange))
+	}
+	if p.DarkVibrant != navy {
+		t.Errorf("DarkVibrant = %s, want %s", Hex(p.DarkVibrant), Hex(navy))
+	}
+	if p.LightMuted != beige {
+		t.Errorf("LightMuted = %s, want %s", Hex(p.LightMuted), Hex(beige))
+	}
+	if p.Text != (color.RGBA{R: 255, G: 255, B: 255, A: 255}) || p.TextContrast < 4.5 {
+		t.Errorf("Text = %s at %.2f:1, want readable white", Hex(p.Text), p.TextContrast)
+	}
+}
+
+func TestExtract_Greyscale(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 10, 10))
+	fill(img, img.Rect, color.RGBA{R: 230, G: 230, B: 230, A: 255})
+
+	p := Extract(img)
+	for name, c := range map[string]color.RGBA{"Vibrant": p.Vibrant, "DarkMuted": p.DarkMuted} {
+		if c.R != c.G || c.G != c.B {
+			t.Errorf("%s = %s, want grey", name, Hex(c))
+		}
+	}
+	if p.Text != (color.RGBA{A: 255}) {
+		t.Errorf("Text = %s, want black on light grey", Hex(p.Text))
+	}
+}
+
+func TestExtract_Transparent(t *testing.T) {
+	p := Extract(image.NewRGBA(image.Rect(0, 0, 4, 4)))
+	if p.Dominant != (color.RGBA{A: 255}) || p.TextContrast != 21 {
+		t.Errorf("palette = %+v, want black with white text", p)
+	}
+}
+
+func TestContrast(t *testing.T) {
+	black := color.RGBA{A: 255}
+	white := color.RGBA{R: 255, G: 255, B: 255, A: 255}
+	if got := Contrast(black, white); math.Abs(got-21) > 0.01 {
+		t.Errorf("black/white = %.2f, want 21", got)
+	}
+	if got := Contrast(white, white); got != 1 {
+		t.Errorf("white/white = %.2f, want 1", got)
+	}
+}
+
+func TestHSLRoundTrip(t *testing.T) {
+	for _, c := range []color.RGBA{{R: 240, G: 120, B: 20, A: 255}, {R: 20, G: 30, B: 90, A: 255}, {R: 80, G: 200, B: 120, A: 255}} {
+		h, s, l := toHSL(c)
+		if got := fromHSL(h, s, l); got != c {
+			t.Errorf("round trip of %s = %s", Hex(c), Hex(got))
+		}
+	}
+}
@@ -0,0 +1,276 @@
+package server
+
+import (
+	"bytes"
+	"container/list"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif" // decode GIF thumbnails
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"smtc-now-playing/internal/thumbnail"
+	"smtc-now-playing/internal/wsproto"
+)
+
+// ErrInvalidArtVariant rejects album art variant parameters.
+var ErrInvalidArtVariant = errors.New("server: invalid album art parameters")
+
+// artBlob is the displayed album art with everything derived from it. It is
+// built once per art change and never modified after derived is closed, so
+// snapshots share it by pointer instead of copying the image on every update.
+type artBlob struct {
+	hash        string
+	data        []byte
+	contentType string
+	source      string // one of the domain.ArtSource constants
+	// derived is closed once palette and styles are set. They are computed
+	// in the background so decoding large art does not hold up the event loop.
+	derived chan struct{}
+	palette *wsproto.PalettePayload // nil when the art cannot be decoded
+	styles  map[string]renderedArt  // pre-rendered styles; nil when the art cannot be decoded
+}
+
+// newArtBlob takes ownership of data, which the caller must not modify
+// afterwards, and starts deriving the palette and styles from it.
+func newArtBlob(hash string, data []byte, contentType, source string) *artBlob {
+	b := &artBlob{hash: hash, data: data, contentType: contentType, source: source, derived: make(chan struct{})}
+	go b.derive()
+	return b
+}
+
+// derive decodes the art and renders its palette and styles.
+func (b *artBlob) derive() {
+	defer close(b.derived)
+	img, format, err := image.Decode(bytes.NewReader(b.data))
+	if err != nil {
+		slog.Debug("album art cannot be decoded", "err", err)
+		return
+	}
+	b.palette = artPalette(img)
+	b.styles = renderArtStyles(img, format)
+}
+
+// isDerived reports whether palette and styles may be read.
+func (b *artBlob) isDerived() bool {
+	select {
+	case <-b.derived:
+		return true
+	default:
+		return false
+	}
+}
+
+// artHash returns the hash of the displayed album art, or "" without art.
+func (st *stateSnapshot) artHash() string {
+	if st.art == nil {
+		return ""
+	}
+	return st.art.hash
+}
+
+// currentPalette returns the palette of the displayed album art, or nil
+// without art or while the palette is still being computed.
+func (st *stateSnapshot) currentPalette() *wsproto.PalettePayload {
+	if st.art == nil || !st.art.isDerived() {
+		return nil
+	}
+	return st.art.palette
+}
+
+// artVariant is a rendering of the album art requested through query
+// parameters. The zero value is the original image.
+type artVariant struct {
+	size   int    // bounding box edge in pixels; 0 keeps the original size
+	fit    string // "contain" or "cover"
+	format string // "png", "jpeg" or "webp"; "" keeps the original format
+}
+
+// isOriginal reports whether v asks for the bytes as received from SMTC.
+func (v artVariant) isOriginal() bool {
+	return v.size == 0 && v.format == ""
+}
+
+// parseArtVariant reads size, fit and format from query.
+func parseArtVariant(query map[string][]string) (artVariant, error) {
+	get := func(key string) string {
+		if vals := query[key]; len(vals) > 0 {
+			return strings.ToLower(strings.TrimSpace(vals[0]))
+		}
+		return ""
+	}
+	var v artVariant
+	if raw := get("size"); raw != "" {
+		size, err := strconv.Atoi(raw)
+		if err != nil || size < 1 || size > maxArtSize {
+			return artVariant{}, fmt.Errorf("%w: size must be between 1 and %d", ErrInvalidArtVariant, maxArtSize)
+		}
+		v.size = size
+	}
+	switch fit := get("fit"); fit {
+	case "", "contain":
+		v.fit = "contain"
+	case "cover":
+		v.fit = "cover"
+	default:
+		return artVariant{}, fmt.Errorf("%w: fit must be cover or contain", ErrInvalidArtVariant)
+	}
+	switch format := get("format"); format {
+	case "":
+	case "png":
+		v.format = "png"
+	case "jpeg", "jpg":
+		v.format = "jpeg"
+	case "webp":
+		v.format = "webp"
+	default:
+		return artVariant{}, fmt.Errorf("%w: format must be png, jpeg or webp", ErrInvalidArtVariant)
+	}
+	return v, nil
+}
+
+// artContentType returns ct, or the sniffed type of data when ct is empty or
+// generic. Sniffed types other than images fall back to octet-stream.
+func artContentType(ct string, data []byte) string {
+	if ct != "" && ct != "application/octet-stream" {
+		return ct
+	}
+	if sniffed := http.DetectContentType(data); strings.HasPrefix(sniffed, "image/") {
+		return sniffed
+	}
+	return "application/octet-stream"
+}
+
+// renderArt decodes data and encodes the variant v of it, returning the
+// encoded bytes and their content type. Images are only ever scaled down.
+func renderArt(data []byte, v artVariant) ([]byte, string, error) {
+	src, srcFormat, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", fmt.Errorf("decode album art: %w", err)
+	}
+	if v.size > 0 {
+		src = fitImage(src, v.size, v.fit == "cover")
+	}
+
+	format := v.format
+	if format == "" {
+		format = srcFormat
+	}
+	return encodeArt(src, format)
+}
+
+// fitImage scales src into a size×size box. contain keeps the whole image;
+// cover fills the box and crops the overflow around the centre. Images that
+// already fit are returned uncropped for contain and cropped for cover.
+func fitImage(src image.Image, size int, cover bool) image.Image {
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w == 0 || h == 0 {
+		return src
+	}
+	if cover {
+		side := min(w, h)
+		crop := image.Rect(0, 0, side, side).Add(b.Min).Add(image.Pt((w-side)/2, (h-side)/2))
+		edge := min(size, side)
+		return thumbnail.Scale(src, crop, edge, edge)
+	}
+	if w <= size && h <= size {
+		return src
+	}
+	return thumbnail.Fit(src, size)
+}
+
+// renderedArt is a cached album art variant.
+type renderedArt struct {
+	key         string
+	data        []byte
+	contentType string
+}
+
+// artCache is an LRU of rendered album art variants keyed by hash and
+// parameters, bounded by the total size of the variants. Variants of earlier
+// tracks age out as new ones are rendered.
+type artCache struct {
+	mu     sync.Mutex
+	budget int // bytes
+	used   int
+	order  *list.List // front is most recently used
+	items  map[string]*list.Element
+}
+
+func newArtCache(budget int) *artCache {
+	return &artCache{budget: budget, order: list.New(), items: make(map[string]*list.Element)}
+}
+
+func artCacheKey(hash string, v artVariant) string {
+	return fmt.Sprintf("%s/%d/%s/%s", hash, v.size, v.fit, v.format)
+}
+
+func (c *artCache) get(key string) (renderedArt, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.items[key]
+	if !ok {
+		return renderedArt{}, false
+	}
+	c.order.MoveToFront(el)
+	return el.Value.(renderedArt), true
+}
+
+// put caches art, evicting the least recently used variants to stay within
+// the budget. Art larger than the whole budget is not cached.
+func (c *artCache) put(art renderedArt) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[art.key]; ok {
+		c.used -= len(el.Value.(renderedArt).data)
+		c.order.Remove(el)
+		delete(c.items, art.key)
+	}
+	if len(art.data) > c.budget {
+		return
+	}
+	c.items[art.key] = c.order.PushFront(art)
+	c.used += len(art.data)
+	for c.used > c.budget {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		evicted := oldest.Value.(renderedArt)
+		delete(c.items, evicted.key)
+		c.used -= len(evicted.data)
+	}
+}
+
+func (s *Server) handleAlbumArt(w http.ResponseWriter, r *http.Request) {
+	rec, ok := s.lookupArt(w, r)
+	if !ok {
+		return
+	}
+	v, err := parseArtVariant(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if v.isOriginal() {
+		serveArt(w, r, rec.hash, artContentType(rec.contentType, rec.data), rec.data)
+		return
+	}
+
+	key := artCacheKey(rec.hash, v)
+	art, ok := s.artCache.get(key)
+	if !ok {
+		data, ct, err := renderArt(rec.data, v)
+		if err != nil {
+			slog.Debug("album art variant failed", "err", err)
+			http.Error(w, "album art cannot be converted", http.StatusUnsupportedMediaType)
+			return
+		}
+		art = renderedArt{key: key, data: data, contentType: ct}
+		s.artCache.put(art)
+	}
+	serveArt(w, r, key, art.contentType, art.data)
+}
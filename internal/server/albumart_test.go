@@ -0,0 +1,187 @@
+package server
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"smtc-now-playing/internal/domain"
+)
+
+// testPNG encodes a w×h image, red on the left half and blue on the right.
+func testPNG(t *testing.T, w, h int) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			c := color.RGBA{R: 255, A: 255}
+			if x >= w/2 {
+				c = color.RGBA{B: 255, A: 255}
+			}
+			img.SetRGBA(x, y, c)
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("encode png: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// waitArtDerived waits until the palette and styles of the displayed art
+// have been computed and returns the snapshot.
+func waitArtDerived(t *testing.T, srv *Server) *stateSnapshot {
+	t.Helper()
+	state := srv.snapshot()
+	if state.art == nil {
+		return state
+	}
+	select {
+	case <-state.art.derived:
+	case <-time.After(5 * time.Second):
+		t.Fatal("album art palette and styles not computed")
+	}
+	return state
+}
+
+func TestParseArtVariant(t *testing.T) {
+	tests := []struct {
+		query   string
+		want    artVariant
+		wantErr error
+	}{
+		{"", artVariant{fit: "contain"}, nil},
+		{"size=64&fit=cover&format=JPG", artVariant{size: 64, fit: "cover", format: "jpeg"}, nil},
+		{"format=png", artVariant{fit: "contain", format: "png"}, nil},
+		{"size=0", artVariant{}, ErrInvalidArtVariant},
+		{"size=99999", artVariant{}, ErrInvalidArtVariant},
+		{"fit=stretch", artVariant{}, ErrInvalidArtVariant},
+		{"format=bmp", artVariant{}, ErrInvalidArtVariant},
+		{"format=WebP", artVariant{fit: "contain", format: "webp"}, nil},
+	}
+	for _, tt := range tests {
+		query, _ := url.ParseQuery(tt.query)
+		got, err := parseArtVariant(query)
+		if !errors.Is(err, tt.wantErr) || got != tt.want {
+			t.Errorf("parseArtVariant(%q) = %+v, %v; want %+v, %v", tt.query, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestFitImage(t *testing.T) {
+	wide := image.NewRGBA(image.Rect(0, 0, 400, 200))
+	tests := []struct {
+		name  string
+		size  int
+		cover bool
+		want  image.Point
+	}{
+		{"contain", 100, false, image.Pt(100, 50)},
+		{"cover", 100, true, image.Pt(100, 100)},
+		{"contain_no_upscale", 800, false, image.Pt(400, 200)},
+		{"cover_no_upscale", 800, true, image.Pt(200, 200)},
+	}
+	for _, tt := range tests {
+		if got := fitImage(wide, tt.size, tt.cover).Bounds().Size(); got != tt.want {
+			t.Errorf("%s: size = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestArtContentType(t *testing.T) {
+	pngData := testPNG(t, 2, 2)
+	if got := artContentType("", pngData); got != "image/png" {
+		t.Errorf("sniffed = %q, want image/png", got)
+	}
+	if got := artContentType("image/jpeg", pngData); got != "image/jpeg" {
+		t.Errorf("reported = %q, want image/jpeg", got)
+	}
+	if got := artContentType("", []byte("plain text")); got != "application/octet-stream" {
+		t.Errorf("non-image = %q, want application/octet-stream", got)
+	}
+}
+
+func TestHandleAlbumArt_Variants(t *testing.T) {
+	srv, _, _ := newTestServer(t)
+	srv.handleInfoEvent(domain.InfoData{Artist: "Artist", Title: "Title", ThumbnailData: testPNG(t, 400, 200)})
+	handler := srv.setupRoutes()
+	base := srv.albumArtURL(srv.snapshot().artHash())
+
+	w := serveLocal(handler, http.MethodGet, base+"?size=100", "")
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "image/png" {
+		t.Fatalf("resize: got %d %q", w.Code, w.Header().Get("Content-Type"))
+	}
+	img, err := png.Decode(w.Body)
+	if err != nil {
+		t.Fatalf("decode resized: %v", err)
+	}
+	if size := img.Bounds().Size(); size != image.Pt(100, 50) {
+		t.Fatalf("resized to %v, want 100x50", size)
+	}
+	if r, _, b, _ := img.At(10, 25).RGBA(); r>>8 != 255 || b != 0 {
+		t.Fatalf("left pixel = %v, want red", img.At(10, 25))
+	}
+
+	w = serveLocal(handler, http.MethodGet, base+"?size=64&fit=cover&format=jpeg", "")
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "image/jpeg" {
+		t.Fatalf("jpeg: got %d %q", w.Code, w.Header().Get("Content-Type"))
+	}
+	if _, ok := srv.artCache.get(artCacheKey(srv.snapshot().artHash(), artVariant{size: 64, fit: "cover", format: "jpeg"})); !ok {
+		t.Fatal("rendered variant was not cached")
+	}
+
+	w = serveLocal(handler, http.MethodGet, base+"?size=32&format=webp", "")
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "image/webp" {
+		t.Fatalf("webp: got %d %q", w.Code, w.Header().Get("Content-Type"))
+	}
+	if body := w.Body.Bytes(); len(body) < 16 || string(body[:4]) != "RIFF" || string(body[8:16]) != "WEBPVP8L" {
+		t.Fatalf("webp body does not start with a VP8L header: % x", body[:min(len(body), 16)])
+	}
+	if w := serveLocal(handler, http.MethodGet, base+"?size=abc", ""); w.Code != http.StatusBadRequest {
+		t.Fatalf("bad size: got %d want %d", w.Code, http.StatusBadRequest)
+	}
+}
+
+func TestHandleAlbumArt_UndecodableVariant(t *testing.T) {
+	srv, _, _ := newTestServer(t)
+	srv.handleInfoEvent(domain.InfoData{Artist: "Artist", Title: "Title", ThumbnailData: []byte{0x01, 0x02}})
+	base := srv.albumArtURL(srv.snapshot().artHash())
+
+	w := serveLocal(srv.setupRoutes(), http.MethodGet, base+"?size=64", "")
+	if w.Code != http.StatusUnsupportedMediaType || !strings.Contains(w.Body.String(), "cannot be converted") {
+		t.Fatalf("got %d %q", w.Code, w.Body.String())
+	}
+}
+
+func TestArtCache_EvictsLeastRecentlyUsed(t *testing.T) {
+	c := newArtCache(10)
+	c.put(renderedArt{key: "a", data: make([]byte, 4)})
+	c.put(renderedArt{key: "b", data: make([]byte, 4)})
+	c.get("a")
+	c.put(renderedArt{key: "c", data: make([]byte, 4)})
+	if _, ok := c.get("b"); ok {
+		t.Fatal("b survived although it was least recently used")
+	}
+	for _, key := range []string{"a", "c"} {
+		if _, ok := c.get(key); !ok {
+			t.Fatalf("%s was evicted", key)
+		}
+	}
+
+	// Replacing an entry frees its old size; art over the budget is not kept.
+	c.put(renderedArt{key: "a", data: make([]byte, 6)})
+	if _, ok := c.get("c"); !ok || c.used != 10 {
+		t.Fatalf("c evicted or used = %d after replacing a, want 10", c.used)
+	}
+	c.put(renderedArt{key: "huge", data: make([]byte, 11)})
+	if _, ok := c.get("huge"); ok || c.used != 10 {
+		t.Fatalf("art over the budget was cached (used = %d)", c.used)
+	}
+}
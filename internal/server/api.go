@@ -1,12 +1,15 @@
 package server
 
 import (
+	"bytes"
 	"encoding/json"
+	"io"
 	"log/slog"
 	"net"
 	"net/http"
 
 	"smtc-now-playing/internal/smtc"
+	"smtc-now-playing/internal/thumbnail"
 	"smtc-now-playing/internal/wsproto"
 )
 
@@ -53,27 +56,13 @@ func (s *Server) handleNowPlaying(w http.ResponseWriter, r *http.Request) {
 	response := struct {
 		Info     wsproto.InfoPayload     `json:"info"`
 		Progress wsproto.ProgressPayload `json:"progress"`
+		Presence wsproto.PresencePayload `json:"presence"`
 	}{
-		Info: wsproto.InfoPayload{
-			Artist:       state.info.Artist,
-			Title:        state.info.Title,
-			AlbumTitle:   state.info.AlbumTitle,
-			AlbumArtist:  state.info.AlbumArtist,
-			PlaybackType: state.info.PlaybackType,
-			SourceApp:    state.info.SourceApp,
-			AlbumArt:     s.albumArtURL(state.albumArtHash),
-		},
+		Info:     wsproto.NewInfoPayload(s.clientInfo(*state.info), s.albumArtURL(state.artHash()), state.currentPalette()),
+		Presence: s.Presence(),
 	}
 	if state.progress != nil {
-		response.Progress = wsproto.ProgressPayload{
-			Position:        state.progress.Position,
-			Duration:        state.progress.Duration,
-			Status:          state.progress.Status,
-			PlaybackRate:    state.progress.PlaybackRate,
-			IsShuffleActive: state.progress.IsShuffleActive,
-			AutoRepeatMode:  state.progress.AutoRepeatMode,
-			LastUpdatedTime: state.progress.LastUpdatedTime,
-		}
+		response.Progress = wsproto.NewProgressPayload(*state.progress)
 	}
 
 	writeJSON(w, http.StatusOK, response)
@@ -88,60 +77,60 @@ func (s *Server) handleSessions(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *Server) handleCapabilities(w http.ResponseWriter, r *http.Request) {
-	writeJSON(w, http.StatusOK, s.svc.GetCapabilities())
+	writeJSON(w, http.StatusOK, s.snapshot().caps)
+}
+
+// handleMetrics reports process-wide counters: what the album art size
+// limits did to the art players published.
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{"albumArt": thumbnail.ReadMetrics()})
 }
 
 func (s *Server) handleControl(w http.ResponseWriter, r *http.Request) {
-	action := r.PathValue("action")
+	s.serveControl(w, r, s.targetFor(""))
+}
 
-	var err error
-	switch action {
-	case "play":
-		err = s.svc.Play()
-	case "pause":
-		err = s.svc.Pause()
-	case "stop":
-		err = s.svc.StopPlayback()
-	case "toggle":
-		err = s.svc.TogglePlayPause()
-	case "next":
-		err = s.svc.SkipNext()
-	case "previous":
-		err = s.svc.SkipPrevious()
-	case "seek":
-		var body struct {
-			Position int64 `json:"position"`
-		}
-		if decodeErr := json.NewDecoder(r.Body).Decode(&body); decodeErr != nil {
-			writeJSON(w, http.StatusBadRequest, map[string]any{"success": false, "error": "invalid request body"})
-			return
-		}
-		err = s.svc.SeekTo(body.Position)
-	case "shuffle":
-		var body struct {
-			Active bool `json:"active"`
-		}
-		if decodeErr := json.NewDecoder(r.Body).Decode(&body); decodeErr != nil {
-			writeJSON(w, http.StatusBadRequest, map[string]any{"success": false, "error": "invalid request body"})
-			return
-		}
-		err = s.svc.SetShuffle(body.Active)
-	case "repeat":
-		var body struct {
-			Mode int `json:"mode"`
-		}
-		if decodeErr := json.NewDecoder(r.Body).Decode(&body); decodeErr != nil {
-			writeJSON(w, http.StatusBadRequest, map[string]any{"success": false, "error": "invalid request body"})
-			return
-		}
-		err = s.svc.SetRepeat(body.Mode)
-	default:
-		writeJSON(w, http.StatusNotFound, map[string]any{"success": false, "error": "unknown action"})
+// handleSessionControl runs a control against the session named in the path
+// without changing the displayed session.
+func (s *Server) handleSessionControl(w http.ResponseWriter, r *http.Request) {
+	s.serveControl(w, r, s.targetFor(r.PathValue("appId")))
+}
+
+func (s *Server) serveControl(w http.ResponseWriter, r *http.Request, target controlTarget) {
+	action := r.PathValue("action")
+	wait, err := parseControlWait(r)
+	if err == nil && wait.enabled && target.appID != "" {
+		err = errWaitNeedsDisplayedSession
+	}
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]any{"success": false, "error": err.Error(), "code": wsproto.CodeInvalidArgument})
 		return
 	}
-
+	if !isControlAction(action) {
+		writeJSON(w, http.StatusNotFound, map[string]any{"success": false, "error": errUnknownAction.Error(), "code": wsproto.CodeInvalidArgument})
+		return
+	}
+	// The body holds the control's args, decoded and checked the same way as
+	// over WebSocket, in batches and in timers.
+	args, err := io.ReadAll(r.Body)
+	if err != nil {
+		s.writeControlError(w, target, errInvalidBody)
+		return
+	}
+	prev := s.snapshot()
+	goal, err := s.executeWSControl(target, action, bytes.TrimSpace(args))
 	if err != nil {
-		writeJSON(w, http.StatusOK, map[string]any{"success": false, "error": err.Error()})
+		s.writeControlError(w, target, err)
+		return
+	}
+	if wait.enabled {
+		result := s.awaitControl(r.Context(), action, prev, goal, wait)
+		writeJSON(w, http.StatusOK, map[string]any{
+			"success":  true,
+			"info":     result.info,
+			"progress": result.progress,
+			"timedOut": result.timedOut,
+		})
 		return
 	}
 	writeJSON(w, http.StatusOK, map[string]any{"success": true})
@@ -1,14 +1,18 @@
 package server
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
 
+	"smtc-now-playing/internal/config"
 	"smtc-now-playing/internal/domain"
 	"smtc-now-playing/internal/smtc"
+	"smtc-now-playing/internal/thumbnail"
+	"smtc-now-playing/internal/wsproto"
 )
 
 func TestHandleNowPlaying_NoSession_404(t *testing.T) {
@@ -47,6 +51,108 @@ func TestHandleNowPlaying_WithData_200(t *testing.T) {
 	}
 }
 
+var _ SMTCService = (*smtc.MockProvider)(nil)
+
+func TestHandleNowPlaying_ExtendedInfoFromProvider(t *testing.T) {
+	provider := &smtc.MockProvider{}
+	srv, err := New(&config.Config{
+		Server: config.ServerConfig{Port: 11451},
+		UI:     config.UIConfig{Theme: "default"},
+	}, provider)
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	events := provider.Subscribe(1)
+	done := make(chan struct{})
+	go func() {
+		srv.processEvents(ctx, events)
+		close(done)
+	}()
+
+	provider.Inject(smtc.InfoEvent{Data: domain.InfoData{
+		Title:           "Test Track",
+		Artist:          "Test Artist",
+		Subtitle:        "Remastered",
+		Genres:          []string{"Rock", "Blues"},
+		TrackNumber:     3,
+		AlbumTrackCount: 12,
+	}})
+	provider.Unsubscribe(events) // the loop drains the event, then returns
+	<-done
+
+	req := httptest.NewRequest(http.MethodGet, "/api/now-playing", nil)
+	w := httptest.NewRecorder()
+	srv.handleNowPlaying(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("got %d want %d", w.Code, http.StatusOK)
+	}
+	var result struct {
+		Info wsproto.InfoPayload `json:"info"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+	info := result.Info
+	if info.Subtitle != "Remastered" || info.TrackNumber != 3 || info.AlbumTrackCount != 12 {
+		t.Fatalf("unexpected extended info: %+v", info)
+	}
+	if len(info.Genres) != 2 || info.Genres[0] != "Rock" || info.Genres[1] != "Blues" {
+		t.Fatalf("genres = %v, want [Rock Blues]", info.Genres)
+	}
+}
+
+func TestHandleNowPlaying_MetadataCleanup(t *testing.T) {
+	tests := []struct {
+		name         string
+		legacyEscape bool
+		wantArtist   string
+		wantTitle    string
+	}{
+		{"raw", false, `AC\DC`, "Back in Black Live"},
+		{"legacy_escape", true, `AC\\DC`, `Back in Black\nLive`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, svc, _ := newTestServer(t)
+			srv.cfg.Metadata = config.DefaultConfig().Metadata
+			srv.cfg.Metadata.LegacyEscape = tt.legacyEscape
+			ctx, cancel := context.WithCancel(context.Background())
+			t.Cleanup(cancel)
+			done := make(chan struct{})
+			go func() {
+				srv.processEvents(ctx, svc.events)
+				close(done)
+			}()
+
+			svc.events <- smtc.InfoEvent{Data: domain.InfoData{
+				Artist: `AC\DC`,
+				Title:  "Back\u200b in Black\nLive",
+			}}
+			close(svc.events)
+			<-done
+
+			req := httptest.NewRequest(http.MethodGet, "/api/now-playing", nil)
+			w := httptest.NewRecorder()
+			srv.handleNowPlaying(w, req)
+			var result struct {
+				Info wsproto.InfoPayload `json:"info"`
+			}
+			if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+				t.Fatal(err)
+			}
+			if result.Info.Artist != tt.wantArtist {
+				t.Errorf("artist = %q, want %q", result.Info.Artist, tt.wantArtist)
+			}
+			if result.Info.Title != tt.wantTitle {
+				t.Errorf("title = %q, want %q", result.Info.Title, tt.wantTitle)
+			}
+		})
+	}
+}
+
 func TestHandleDevices_Empty_ReturnsArray(t *testing.T) {
 	srv, _, _ := newTestServer(t)
 	req := httptest.NewRequest(http.MethodGet, "/api/devices", nil)
@@ -77,8 +183,8 @@ func TestHandleDevices_WithSessions_200(t *testing.T) {
 }
 
 func TestHandleCapabilities_200(t *testing.T) {
-	srv, svc, _ := newTestServer(t)
-	svc.capabilities = smtc.ControlCapabilities{IsPlayEnabled: true}
+	srv, _, _ := newTestServer(t)
+	srv.handleEvent(smtc.CapabilitiesChangedEvent{Caps: smtc.ControlCapabilities{IsPlayEnabled: true}})
 	req := httptest.NewRequest(http.MethodGet, "/api/capabilities", nil)
 	w := httptest.NewRecorder()
 	srv.handleCapabilities(w, req)
@@ -89,8 +195,8 @@ func TestHandleCapabilities_200(t *testing.T) {
 	if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
 		t.Fatal(err)
 	}
-	if _, ok := result["isPlayEnabled"]; !ok {
-		t.Fatalf("missing isPlayEnabled field: %+v", result)
+	if result["isPlayEnabled"] != true {
+		t.Fatalf("isPlayEnabled = %v, want true: %+v", result["isPlayEnabled"], result)
 	}
 }
 
@@ -149,8 +255,8 @@ func TestHandleControlSeek_ValidBody(t *testing.T) {
 	req.SetPathValue("action", "seek")
 	w := httptest.NewRecorder()
 	localhostOnly(srv.handleControl, false)(w, req)
-	if w.Code != http.StatusOK {
-		t.Fatalf("got %d want %d", w.Code, http.StatusOK)
+	if w.Code != http.StatusConflict {
+		t.Fatalf("got %d want %d", w.Code, http.StatusConflict)
 	}
 	if len(svc.seekCalls) != 1 || svc.seekCalls[0] != 5000 {
 		t.Fatalf("seekCalls = %v, want [5000]", svc.seekCalls)
@@ -223,6 +329,52 @@ func TestHandleControlRepeat_InvalidBody(t *testing.T) {
 	}
 }
 
+func TestHandleControlRate_ValidBody(t *testing.T) {
+	srv, svc, _ := newTestServer(t)
+	req := httptest.NewRequest(http.MethodPost, "/api/control/rate", strings.NewReader(`{"rate": 1.5}`))
+	req.RemoteAddr = "127.0.0.1:1234"
+	req.SetPathValue("action", "rate")
+	w := httptest.NewRecorder()
+	localhostOnly(srv.handleControl, false)(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("got %d want %d", w.Code, http.StatusOK)
+	}
+	if len(svc.rateCalls) != 1 || svc.rateCalls[0] != 1.5 {
+		t.Fatalf("rateCalls = %v, want [1.5]", svc.rateCalls)
+	}
+}
+
+func TestHandleControlRate_InvalidRate(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"missing", `{}`},
+		{"zero", `{"rate": 0}`},
+		{"negative", `{"rate": -1}`},
+		{"too_slow", `{"rate": 0.1}`},
+		{"too_fast", `{"rate": 8}`},
+		{"malformed", `bad`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, svc, _ := newTestServer(t)
+			req := httptest.NewRequest(http.MethodPost, "/api/control/rate", strings.NewReader(tt.body))
+			req.RemoteAddr = "127.0.0.1:1234"
+			req.SetPathValue("action", "rate")
+			w := httptest.NewRecorder()
+			localhostOnly(srv.handleControl, false)(w, req)
+			if w.Code != http.StatusBadRequest {
+				t.Fatalf("got %d want %d", w.Code, http.StatusBadRequest)
+			}
+			if len(svc.rateCalls) != 0 {
+				t.Fatalf("rateCalls = %v, want none", svc.rateCalls)
+			}
+		})
+	}
+}
+
 func TestHandleControl_AllowRemote(t *testing.T) {
 	srv, _, _ := newTestServer(t)
 	req := httptest.NewRequest(http.MethodPost, "/api/control/play", nil)
@@ -258,3 +410,103 @@ func TestWriteJSON_OKStatus(t *testing.T) {
 		t.Fatalf("got %d want %d", w.Code, http.StatusOK)
 	}
 }
+
+func TestHandleSessionControl_TargetsSessionWithoutSwitching(t *testing.T) {
+	srv, svc, _ := newTestServer(t)
+	srv.handleEvent(smtc.DeviceChangedEvent{AppID: "Spotify.exe"})
+	handler := srv.setupRoutes()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/sessions/chrome.exe/control/pause", nil)
+	req.RemoteAddr = "127.0.0.1:1234"
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("got %d want %d: %s", w.Code, http.StatusOK, w.Body.String())
+	}
+	if len(svc.sessionTargets) != 1 || svc.sessionTargets[0] != "chrome.exe" {
+		t.Fatalf("sessionTargets = %v, want [chrome.exe]", svc.sessionTargets)
+	}
+	if got := snapshotForTest(t, srv).activeAppID; got != "Spotify.exe" {
+		t.Fatalf("activeAppID = %q, want Spotify.exe", got)
+	}
+}
+
+func TestHandleSessionControl_DisplayedSessionIsUntargeted(t *testing.T) {
+	srv, svc, _ := newTestServer(t)
+	srv.handleEvent(smtc.CapabilitiesChangedEvent{Caps: smtc.ControlCapabilities{IsPlayEnabled: true}})
+	srv.handleEvent(smtc.DeviceChangedEvent{AppID: "Spotify.exe"})
+	req := httptest.NewRequest(http.MethodPost, "/api/sessions/Spotify.exe/control/play", nil)
+	req.RemoteAddr = "127.0.0.1:1234"
+	req.SetPathValue("appId", "Spotify.exe")
+	req.SetPathValue("action", "play")
+	w := httptest.NewRecorder()
+	localhostOnly(srv.handleSessionControl, false)(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("got %d want %d", w.Code, http.StatusOK)
+	}
+	if len(svc.sessionTargets) != 0 {
+		t.Fatalf("sessionTargets = %v, want none", svc.sessionTargets)
+	}
+}
+
+func TestHandleSessionControl_Errors(t *testing.T) {
+	tests := []struct {
+		name     string
+		action   string
+		query    string
+		body     string
+		nextErr  error
+		wantCode int
+	}{
+		{"not_found", "next", "", "", smtc.ErrSessionNotFound, http.StatusNotFound},
+		{"relative_seek_not_found", "seek", "", `{"offset": 1000}`, nil, http.StatusNotFound},
+		{"wait_rejected", "next", "?wait=true", "", nil, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, svc, _ := newTestServer(t)
+			svc.nextErr = tt.nextErr
+			req := httptest.NewRequest(http.MethodPost, "/api/sessions/gone.exe/control/"+tt.action+tt.query, strings.NewReader(tt.body))
+			req.RemoteAddr = "127.0.0.1:1234"
+			req.SetPathValue("appId", "gone.exe")
+			req.SetPathValue("action", tt.action)
+			w := httptest.NewRecorder()
+			localhostOnly(srv.handleSessionControl, false)(w, req)
+			if w.Code != tt.wantCode {
+				t.Fatalf("got %d want %d: %s", w.Code, tt.wantCode, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestHandleSessionControl_RelativeSeekUsesSessionProgress(t *testing.T) {
+	srv, svc, _ := newTestServer(t)
+	srv.handleProgressEvent(domain.ProgressData{Position: 10, Duration: 60, Status: smtc.StatusPaused})
+	svc.sessionProgress = map[string]domain.ProgressData{
+		"chrome.exe": {Position: 100, Duration: 300, Status: smtc.StatusPaused},
+	}
+	req := httptest.NewRequest(http.MethodPost, "/api/sessions/chrome.exe/control/seek", strings.NewReader(`{"offset": 30000}`))
+	req.RemoteAddr = "127.0.0.1:1234"
+	req.SetPathValue("appId", "chrome.exe")
+	req.SetPathValue("action", "seek")
+	w := httptest.NewRecorder()
+	localhostOnly(srv.handleSessionControl, false)(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("got %d want %d: %s", w.Code, http.StatusOK, w.Body.String())
+	}
+	if len(svc.seekCalls) != 1 || svc.seekCalls[0] != 130000 {
+		t.Fatalf("seekCalls = %v, want [130000]", svc.seekCalls)
+	}
+}
+
+func TestHandleMetrics(t *testing.T) {
+	srv, _, _ := newTestServer(t)
+	w := serveLocal(srv.setupRoutes(), http.MethodGet, "/api/metrics", "")
+	var body struct {
+		AlbumArt *thumbnail.Metrics `json:"albumArt"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&body); err != nil || w.Code != http.StatusOK || body.AlbumArt == nil {
+		t.Fatalf("got %d %v: %+v", w.Code, err, body)
+	}
+}
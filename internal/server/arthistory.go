@@ -0,0 +1,278 @@
+package server
+
+import (
+	"bytes"
+	"container/list"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"smtc-now-playing/internal/wsproto"
+)
+
+// artCacheControl lets clients cache album art forever: every URL embeds the
+// SHA-256 of the image it serves.
+const artCacheControl = "public, max-age=31536000, immutable"
+
+// artRecord is one image in the album art history.
+type artRecord struct {
+	hash        string
+	data        []byte // nil once the image is only kept on disk
+	size        int
+	original    int // bytes before the provider downscaled it; 0 if it did not
+	contentType string
+	source      string // "" for art indexed from the disk cache
+	palette     *wsproto.PalettePayload
+	title       string
+	artist      string
+	albumTitle  string
+	seenAt      time.Time
+}
+
+// AlbumArtEntry describes an image in the album art history.
+type AlbumArtEntry struct {
+	Hash        string `json:"hash"`
+	URL         string `json:"url"`
+	ContentType string `json:"contentType,omitempty"`
+	Size        int    `json:"size"`
+	Original    int    `json:"originalSize,omitempty"` // bytes the player published, when downscaled
+	Source      string `json:"source,omitempty"`
+	Title       string `json:"title,omitempty"`
+	Artist      string `json:"artist,omitempty"`
+	AlbumTitle  string `json:"albumTitle,omitempty"`
+	SeenAt      int64  `json:"seenAt"` // unix milliseconds
+	Current     bool   `json:"current"`
+}
+
+// artHistory is a bounded LRU of recent album art keyed by SHA-256, so art
+// of earlier tracks keeps being served after the track changes. With a disk
+// directory set, images also go to disk and older ones are read back from
+// there once they leave memory.
+type artHistory struct {
+	mu     sync.Mutex
+	memory int    // images whose data is kept in memory
+	disk   int    // images kept on disk; 0 without a directory
+	dir    string // "" disables the disk cache
+	order  *list.List
+	items  map[string]*list.Element // front of order is most recently seen
+}
+
+func newArtHistory(memory int) *artHistory {
+	return &artHistory{memory: max(1, memory), order: list.New(), items: make(map[string]*list.Element)}
+}
+
+// isArtHash reports whether name is a hex SHA-256, the only file names the
+// disk cache reads or writes.
+func isArtHash(name string) bool {
+	b, err := hex.DecodeString(name)
+	return err == nil && len(b) == 32
+}
+
+// setDir enables the disk cache in dir, keeping up to limit images, and
+// indexes the images already there, newest first.
+func (h *artHistory) setDir(dir string, limit int) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("create album art dir: %w", err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("read album art dir: %w", err)
+	}
+	var found []*artRecord
+	for _, e := range entries {
+		if !e.Type().IsRegular() || !isArtHash(e.Name()) {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		found = append(found, &artRecord{hash: e.Name(), size: int(info.Size()), seenAt: info.ModTime()})
+	}
+	slices.SortFunc(found, func(a, b *artRecord) int { return b.seenAt.Compare(a.seenAt) })
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.dir, h.disk = dir, limit
+	for _, rec := range found {
+		if _, ok := h.items[rec.hash]; !ok {
+			h.items[rec.hash] = h.order.PushBack(rec)
+		}
+	}
+	h.trimLocked()
+	return nil
+}
+
+// add records rec as the most recently seen image. Seeing an image again
+// refreshes its metadata and moves it to the front.
+func (h *artHistory) add(rec artRecord) {
+	h.mu.Lock()
+	dir := h.dir
+	h.mu.Unlock()
+	if dir != "" {
+		if err := writeArtFile(dir, rec.hash, rec.data); err != nil {
+			slog.Warn("failed to cache album art on disk", "err", err)
+		}
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	rec.size = len(rec.data)
+	if el, ok := h.items[rec.hash]; ok {
+		if rec.palette == nil {
+			rec.palette = el.Value.(*artRecord).palette
+		}
+		el.Value = &rec
+		h.order.MoveToFront(el)
+	} else {
+		h.items[rec.hash] = h.order.PushFront(&rec)
+	}
+	h.trimLocked()
+}
+
+// trimLocked drops the oldest images beyond the history size, and with a
+// disk cache releases the data of images beyond the memory size.
+func (h *artHistory) trimLocked() {
+	for h.order.Len() > max(h.memory, h.disk) {
+		oldest := h.order.Back()
+		h.order.Remove(oldest)
+		hash := oldest.Value.(*artRecord).hash
+		delete(h.items, hash)
+		if h.dir != "" {
+			if err := os.Remove(filepath.Join(h.dir, hash)); err != nil && !os.IsNotExist(err) {
+				slog.Debug("failed to remove cached album art", "err", err)
+			}
+		}
+	}
+	if h.dir == "" {
+		return
+	}
+	i := 0
+	for el := h.order.Front(); el != nil; el = el.Next() {
+		if i >= h.memory {
+			el.Value.(*artRecord).data = nil
+		}
+		i++
+	}
+}
+
+// get returns the image with the given hash, reading it from disk when it is
+// no longer in memory.
+func (h *artHistory) get(hash string) (artRecord, bool) {
+	h.mu.Lock()
+	el, ok := h.items[hash]
+	var rec artRecord
+	if ok {
+		rec = *el.Value.(*artRecord)
+	}
+	dir := h.dir
+	h.mu.Unlock()
+	if !ok {
+		return artRecord{}, false
+	}
+	if rec.data == nil {
+		if dir == "" {
+			return artRecord{}, false
+		}
+		data, err := os.ReadFile(filepath.Join(dir, hash))
+		if err != nil {
+			slog.Debug("failed to read cached album art", "err", err)
+			return artRecord{}, false
+		}
+		rec.data = data
+	}
+	return rec, true
+}
+
+// setPalette stores the palette computed for an image after it was added.
+func (h *artHistory) setPalette(hash string, p *wsproto.PalettePayload) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if el, ok := h.items[hash]; ok {
+		el.Value.(*artRecord).palette = p
+	}
+}
+
+// entries lists the history, most recently seen first.
+func (h *artHistory) entries() []artRecord {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	out := make([]artRecord, 0, h.order.Len())
+	for el := h.order.Front(); el != nil; el = el.Next() {
+		out = append(out, *el.Value.(*artRecord))
+	}
+	return out
+}
+
+// writeArtFile stores data as dir/hash. An existing file is only touched, so
+// its modification time orders the history after a restart.
+func writeArtFile(dir, hash string, data []byte) error {
+	path := filepath.Join(dir, hash)
+	if _, err := os.Stat(path); err == nil {
+		now := time.Now()
+		return os.Chtimes(path, now, now)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// SetAlbumArtDir enables the on-disk album art cache in dir. It must be
+// called before Run.
+func (s *Server) SetAlbumArtDir(dir string) error {
+	return s.artHistory.setDir(dir, s.cfg.AlbumArt.DiskHistory)
+}
+
+// lookupArt returns the album art named by the request, writing a 404 when
+// it is not in the history. Responses for art with a known source name it in
+// the X-Album-Art-Source header.
+func (s *Server) lookupArt(w http.ResponseWriter, r *http.Request) (artRecord, bool) {
+	rec, ok := s.artHistory.get(r.PathValue("hash"))
+	if !ok || len(rec.data) == 0 {
+		w.WriteHeader(http.StatusNotFound)
+		return artRecord{}, false
+	}
+	if rec.source != "" {
+		w.Header().Set("X-Album-Art-Source", rec.source)
+	}
+	return rec, true
+}
+
+// serveArt writes content-addressed data with a strong ETag and immutable
+// caching. http.ServeContent answers HEAD, If-None-Match and Range requests.
+func serveArt(w http.ResponseWriter, r *http.Request, etag, contentType string, data []byte) {
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("ETag", `"`+etag+`"`)
+	w.Header().Set("Cache-Control", artCacheControl)
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(data))
+}
+
+func (s *Server) handleAlbumArtIndex(w http.ResponseWriter, r *http.Request) {
+	current := s.snapshot().artHash()
+	records := s.artHistory.entries()
+	entries := make([]AlbumArtEntry, 0, len(records))
+	for _, rec := range records {
+		entries = append(entries, AlbumArtEntry{
+			Hash:        rec.hash,
+			URL:         s.albumArtURL(rec.hash),
+			ContentType: rec.contentType,
+			Size:        rec.size,
+			Original:    rec.original,
+			Source:      rec.source,
+			Title:       rec.title,
+			Artist:      rec.artist,
+			AlbumTitle:  rec.albumTitle,
+			SeenAt:      rec.seenAt.UnixMilli(),
+			Current:     rec.hash == current,
+		})
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"albumArt": entries})
+}
@@ -0,0 +1,211 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"smtc-now-playing/internal/domain"
+)
+
+func testArtRecord(data string, seen time.Time) artRecord {
+	sum := sha256.Sum256([]byte(data))
+	return artRecord{hash: hex.EncodeToString(sum[:]), data: []byte(data), seenAt: seen}
+}
+
+func TestHandleAlbumArt_ServesPreviousArt(t *testing.T) {
+	srv, _, _ := newTestServer(t)
+	srv.cfg.AlbumArt.History = 5
+	srv.artHistory = newArtHistory(srv.cfg.AlbumArt.History)
+	handler := srv.setupRoutes()
+
+	srv.handleInfoEvent(domain.InfoData{Artist: "Artist", Title: "First", ThumbnailData: testPNG(t, 8, 8)})
+	first := srv.snapshot().artHash()
+	srv.handleInfoEvent(domain.InfoData{Artist: "Artist", Title: "Second", ThumbnailData: testPNG(t, 16, 8)})
+	second := srv.snapshot().artHash()
+
+	for _, path := range []string{"", "?size=4", "/grayscale", "/palette.css"} {
+		if w := serveLocal(handler, http.MethodGet, srv.albumArtURL(first)+path, ""); w.Code != http.StatusOK {
+			t.Fatalf("previous art %q: got %d want %d", path, w.Code, http.StatusOK)
+		}
+	}
+
+	w := serveLocal(handler, http.MethodGet, "/api/albumArt", "")
+	var body struct {
+		AlbumArt []AlbumArtEntry `json:"albumArt"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode index: %v", err)
+	}
+	if len(body.AlbumArt) != 2 {
+		t.Fatalf("index has %d entries, want 2", len(body.AlbumArt))
+	}
+	newest, oldest := body.AlbumArt[0], body.AlbumArt[1]
+	if newest.Hash != second || !newest.Current || newest.Title != "Second" || newest.URL != srv.albumArtURL(second) {
+		t.Errorf("newest = %+v, want the current art of Second", newest)
+	}
+	if oldest.Hash != first || oldest.Current || oldest.Size == 0 {
+		t.Errorf("oldest = %+v, want the earlier art", oldest)
+	}
+}
+
+func TestHandleAlbumArt_HTTPCaching(t *testing.T) {
+	srv, _, _ := newTestServer(t)
+	art := testPNG(t, 8, 8)
+	srv.handleInfoEvent(domain.InfoData{Artist: "Artist", Title: "Title", ThumbnailData: art})
+	handler := srv.setupRoutes()
+	hash := srv.snapshot().artHash()
+	url := srv.albumArtURL(hash)
+
+	w := serveLocal(handler, http.MethodGet, url, "")
+	if got := w.Header().Get("ETag"); got != `"`+hash+`"` {
+		t.Fatalf("ETag = %q, want the quoted hash", got)
+	}
+	if got := w.Header().Get("Cache-Control"); got != artCacheControl {
+		t.Fatalf("Cache-Control = %q, want %q", got, artCacheControl)
+	}
+
+	serve := func(method string, header http.Header) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, url, nil)
+		req.Header = header
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+	if w := serve(http.MethodGet, http.Header{"If-None-Match": {`"` + hash + `"`}}); w.Code != http.StatusNotModified {
+		t.Fatalf("If-None-Match: got %d want %d", w.Code, http.StatusNotModified)
+	}
+	w = serve(http.MethodGet, http.Header{"Range": {"bytes=0-3"}})
+	if w.Code != http.StatusPartialContent || w.Body.String() != string(art[:4]) {
+		t.Fatalf("Range: got %d with %d bytes", w.Code, w.Body.Len())
+	}
+	w = serve(http.MethodHead, http.Header{})
+	if w.Code != http.StatusOK || w.Body.Len() != 0 || w.Header().Get("Content-Type") != "image/png" {
+		t.Fatalf("HEAD: got %d with %d bytes, %q", w.Code, w.Body.Len(), w.Header().Get("Content-Type"))
+	}
+
+	w = serveLocal(handler, http.MethodGet, url+"?size=4", "")
+	if etag := w.Header().Get("ETag"); etag == "" || etag == `"`+hash+`"` {
+		t.Fatalf("variant ETag = %q, want one distinct from the original", etag)
+	}
+}
+
+func TestArtHistory_EvictsOldest(t *testing.T) {
+	h := newArtHistory(2)
+	now := time.Now()
+	a, b, c := testArtRecord("a", now), testArtRecord("b", now), testArtRecord("c", now)
+	h.add(a)
+	h.add(b)
+	h.add(a) // seen again, so b is now the oldest
+	h.add(c)
+	if _, ok := h.get(b.hash); ok {
+		t.Fatal("b survived although it was least recently seen")
+	}
+	for _, rec := range []artRecord{a, c} {
+		if _, ok := h.get(rec.hash); !ok {
+			t.Fatalf("%s was evicted", rec.data)
+		}
+	}
+}
+
+func TestArtHistory_DiskCache(t *testing.T) {
+	dir := t.TempDir()
+	h := newArtHistory(1)
+	if err := h.setDir(dir, 2); err != nil {
+		t.Fatalf("setDir: %v", err)
+	}
+	now := time.Now()
+	a, b, c := testArtRecord("a", now), testArtRecord("b", now), testArtRecord("c", now)
+	h.add(a)
+	h.add(b)
+
+	got, ok := h.get(a.hash)
+	if !ok || string(got.data) != "a" {
+		t.Fatalf("a = %q, %v; want it read back from disk", got.data, ok)
+	}
+
+	// A new history indexes what is on disk.
+	reopened := newArtHistory(1)
+	if err := os.WriteFile(filepath.Join(dir, "not-art.txt"), []byte("x"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := reopened.setDir(dir, 2); err != nil {
+		t.Fatalf("setDir: %v", err)
+	}
+	if n := len(reopened.entries()); n != 2 {
+		t.Fatalf("reopened history has %d entries, want 2", n)
+	}
+	reopened.add(c)
+	if _, err := os.Stat(filepath.Join(dir, c.hash)); err != nil {
+		t.Fatalf("c not written to disk: %v", err)
+	}
+	if n := len(reopened.entries()); n != 2 {
+		t.Fatalf("history has %d entries after adding c, want 2", n)
+	}
+	files, _ := filepath.Glob(filepath.Join(dir, "*"))
+	if len(files) != 3 { // two images and not-art.txt
+		t.Fatalf("disk has %v, want the evicted image removed", files)
+	}
+}
+
+func TestHandleAlbumArt_Source(t *testing.T) {
+	srv, _, _ := newTestServer(t)
+	handler := srv.setupRoutes()
+
+	srv.handleInfoEvent(domain.InfoData{Artist: "Artist", Title: "Player", ThumbnailData: testPNG(t, 8, 8)})
+	if got := srv.snapshot().info.ThumbnailSource; got != domain.ArtSourcePlayer {
+		t.Fatalf("source = %q, want %q for art without one", got, domain.ArtSourcePlayer)
+	}
+
+	srv.handleInfoEvent(domain.InfoData{
+		Artist: "Artist", Title: "Tile",
+		ThumbnailData: testPNG(t, 16, 16), ThumbnailContentType: "image/png", ThumbnailSource: domain.ArtSourceGenerated,
+	})
+	url := srv.albumArtURL(srv.snapshot().artHash())
+	for _, path := range []string{"", "?size=4", "/blur"} {
+		w := serveLocal(handler, http.MethodGet, url+path, "")
+		if got := w.Header().Get("X-Album-Art-Source"); got != domain.ArtSourceGenerated {
+			t.Errorf("%q: X-Album-Art-Source = %q, want %q", path, got, domain.ArtSourceGenerated)
+		}
+	}
+
+	w := serveLocal(handler, http.MethodGet, "/api/now-playing", "")
+	var body struct {
+		Info struct {
+			AlbumArtSource string `json:"albumArtSource"`
+		} `json:"info"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if body.Info.AlbumArtSource != domain.ArtSourceGenerated {
+		t.Fatalf("albumArtSource = %q, want %q", body.Info.AlbumArtSource, domain.ArtSourceGenerated)
+	}
+
+	srv.handleInfoEvent(domain.InfoData{Artist: "Artist", Title: "No art", ThumbnailSource: domain.ArtSourceApp})
+	if got := srv.snapshot().info.ThumbnailSource; got != "" {
+		t.Fatalf("source = %q without art, want it empty", got)
+	}
+}
+
+func TestHandleAlbumArtIndex_OriginalSize(t *testing.T) {
+	srv, _, _ := newTestServer(t)
+	srv.handleInfoEvent(domain.InfoData{Artist: "Artist", Title: "Title", ThumbnailData: testPNG(t, 8, 8), ThumbnailOriginal: 5 << 20})
+
+	w := serveLocal(srv.setupRoutes(), http.MethodGet, "/api/albumArt", "")
+	var body struct {
+		AlbumArt []AlbumArtEntry `json:"albumArt"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode index: %v", err)
+	}
+	if len(body.AlbumArt) != 1 || body.AlbumArt[0].Original != 5<<20 || body.AlbumArt[0].Size >= 5<<20 {
+		t.Fatalf("index = %+v, want the downscaled art with its original size", body.AlbumArt)
+	}
+}
@@ -0,0 +1,233 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"smtc-now-playing/internal/webp"
+)
+
+// Album art styles served under /albumArt/{hash}/{style}.
+const (
+	artStyleBlur      = "blur"
+	artStyleGrayscale = "grayscale"
+	artStyleSquare    = "square"
+)
+
+// renderArtStyles renders every style of img at its default settings. It runs
+// once per art change, off the event loop, so theme backgrounds do not pay
+// for the effect.
+func renderArtStyles(img image.Image, srcFormat string) map[string]renderedArt {
+	styles := make(map[string]renderedArt, 3)
+	for _, style := range []string{artStyleBlur, artStyleGrayscale, artStyleSquare} {
+		out, format := renderStyle(img, srcFormat, style, defaultBlurRadius)
+		data, ct, err := encodeArt(out, format)
+		if err != nil {
+			slog.Debug("album art style failed", "style", style, "err", err)
+			continue
+		}
+		styles[style] = renderedArt{key: style, data: data, contentType: ct}
+	}
+	return styles
+}
+
+// renderStyle applies style to img and returns the result with the format
+// to encode it in. Square art is always PNG to keep its transparent padding.
+func renderStyle(img image.Image, srcFormat, style string, radius int) (image.Image, string) {
+	switch style {
+	case artStyleBlur:
+		return blurImage(img, radius), srcFormat
+	case artStyleGrayscale:
+		return grayscaleImage(img), srcFormat
+	default:
+		return squareImage(img), "png"
+	}
+}
+
+// encodeArt encodes img as JPEG or lossless WebP when format is "jpeg" or
+// "webp", and as PNG otherwise.
+func encodeArt(img image.Image, format string) ([]byte, string, error) {
+	var buf bytes.Buffer
+	var err error
+	switch format {
+	case "jpeg":
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: artJPEGQuality})
+	case "webp":
+		err = webp.Encode(&buf, img)
+	default:
+		format = "png"
+		err = png.Encode(&buf, img)
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("encode album art: %w", err)
+	}
+	return buf.Bytes(), "image/" + format, nil
+}
+
+// toRGBA returns src as an *image.RGBA anchored at the origin.
+func toRGBA(src image.Image) *image.RGBA {
+	b := src.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(dst, dst.Rect, src, b.Min, draw.Src)
+	return dst
+}
+
+// blurImage approximates a Gaussian blur of the given radius with three box
+// blur passes in each direction. Edge pixels are repeated past the border so
+// the image does not darken towards its edges.
+func blurImage(src image.Image, radius int) *image.RGBA {
+	img := toRGBA(src)
+	box := max(1, (radius+2)/3)
+	tmp := image.NewRGBA(img.Rect)
+	for range 3 {
+		boxBlur(tmp, img, box, true)
+		boxBlur(img, tmp, box, false)
+	}
+	return img
+}
+
+// boxBlur averages each pixel of src with its r neighbours on either side,
+// horizontally or vertically, and writes the result to dst.
+func boxBlur(dst, src *image.RGBA, r int, horizontal bool) {
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+	lines, length := h, w
+	if !horizontal {
+		lines, length = w, h
+	}
+	offset := func(line, i int) int {
+		i = min(max(i, 0), length-1)
+		if horizontal {
+			return src.PixOffset(i, line)
+		}
+		return src.PixOffset(line, i)
+	}
+	n := 2*r + 1
+	for line := 0; line < lines; line++ {
+		var sum [4]int
+		for i := -r; i <= r; i++ {
+			o := offset(line, i)
+			for c := range sum {
+				sum[c] += int(src.Pix[o+c])
+			}
+		}
+		for i := 0; i < length; i++ {
+			o := offset(line, i)
+			for c := range sum {
+				dst.Pix[o+c] = uint8(sum[c] / n)
+			}
+			out, in := offset(line, i-r), offset(line, i+r+1)
+			for c := range sum {
+				sum[c] += int(src.Pix[in+c]) - int(src.Pix[out+c])
+			}
+		}
+	}
+}
+
+// grayscaleImage converts src to grey using the same luma weights as
+// color.GrayModel, keeping alpha.
+func grayscaleImage(src image.Image) *image.RGBA {
+	img := toRGBA(src)
+	for i := 0; i < len(img.Pix); i += 4 {
+		r, g, b := uint32(img.Pix[i]), uint32(img.Pix[i+1]), uint32(img.Pix[i+2])
+		y := uint8((19595*r + 38470*g + 7471*b + 1<<15) >> 16)
+		img.Pix[i], img.Pix[i+1], img.Pix[i+2] = y, y, y
+	}
+	return img
+}
+
+// squareImage pads src with transparency to a square, centring the image.
+func squareImage(src image.Image) *image.RGBA {
+	b := src.Bounds()
+	side := max(b.Dx(), b.Dy())
+	dst := image.NewRGBA(image.Rect(0, 0, side, side))
+	at := image.Pt((side-b.Dx())/2, (side-b.Dy())/2)
+	draw.Draw(dst, b.Sub(b.Min).Add(at), src, b.Min, draw.Src)
+	return dst
+}
+
+// parseBlurRadius reads the radius query parameter, defaulting to
+// defaultBlurRadius.
+func parseBlurRadius(raw string) (int, error) {
+	if raw == "" {
+		return defaultBlurRadius, nil
+	}
+	radius, err := strconv.Atoi(raw)
+	if err != nil || radius < 1 || radius > maxBlurRadius {
+		return 0, fmt.Errorf("%w: radius must be between 1 and %d", ErrInvalidArtVariant, maxBlurRadius)
+	}
+	return radius, nil
+}
+
+// handleArtStyle serves a style of the album art. The current art's styles
+// at default settings are pre-rendered in the background, and requests that
+// arrive first wait for them; other art and blur radii are rendered on
+// request and kept in the variant cache.
+func (s *Server) handleArtStyle(style string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		rec, ok := s.lookupArt(w, r)
+		if !ok {
+			return
+		}
+		radius := 0
+		if style == artStyleBlur {
+			var err error
+			if radius, err = parseBlurRadius(r.URL.Query().Get("radius")); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		key := artStyleKey(rec.hash, style, radius)
+		state := s.snapshot()
+		var art renderedArt
+		if rec.hash == state.artHash() && (style != artStyleBlur || radius == defaultBlurRadius) {
+			select {
+			case <-state.art.derived:
+			case <-r.Context().Done():
+				return
+			}
+			art, ok = state.art.styles[style]
+		} else {
+			art, ok = s.styledArt(key, rec.data, style, radius)
+		}
+		if !ok {
+			http.Error(w, "album art cannot be converted", http.StatusUnsupportedMediaType)
+			return
+		}
+		serveArt(w, r, key, art.contentType, art.data)
+	}
+}
+
+// artStyleKey identifies a style of an image in the variant cache. radius is
+// 0 for styles without one.
+func artStyleKey(hash, style string, radius int) string {
+	return fmt.Sprintf("%s/%s/%d", hash, style, radius)
+}
+
+// styledArt returns data rendered in style, rendering it into the variant
+// cache on first use.
+func (s *Server) styledArt(key string, data []byte, style string, radius int) (renderedArt, bool) {
+	if art, ok := s.artCache.get(key); ok {
+		return art, true
+	}
+	img, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		slog.Debug("album art style failed", "style", style, "err", err)
+		return renderedArt{}, false
+	}
+	out, format := renderStyle(img, format, style, radius)
+	encoded, ct, err := encodeArt(out, format)
+	if err != nil {
+		slog.Debug("album art style failed", "style", style, "err", err)
+		return renderedArt{}, false
+	}
+	art := renderedArt{key: key, data: encoded, contentType: ct}
+	s.artCache.put(art)
+	return art, true
+}
@@ -0,0 +1,99 @@
+package server
+
+import (
+	"image"
+	"image/color"
+	"image/png"
+	"net/http"
+	"testing"
+
+	"smtc-now-playing/internal/domain"
+)
+
+func TestBlurImage(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 40, 10))
+	for y := 0; y < 10; y++ {
+		for x := 0; x < 40; x++ {
+			if x < 20 {
+				src.SetRGBA(x, y, color.RGBA{R: 255, A: 255})
+			} else {
+				src.SetRGBA(x, y, color.RGBA{B: 255, A: 255})
+			}
+		}
+	}
+	img := blurImage(src, 6)
+	if c := img.RGBAAt(0, 5); c != (color.RGBA{R: 255, A: 255}) {
+		t.Errorf("edge = %v, want red kept at the border", c)
+	}
+	if c := img.RGBAAt(20, 5); c.R == 0 || c.B == 0 {
+		t.Errorf("seam = %v, want red and blue mixed", c)
+	}
+}
+
+func TestGrayscaleAndSquareImage(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 4, 2))
+	for i := range src.Pix {
+		src.Pix[i] = 255
+	}
+	src.SetRGBA(0, 0, color.RGBA{R: 255, A: 128})
+
+	gray := grayscaleImage(src)
+	if c := gray.RGBAAt(0, 0); c.R != c.G || c.G != c.B || c.A != 128 {
+		t.Errorf("grayscale pixel = %v, want grey with alpha kept", c)
+	}
+
+	sq := squareImage(src)
+	if sq.Rect.Size() != image.Pt(4, 4) {
+		t.Fatalf("square size = %v, want 4x4", sq.Rect.Size())
+	}
+	if sq.RGBAAt(0, 0).A != 0 || sq.RGBAAt(3, 1) != (color.RGBA{R: 255, G: 255, B: 255, A: 255}) {
+		t.Errorf("square = top %v, centre %v; want transparent padding around the image", sq.RGBAAt(0, 0), sq.RGBAAt(3, 1))
+	}
+}
+
+func TestHandleArtStyle(t *testing.T) {
+	srv, _, _ := newTestServer(t)
+	srv.handleInfoEvent(domain.InfoData{Artist: "Artist", Title: "Title", ThumbnailData: testPNG(t, 40, 20)})
+	handler := srv.setupRoutes()
+	base := srv.albumArtURL(srv.snapshot().artHash())
+
+	if styles := waitArtDerived(t, srv).art.styles; len(styles) != 3 {
+		t.Fatalf("styles rendered = %d, want 3", len(styles))
+	}
+	for _, style := range []string{artStyleBlur, artStyleGrayscale, artStyleSquare} {
+		w := serveLocal(handler, http.MethodGet, base+"/"+style, "")
+		if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "image/png" {
+			t.Fatalf("%s: got %d %q", style, w.Code, w.Header().Get("Content-Type"))
+		}
+		img, err := png.Decode(w.Body)
+		if err != nil {
+			t.Fatalf("%s: decode: %v", style, err)
+		}
+		want := image.Pt(40, 20)
+		if style == artStyleSquare {
+			want = image.Pt(40, 40)
+		}
+		if size := img.Bounds().Size(); size != want {
+			t.Fatalf("%s: size = %v, want %v", style, size, want)
+		}
+	}
+
+	if w := serveLocal(handler, http.MethodGet, base+"/blur?radius=4", ""); w.Code != http.StatusOK {
+		t.Fatalf("custom radius: got %d", w.Code)
+	}
+	if _, ok := srv.artCache.get(srv.snapshot().artHash() + "/blur/4"); !ok {
+		t.Fatal("custom radius blur was not cached")
+	}
+	if w := serveLocal(handler, http.MethodGet, base+"/blur?radius=0", ""); w.Code != http.StatusBadRequest {
+		t.Fatalf("bad radius: got %d want %d", w.Code, http.StatusBadRequest)
+	}
+	if w := serveLocal(handler, http.MethodGet, "/albumArt/deadbeef/grayscale", ""); w.Code != http.StatusNotFound {
+		t.Fatalf("unknown hash: got %d want %d", w.Code, http.StatusNotFound)
+	}
+
+	srv.handleInfoEvent(domain.InfoData{Artist: "Artist", Title: "Broken", ThumbnailData: []byte{0x01, 0x02}})
+	base = srv.albumArtURL(srv.snapshot().artHash())
+	if w := serveLocal(handler, http.MethodGet, base+"/square", ""); w.Code != http.StatusUnsupportedMediaType {
+		t.Fatalf("undecodable art: got %d want %d", w.Code, http.StatusUnsupportedMediaType)
+	}
+}
@@ -0,0 +1,294 @@
+package server
+
+import (
+	"cmp"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/width"
+
+	"smtc-now-playing/internal/wsproto"
+)
+
+// badgeStyle is the geometry of a badge style preset.
+type badgeStyle struct {
+	height   int
+	radius   int
+	fontSize float64
+	bold     bool
+	upper    bool    // upper-case the text
+	spacing  float64 // letter spacing in pixels
+	padding  int     // around the text
+	icon     float64 // size of the status icon
+}
+
+// badgeStyles are the style presets, named after the shields.io styles they
+// resemble.
+var badgeStyles = map[string]badgeStyle{
+	"flat":          {height: 20, radius: 3, fontSize: 11, padding: 6, icon: 8},
+	"flat-square":   {height: 20, fontSize: 11, padding: 6, icon: 8},
+	"for-the-badge": {height: 28, fontSize: 10, bold: true, upper: true, spacing: 1, padding: 9, icon: 10},
+}
+
+// badgeStatusColors are the default message colours of each presence state.
+var badgeStatusColors = map[wsproto.PresenceState]string{
+	wsproto.PresenceActive: "#1db954",
+	wsproto.PresencePaused: "#dfb317",
+	wsproto.PresenceIdle:   "#9f9f9f",
+	wsproto.PresenceClosed: "#9f9f9f",
+}
+
+// badgeRequest is a badge as asked for by query parameters. Empty colours
+// use the style's defaults.
+type badgeRequest struct {
+	style      string
+	art        bool
+	maxLength  int // of the title and the artist each, in columns
+	color      string
+	labelColor string
+	textColor  string
+}
+
+// parseBadgeRequest reads style, art, maxLength and the colours from query.
+func parseBadgeRequest(query url.Values) (badgeRequest, error) {
+	req := badgeRequest{style: strings.ToLower(query.Get("style")), art: true, maxLength: defaultBadgeLength}
+	if req.style == "" {
+		req.style = "flat"
+	}
+	if _, ok := badgeStyles[req.style]; !ok {
+		return badgeRequest{}, errors.New("style must be flat, flat-square or for-the-badge")
+	}
+	if raw := query.Get("art"); raw != "" {
+		art, err := strconv.ParseBool(raw)
+		if err != nil {
+			return badgeRequest{}, errors.New("art must be true or false")
+		}
+		req.art = art
+	}
+	if raw := query.Get("maxLength"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < minBadgeLength || n > maxBadgeLength {
+			return badgeRequest{}, fmt.Errorf("maxLength must be between %d and %d", minBadgeLength, maxBadgeLength)
+		}
+		req.maxLength = n
+	}
+	for _, c := range []struct {
+		key string
+		dst *string
+	}{{"color", &req.color}, {"labelColor", &req.labelColor}, {"textColor", &req.textColor}} {
+		raw := query.Get(c.key)
+		if raw == "" {
+			continue
+		}
+		color, ok := parseBadgeColor(raw)
+		if !ok {
+			return badgeRequest{}, fmt.Errorf("%s must be a hex colour or a colour name", c.key)
+		}
+		*c.dst = color
+	}
+	return req, nil
+}
+
+// parseBadgeColor accepts a hex colour of 3 or 6 digits, with or without
+// '#', or a CSS colour name. Anything else could break out of the attribute
+// it is written to, so it is refused.
+func parseBadgeColor(s string) (string, bool) {
+	hex := strings.TrimPrefix(s, "#")
+	if (len(hex) == 3 || len(hex) == 6) && strings.Trim(strings.ToLower(hex), "0123456789abcdef") == "" {
+		return "#" + strings.ToLower(hex), true
+	}
+	if len(s) > 20 || strings.TrimFunc(s, func(r rune) bool { return r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' }) != "" {
+		return "", false
+	}
+	return strings.ToLower(s), true
+}
+
+// handleBadge serves a compact SVG badge of what is playing, for pages that
+// only accept images. Badges are rendered once per track, album art, presence
+// state and parameters.
+func (s *Server) handleBadge(w http.ResponseWriter, r *http.Request) {
+	req, err := parseBadgeRequest(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	state := s.snapshot()
+	presence := s.Presence().State
+	key := badgeKey(state, presence, req)
+	badge, ok := s.badgeCache.get(key)
+	if !ok {
+		badge = renderedArt{key: key, data: []byte(s.renderBadge(state, presence, req)), contentType: "image/svg+xml; charset=utf-8"}
+		s.badgeCache.put(badge)
+	}
+	// The badge embeds nothing but its own data: URI art; keep it that way
+	// when it is opened directly rather than through an <img>.
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; img-src data:")
+	serveRendered(w, r, badge)
+}
+
+// badgeKey identifies a rendered badge by everything renderBadge reads. It
+// leaves out the state revision, which every progress tick bumps.
+func badgeKey(state *stateSnapshot, presence wsproto.PresenceState, req badgeRequest) string {
+	var title, artist string
+	if state.info != nil {
+		title, artist = state.info.Title, state.info.Artist
+	}
+	return fmt.Sprintf("%q/%q/%s/%s/%+v", title, artist, state.artHash(), presence, req)
+}
+
+// renderBadge draws the badge: a label with the album art and a status
+// icon, then the title and artist.
+func (s *Server) renderBadge(state *stateSnapshot, presence wsproto.PresenceState, req badgeRequest) string {
+	st := badgeStyles[req.style]
+	h := st.height
+	label := cmp.Or(req.labelColor, "#555")
+	message := cmp.Or(req.color, badgeStatusColors[presence], "#9f9f9f")
+	textColor := cmp.Or(req.textColor, "#fff")
+
+	title, full := "Not playing", "Not playing"
+	if info := state.info; info != nil && presence != wsproto.PresenceClosed && (info.Title != "" || info.Artist != "") {
+		title = truncateColumns(info.Title, req.maxLength)
+		full = info.Title
+		if info.Artist != "" {
+			title += " — " + truncateColumns(info.Artist, req.maxLength)
+			full += " — " + info.Artist
+		}
+	}
+	if st.upper {
+		title = strings.ToUpper(title)
+	}
+
+	var art string
+	if req.art {
+		// Twice the badge height so the art stays sharp on high-DPI screens.
+		if img := s.badgeArt.get(state.art, 2*h, 2*h); img != nil {
+			format := "png"
+			if img.Opaque() {
+				format = "jpeg"
+			}
+			if data, ct, err := encodeArt(img, format); err == nil {
+				art = "data:" + ct + ";base64," + base64.StdEncoding.EncodeToString(data)
+			} else {
+				slog.Debug("badge art cannot be encoded", "err", err)
+			}
+		}
+	}
+	artW := 0
+	if art != "" {
+		artW = h
+	}
+	iconW := int(st.icon) + 2*st.padding
+	labelW := artW + iconW
+	textW := textWidth(title, st)
+	width := labelW + textW + 2*st.padding
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" xmlns:xlink="http://www.w3.org/1999/xlink" width="%d" height="%d" role="img" aria-label="%s">`, width, h, escapeXML(full))
+	fmt.Fprintf(&b, `<title>%s</title>`, escapeXML(full))
+	fmt.Fprintf(&b, `<clipPath id="r"><rect width="%d" height="%d" rx="%d" fill="#fff"/></clipPath>`, width, h, st.radius)
+	b.WriteString(`<g clip-path="url(#r)">`)
+	fmt.Fprintf(&b, `<rect width="%d" height="%d" fill="%s"/>`, labelW, h, label)
+	fmt.Fprintf(&b, `<rect x="%d" width="%d" height="%d" fill="%s"/>`, labelW, width-labelW, h, message)
+	if art != "" {
+		fmt.Fprintf(&b, `<image width="%d" height="%d" preserveAspectRatio="xMidYMid slice" xlink:href="%s"/>`, h, h, art)
+	}
+	b.WriteString(`</g>`)
+	writeBadgeIcon(&b, presence, float64(artW+iconW/2), float64(h)/2, st.icon, textColor)
+
+	weight := ""
+	if st.bold {
+		weight = ` font-weight="bold"`
+	}
+	fmt.Fprintf(&b, `<text x="%d" y="%s" fill="%s" font-family="Verdana,Geneva,DejaVu Sans,sans-serif" font-size="%s"%s letter-spacing="%s" textLength="%d" lengthAdjust="spacingAndGlyphs">%s</text>`,
+		labelW+st.padding, formatFloat(float64(h)/2+st.fontSize*0.35), textColor, formatFloat(st.fontSize), weight, formatFloat(st.spacing), textW, escapeXML(title))
+	b.WriteString(`</svg>`)
+	return b.String()
+}
+
+// writeBadgeIcon draws the status icon of presence, size across, centred
+// on cx, cy: play while active, pause while paused and stop otherwise.
+func writeBadgeIcon(b *strings.Builder, presence wsproto.PresenceState, cx, cy, size float64, fill string) {
+	x0, y0, x1, y1 := cx-size/2, cy-size/2, cx+size/2, cy+size/2
+	f := formatFloat
+	switch presence {
+	case wsproto.PresenceActive:
+		fmt.Fprintf(b, `<path d="M%s %sL%s %sL%s %sZ" fill="%s"/>`, f(x0+size/8), f(y0), f(x1), f(cy), f(x0+size/8), f(y1), fill)
+	case wsproto.PresencePaused:
+		bar := size * 3 / 8
+		fmt.Fprintf(b, `<path d="M%s %sh%sv%sh-%sZM%s %sh%sv%sh-%sZ" fill="%s"/>`,
+			f(x0), f(y0), f(bar), f(size), f(bar), f(x1-bar), f(y0), f(bar), f(size), f(bar), fill)
+	default:
+		fmt.Fprintf(b, `<rect x="%s" y="%s" width="%s" height="%s" fill="%s"/>`, f(x0+size/8), f(y0+size/8), f(size*3/4), f(size*3/4), fill)
+	}
+}
+
+// escapeXML escapes s for text and attribute values. Characters XML does
+// not allow at all, such as most control characters, become U+FFFD.
+func escapeXML(s string) string {
+	var b strings.Builder
+	_ = xml.EscapeText(&b, []byte(s)) // writes to a strings.Builder do not fail
+	return b.String()
+}
+
+// runeColumns is how many columns r takes: 2 for East Asian wide
+// characters, 0 for combining marks and format characters, 1 otherwise.
+func runeColumns(r rune) int {
+	switch {
+	case unicode.In(r, unicode.Mn, unicode.Me, unicode.Cf):
+		return 0
+	case width.LookupRune(r).Kind() == width.EastAsianWide || width.LookupRune(r).Kind() == width.EastAsianFullwidth:
+		return 2
+	}
+	return 1
+}
+
+// truncateColumns shortens s to at most n columns, ending it with "…" when
+// anything was cut. Combining marks stay with the character before them.
+func truncateColumns(s string, n int) string {
+	cols := 0
+	for _, r := range s {
+		cols += runeColumns(r)
+	}
+	if cols <= n {
+		return s
+	}
+	cols = 0
+	for i, r := range s {
+		c := runeColumns(r)
+		if c > 0 && cols+c > n-1 {
+			return strings.TrimRightFunc(s[:i], unicode.IsSpace) + "…"
+		}
+		cols += c
+	}
+	return s
+}
+
+// textWidth estimates the rendered width of s in pixels. Badge text is set
+// with textLength, so viewers stretch or squeeze it to exactly this width
+// whatever font they substitute.
+func textWidth(s string, st badgeStyle) int {
+	em := 0.62
+	if st.bold || st.upper {
+		em = 0.75
+	}
+	w := 0.0
+	for _, r := range s {
+		switch runeColumns(r) {
+		case 1:
+			w += st.fontSize*em + st.spacing
+		case 2:
+			w += st.fontSize + st.spacing
+		}
+	}
+	return int(w + 0.5)
+}
+
+func formatFloat(f float64) string { return strconv.FormatFloat(f, 'f', -1, 64) }
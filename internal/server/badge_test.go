@@ -0,0 +1,152 @@
+package server
+
+import (
+	"encoding/xml"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"smtc-now-playing/internal/domain"
+	"smtc-now-playing/internal/smtc"
+)
+
+func TestParseBadgeRequest(t *testing.T) {
+	tests := []struct {
+		query   string
+		want    badgeRequest
+		wantErr bool
+	}{
+		{"", badgeRequest{style: "flat", art: true, maxLength: defaultBadgeLength}, false},
+		{"style=For-The-Badge&art=false&maxLength=10", badgeRequest{style: "for-the-badge", maxLength: 10}, false},
+		{"color=%23ABC&labelColor=222222&textColor=Black", badgeRequest{style: "flat", art: true, maxLength: defaultBadgeLength, color: "#abc", labelColor: "#222222", textColor: "black"}, false},
+		{"style=plastic", badgeRequest{}, true},
+		{"art=maybe", badgeRequest{}, true},
+		{"maxLength=2", badgeRequest{}, true},
+		{"color=%22%2F%3E%3Cscript%3E", badgeRequest{}, true},
+		{"color=12345", badgeRequest{}, true},
+		{"textColor=rgb(0,0,0)", badgeRequest{}, true},
+	}
+	for _, tt := range tests {
+		query, _ := url.ParseQuery(tt.query)
+		got, err := parseBadgeRequest(query)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("parseBadgeRequest(%q) = %+v, %v; want %+v, error %v", tt.query, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestTruncateColumns(t *testing.T) {
+	tests := []struct {
+		in   string
+		n    int
+		want string
+	}{
+		{"Short", 10, "Short"},
+		{"Exactly ten", 11, "Exactly ten"},
+		{"A much longer title", 8, "A much…"},
+		{"日本語のタイトル", 8, "日本語…"},
+		{"Cafe\u0301 society", 5, "Cafe\u0301…"},
+	}
+	for _, tt := range tests {
+		if got := truncateColumns(tt.in, tt.n); got != tt.want {
+			t.Errorf("truncateColumns(%q, %d) = %q, want %q", tt.in, tt.n, got, tt.want)
+		}
+	}
+}
+
+// decodeSVG checks that body is well-formed XML and returns its text.
+func decodeSVG(t *testing.T, body io.Reader) string {
+	t.Helper()
+	var text strings.Builder
+	dec := xml.NewDecoder(body)
+	for {
+		tok, err := dec.Token()
+		if errors.Is(err, io.EOF) {
+			return text.String()
+		}
+		if err != nil {
+			t.Fatalf("badge is not well-formed XML: %v", err)
+		}
+		if data, ok := tok.(xml.CharData); ok {
+			text.Write(data)
+		}
+	}
+}
+
+func TestHandleBadge(t *testing.T) {
+	srv, _, _ := newTestServer(t)
+	handler := srv.setupRoutes()
+
+	w := serveLocal(handler, http.MethodGet, "/badge.svg", "")
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "image/svg+xml; charset=utf-8" {
+		t.Fatalf("nothing playing: got %d %q", w.Code, w.Header().Get("Content-Type"))
+	}
+	if text := decodeSVG(t, w.Body); !strings.Contains(text, "Not playing") {
+		t.Fatalf("nothing playing badge text = %q", text)
+	}
+
+	title := `<b>"Tom & Jerry's"</b> 日本語` + "\x01‮"
+	srv.handleInfoEvent(domain.InfoData{Artist: "Artist", Title: title, ThumbnailData: testPNG(t, 64, 64)})
+	srv.handleProgressEvent(domain.ProgressData{Position: 30, Duration: 240, Status: smtc.StatusPlaying})
+
+	w = serveLocal(handler, http.MethodGet, "/badge.svg?maxLength=200", "")
+	body := w.Body.String()
+	if !strings.Contains(body, "data:image/jpeg;base64,") {
+		t.Fatal("badge does not embed the album art")
+	}
+	if strings.Contains(body, "<b>") {
+		t.Fatal("title markup was not escaped")
+	}
+	if w.Header().Get("Content-Security-Policy") == "" {
+		t.Fatal("badge has no Content-Security-Policy")
+	}
+	want := strings.ReplaceAll(title, "\x01", "�") + " — Artist"
+	if text := decodeSVG(t, strings.NewReader(body)); !strings.Contains(text, want) {
+		t.Fatalf("badge text = %q, want it to contain %q", text, want)
+	}
+
+	w = serveLocal(handler, http.MethodGet, "/badge.svg?art=false&color=ff0000", "")
+	if body := w.Body.String(); strings.Contains(body, "base64") || !strings.Contains(body, `fill="#ff0000"`) {
+		t.Fatalf("art=false&color=ff0000 badge = %s", body)
+	}
+	if w := serveLocal(handler, http.MethodGet, "/badge.svg?style=plastic", ""); w.Code != http.StatusBadRequest {
+		t.Fatalf("bad style: got %d want %d", w.Code, http.StatusBadRequest)
+	}
+}
+
+func TestHandleBadge_FollowsPresence(t *testing.T) {
+	srv, _, _ := newTestServer(t)
+	srv.handleInfoEvent(domain.InfoData{Artist: "Artist", Title: "Title"})
+	srv.handleProgressEvent(domain.ProgressData{Position: 30, Duration: 240, Status: smtc.StatusPlaying})
+	handler := srv.setupRoutes()
+
+	playing := serveLocal(handler, http.MethodGet, "/badge.svg", "")
+	if !strings.Contains(playing.Body.String(), badgeStatusColors["active"]) {
+		t.Fatal("playing badge is not in the active colour")
+	}
+	srv.handleProgressEvent(domain.ProgressData{Position: 30, Duration: 240, Status: smtc.StatusPaused})
+	paused := serveLocal(handler, http.MethodGet, "/badge.svg", "")
+	if paused.Header().Get("ETag") == playing.Header().Get("ETag") || !strings.Contains(paused.Body.String(), badgeStatusColors["paused"]) {
+		t.Fatal("badge did not change when playback paused")
+	}
+}
+
+func TestHandleBadge_CachedAcrossProgress(t *testing.T) {
+	srv, _, _ := newTestServer(t)
+	srv.handleInfoEvent(domain.InfoData{Artist: "Artist", Title: "Title"})
+	srv.handleProgressEvent(domain.ProgressData{Position: 30, Duration: 240, Status: smtc.StatusPlaying})
+	handler := srv.setupRoutes()
+
+	first := serveLocal(handler, http.MethodGet, "/badge.svg", "")
+	srv.handleProgressEvent(domain.ProgressData{Position: 31, Duration: 240, Status: smtc.StatusPlaying})
+	second := serveLocal(handler, http.MethodGet, "/badge.svg", "")
+	if second.Header().Get("ETag") != first.Header().Get("ETag") {
+		t.Fatal("badge changed with the playback position")
+	}
+	if n := len(srv.badgeCache.items); n != 1 {
+		t.Fatalf("badge cache holds %d badges after a progress update, want 1", n)
+	}
+}
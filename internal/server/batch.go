@@ -0,0 +1,264 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lxzan/gws"
+
+	"smtc-now-playing/internal/smtc"
+	"smtc-now-playing/internal/wsproto"
+)
+
+// Sentinel errors for batches and macros.
+var (
+	ErrInvalidBatch  = errors.New("server: invalid batch")
+	ErrMacroNotFound = errors.New("server: macro not found")
+)
+
+// errStepConditionNeedsDisplayedSession rejects capability conditions and
+// waits for other sessions: both observe the server's state, which only
+// tracks the displayed session.
+var errStepConditionNeedsDisplayedSession = errors.New("ifCapability and wait are only supported for the displayed session")
+
+// batchStatuses maps the status names of IfStatus to SMTC playback statuses.
+var batchStatuses = map[string]int{
+	"playing": smtc.StatusPlaying,
+	"paused":  smtc.StatusPaused,
+	"stopped": smtc.StatusStopped,
+}
+
+// sessionLocks serializes batches per session, so two macros sent to the
+// same player do not interleave their steps.
+type sessionLocks struct {
+	mu    sync.Mutex
+	locks map[string]*sync.Mutex
+}
+
+// lock acquires the lock of the session key and returns its release.
+func (l *sessionLocks) lock(key string) func() {
+	l.mu.Lock()
+	if l.locks == nil {
+		l.locks = make(map[string]*sync.Mutex)
+	}
+	m, ok := l.locks[key]
+	if !ok {
+		m = &sync.Mutex{}
+		l.locks[key] = m
+	}
+	l.mu.Unlock()
+	m.Lock()
+	return m.Unlock
+}
+
+// resolveBatch returns the steps of req, looking a macro up in the config,
+// and validates them for target.
+func (s *Server) resolveBatch(req wsproto.BatchPayload, target controlTarget) ([]wsproto.BatchStep, error) {
+	steps := req.Steps
+	switch {
+	case req.Macro != "" && len(steps) > 0:
+		return nil, fmt.Errorf("%w: give steps or a macro, not both", ErrInvalidBatch)
+	case req.Macro != "":
+		macro, ok := s.cfg.Macros[req.Macro]
+		if !ok {
+			return nil, fmt.Errorf("%w: %q", ErrMacroNotFound, req.Macro)
+		}
+		steps = make([]wsproto.BatchStep, len(macro))
+		for i, step := range macro {
+			steps[i] = wsproto.BatchStep(step)
+		}
+	case len(steps) == 0:
+		return nil, fmt.Errorf("%w: steps or a macro is required", ErrInvalidBatch)
+	}
+	if len(steps) > maxBatchSteps {
+		return nil, fmt.Errorf("%w: at most %d steps are allowed", ErrInvalidBatch, maxBatchSteps)
+	}
+
+	var total time.Duration
+	for i, step := range steps {
+		if !isControlAction(step.Action) {
+			return nil, fmt.Errorf("%w: step %d: unknown action %q", ErrInvalidBatch, i+1, step.Action)
+		}
+		// Bad args would otherwise surface only after the steps before them ran.
+		if _, err := decodeControlArgs(step.Action, step.Args); err != nil {
+			return nil, fmt.Errorf("%w: step %d: %w", ErrInvalidBatch, i+1, err)
+		}
+		if step.Delay < 0 || step.Timeout < 0 {
+			return nil, fmt.Errorf("%w: step %d: delay and timeout must not be negative", ErrInvalidBatch, i+1)
+		}
+		if step.IfCapability != "" {
+			if _, ok := s.capabilitiesToMap()[step.IfCapability]; !ok {
+				return nil, fmt.Errorf("%w: step %d: unknown capability %q", ErrInvalidBatch, i+1, step.IfCapability)
+			}
+		}
+		if step.IfStatus != "" {
+			if _, ok := batchStatuses[strings.TrimPrefix(step.IfStatus, "!")]; !ok {
+				return nil, fmt.Errorf("%w: step %d: unknown status %q", ErrInvalidBatch, i+1, step.IfStatus)
+			}
+		}
+		if target.appID != "" && (step.Wait || step.IfCapability != "") {
+			return nil, fmt.Errorf("%w: step %d: %w", ErrInvalidBatch, i+1, errStepConditionNeedsDisplayedSession)
+		}
+		total += time.Duration(step.Delay) * time.Millisecond
+		if step.Wait {
+			total += newControlWait(true, step.Timeout).timeout
+		}
+	}
+	if total > maxBatchDuration {
+		return nil, fmt.Errorf("%w: delays and waits add up to more than %s", ErrInvalidBatch, maxBatchDuration)
+	}
+	return steps, nil
+}
+
+// RunBatch runs the steps of req in order against its session and reports
+// each step. The first failing step stops the batch; the steps after it are
+// reported as skipped. An error is returned only when req itself is invalid.
+func (s *Server) RunBatch(ctx context.Context, req wsproto.BatchPayload) ([]wsproto.StepResult, error) {
+	target := s.targetFor(req.Session)
+	steps, err := s.resolveBatch(req, target)
+	if err != nil {
+		return nil, err
+	}
+
+	key := target.appID
+	if key == "" {
+		key = s.snapshot().activeAppID
+	}
+	unlock := s.batchLocks.lock(key)
+	defer unlock()
+
+	results := make([]wsproto.StepResult, len(steps))
+	failed := false
+	for i, step := range steps {
+		results[i].Action = step.Action
+		if failed {
+			results[i].Skipped = true
+			continue
+		}
+		err := s.runBatchStep(ctx, target, step, &results[i])
+		if err != nil {
+			results[i].Error = err.Error()
+			results[i].Code, _ = s.controlErrorCode(target, err)
+			failed = true
+		}
+	}
+	if failed {
+		slog.Debug("batch stopped at failed step", "macro", req.Macro, "session", target.appID)
+	}
+	return results, nil
+}
+
+// runBatchStep runs one step, filling in res. Unmet conditions mark the step
+// skipped without an error.
+func (s *Server) runBatchStep(ctx context.Context, target controlTarget, step wsproto.BatchStep, res *wsproto.StepResult) error {
+	if step.Delay > 0 {
+		t := time.NewTimer(time.Duration(step.Delay) * time.Millisecond)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+	ok, err := s.stepCondition(target, step)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		res.Skipped = true
+		return nil
+	}
+
+	prev := s.snapshot()
+	goal, err := s.executeWSControl(target, step.Action, step.Args)
+	if err != nil {
+		return err
+	}
+	if step.Wait {
+		res.TimedOut = s.awaitControl(ctx, step.Action, prev, goal, newControlWait(true, step.Timeout)).timedOut
+	}
+	res.Success = true
+	return nil
+}
+
+// stepCondition reports whether the conditions of step hold for target.
+func (s *Server) stepCondition(target controlTarget, step wsproto.BatchStep) (bool, error) {
+	if step.IfCapability != "" && !s.capabilitiesToMap()[step.IfCapability] {
+		return false, nil
+	}
+	if step.IfStatus == "" {
+		return true, nil
+	}
+	name, negate := strings.CutPrefix(step.IfStatus, "!")
+	status := smtc.StatusClosed
+	if target.appID != "" {
+		progress, err := s.svc.SessionProgress(target.appID)
+		if err != nil {
+			return false, err
+		}
+		status = progress.Status
+	} else if progress := s.snapshot().progress; progress != nil {
+		status = progress.Status
+	}
+	return (status == batchStatuses[name]) != negate, nil
+}
+
+// batchSucceeded reports whether no step of a batch failed.
+func batchSucceeded(results []wsproto.StepResult) bool {
+	for _, r := range results {
+		if r.Error != "" {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *Server) handleWSBatch(conn *gws.Conn, id string, req wsproto.BatchPayload) {
+	results, err := s.RunBatch(context.Background(), req)
+	payload := wsproto.AckPayload{Success: err == nil && batchSucceeded(results), Steps: results}
+	if err != nil {
+		payload.Error = err.Error()
+		payload.Code, _ = s.controlErrorCode(controlTarget{}, err)
+	}
+	msg, err := json.Marshal(wsproto.NewAckPayload(id, payload))
+	if err != nil {
+		slog.Warn("failed to marshal websocket ack", "err", err)
+		return
+	}
+	if err := conn.WriteMessage(gws.OpcodeText, msg); err != nil {
+		slog.Debug("failed to write websocket ack", "err", err)
+	}
+}
+
+func (s *Server) handleBatch(w http.ResponseWriter, r *http.Request) {
+	var req wsproto.BatchPayload
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.writeControlError(w, controlTarget{}, errInvalidBody)
+		return
+	}
+	if appID := r.PathValue("appId"); appID != "" {
+		req.Session = appID
+	}
+	results, err := s.RunBatch(r.Context(), req)
+	if err != nil {
+		s.writeControlError(w, controlTarget{}, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"success": batchSucceeded(results), "steps": results})
+}
+
+func (s *Server) handleMacros(w http.ResponseWriter, r *http.Request) {
+	macros := s.cfg.Macros
+	if macros == nil {
+		writeJSON(w, http.StatusOK, map[string]any{})
+		return
+	}
+	writeJSON(w, http.StatusOK, macros)
+}
@@ -0,0 +1,206 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/lxzan/gws"
+
+	"smtc-now-playing/internal/config"
+	"smtc-now-playing/internal/domain"
+	"smtc-now-playing/internal/smtc"
+	"smtc-now-playing/internal/wsproto"
+)
+
+func TestResolveBatch(t *testing.T) {
+	srv, _, _ := newTestServer(t)
+	srv.cfg.Macros = map[string][]config.MacroStep{
+		"restart": {{Action: "previous", Wait: true}, {Action: "seek", Args: json.RawMessage(`{"position":0}`)}},
+		"broken":  {{Action: "pause"}, {Action: "next"}, {Action: "seek", Args: json.RawMessage(`{"position":0,"percent":50}`)}},
+	}
+	displayed := srv.targetFor("")
+	other := srv.targetFor("Spotify.exe")
+
+	tests := []struct {
+		name    string
+		req     wsproto.BatchPayload
+		target  controlTarget
+		wantErr error
+	}{
+		{"steps", wsproto.BatchPayload{Steps: []wsproto.BatchStep{{Action: "play", IfStatus: "!playing"}}}, displayed, nil},
+		{"macro", wsproto.BatchPayload{Macro: "restart"}, displayed, nil},
+		{"empty", wsproto.BatchPayload{}, displayed, ErrInvalidBatch},
+		{"steps_and_macro", wsproto.BatchPayload{Macro: "restart", Steps: []wsproto.BatchStep{{Action: "play"}}}, displayed, ErrInvalidBatch},
+		{"unknown_macro", wsproto.BatchPayload{Macro: "nope"}, displayed, ErrMacroNotFound},
+		{"unknown_action", wsproto.BatchPayload{Steps: []wsproto.BatchStep{{Action: "explode"}}}, displayed, ErrInvalidBatch},
+		{"bad_args", wsproto.BatchPayload{Steps: []wsproto.BatchStep{{Action: "rate", Args: json.RawMessage(`{"rate":99}`)}}}, displayed, ErrInvalidBatch},
+		{"macro_with_bad_args", wsproto.BatchPayload{Macro: "broken"}, displayed, ErrInvalidSeek},
+		{"unknown_capability", wsproto.BatchPayload{Steps: []wsproto.BatchStep{{Action: "play", IfCapability: "teleport"}}}, displayed, ErrInvalidBatch},
+		{"unknown_status", wsproto.BatchPayload{Steps: []wsproto.BatchStep{{Action: "play", IfStatus: "dancing"}}}, displayed, ErrInvalidBatch},
+		{"too_long", wsproto.BatchPayload{Steps: []wsproto.BatchStep{{Action: "play", Delay: 5000}, {Action: "pause", Delay: 5000}}}, displayed, ErrInvalidBatch},
+		{"wait_on_other_session", wsproto.BatchPayload{Macro: "restart"}, other, ErrInvalidBatch},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			steps, err := srv.resolveBatch(tt.req, tt.target)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("err = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || len(steps) == 0 {
+				t.Fatalf("steps = %+v, err = %v", steps, err)
+			}
+		})
+	}
+}
+
+func TestRunBatch_StopsAtFailedStep(t *testing.T) {
+	srv, svc, _ := newTestServer(t)
+	svc.nextErr = errors.New("next failed")
+
+	results, err := srv.RunBatch(context.Background(), wsproto.BatchPayload{Steps: []wsproto.BatchStep{
+		{Action: "seek", Args: json.RawMessage(`{"position":1000}`)},
+		{Action: "next"},
+		{Action: "shuffle", Args: json.RawMessage(`{"active":true}`)},
+	}})
+	if err != nil {
+		t.Fatalf("RunBatch: %v", err)
+	}
+	want := []wsproto.StepResult{
+		{Action: "seek", Success: true},
+		{Action: "next", Error: "next failed", Code: wsproto.CodeProviderError},
+		{Action: "shuffle", Skipped: true},
+	}
+	for i := range want {
+		if results[i] != want[i] {
+			t.Fatalf("results = %+v, want %+v", results, want)
+		}
+	}
+	if batchSucceeded(results) {
+		t.Fatal("batchSucceeded = true, want false")
+	}
+	if len(svc.shuffleCalls) != 0 {
+		t.Fatalf("shuffleCalls = %v, want none after the failed step", svc.shuffleCalls)
+	}
+}
+
+func TestRunBatch_Conditions(t *testing.T) {
+	srv, svc, _ := newTestServer(t)
+	srv.handleCapabilitiesEvent(smtc.ControlCapabilities{IsSeekEnabled: true})
+	srv.handleProgressEvent(domain.ProgressData{Position: 30, Duration: 240, Status: smtc.StatusPaused})
+
+	results, err := srv.RunBatch(context.Background(), wsproto.BatchPayload{Steps: []wsproto.BatchStep{
+		{Action: "rate", Args: json.RawMessage(`{"rate":2}`), IfCapability: "rate"},
+		{Action: "seek", Args: json.RawMessage(`{"position":0}`), IfCapability: "seek"},
+		{Action: "repeat", Args: json.RawMessage(`{"mode":1}`), IfStatus: "playing"},
+		{Action: "shuffle", Args: json.RawMessage(`{"active":true}`), IfStatus: "!playing"},
+	}})
+	if err != nil {
+		t.Fatalf("RunBatch: %v", err)
+	}
+	skipped := []bool{true, false, true, false}
+	for i, r := range results {
+		if r.Skipped != skipped[i] || r.Success == skipped[i] {
+			t.Fatalf("step %d = %+v, want skipped=%v", i+1, r, skipped[i])
+		}
+	}
+	if len(svc.rateCalls) != 0 || len(svc.repeatCalls) != 0 || len(svc.seekCalls) != 1 || len(svc.shuffleCalls) != 1 {
+		t.Fatalf("calls: rate=%v seek=%v repeat=%v shuffle=%v", svc.rateCalls, svc.seekCalls, svc.repeatCalls, svc.shuffleCalls)
+	}
+}
+
+func TestSessionLocks_Serialize(t *testing.T) {
+	var locks sessionLocks
+	unlock := locks.lock("Spotify.exe")
+
+	acquired := make(chan struct{})
+	go func() {
+		defer locks.lock("Spotify.exe")()
+		close(acquired)
+	}()
+	// Another session is not held up.
+	locks.lock("Chrome")()
+
+	select {
+	case <-acquired:
+		t.Fatal("second batch for the session ran while the first held the lock")
+	case <-time.After(50 * time.Millisecond):
+	}
+	unlock()
+	select {
+	case <-acquired:
+	case <-time.After(time.Second):
+		t.Fatal("second batch did not run after the first released the lock")
+	}
+}
+
+func TestBatchEndpoint_Macro(t *testing.T) {
+	srv, svc, _ := newTestServer(t)
+	srv.cfg.Macros = map[string][]config.MacroStep{
+		"rewind": {{Action: "seek", Args: json.RawMessage(`{"position":0}`)}, {Action: "play"}},
+	}
+	handler := srv.setupRoutes()
+
+	w := serveLocal(handler, http.MethodPost, "/api/control/batch", `{"macro":"rewind"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("batch: got %d: %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Success bool                 `json:"success"`
+		Steps   []wsproto.StepResult `json:"steps"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if !resp.Success || len(resp.Steps) != 2 || resp.Steps[1].Action != "play" {
+		t.Fatalf("response = %+v", resp)
+	}
+	if len(svc.seekCalls) != 1 || svc.seekCalls[0] != 0 {
+		t.Fatalf("seekCalls = %v, want [0]", svc.seekCalls)
+	}
+
+	if w := serveLocal(handler, http.MethodPost, "/api/control/batch", `{"macro":"missing"}`); w.Code != http.StatusNotFound {
+		t.Fatalf("unknown macro: got %d want %d", w.Code, http.StatusNotFound)
+	}
+	if w := serveLocal(handler, http.MethodPost, "/api/control/batch", `{"steps":[]}`); w.Code != http.StatusBadRequest {
+		t.Fatalf("empty batch: got %d want %d", w.Code, http.StatusBadRequest)
+	}
+}
+
+func TestHandleWebSocket_BatchAck(t *testing.T) {
+	srv, svc, _ := newTestServer(t)
+	httpSrv := startWSTestServer(t, srv)
+	conn, handler := connectWSClient(t, httpSrv.URL)
+	_ = mustReadEnvelope(t, handler.msgs) // hello
+
+	batch := wsproto.Envelope{Type: wsproto.MsgBatch, V: wsproto.ProtocolVersion, ID: "batch-1", TS: time.Now().UnixMilli()}
+	batch.Data, _ = json.Marshal(wsproto.BatchPayload{Steps: []wsproto.BatchStep{
+		{Action: "repeat", Args: json.RawMessage(`{"mode":1}`)},
+		{Action: "seek", Args: json.RawMessage(`{"position":0}`), Delay: 10},
+	}})
+	msg, _ := json.Marshal(batch)
+	if err := conn.WriteMessage(gws.OpcodeText, msg); err != nil {
+		t.Fatalf("write batch: %v", err)
+	}
+
+	ack := mustReadEnvelope(t, handler.msgs)
+	if ack.Type != wsproto.MsgAck || ack.ID != "batch-1" {
+		t.Fatalf("ack envelope = %+v", ack)
+	}
+	var payload wsproto.AckPayload
+	if err := json.Unmarshal(ack.Data, &payload); err != nil {
+		t.Fatalf("decode ack payload: %v", err)
+	}
+	if !payload.Success || len(payload.Steps) != 2 || !payload.Steps[0].Success || !payload.Steps[1].Success {
+		t.Fatalf("ack = %+v", payload)
+	}
+	if len(svc.repeatCalls) != 1 || len(svc.seekCalls) != 1 {
+		t.Fatalf("repeatCalls = %v, seekCalls = %v", svc.repeatCalls, svc.seekCalls)
+	}
+}
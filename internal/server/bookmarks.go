@@ -0,0 +1,272 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"smtc-now-playing/internal/bookmarks"
+	"smtc-now-playing/internal/smtc"
+)
+
+// Sentinel errors for bookmarks and the A-B loop.
+var (
+	ErrNoTrack     = errors.New("server: no track playing")
+	ErrInvalidLoop = errors.New("server: invalid loop request")
+)
+
+// errBookmarkNeedsDisplayedSession rejects bookmark jumps for other sessions:
+// bookmarks are looked up by the displayed track.
+var errBookmarkNeedsDisplayedSession = errors.New("bookmarks are only supported for the displayed session")
+
+// abLoop is an active A-B loop on one track.
+type abLoop struct {
+	key      bookmarks.TrackKey
+	a, b     int64 // milliseconds
+	lastSeek time.Time
+}
+
+// loopState guards the active A-B loop.
+type loopState struct {
+	mu   sync.Mutex
+	loop *abLoop
+}
+
+// bookmarkRequest is the body of POST /api/bookmarks. PositionMs defaults to
+// the current position.
+type bookmarkRequest struct {
+	Name       string `json:"name"`
+	PositionMs *int64 `json:"positionMs"`
+}
+
+// bookmarkJumpRequest is the body of the bookmark control.
+type bookmarkJumpRequest struct {
+	ID string `json:"id"`
+}
+
+// loopRequest is the body of PUT /api/loop. Each end is given either as a
+// position in milliseconds or as a bookmark ID.
+type loopRequest struct {
+	A    *int64 `json:"a"`
+	B    *int64 `json:"b"`
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// loopResponse reports the A-B loop state.
+type loopResponse struct {
+	Active bool  `json:"active"`
+	A      int64 `json:"a,omitempty"`
+	B      int64 `json:"b,omitempty"`
+}
+
+// SetBookmarkStore replaces the bookmark store. It must be called before Run.
+func (s *Server) SetBookmarkStore(store *bookmarks.Store) {
+	s.bookmarks = store
+}
+
+// currentTrackKey identifies the displayed track.
+func (s *Server) currentTrackKey(state *stateSnapshot) (bookmarks.TrackKey, error) {
+	if state.info == nil || state.progress == nil || state.info.Title == "" {
+		return bookmarks.TrackKey{}, ErrNoTrack
+	}
+	return bookmarks.KeyFor(*state.info, *state.progress), nil
+}
+
+// jumpToBookmark seeks the displayed session to the bookmark with id and
+// returns the bookmark's position in milliseconds.
+func (s *Server) jumpToBookmark(t controlTarget, id string) (int64, error) {
+	if t.appID != "" {
+		return 0, errBookmarkNeedsDisplayedSession
+	}
+	key, err := s.currentTrackKey(s.snapshot())
+	if err != nil {
+		return 0, err
+	}
+	b, err := s.bookmarks.Get(key, id)
+	if err != nil {
+		return 0, err
+	}
+	return b.PositionMs, t.ctl.SeekTo(b.PositionMs)
+}
+
+// resolveLoop turns req into loop bounds in milliseconds for the track key,
+// looking bookmark ends up in the store.
+func (s *Server) resolveLoop(key bookmarks.TrackKey, req loopRequest) (a, b int64, err error) {
+	end := func(name string, pos *int64, id string) (int64, error) {
+		switch {
+		case pos != nil && id != "":
+			return 0, fmt.Errorf("%w: give %s as a position or a bookmark, not both", ErrInvalidLoop, name)
+		case pos != nil:
+			return *pos, nil
+		case id != "":
+			bm, err := s.bookmarks.Get(key, id)
+			if err != nil {
+				return 0, err
+			}
+			return bm.PositionMs, nil
+		}
+		return 0, fmt.Errorf("%w: %s is required", ErrInvalidLoop, name)
+	}
+	if a, err = end("a", req.A, req.From); err != nil {
+		return 0, 0, err
+	}
+	if b, err = end("b", req.B, req.To); err != nil {
+		return 0, 0, err
+	}
+	if a < 0 || b-a < minLoopLength.Milliseconds() {
+		return 0, 0, fmt.Errorf("%w: b must be at least %s after a", ErrInvalidLoop, minLoopLength)
+	}
+	if key.Duration > 0 && b > int64(key.Duration)*1000 {
+		return 0, 0, fmt.Errorf("%w: b is past the end of the track", ErrInvalidLoop)
+	}
+	return a, b, nil
+}
+
+// runLoopWatcher enforces the A-B loop until ctx is canceled.
+func (s *Server) runLoopWatcher(ctx context.Context) {
+	ticker := time.NewTicker(loopCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			s.checkLoop(now)
+		}
+	}
+}
+
+// checkLoop seeks back to A once the interpolated playback clock passes B.
+// The loop ends by itself when the displayed track changes; a change of the
+// reported duration alone does not end it.
+func (s *Server) checkLoop(now time.Time) {
+	s.loop.mu.Lock()
+	l := s.loop.loop
+	if l == nil {
+		s.loop.mu.Unlock()
+		return
+	}
+	state := s.snapshot()
+	if key, err := s.currentTrackKey(state); err != nil || !key.SameTrack(l.key) {
+		s.loop.loop = nil
+		s.loop.mu.Unlock()
+		slog.Debug("A-B loop cleared on track change")
+		return
+	}
+	// Give the player time to report the new position after a seek.
+	if state.progress.Status != smtc.StatusPlaying || now.Sub(l.lastSeek) < loopSeekCooldown ||
+		interpolatedPositionMs(state.progress, now) < l.b {
+		s.loop.mu.Unlock()
+		return
+	}
+	l.lastSeek = now
+	a := l.a
+	s.loop.mu.Unlock()
+
+	args, _ := json.Marshal(seekRequest{Position: &a})
+	if _, err := s.executeWSControl(s.targetFor(""), "seek", args); err != nil {
+		slog.Warn("A-B loop seek failed", "err", err)
+	}
+}
+
+func (s *Server) handleListBookmarks(w http.ResponseWriter, r *http.Request) {
+	key, err := s.currentTrackKey(s.snapshot())
+	if err != nil {
+		writeJSON(w, http.StatusNotFound, map[string]any{"error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"track": key, "bookmarks": s.bookmarks.List(key)})
+}
+
+func (s *Server) handleCreateBookmark(w http.ResponseWriter, r *http.Request) {
+	var req bookmarkRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]any{"success": false, "error": "invalid request body"})
+		return
+	}
+	state := s.snapshot()
+	key, err := s.currentTrackKey(state)
+	if err != nil {
+		writeJSON(w, http.StatusNotFound, map[string]any{"success": false, "error": err.Error()})
+		return
+	}
+	position := interpolatedPositionMs(state.progress, time.Now())
+	if req.PositionMs != nil {
+		position = *req.PositionMs
+	}
+
+	b, err := s.bookmarks.Add(key, req.Name, position)
+	switch {
+	case errors.Is(err, bookmarks.ErrInvalid):
+		writeJSON(w, http.StatusBadRequest, map[string]any{"success": false, "error": err.Error()})
+	case err != nil:
+		writeJSON(w, http.StatusInternalServerError, map[string]any{"success": false, "error": err.Error()})
+	default:
+		writeJSON(w, http.StatusCreated, b)
+	}
+}
+
+func (s *Server) handleDeleteBookmark(w http.ResponseWriter, r *http.Request) {
+	key, err := s.currentTrackKey(s.snapshot())
+	if err == nil {
+		err = s.bookmarks.Delete(key, r.PathValue("id"))
+	}
+	switch {
+	case errors.Is(err, ErrNoTrack), errors.Is(err, bookmarks.ErrNotFound):
+		writeJSON(w, http.StatusNotFound, map[string]any{"success": false, "error": err.Error()})
+	case err != nil:
+		writeJSON(w, http.StatusInternalServerError, map[string]any{"success": false, "error": err.Error()})
+	default:
+		writeJSON(w, http.StatusOK, map[string]any{"success": true})
+	}
+}
+
+func (s *Server) handleGetLoop(w http.ResponseWriter, r *http.Request) {
+	s.loop.mu.Lock()
+	defer s.loop.mu.Unlock()
+	resp := loopResponse{}
+	if l := s.loop.loop; l != nil {
+		resp = loopResponse{Active: true, A: l.a, B: l.b}
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) handleSetLoop(w http.ResponseWriter, r *http.Request) {
+	var req loopRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]any{"success": false, "error": "invalid request body"})
+		return
+	}
+	key, err := s.currentTrackKey(s.snapshot())
+	if err != nil {
+		writeJSON(w, http.StatusNotFound, map[string]any{"success": false, "error": err.Error()})
+		return
+	}
+	a, b, err := s.resolveLoop(key, req)
+	switch {
+	case errors.Is(err, bookmarks.ErrNotFound):
+		writeJSON(w, http.StatusNotFound, map[string]any{"success": false, "error": err.Error()})
+		return
+	case err != nil:
+		writeJSON(w, http.StatusBadRequest, map[string]any{"success": false, "error": err.Error()})
+		return
+	}
+
+	s.loop.mu.Lock()
+	s.loop.loop = &abLoop{key: key, a: a, b: b}
+	s.loop.mu.Unlock()
+	writeJSON(w, http.StatusOK, loopResponse{Active: true, A: a, B: b})
+}
+
+func (s *Server) handleClearLoop(w http.ResponseWriter, r *http.Request) {
+	s.loop.mu.Lock()
+	s.loop.loop = nil
+	s.loop.mu.Unlock()
+	writeJSON(w, http.StatusOK, loopResponse{})
+}
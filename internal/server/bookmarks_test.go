@@ -0,0 +1,193 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"smtc-now-playing/internal/bookmarks"
+	"smtc-now-playing/internal/domain"
+	"smtc-now-playing/internal/smtc"
+)
+
+func newBookmarkTestServer(t *testing.T) (*Server, *fakeSMTCService, http.Handler) {
+	t.Helper()
+	srv, svc, _ := newTestServer(t)
+	srv.handleInfoEvent(domain.InfoData{SourceApp: "Spotify.exe", Artist: "Artist", Title: "Song", AlbumTitle: "Album"})
+	srv.handleProgressEvent(domain.ProgressData{Position: 30, Duration: 240, Status: smtc.StatusPaused})
+	return srv, svc, srv.setupRoutes()
+}
+
+func serveLocal(handler http.Handler, method, target, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.RemoteAddr = "127.0.0.1:1234"
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	return w
+}
+
+func TestBookmarkEndpoints(t *testing.T) {
+	_, _, handler := newBookmarkTestServer(t)
+
+	w := serveLocal(handler, http.MethodPost, "/api/bookmarks", `{"name":"chorus","positionMs":90000}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create: got %d want %d: %s", w.Code, http.StatusCreated, w.Body.String())
+	}
+	var chorus bookmarks.Bookmark
+	if err := json.NewDecoder(w.Body).Decode(&chorus); err != nil {
+		t.Fatalf("decode bookmark: %v", err)
+	}
+
+	// Without positionMs the current position is used.
+	w = serveLocal(handler, http.MethodPost, "/api/bookmarks", `{"name":"here"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create at current position: got %d: %s", w.Code, w.Body.String())
+	}
+
+	if w := serveLocal(handler, http.MethodPost, "/api/bookmarks", `{"positionMs":1}`); w.Code != http.StatusBadRequest {
+		t.Fatalf("create without name: got %d want %d", w.Code, http.StatusBadRequest)
+	}
+
+	w = serveLocal(handler, http.MethodGet, "/api/bookmarks", "")
+	var listed struct {
+		Track     bookmarks.TrackKey   `json:"track"`
+		Bookmarks []bookmarks.Bookmark `json:"bookmarks"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&listed); err != nil {
+		t.Fatalf("decode list: %v", err)
+	}
+	want := bookmarks.TrackKey{SourceApp: "Spotify.exe", Artist: "Artist", Title: "Song", Album: "Album", Duration: 240}
+	if listed.Track != want {
+		t.Fatalf("track = %+v, want %+v", listed.Track, want)
+	}
+	if len(listed.Bookmarks) != 2 || listed.Bookmarks[0].PositionMs != 30000 || listed.Bookmarks[1].ID != chorus.ID {
+		t.Fatalf("bookmarks = %+v", listed.Bookmarks)
+	}
+
+	if w := serveLocal(handler, http.MethodDelete, "/api/bookmarks/"+chorus.ID, ""); w.Code != http.StatusOK {
+		t.Fatalf("delete: got %d want %d", w.Code, http.StatusOK)
+	}
+	if w := serveLocal(handler, http.MethodDelete, "/api/bookmarks/"+chorus.ID, ""); w.Code != http.StatusNotFound {
+		t.Fatalf("delete again: got %d want %d", w.Code, http.StatusNotFound)
+	}
+}
+
+func TestBookmarkEndpoints_NoTrack(t *testing.T) {
+	srv, _, _ := newTestServer(t)
+	w := serveLocal(srv.setupRoutes(), http.MethodPost, "/api/bookmarks", `{"name":"x","positionMs":1}`)
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("got %d want %d", w.Code, http.StatusNotFound)
+	}
+}
+
+func TestBookmarkControl_JumpsToBookmark(t *testing.T) {
+	srv, svc, handler := newBookmarkTestServer(t)
+	key, _ := srv.currentTrackKey(srv.snapshot())
+	b, _ := srv.bookmarks.Add(key, "bridge", 150000)
+
+	if w := serveLocal(handler, http.MethodPost, "/api/control/bookmark", `{"id":"`+b.ID+`"}`); w.Code != http.StatusOK {
+		t.Fatalf("jump: got %d: %s", w.Code, w.Body.String())
+	}
+	if w := serveLocal(handler, http.MethodPost, "/api/control/bookmark", `{"id":"missing"}`); w.Code != http.StatusNotFound {
+		t.Fatalf("jump to missing: got %d want %d", w.Code, http.StatusNotFound)
+	}
+	if _, err := srv.executeWSControl(srv.targetFor(""), "bookmark", json.RawMessage(`{"id":"`+b.ID+`"}`)); err != nil {
+		t.Fatalf("ws jump: %v", err)
+	}
+	if len(svc.seekCalls) != 2 || svc.seekCalls[0] != 150000 || svc.seekCalls[1] != 150000 {
+		t.Fatalf("seekCalls = %v, want two seeks to 150000", svc.seekCalls)
+	}
+}
+
+func TestLoopEndpoints(t *testing.T) {
+	srv, _, handler := newBookmarkTestServer(t)
+	key, _ := srv.currentTrackKey(srv.snapshot())
+	verse, _ := srv.bookmarks.Add(key, "verse", 20000)
+
+	tests := []struct {
+		body     string
+		wantCode int
+	}{
+		{`{"a":10000}`, http.StatusBadRequest},
+		{`{"a":10000,"b":10500}`, http.StatusBadRequest},
+		{`{"a":10000,"b":999000}`, http.StatusBadRequest},
+		{`{"a":10000,"from":"` + verse.ID + `","b":20000}`, http.StatusBadRequest},
+		{`{"from":"missing","b":20000}`, http.StatusNotFound},
+		{`{"from":"` + verse.ID + `","b":45000}`, http.StatusOK},
+	}
+	for _, tt := range tests {
+		if w := serveLocal(handler, http.MethodPut, "/api/loop", tt.body); w.Code != tt.wantCode {
+			t.Fatalf("%s: got %d want %d: %s", tt.body, w.Code, tt.wantCode, w.Body.String())
+		}
+	}
+
+	var got loopResponse
+	_ = json.NewDecoder(serveLocal(handler, http.MethodGet, "/api/loop", "").Body).Decode(&got)
+	if got != (loopResponse{Active: true, A: 20000, B: 45000}) {
+		t.Fatalf("loop = %+v", got)
+	}
+
+	serveLocal(handler, http.MethodDelete, "/api/loop", "")
+	got = loopResponse{}
+	_ = json.NewDecoder(serveLocal(handler, http.MethodGet, "/api/loop", "").Body).Decode(&got)
+	if got.Active {
+		t.Fatalf("loop after clear = %+v, want inactive", got)
+	}
+}
+
+func TestCheckLoop(t *testing.T) {
+	srv, svc, handler := newBookmarkTestServer(t)
+	now := time.UnixMilli(1700000000000)
+	srv.handleProgressEvent(domain.ProgressData{Position: 40, Duration: 240, Status: smtc.StatusPlaying, LastUpdatedTime: now.UnixMilli()})
+	if w := serveLocal(handler, http.MethodPut, "/api/loop", `{"a":20000,"b":45000}`); w.Code != http.StatusOK {
+		t.Fatalf("set loop: got %d: %s", w.Code, w.Body.String())
+	}
+
+	srv.checkLoop(now.Add(4 * time.Second)) // 44s: before B
+	if len(svc.seekCalls) != 0 {
+		t.Fatalf("seekCalls before B = %v, want none", svc.seekCalls)
+	}
+	srv.checkLoop(now.Add(5 * time.Second)) // 45s: at B
+	srv.checkLoop(now.Add(5*time.Second + 500*time.Millisecond))
+	if len(svc.seekCalls) != 1 || svc.seekCalls[0] != 20000 {
+		t.Fatalf("seekCalls = %v, want one seek to A within the cooldown", svc.seekCalls)
+	}
+
+	// A duration revised mid-track, or unknown for a moment, keeps the loop.
+	srv.handleProgressEvent(domain.ProgressData{Position: 41, Duration: 0, Status: smtc.StatusPlaying, LastUpdatedTime: now.Add(time.Second).UnixMilli()})
+	srv.checkLoop(now.Add(5*time.Second + 600*time.Millisecond))
+	srv.handleProgressEvent(domain.ProgressData{Position: 41, Duration: 241, Status: smtc.StatusPlaying, LastUpdatedTime: now.Add(time.Second).UnixMilli()})
+	srv.checkLoop(now.Add(5*time.Second + 700*time.Millisecond))
+	if srv.loop.loop == nil {
+		t.Fatal("loop cleared by a duration change")
+	}
+
+	// A different track ends the loop.
+	srv.handleInfoEvent(domain.InfoData{SourceApp: "Spotify.exe", Artist: "Artist", Title: "Next", AlbumTitle: "Album"})
+	srv.checkLoop(now.Add(10 * time.Second))
+	if srv.loop.loop != nil {
+		t.Fatal("loop still active after track change")
+	}
+	if len(svc.seekCalls) != 1 {
+		t.Fatalf("seekCalls after track change = %v", svc.seekCalls)
+	}
+}
+
+func TestCheckLoop_SeekDisabled(t *testing.T) {
+	srv, svc, handler := newBookmarkTestServer(t)
+	srv.handleEvent(smtc.DeviceChangedEvent{AppID: "Spotify.exe"})
+	srv.handleCapabilitiesEvent(smtc.ControlCapabilities{IsPlayEnabled: true})
+	now := time.UnixMilli(1700000000000)
+	srv.handleProgressEvent(domain.ProgressData{Position: 40, Duration: 240, Status: smtc.StatusPlaying, LastUpdatedTime: now.UnixMilli()})
+	if w := serveLocal(handler, http.MethodPut, "/api/loop", `{"a":20000,"b":45000}`); w.Code != http.StatusOK {
+		t.Fatalf("set loop: got %d: %s", w.Code, w.Body.String())
+	}
+
+	srv.checkLoop(now.Add(5 * time.Second))
+	if len(svc.seekCalls) != 0 {
+		t.Fatalf("seekCalls = %v, want none while the player reports seeking as disabled", svc.seekCalls)
+	}
+}
@@ -0,0 +1,392 @@
+package server
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"smtc-now-playing/internal/bitmapfont"
+	"smtc-now-playing/internal/thumbnail"
+)
+
+// Card layouts. wide puts the art left of the text, tall above it, and key
+// fills a small square with the art and overlays the title, for Stream Deck
+// keys and similar.
+const (
+	cardLayoutWide = "wide"
+	cardLayoutTall = "tall"
+	cardLayoutKey  = "key"
+)
+
+// cardSizes are the default sizes of the card layouts.
+var cardSizes = map[string]image.Point{
+	cardLayoutWide: {600, 200},
+	cardLayoutTall: {300, 400},
+	cardLayoutKey:  {144, 144},
+}
+
+// cardTheme is the colours of a card.
+type cardTheme struct {
+	background color.RGBA
+	title      color.RGBA
+	artist     color.RGBA
+	track      color.RGBA // progress bar background and art placeholder
+	fill       color.RGBA // elapsed part of the progress bar
+}
+
+// cardThemes are the fixed themes. The "art" theme is picked from the
+// album art palette; see (*Server).cardTheme.
+var cardThemes = map[string]cardTheme{
+	"dark": {
+		background: color.RGBA{0x12, 0x12, 0x12, 0xff},
+		title:      color.RGBA{0xff, 0xff, 0xff, 0xff},
+		artist:     color.RGBA{0xb3, 0xb3, 0xb3, 0xff},
+		track:      color.RGBA{0x3a, 0x3a, 0x3a, 0xff},
+		fill:       color.RGBA{0xff, 0xff, 0xff, 0xff},
+	},
+	"light": {
+		background: color.RGBA{0xf5, 0xf5, 0xf5, 0xff},
+		title:      color.RGBA{0x11, 0x11, 0x11, 0xff},
+		artist:     color.RGBA{0x55, 0x55, 0x55, 0xff},
+		track:      color.RGBA{0xd0, 0xd0, 0xd0, 0xff},
+		fill:       color.RGBA{0x11, 0x11, 0x11, 0xff},
+	},
+}
+
+// cardRequest is a card as asked for by query parameters.
+type cardRequest struct {
+	layout string
+	width  int
+	height int
+	theme  string // "dark", "light" or "art"
+	format string // "png" or "jpeg"
+}
+
+// parseCardRequest reads layout, width, height and theme from query. A
+// width or height given alone scales the other to the layout's aspect ratio.
+func parseCardRequest(query url.Values, format string) (cardRequest, error) {
+	get := func(key string) string { return strings.ToLower(strings.TrimSpace(query.Get(key))) }
+	req := cardRequest{layout: get("layout"), theme: get("theme"), format: format}
+	if req.layout == "" {
+		req.layout = cardLayoutWide
+	}
+	size, ok := cardSizes[req.layout]
+	if !ok {
+		return cardRequest{}, fmt.Errorf("layout must be %s, %s or %s", cardLayoutWide, cardLayoutTall, cardLayoutKey)
+	}
+	switch req.theme {
+	case "":
+		req.theme = "dark"
+	case "dark", "light", "art":
+	default:
+		return cardRequest{}, fmt.Errorf("theme must be dark, light or art")
+	}
+
+	dim := func(key string) (int, error) {
+		raw := get(key)
+		if raw == "" {
+			return 0, nil
+		}
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < minCardSize || n > maxCardSize {
+			return 0, fmt.Errorf("%s must be between %d and %d", key, minCardSize, maxCardSize)
+		}
+		return n, nil
+	}
+	var err error
+	if req.width, err = dim("width"); err != nil {
+		return cardRequest{}, err
+	}
+	if req.height, err = dim("height"); err != nil {
+		return cardRequest{}, err
+	}
+	switch {
+	case req.width == 0 && req.height == 0:
+		req.width, req.height = size.X, size.Y
+	case req.height == 0:
+		req.height = max(minCardSize, req.width*size.Y/size.X)
+	case req.width == 0:
+		req.width = max(minCardSize, req.height*size.X/size.Y)
+	}
+	return req, nil
+}
+
+// cardKey identifies a card of the state revision rev in the card cache.
+func cardKey(rev uint64, req cardRequest) string {
+	return fmt.Sprintf("%d/%s/%dx%d/%s/%s", rev, req.layout, req.width, req.height, req.theme, req.format)
+}
+
+// handleCard serves the now-playing card as an image. Cards are rendered
+// once per state revision and parameters; clients revalidate with the ETag.
+func (s *Server) handleCard(format string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		req, err := parseCardRequest(r.URL.Query(), format)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		state := s.snapshot()
+		key := cardKey(state.rev, req)
+		card, ok := s.cardCache.get(key)
+		if !ok {
+			data, ct, err := encodeArt(s.renderCard(state, req), req.format)
+			if err != nil {
+				slog.Warn("failed to render card", "err", err)
+				http.Error(w, "card cannot be rendered", http.StatusInternalServerError)
+				return
+			}
+			card = renderedArt{key: key, data: data, contentType: ct}
+			s.cardCache.put(card)
+		}
+		serveRendered(w, r, card)
+	}
+}
+
+// serveRendered serves an image rendered from the current state. Its ETag
+// is taken from the content, so clients polling with If-None-Match get 304
+// until the image changes.
+func serveRendered(w http.ResponseWriter, r *http.Request, img renderedArt) {
+	sum := sha256.Sum256(img.data)
+	w.Header().Set("Content-Type", img.contentType)
+	w.Header().Set("ETag", `"`+hex.EncodeToString(sum[:16])+`"`)
+	w.Header().Set("Cache-Control", "no-cache")
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(img.data))
+}
+
+// cardText is what a card shows.
+type cardText struct {
+	title, artist     string
+	elapsed, duration string  // "" without a known duration
+	progress          float64 // 0 to 1
+}
+
+func newCardText(state *stateSnapshot) cardText {
+	var t cardText
+	if state.info == nil || (state.info.Title == "" && state.info.Artist == "") {
+		t.title = "Nothing playing"
+		return t
+	}
+	t.title, t.artist = state.info.Title, state.info.Artist
+	if p := state.progress; p != nil && p.Duration > 0 {
+		pos := min(max(p.Position, 0), p.Duration)
+		t.elapsed, t.duration = clock(pos), clock(p.Duration)
+		t.progress = float64(pos) / float64(p.Duration)
+	}
+	return t
+}
+
+// clock formats seconds as m:ss, or h:mm:ss from an hour.
+func clock(sec int) string {
+	if sec >= 3600 {
+		return fmt.Sprintf("%d:%02d:%02d", sec/3600, sec/60%60, sec%60)
+	}
+	return fmt.Sprintf("%d:%02d", sec/60, sec%60)
+}
+
+// cardTheme returns the colours for the named theme. "art" takes them from
+// the album art palette and falls back to "dark" without one.
+func (s *Server) cardTheme(name string, state *stateSnapshot) cardTheme {
+	p := state.currentPalette()
+	if name != "art" || p == nil {
+		if theme, ok := cardThemes[name]; ok {
+			return theme
+		}
+		return cardThemes["dark"]
+	}
+	bg, text := parseHexColor(p.Dominant), parseHexColor(p.Text)
+	return cardTheme{
+		background: bg,
+		title:      text,
+		artist:     mixColor(text, bg, 0.3),
+		track:      mixColor(text, bg, 0.75),
+		fill:       text,
+	}
+}
+
+// renderCard draws the card for state.
+func (s *Server) renderCard(state *stateSnapshot, req cardRequest) *image.RGBA {
+	w, h := req.width, req.height
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	theme := s.cardTheme(req.theme, state)
+	fillRect(img, img.Rect, theme.background)
+	text := newCardText(state)
+	s.checkCardGlyphs(text)
+
+	switch req.layout {
+	case cardLayoutKey:
+		s.drawCardArt(img, img.Rect, &s.cardArt, state, theme)
+		// Darken the lower part so the title reads on any art.
+		for y := h * 2 / 5; y < h; y++ {
+			a := uint8(190 * (y - h*2/5) / max(1, h-h*2/5))
+			fillRect(img, image.Rect(0, y, w, y+1), color.RGBA{A: a})
+		}
+		barH := max(2, h/30)
+		pad := max(2, w/20)
+		face := s.cardFace(h / 7)
+		white := color.RGBA{0xff, 0xff, 0xff, 0xff}
+		baseline := h - barH - pad - (face.Height() - face.Ascent())
+		face.Draw(img, pad, baseline, face.Truncate(text.title, w-2*pad), white)
+		drawProgress(img, image.Rect(0, h-barH, w, h), text.progress, color.RGBA{0x80, 0x80, 0x80, 0x80}, white)
+
+	case cardLayoutTall:
+		pad := max(2, w/12)
+		side := min(w-2*pad, h*3/5)
+		s.drawCardArt(img, image.Rect((w-side)/2, pad, (w+side)/2, pad+side), &s.cardArt, state, theme)
+		title, artist, small := s.cardFace(w/12), s.cardFace(w/16), s.cardFace(w/22)
+		y := pad + side + pad/2 + title.Ascent()
+		title.Draw(img, pad, y, title.Truncate(text.title, w-2*pad), theme.title)
+		y += title.Height() - title.Ascent() + pad/4 + artist.Ascent()
+		artist.Draw(img, pad, y, artist.Truncate(text.artist, w-2*pad), theme.artist)
+		drawCardBar(img, image.Rect(pad, 0, w-pad, h-pad), text, small, theme)
+
+	default:
+		pad := max(2, h/10)
+		side := h - 2*pad
+		s.drawCardArt(img, image.Rect(pad, pad, pad+side, pad+side), &s.cardArt, state, theme)
+		x := pad + side + pad
+		title, artist, small := s.cardFace(h/6), s.cardFace(h/9), s.cardFace(h/12)
+		y := pad + title.Ascent()
+		title.Draw(img, x, y, title.Truncate(text.title, w-x-pad), theme.title)
+		y += title.Height() - title.Ascent() + pad/3 + artist.Ascent()
+		artist.Draw(img, x, y, artist.Truncate(text.artist, w-x-pad), theme.artist)
+		drawCardBar(img, image.Rect(x, 0, w-pad, h-pad), text, small, theme)
+	}
+	return img
+}
+
+// cardFace returns a face about size pixels tall in the card fonts.
+func (s *Server) cardFace(size int) *bitmapfont.Face {
+	return bitmapfont.NewFace(max(1, size), s.cardFonts...)
+}
+
+// checkCardGlyphs logs, once per title and artist, the characters of text
+// that no card font has, which are drawn as boxes.
+func (s *Server) checkCardGlyphs(text cardText) {
+	key := text.title + "\x00" + text.artist
+	if prev := s.glyphsChecked.Swap(&key); prev != nil && *prev == key {
+		return
+	}
+	if missing := s.cardFace(1).Missing(text.title + text.artist); len(missing) > 0 {
+		slog.Warn("card text has characters no font covers, add a BDF font with them to card.fontDir",
+			"title", text.title, "artist", text.artist, "missing", string(missing))
+	}
+}
+
+// drawCardBar draws the progress bar along the bottom of r, with the elapsed
+// time and duration above its ends. Tracks without a duration get neither.
+func drawCardBar(img *image.RGBA, r image.Rectangle, text cardText, face *bitmapfont.Face, theme cardTheme) {
+	if text.duration == "" {
+		return
+	}
+	barH := max(2, r.Dy()/40)
+	bar := image.Rect(r.Min.X, r.Max.Y-barH, r.Max.X, r.Max.Y)
+	drawProgress(img, bar, text.progress, theme.track, theme.fill)
+	baseline := bar.Min.Y - barH - (face.Height() - face.Ascent())
+	face.Draw(img, r.Min.X, baseline, text.elapsed, theme.artist)
+	face.Draw(img, r.Max.X-face.Width(text.duration), baseline, text.duration, theme.artist)
+}
+
+// drawProgress fills r with track and the first progress of it with fill.
+func drawProgress(img *image.RGBA, r image.Rectangle, progress float64, track, fill color.RGBA) {
+	fillRect(img, r, track)
+	done := r
+	done.Max.X = r.Min.X + int(float64(r.Dx())*progress+0.5)
+	fillRect(img, done, fill)
+}
+
+// drawCardArt draws the album art cropped to fill r, scaled through cache,
+// or a placeholder note when there is no art or it cannot be decoded.
+func (s *Server) drawCardArt(img *image.RGBA, r image.Rectangle, cache *cardArtCache, state *stateSnapshot, theme cardTheme) {
+	if art := cache.get(state.art, r.Dx(), r.Dy()); art != nil {
+		draw.Draw(img, r, art, image.Point{}, draw.Src)
+		return
+	}
+	fillRect(img, r, theme.track)
+	face := s.cardFace(r.Dy() / 2)
+	x := r.Min.X + (r.Dx()-face.Width("♪"))/2
+	y := r.Min.Y + (r.Dy()+face.Ascent())/2
+	face.Draw(img, x, y, "♪", theme.artist)
+}
+
+// cardArtCache keeps the current album art scaled for the last card size
+// drawn, so cards of later state revisions do not decode it again.
+type cardArtCache struct {
+	mu  sync.Mutex
+	key string
+	img *image.RGBA // nil when the art cannot be decoded
+}
+
+// get returns the art of blob cropped and scaled to w×h, or nil.
+func (c *cardArtCache) get(blob *artBlob, w, h int) *image.RGBA {
+	if blob == nil {
+		return nil
+	}
+	key := fmt.Sprintf("%s/%dx%d", blob.hash, w, h)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.key == key {
+		return c.img
+	}
+	c.key, c.img = key, nil
+	src, _, err := image.Decode(bytes.NewReader(blob.data))
+	if err != nil {
+		slog.Debug("card album art cannot be decoded", "err", err)
+		return nil
+	}
+	c.img = coverImage(src, w, h)
+	return c.img
+}
+
+// coverImage scales src to fill w×h, cropping the overflow around the
+// centre.
+func coverImage(src image.Image, w, h int) *image.RGBA {
+	b := src.Bounds()
+	crop := b
+	if b.Dx()*h > b.Dy()*w {
+		cw := b.Dy() * w / h
+		crop.Min.X += (b.Dx() - cw) / 2
+		crop.Max.X = crop.Min.X + cw
+	} else {
+		ch := b.Dx() * h / w
+		crop.Min.Y += (b.Dy() - ch) / 2
+		crop.Max.Y = crop.Min.Y + ch
+	}
+	return thumbnail.Scale(src, crop, w, h)
+}
+
+func fillRect(img *image.RGBA, r image.Rectangle, c color.RGBA) {
+	draw.Draw(img, r, image.NewUniform(c), image.Point{}, draw.Over)
+}
+
+// parseHexColor parses #rrggbb as produced by the palette. Anything else is
+// black.
+func parseHexColor(s string) color.RGBA {
+	b, err := hex.DecodeString(strings.TrimPrefix(s, "#"))
+	if err != nil || len(b) != 3 {
+		return color.RGBA{A: 0xff}
+	}
+	return color.RGBA{b[0], b[1], b[2], 0xff}
+}
+
+// mixColor moves a towards b by t.
+func mixColor(a, b color.RGBA, t float64) color.RGBA {
+	mix := func(x, y uint8) uint8 { return uint8(float64(x) + (float64(y)-float64(x))*t + 0.5) }
+	return color.RGBA{mix(a.R, b.R), mix(a.G, b.G), mix(a.B, b.B), 0xff}
+}
+
+// SetCardFonts sets the fonts card text is drawn in before the built-in
+// font. It must be called before Run.
+func (s *Server) SetCardFonts(fonts []*bitmapfont.Font) {
+	s.cardFonts = fonts
+}
@@ -0,0 +1,117 @@
+package server
+
+import (
+	"image"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"smtc-now-playing/internal/domain"
+	"smtc-now-playing/internal/smtc"
+)
+
+func TestParseCardRequest(t *testing.T) {
+	tests := []struct {
+		query   string
+		want    cardRequest
+		wantErr bool
+	}{
+		{"", cardRequest{layout: "wide", width: 600, height: 200, theme: "dark", format: "png"}, false},
+		{"layout=KEY&theme=light", cardRequest{layout: "key", width: 144, height: 144, theme: "light", format: "png"}, false},
+		{"layout=wide&width=300", cardRequest{layout: "wide", width: 300, height: 100, theme: "dark", format: "png"}, false},
+		{"layout=tall&height=200&theme=art", cardRequest{layout: "tall", width: 150, height: 200, theme: "art", format: "png"}, false},
+		{"width=320&height=240", cardRequest{layout: "wide", width: 320, height: 240, theme: "dark", format: "png"}, false},
+		{"layout=square", cardRequest{}, true},
+		{"theme=blue", cardRequest{}, true},
+		{"width=8", cardRequest{}, true},
+		{"height=99999", cardRequest{}, true},
+		{"width=abc", cardRequest{}, true},
+	}
+	for _, tt := range tests {
+		query, _ := url.ParseQuery(tt.query)
+		got, err := parseCardRequest(query, "png")
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("parseCardRequest(%q) = %+v, %v; want %+v, error %v", tt.query, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestClock(t *testing.T) {
+	for sec, want := range map[int]string{0: "0:00", 83: "1:23", 3600: "1:00:00", 3725: "1:02:05"} {
+		if got := clock(sec); got != want {
+			t.Errorf("clock(%d) = %q, want %q", sec, got, want)
+		}
+	}
+}
+
+func TestHandleCard(t *testing.T) {
+	srv, _, _ := newTestServer(t)
+	handler := srv.setupRoutes()
+
+	w := serveLocal(handler, http.MethodGet, "/api/card.png", "")
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "image/png" {
+		t.Fatalf("nothing playing: got %d %q", w.Code, w.Header().Get("Content-Type"))
+	}
+
+	srv.handleInfoEvent(domain.InfoData{Artist: "Artist", Title: "Title", ThumbnailData: testPNG(t, 64, 64)})
+	srv.handleProgressEvent(domain.ProgressData{Position: 30, Duration: 240, Status: smtc.StatusPaused})
+	w = serveLocal(handler, http.MethodGet, "/api/card.png?layout=tall&width=150", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("png: got %d: %s", w.Code, w.Body.String())
+	}
+	img, err := png.Decode(w.Body)
+	if err != nil {
+		t.Fatalf("decode png: %v", err)
+	}
+	if size := img.Bounds().Size(); size != image.Pt(150, 200) {
+		t.Fatalf("card is %v, want 150x200", size)
+	}
+
+	w = serveLocal(handler, http.MethodGet, "/api/card.jpg?layout=key", "")
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "image/jpeg" {
+		t.Fatalf("jpeg: got %d %q", w.Code, w.Header().Get("Content-Type"))
+	}
+	if img, err := jpeg.Decode(w.Body); err != nil {
+		t.Fatalf("decode jpeg: %v", err)
+	} else if size := img.Bounds().Size(); size != image.Pt(144, 144) {
+		t.Fatalf("key card is %v, want 144x144", size)
+	}
+
+	if w := serveLocal(handler, http.MethodGet, "/api/card.png?layout=square", ""); w.Code != http.StatusBadRequest {
+		t.Fatalf("bad layout: got %d want %d", w.Code, http.StatusBadRequest)
+	}
+}
+
+func TestHandleCard_CachedPerRevision(t *testing.T) {
+	srv, _, _ := newTestServer(t)
+	srv.handleInfoEvent(domain.InfoData{Artist: "Artist", Title: "Title"})
+	handler := srv.setupRoutes()
+
+	first := serveLocal(handler, http.MethodGet, "/api/card.png", "")
+	etag := first.Header().Get("ETag")
+	if first.Code != http.StatusOK || etag == "" {
+		t.Fatalf("first: got %d etag %q", first.Code, etag)
+	}
+	req, _ := parseCardRequest(url.Values{}, "png")
+	if _, ok := srv.cardCache.get(cardKey(srv.snapshot().rev, req)); !ok {
+		t.Fatal("card was not cached for the current revision")
+	}
+
+	revalidate := httptest.NewRequest(http.MethodGet, "/api/card.png", nil)
+	revalidate.RemoteAddr = "127.0.0.1:1234"
+	revalidate.Header.Set("If-None-Match", etag)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, revalidate)
+	if w.Code != http.StatusNotModified {
+		t.Fatalf("revalidate: got %d want %d", w.Code, http.StatusNotModified)
+	}
+
+	srv.handleInfoEvent(domain.InfoData{Artist: "Artist", Title: "Other Title"})
+	second := serveLocal(handler, http.MethodGet, "/api/card.png", "")
+	if second.Header().Get("ETag") == etag {
+		t.Fatal("card was not re-rendered after the track changed")
+	}
+}
@@ -21,4 +21,57 @@ const (
 	subscribeBufSize = 64
 	// hubChanCapacity is the size of the hub command channel.
 	hubChanCapacity = 64
+	// controlWaitDefault is how long a control in wait mode waits for its effect by default.
+	controlWaitDefault = 3 * time.Second
+	// controlWaitMax caps the wait timeout; it must stay below httpWriteTimeout.
+	controlWaitMax = 5 * time.Second
+	// seekWaitTolerance is how far the reported position may be from a seek's
+	// target for a wait to count the seek as done; sources that report whole
+	// seconds are up to a second off.
+	seekWaitTolerance = 1500 * time.Millisecond
+	// rateWaitTolerance is how far the reported playback rate may be from the
+	// requested one for a wait to count the change as done; players round it.
+	rateWaitTolerance = 0.01
+	// defaultSeekStep is the jump used by the forward/backward controls when no step is given.
+	defaultSeekStep = 10 * time.Second
+	// maxTimerDelay is how far ahead a time-based timer may be scheduled.
+	maxTimerDelay = 24 * time.Hour
+	// loopCheckInterval is how often the A-B loop compares the playback clock against B.
+	loopCheckInterval = 100 * time.Millisecond
+	// loopSeekCooldown is the minimum time between two A-B loop seeks.
+	loopSeekCooldown = time.Second
+	// minLoopLength is the shortest A-B loop accepted.
+	minLoopLength = time.Second
+	// maxBatchSteps is the most steps a batch or macro may have.
+	maxBatchSteps = 16
+	// maxBatchDuration caps the delays and wait timeouts of a batch combined;
+	// it must stay below httpWriteTimeout.
+	maxBatchDuration = 8 * time.Second
+	// maxArtSize is the largest size accepted by the album art endpoint.
+	maxArtSize = 2048
+	// artCacheBytes bounds the total size of the rendered album art variants kept.
+	artCacheBytes = 32 << 20
+	// artJPEGQuality is the quality of album art re-encoded as JPEG.
+	artJPEGQuality = 85
+	// defaultBlurRadius is the radius of the pre-rendered blurred album art.
+	defaultBlurRadius = 20
+	// maxBlurRadius is the largest blur radius accepted.
+	maxBlurRadius = 100
+	// minCardSize and maxCardSize bound the width and height of card images.
+	minCardSize = 16
+	maxCardSize = 2048
+	// cardCacheBytes bounds the total size of the rendered cards kept.
+	cardCacheBytes = 8 << 20
+	// keyCacheBytes bounds the total size of the rendered key images kept.
+	// Title and progress keys change often, so it holds a few frames of each.
+	keyCacheBytes = 2 << 20
+	// keyScrollFrame is how long each frame of a scrolling title key lasts.
+	keyScrollFrame = 200 * time.Millisecond
+	// defaultBadgeLength, minBadgeLength and maxBadgeLength bound the title
+	// and artist of the badge, in columns.
+	defaultBadgeLength = 32
+	minBadgeLength     = 4
+	maxBadgeLength     = 200
+	// badgeCacheBytes bounds the total size of the rendered badges kept.
+	badgeCacheBytes = 1 << 20
 )
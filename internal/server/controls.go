@@ -0,0 +1,127 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"smtc-now-playing/internal/smtc"
+	"smtc-now-playing/internal/wsproto"
+)
+
+// Sentinel errors for control pre-flight checks.
+var (
+	ErrNotSupported      = errors.New("server: control not supported by the player")
+	ErrInvalidRepeatMode = errors.New("server: invalid repeat mode")
+)
+
+// Repeat modes accepted by the repeat control: none, track and list.
+const (
+	minRepeatMode = 0
+	maxRepeatMode = 2
+)
+
+// actionEnabled reports whether caps allow action. toggle needs either play
+// or pause; the seek-based controls need seek.
+func actionEnabled(caps smtc.ControlCapabilities, action string) bool {
+	switch action {
+	case "play":
+		return caps.IsPlayEnabled
+	case "pause":
+		return caps.IsPauseEnabled
+	case "stop":
+		return caps.IsStopEnabled
+	case "toggle":
+		return caps.IsPlayEnabled || caps.IsPauseEnabled
+	case "next":
+		return caps.IsNextEnabled
+	case "previous":
+		return caps.IsPreviousEnabled
+	case "seek", "forward", "backward", "bookmark":
+		return caps.IsSeekEnabled
+	case "shuffle":
+		return caps.IsShuffleEnabled
+	case "repeat":
+		return caps.IsRepeatEnabled
+	case "rate":
+		return caps.IsPlaybackRateEnabled
+	}
+	return false
+}
+
+// preflight rejects action before it reaches the player when the displayed
+// session reports it as disabled. Only the displayed session's capabilities
+// are tracked, so controls for other sessions and controls sent before any
+// session was displayed go through unchecked, as do unknown actions, which
+// the dispatcher rejects. smtc.ignoreCapabilities turns the check off.
+func (s *Server) preflight(t controlTarget, action string) error {
+	if t.appID != "" || !isControlAction(action) {
+		return nil
+	}
+	state := s.snapshot()
+	if s.capsAllow(state, action) {
+		return nil
+	}
+	return fmt.Errorf("%w: %s reports %s as disabled", ErrNotSupported, state.activeAppID, action)
+}
+
+// capsAllow reports whether preflight lets action through to the displayed
+// session of state. Before any session is displayed its capabilities are
+// unknown, so everything is allowed.
+func (s *Server) capsAllow(state *stateSnapshot, action string) bool {
+	return s.cfg.SMTC.IgnoreCapabilities || state.activeAppID == "" || actionEnabled(state.caps, action)
+}
+
+// validateRepeatMode rejects modes other than none, track and list.
+func validateRepeatMode(mode int) error {
+	if mode < minRepeatMode || mode > maxRepeatMode {
+		return fmt.Errorf("%w: %d (must be 0 for none, 1 for track or 2 for list)", ErrInvalidRepeatMode, mode)
+	}
+	return nil
+}
+
+// controlSpecs describes every control action and its arguments, marking
+// the actions preflight would reject for the displayed session.
+func (s *Server) controlSpecs() []wsproto.ControlSpec {
+	state := s.snapshot()
+	ptr := func(v float64) *float64 { return &v }
+	specs := []wsproto.ControlSpec{
+		{Action: "play"},
+		{Action: "pause"},
+		{Action: "stop"},
+		{Action: "toggle"},
+		{Action: "next"},
+		{Action: "previous"},
+		{Action: "seek", OneOf: true, Args: []wsproto.ArgSpec{
+			{Name: "position", Type: "integer", Unit: "ms"},
+			{Name: "offset", Type: "integer", Unit: "ms"},
+			{Name: "percent", Type: "number", Min: ptr(0), Max: ptr(100)},
+		}},
+		{Action: "forward", Args: []wsproto.ArgSpec{
+			{Name: "step", Type: "integer", Unit: "ms", Min: ptr(1), Default: ptr(float64(defaultSeekStep.Milliseconds()))},
+		}},
+		{Action: "backward", Args: []wsproto.ArgSpec{
+			{Name: "step", Type: "integer", Unit: "ms", Min: ptr(1), Default: ptr(float64(defaultSeekStep.Milliseconds()))},
+		}},
+		{Action: "bookmark", Args: []wsproto.ArgSpec{
+			{Name: "id", Type: "string", Required: true},
+		}},
+		{Action: "shuffle", Args: []wsproto.ArgSpec{
+			{Name: "active", Type: "boolean", Required: true},
+		}},
+		{Action: "repeat", Args: []wsproto.ArgSpec{
+			{Name: "mode", Type: "integer", Required: true, Enum: []float64{0, 1, 2}},
+		}},
+		{Action: "rate", Args: []wsproto.ArgSpec{
+			{Name: "rate", Type: "number", Required: true, Min: ptr(minPlaybackRate), Max: ptr(maxPlaybackRate)},
+		}},
+	}
+	for i := range specs {
+		specs[i].Enabled = s.capsAllow(state, specs[i].Action)
+	}
+	return specs
+}
+
+func (s *Server) handleControls(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.controlSpecs())
+}
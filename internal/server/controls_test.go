@@ -0,0 +1,196 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+
+	"smtc-now-playing/internal/config"
+	"smtc-now-playing/internal/smtc"
+	"smtc-now-playing/internal/wsproto"
+)
+
+func TestPreflight(t *testing.T) {
+	srv, _, _ := newTestServer(t)
+	srv.handleCapabilitiesEvent(smtc.ControlCapabilities{IsPauseEnabled: true, IsSeekEnabled: true})
+	displayed := srv.targetFor("")
+
+	// Before any session is displayed the capabilities mean nothing.
+	if err := srv.preflight(displayed, "next"); err != nil {
+		t.Fatalf("no session: err = %v", err)
+	}
+	srv.handleEvent(smtc.DeviceChangedEvent{AppID: "Spotify.exe"})
+
+	tests := []struct {
+		action  string
+		target  controlTarget
+		wantErr bool
+	}{
+		{"pause", displayed, false},
+		{"toggle", displayed, false},
+		{"backward", displayed, false},
+		{"bookmark", displayed, false},
+		{"next", displayed, true},
+		{"rate", displayed, true},
+		{"next", srv.targetFor("chrome.exe"), false},
+		{"explode", displayed, false},
+	}
+	for _, tt := range tests {
+		err := srv.preflight(tt.target, tt.action)
+		if gotErr := errors.Is(err, ErrNotSupported); gotErr != tt.wantErr {
+			t.Fatalf("preflight(%q, %q) = %v, want rejected=%v", tt.target.appID, tt.action, err, tt.wantErr)
+		}
+	}
+
+	srv.cfg.SMTC.IgnoreCapabilities = true
+	if err := srv.preflight(displayed, "next"); err != nil {
+		t.Fatalf("ignoreCapabilities: err = %v", err)
+	}
+}
+
+func TestControlEndpoint_RejectsDisabledControl(t *testing.T) {
+	srv, svc, _ := newTestServer(t)
+	srv.handleCapabilitiesEvent(smtc.ControlCapabilities{IsPlayEnabled: true})
+	srv.handleEvent(smtc.DeviceChangedEvent{AppID: "Spotify.exe"})
+	handler := srv.setupRoutes()
+
+	w := serveLocal(handler, http.MethodPost, "/api/control/seek", `{"position":1000}`)
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("seek: got %d want %d: %s", w.Code, http.StatusUnprocessableEntity, w.Body.String())
+	}
+	var resp struct {
+		Code wsproto.ErrorCode `json:"code"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if resp.Code != wsproto.CodeNotSupported {
+		t.Fatalf("code = %q, want %q", resp.Code, wsproto.CodeNotSupported)
+	}
+	if len(svc.seekCalls) != 0 {
+		t.Fatalf("seekCalls = %v, want none", svc.seekCalls)
+	}
+
+	srv.cfg.SMTC.IgnoreCapabilities = true
+	if w := serveLocal(handler, http.MethodPost, "/api/control/seek", `{"position":1000}`); w.Code != http.StatusOK {
+		t.Fatalf("seek with ignoreCapabilities: got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestControlEndpoint_RepeatMode(t *testing.T) {
+	srv, svc, _ := newTestServer(t)
+	handler := srv.setupRoutes()
+
+	if w := serveLocal(handler, http.MethodPost, "/api/control/repeat", `{"mode":3}`); w.Code != http.StatusBadRequest {
+		t.Fatalf("mode 3: got %d want %d", w.Code, http.StatusBadRequest)
+	}
+	if _, err := srv.executeWSControl(srv.targetFor(""), "repeat", json.RawMessage(`{"mode":-1}`)); !errors.Is(err, ErrInvalidRepeatMode) {
+		t.Fatalf("ws mode -1: err = %v", err)
+	}
+	if len(svc.repeatCalls) != 0 {
+		t.Fatalf("repeatCalls = %v, want none", svc.repeatCalls)
+	}
+}
+
+func TestControlsEndpoint(t *testing.T) {
+	srv, _, _ := newTestServer(t)
+	handler := srv.setupRoutes()
+
+	// With no session displayed preflight checks nothing, so nothing is
+	// advertised as disabled either.
+	var unchecked []wsproto.ControlSpec
+	_ = json.NewDecoder(serveLocal(handler, http.MethodGet, "/api/controls", "").Body).Decode(&unchecked)
+	for _, spec := range unchecked {
+		if !spec.Enabled {
+			t.Fatalf("%s disabled with no session displayed", spec.Action)
+		}
+	}
+
+	srv.handleCapabilitiesEvent(smtc.ControlCapabilities{IsSeekEnabled: true, IsPlaybackRateEnabled: true})
+	srv.handleEvent(smtc.DeviceChangedEvent{AppID: "Spotify.exe"})
+
+	w := serveLocal(handler, http.MethodGet, "/api/controls", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("got %d want %d", w.Code, http.StatusOK)
+	}
+	var specs []wsproto.ControlSpec
+	if err := json.NewDecoder(w.Body).Decode(&specs); err != nil {
+		t.Fatalf("decode specs: %v", err)
+	}
+	byAction := make(map[string]wsproto.ControlSpec, len(specs))
+	for _, spec := range specs {
+		if !isControlAction(spec.Action) {
+			t.Fatalf("spec for unknown action %q", spec.Action)
+		}
+		byAction[spec.Action] = spec
+	}
+	if !byAction["forward"].Enabled || byAction["next"].Enabled {
+		t.Fatalf("enabled: forward=%v next=%v", byAction["forward"].Enabled, byAction["next"].Enabled)
+	}
+	rate := byAction["rate"].Args[0]
+	if !rate.Required || *rate.Min != minPlaybackRate || *rate.Max != maxPlaybackRate {
+		t.Fatalf("rate arg = %+v", rate)
+	}
+	if seek := byAction["seek"]; !seek.OneOf || len(seek.Args) != 3 {
+		t.Fatalf("seek spec = %+v", seek)
+	}
+}
+
+func TestControls_LastSessionClosed(t *testing.T) {
+	srv, svc, _ := newTestServer(t)
+	handler := srv.setupRoutes()
+	srv.handleEvent(smtc.DeviceChangedEvent{AppID: "Spotify.exe"})
+	srv.handleEvent(smtc.CapabilitiesChangedEvent{Caps: smtc.ControlCapabilities{IsPlayEnabled: true}})
+
+	// The order smtc reports the last session closing in.
+	srv.handleEvent(smtc.DeviceChangedEvent{AppID: ""})
+	srv.handleEvent(smtc.CapabilitiesChangedEvent{})
+	svc.playErr = smtc.ErrNoSession
+
+	w := serveLocal(handler, http.MethodPost, "/api/control/play", "")
+	var resp struct {
+		Code wsproto.ErrorCode `json:"code"`
+	}
+	_ = json.NewDecoder(w.Body).Decode(&resp)
+	if w.Code != http.StatusConflict || resp.Code != wsproto.CodeNoSession {
+		t.Fatalf("play with no session: got %d %q, want %d %q", w.Code, resp.Code, http.StatusConflict, wsproto.CodeNoSession)
+	}
+}
+
+func TestDeviceChange_RebroadcastsControls(t *testing.T) {
+	srv, err := New(&config.Config{
+		Server: config.ServerConfig{Port: 11451},
+		UI:     config.UIConfig{Theme: "default"},
+	}, newFakeSMTCService())
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+	// Capabilities arriving before the first device are judged against no
+	// session at all, so everything is enabled.
+	srv.handleEvent(smtc.CapabilitiesChangedEvent{Caps: smtc.ControlCapabilities{IsPlayEnabled: true}})
+	<-srv.hub.ch
+
+	srv.handleEvent(smtc.DeviceChangedEvent{AppID: "Spotify.exe"})
+	var env wsproto.Envelope
+	if err := json.Unmarshal((<-srv.hub.ch).(broadcastCmd).msg, &env); err != nil || env.Type != wsproto.MsgCapabilities {
+		t.Fatalf("device change broadcast %+v, %v; want a capabilities message", env, err)
+	}
+	var payload wsproto.CapabilitiesPayload
+	if err := json.Unmarshal(env.Data, &payload); err != nil {
+		t.Fatalf("decode capabilities: %v", err)
+	}
+	caps := smtc.ControlCapabilities{IsPlayEnabled: true}
+	for _, spec := range payload.Controls {
+		if want := actionEnabled(caps, spec.Action); spec.Enabled != want {
+			t.Errorf("%s enabled = %v after the device change, want %v", spec.Action, spec.Enabled, want)
+		}
+	}
+
+	srv.handleEvent(smtc.DeviceChangedEvent{AppID: "Spotify.exe"})
+	select {
+	case cmd := <-srv.hub.ch:
+		t.Fatalf("unchanged device broadcast %T", cmd)
+	default:
+	}
+}
@@ -0,0 +1,67 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"smtc-now-playing/internal/bookmarks"
+	"smtc-now-playing/internal/smtc"
+	"smtc-now-playing/internal/wsproto"
+)
+
+// Errors reported for malformed controls.
+var (
+	errInvalidBody         = errors.New("invalid request body")
+	errUnknownAction       = errors.New("unknown action")
+	errInvalidControl      = errors.New("invalid control payload")
+	errInvalidBatchPayload = errors.New("invalid batch payload")
+	errUnsupportedMessage  = errors.New("unsupported message type")
+)
+
+// controlErrorCode classifies a control failure and picks its HTTP status.
+// A provider failure of a control the displayed session reports as disabled
+// is classified as not supported.
+func (s *Server) controlErrorCode(t controlTarget, err error) (wsproto.ErrorCode, int) {
+	var (
+		ctlErr    *smtc.ControlError
+		syntaxErr *json.SyntaxError
+		typeErr   *json.UnmarshalTypeError
+	)
+	switch {
+	case errors.Is(err, smtc.ErrSessionNotFound):
+		return wsproto.CodeNoSession, http.StatusNotFound
+	case errors.Is(err, smtc.ErrNoSession):
+		return wsproto.CodeNoSession, http.StatusConflict
+	case errors.Is(err, smtc.ErrBusy):
+		return wsproto.CodeBusy, http.StatusServiceUnavailable
+	case errors.Is(err, ErrNoProgress), errors.Is(err, ErrNotSupported):
+		return wsproto.CodeNotSupported, http.StatusUnprocessableEntity
+	case errors.Is(err, bookmarks.ErrNotFound), errors.Is(err, ErrNoTrack), errors.Is(err, ErrMacroNotFound),
+		errors.Is(err, ErrTimerNotFound):
+		return wsproto.CodeNotFound, http.StatusNotFound
+	case errors.Is(err, errInvalidBody), errors.Is(err, errUnknownAction), errors.Is(err, errInvalidControl),
+		errors.Is(err, errInvalidBatchPayload), errors.Is(err, errUnsupportedMessage),
+		errors.Is(err, ErrInvalidSeek), errors.Is(err, ErrInvalidPlaybackRate), errors.Is(err, ErrInvalidRepeatMode),
+		errors.Is(err, ErrInvalidBatch), errors.Is(err, ErrInvalidTimer), errors.Is(err, errBookmarkNeedsDisplayedSession),
+		errors.Is(err, errWaitNeedsDisplayedSession), errors.As(err, &syntaxErr), errors.As(err, &typeErr):
+		return wsproto.CodeInvalidArgument, http.StatusBadRequest
+	case errors.Is(err, context.DeadlineExceeded):
+		return wsproto.CodeTimeout, http.StatusGatewayTimeout
+	case errors.As(err, &ctlErr):
+		if ctlErr.TimedOut {
+			return wsproto.CodeTimeout, http.StatusGatewayTimeout
+		}
+		if enabled, known := s.capabilitiesToMap()[ctlErr.Action]; t.appID == "" && known && !enabled {
+			return wsproto.CodeNotSupported, http.StatusUnprocessableEntity
+		}
+	}
+	return wsproto.CodeProviderError, http.StatusBadGateway
+}
+
+// writeControlError writes a failed REST control response.
+func (s *Server) writeControlError(w http.ResponseWriter, t controlTarget, err error) {
+	code, status := s.controlErrorCode(t, err)
+	writeJSON(w, status, map[string]any{"success": false, "error": err.Error(), "code": code})
+}
@@ -0,0 +1,52 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"smtc-now-playing/internal/smtc"
+	"smtc-now-playing/internal/wsproto"
+)
+
+func TestControlErrorCode(t *testing.T) {
+	srv, _, _ := newTestServer(t)
+	srv.handleCapabilitiesEvent(smtc.ControlCapabilities{IsPlayEnabled: true})
+	displayed := srv.targetFor("")
+	other := srv.targetFor("chrome.exe")
+
+	tests := []struct {
+		name       string
+		target     controlTarget
+		err        error
+		wantCode   wsproto.ErrorCode
+		wantStatus int
+	}{
+		{"no_session", displayed, smtc.ErrNoSession, wsproto.CodeNoSession, http.StatusConflict},
+		{"session_not_found", other, smtc.ErrSessionNotFound, wsproto.CodeNoSession, http.StatusNotFound},
+		{"busy", displayed, smtc.ErrBusy, wsproto.CodeBusy, http.StatusServiceUnavailable},
+		{"invalid_seek", displayed, fmt.Errorf("%w: bad", ErrInvalidSeek), wsproto.CodeInvalidArgument, http.StatusBadRequest},
+		{"bad_args", displayed, json.Unmarshal([]byte(`{`), &struct{}{}), wsproto.CodeInvalidArgument, http.StatusBadRequest},
+		{"no_track", displayed, ErrNoTrack, wsproto.CodeNotFound, http.StatusNotFound},
+		{"preflight", displayed, fmt.Errorf("%w: seek", ErrNotSupported), wsproto.CodeNotSupported, http.StatusUnprocessableEntity},
+		{"invalid_repeat", displayed, fmt.Errorf("%w: 7", ErrInvalidRepeatMode), wsproto.CodeInvalidArgument, http.StatusBadRequest},
+		{"no_timeline", displayed, ErrNoProgress, wsproto.CodeNotSupported, http.StatusUnprocessableEntity},
+		{"deadline", displayed, context.DeadlineExceeded, wsproto.CodeTimeout, http.StatusGatewayTimeout},
+		{"async_timeout", displayed, &smtc.ControlError{Action: "play", TimedOut: true}, wsproto.CodeTimeout, http.StatusGatewayTimeout},
+		{"disabled_control", displayed, &smtc.ControlError{Action: "seek", Status: 3}, wsproto.CodeNotSupported, http.StatusUnprocessableEntity},
+		{"enabled_control", displayed, &smtc.ControlError{Action: "play", Status: 3}, wsproto.CodeProviderError, http.StatusBadGateway},
+		{"other_session_control", other, &smtc.ControlError{Action: "seek", Status: 3}, wsproto.CodeProviderError, http.StatusBadGateway},
+		{"unknown", displayed, errors.New("boom"), wsproto.CodeProviderError, http.StatusBadGateway},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, status := srv.controlErrorCode(tt.target, tt.err)
+			if code != tt.wantCode || status != tt.wantStatus {
+				t.Fatalf("got %q/%d, want %q/%d", code, status, tt.wantCode, tt.wantStatus)
+			}
+		})
+	}
+}
@@ -0,0 +1,343 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"log/slog"
+	"math"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"smtc-now-playing/internal/bitmapfont"
+	"smtc-now-playing/internal/smtc"
+)
+
+// Key image kinds, served as /api/keys/{kind}.png.
+const (
+	keyArt      = "art"      // album art with a play/pause overlay
+	keyTitle    = "title"    // the title, scrolling when it does not fit
+	keyNext     = "next"     // next icon, greyed out when next is disabled
+	keyPrevious = "previous" // previous icon, greyed out when previous is disabled
+	keyProgress = "progress" // progress ring with the elapsed time
+)
+
+// errKeyNotFound is returned for key kinds that do not exist.
+var errKeyNotFound = errors.New("unknown key; want art, title, next, previous or progress")
+
+// keySizes are the key sizes of Stream Deck models: 72 for the original and
+// Mini, 96 for the XL, and 144 for high-DPI keys.
+var keySizes = []int{72, 96, 144}
+
+// keyRequest is a key image as asked for by its path and query.
+type keyRequest struct {
+	kind  string
+	size  int
+	frame int // title frame, or -1 to follow the clock
+}
+
+// parseKeyRequest reads the kind from file, such as "art.png", and size and
+// frame from query. Unknown kinds return errKeyNotFound.
+func parseKeyRequest(file string, query url.Values) (keyRequest, error) {
+	kind, ok := strings.CutSuffix(file, ".png")
+	switch {
+	case !ok:
+		return keyRequest{}, errKeyNotFound
+	case kind == keyArt, kind == keyTitle, kind == keyNext, kind == keyPrevious, kind == keyProgress:
+	default:
+		return keyRequest{}, errKeyNotFound
+	}
+	req := keyRequest{kind: kind, size: keySizes[0], frame: -1}
+	if raw := query.Get("size"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || !validKeySize(n) {
+			return keyRequest{}, errors.New("size must be 72, 96 or 144")
+		}
+		req.size = n
+	}
+	if raw := query.Get("frame"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 0 {
+			return keyRequest{}, errors.New("frame must be a non-negative integer")
+		}
+		req.frame = n
+	}
+	return req, nil
+}
+
+func validKeySize(n int) bool { return slices.Contains(keySizes, n) }
+
+// handleKey serves a square key image for Stream Deck style controllers.
+// Keys are rendered once per state revision and frame; the frame is the
+// scroll position of a title key and the elapsed second of a progress key,
+// so clients polling with If-None-Match only download keys that changed.
+func (s *Server) handleKey(w http.ResponseWriter, r *http.Request) {
+	req, err := parseKeyRequest(r.PathValue("file"), r.URL.Query())
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, errKeyNotFound) {
+			status = http.StatusNotFound
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+	state := s.snapshot()
+	frame := s.keyFrame(state, req, time.Now())
+	key := fmt.Sprintf("%d/%s/%d/%d", state.rev, req.kind, req.size, frame)
+	img, ok := s.keyCache.get(key)
+	if !ok {
+		data, ct, err := encodeArt(s.renderKey(state, req.kind, req.size, frame), "png")
+		if err != nil {
+			slog.Warn("failed to render key", "kind", req.kind, "err", err)
+			http.Error(w, "key cannot be rendered", http.StatusInternalServerError)
+			return
+		}
+		img = renderedArt{key: key, data: data, contentType: ct}
+		s.keyCache.put(img)
+	}
+	serveRendered(w, r, img)
+}
+
+// keyFrame returns the part of a key that changes without the state: the
+// scroll frame of a title key, wrapped to the length of its cycle, and the
+// elapsed second of a progress key. Other keys have a single frame.
+func (s *Server) keyFrame(state *stateSnapshot, req keyRequest, now time.Time) int {
+	switch req.kind {
+	case keyTitle:
+		frames := s.titleFrames(newCardText(state).title, req.size)
+		frame := req.frame
+		if frame < 0 {
+			frame = int(now.UnixMilli() / keyScrollFrame.Milliseconds())
+		}
+		return frame % frames
+	case keyProgress:
+		p := state.progress
+		if p == nil || p.Duration <= 0 {
+			return 0
+		}
+		pos := interpolatedPositionMs(p, now) / 1000
+		return int(min(max(pos, 0), int64(p.Duration)))
+	}
+	return 0
+}
+
+// renderKey draws the key of kind at size×size for state and frame.
+func (s *Server) renderKey(state *stateSnapshot, kind string, size, frame int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, size, size))
+	theme := cardThemes["dark"]
+	fillRect(img, img.Rect, theme.background)
+	disabled := mixColor(theme.title, theme.background, 0.7)
+	n := float64(size)
+	caps := state.caps
+
+	switch kind {
+	case keyArt:
+		s.drawCardArt(img, img.Rect, &s.keyArt, state, theme)
+		fillShape(img, color.RGBA{A: 0x99}, circle(n/2, n/2, n*0.22))
+		playing := state.progress != nil && state.progress.Status == smtc.StatusPlaying
+		icon, enabled := playIcon(n), caps.IsPlayEnabled
+		if playing {
+			icon, enabled = pauseIcon(n), caps.IsPauseEnabled
+		}
+		fillShape(img, pick(enabled, color.RGBA{0xff, 0xff, 0xff, 0xff}, disabled), icon)
+
+	case keyNext, keyPrevious:
+		icon, enabled := skipIcon(n, false), caps.IsNextEnabled
+		if kind == keyPrevious {
+			icon, enabled = skipIcon(n, true), caps.IsPreviousEnabled
+		}
+		fillShape(img, pick(enabled, theme.title, disabled), icon)
+
+	case keyTitle:
+		text := newCardText(state)
+		s.checkCardGlyphs(text)
+		title, artist := s.cardFace(size/5), s.cardFace(size/8)
+		pad := size / 12
+		y := size/2 - (title.Height()-title.Ascent())/2
+		if w := title.Width(text.title); w <= size-2*pad {
+			title.Draw(img, (size-w)/2, y, text.title, theme.title)
+		} else {
+			cycle, step := titleScroll(title, text.title, size)
+			x := pad - frame*step%cycle
+			title.Draw(img, x, y, text.title, theme.title)
+			title.Draw(img, x+cycle, y, text.title, theme.title)
+		}
+		line := artist.Truncate(text.artist, size-2*pad)
+		y += title.Height() - title.Ascent() + pad/2 + artist.Ascent()
+		artist.Draw(img, (size-artist.Width(line))/2, y, line, theme.artist)
+
+	case keyProgress:
+		outer, width := n/2-n/12, n/10
+		fillShape(img, theme.track, ring(n/2, n/2, outer-width, outer, 1))
+		label := "--:--"
+		if p := state.progress; p != nil && p.Duration > 0 {
+			fillShape(img, theme.fill, ring(n/2, n/2, outer-width, outer, float64(frame)/float64(p.Duration)))
+			label = clock(frame)
+		}
+		face := s.cardFace(size / 6)
+		if face.Width(label) > int(2*(outer-width))-2 {
+			face = s.cardFace(size / 9)
+		}
+		face.Draw(img, (size-face.Width(label))/2, (size+face.Ascent())/2, label, theme.title)
+	}
+	return img
+}
+
+// titleFrames is how many frames a title key takes to scroll through title
+// once: 1 when it fits.
+func (s *Server) titleFrames(title string, size int) int {
+	face := s.cardFace(size / 5)
+	if face.Width(title) <= size-2*(size/12) {
+		return 1
+	}
+	cycle, step := titleScroll(face, title, size)
+	return (cycle + step - 1) / step
+}
+
+// titleScroll returns the distance after which a scrolling title repeats,
+// including the gap before the next copy, and how far it moves per frame.
+func titleScroll(face *bitmapfont.Face, title string, size int) (cycle, step int) {
+	return face.Width(title) + size/3, max(1, size/24)
+}
+
+func pick(ok bool, yes, no color.RGBA) color.RGBA {
+	if ok {
+		return yes
+	}
+	return no
+}
+
+// shape reports whether a point is inside it and the pixels it can touch.
+type shape struct {
+	bounds image.Rectangle
+	inside func(x, y float64) bool
+}
+
+// fillShape paints sh onto img in c, antialiased by sampling each pixel 4×4
+// times.
+func fillShape(img *image.RGBA, c color.RGBA, sh shape) {
+	r := sh.bounds.Intersect(img.Rect)
+	for py := r.Min.Y; py < r.Max.Y; py++ {
+		for px := r.Min.X; px < r.Max.X; px++ {
+			hits := 0
+			for sy := 0; sy < 4; sy++ {
+				for sx := 0; sx < 4; sx++ {
+					if sh.inside(float64(px)+(float64(sx)+0.5)/4, float64(py)+(float64(sy)+0.5)/4) {
+						hits++
+					}
+				}
+			}
+			if hits > 0 {
+				blend(img, px, py, c, float64(hits)/16)
+			}
+		}
+	}
+}
+
+// blend paints c over the pixel at x, y with coverage cov.
+func blend(img *image.RGBA, x, y int, c color.RGBA, cov float64) {
+	a := cov * float64(c.A) / 0xff
+	i := img.PixOffset(x, y)
+	for ch, v := range [4]uint8{c.R, c.G, c.B, 0xff} {
+		img.Pix[i+ch] = uint8(float64(v)*a + float64(img.Pix[i+ch])*(1-a) + 0.5)
+	}
+}
+
+func boundsOf(x0, y0, x1, y1 float64) image.Rectangle {
+	return image.Rect(int(math.Floor(x0)), int(math.Floor(y0)), int(math.Ceil(x1)), int(math.Ceil(y1)))
+}
+
+func circle(cx, cy, radius float64) shape {
+	return shape{
+		bounds: boundsOf(cx-radius, cy-radius, cx+radius, cy+radius),
+		inside: func(x, y float64) bool { return math.Hypot(x-cx, y-cy) <= radius },
+	}
+}
+
+// ring is the part of the annulus between inner and outer covering
+// fraction of the turn, clockwise from the top.
+func ring(cx, cy, inner, outer, fraction float64) shape {
+	return shape{
+		bounds: boundsOf(cx-outer, cy-outer, cx+outer, cy+outer),
+		inside: func(x, y float64) bool {
+			d := math.Hypot(x-cx, y-cy)
+			if d < inner || d > outer {
+				return false
+			}
+			angle := math.Atan2(x-cx, cy-y) / (2 * math.Pi)
+			if angle < 0 {
+				angle++
+			}
+			return angle <= fraction
+		},
+	}
+}
+
+// polygon is a convex polygon with points in clockwise order.
+func polygon(pts ...[2]float64) shape {
+	x0, y0, x1, y1 := math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)
+	for _, p := range pts {
+		x0, y0, x1, y1 = min(x0, p[0]), min(y0, p[1]), max(x1, p[0]), max(y1, p[1])
+	}
+	return shape{
+		bounds: boundsOf(x0, y0, x1, y1),
+		inside: func(x, y float64) bool {
+			for i, a := range pts {
+				b := pts[(i+1)%len(pts)]
+				if (b[0]-a[0])*(y-a[1])-(b[1]-a[1])*(x-a[0]) < 0 {
+					return false
+				}
+			}
+			return true
+		},
+	}
+}
+
+// union combines shapes.
+func union(shapes ...shape) shape {
+	sh := shape{inside: func(x, y float64) bool {
+		for _, s := range shapes {
+			if s.inside(x, y) {
+				return true
+			}
+		}
+		return false
+	}}
+	for _, s := range shapes {
+		sh.bounds = sh.bounds.Union(s.bounds)
+	}
+	return sh
+}
+
+// playIcon is a triangle pointing right, centred on a key of side n.
+func playIcon(n float64) shape {
+	return polygon([2]float64{n * 0.43, n * 0.39}, [2]float64{n * 0.61, n * 0.5}, [2]float64{n * 0.43, n * 0.61})
+}
+
+// pauseIcon is two bars, centred on a key of side n.
+func pauseIcon(n float64) shape {
+	bar := func(x float64) shape {
+		return polygon([2]float64{x, n * 0.4}, [2]float64{x + n*0.06, n * 0.4}, [2]float64{x + n*0.06, n * 0.6}, [2]float64{x, n * 0.6})
+	}
+	return union(bar(n*0.41), bar(n*0.53))
+}
+
+// skipIcon is a triangle against a bar, pointing right for next or left for
+// previous, filling the middle of a key of side n.
+func skipIcon(n float64, previous bool) shape {
+	tri := polygon([2]float64{n * 0.3, n * 0.3}, [2]float64{n * 0.62, n * 0.5}, [2]float64{n * 0.3, n * 0.7})
+	bar := polygon([2]float64{n * 0.62, n * 0.3}, [2]float64{n * 0.7, n * 0.3}, [2]float64{n * 0.7, n * 0.7}, [2]float64{n * 0.62, n * 0.7})
+	icon := union(tri, bar)
+	if !previous {
+		return icon
+	}
+	return shape{
+		bounds: boundsOf(n*0.3, n*0.3, n*0.7, n*0.7),
+		inside: func(x, y float64) bool { return icon.inside(n-x, y) },
+	}
+}
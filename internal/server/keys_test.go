@@ -0,0 +1,113 @@
+package server
+
+import (
+	"errors"
+	"image"
+	"image/png"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"smtc-now-playing/internal/domain"
+	"smtc-now-playing/internal/smtc"
+)
+
+func TestParseKeyRequest(t *testing.T) {
+	tests := []struct {
+		file, query       string
+		want              keyRequest
+		wantErr, notFound bool
+	}{
+		{"art.png", "", keyRequest{kind: "art", size: 72, frame: -1}, false, false},
+		{"title.png", "size=144&frame=3", keyRequest{kind: "title", size: 144, frame: 3}, false, false},
+		{"progress.png", "size=96", keyRequest{kind: "progress", size: 96, frame: -1}, false, false},
+		{"stop.png", "", keyRequest{}, true, true},
+		{"next.jpg", "", keyRequest{}, true, true},
+		{"next.png", "size=100", keyRequest{}, true, false},
+		{"title.png", "frame=-1", keyRequest{}, true, false},
+	}
+	for _, tt := range tests {
+		query, _ := url.ParseQuery(tt.query)
+		got, err := parseKeyRequest(tt.file, query)
+		if (err != nil) != tt.wantErr || errors.Is(err, errKeyNotFound) != tt.notFound || got != tt.want {
+			t.Errorf("parseKeyRequest(%q, %q) = %+v, %v; want %+v, error %v", tt.file, tt.query, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestHandleKey(t *testing.T) {
+	srv, _, _ := newTestServer(t)
+	srv.handleInfoEvent(domain.InfoData{Artist: "Artist", Title: "Title", ThumbnailData: testPNG(t, 64, 64)})
+	srv.handleProgressEvent(domain.ProgressData{Position: 30, Duration: 240, Status: smtc.StatusPaused})
+	handler := srv.setupRoutes()
+
+	for _, kind := range []string{"art", "title", "next", "previous", "progress"} {
+		w := serveLocal(handler, http.MethodGet, "/api/keys/"+kind+".png?size=96", "")
+		if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "image/png" || w.Header().Get("ETag") == "" {
+			t.Fatalf("%s: got %d %q etag %q", kind, w.Code, w.Header().Get("Content-Type"), w.Header().Get("ETag"))
+		}
+		img, err := png.Decode(w.Body)
+		if err != nil {
+			t.Fatalf("%s: decode: %v", kind, err)
+		}
+		if size := img.Bounds().Size(); size != image.Pt(96, 96) {
+			t.Fatalf("%s: key is %v, want 96x96", kind, size)
+		}
+	}
+
+	if w := serveLocal(handler, http.MethodGet, "/api/keys/stop.png", ""); w.Code != http.StatusNotFound {
+		t.Fatalf("unknown kind: got %d want %d", w.Code, http.StatusNotFound)
+	}
+	if w := serveLocal(handler, http.MethodGet, "/api/keys/art.png?size=100", ""); w.Code != http.StatusBadRequest {
+		t.Fatalf("bad size: got %d want %d", w.Code, http.StatusBadRequest)
+	}
+}
+
+func TestHandleKey_GreyedOutByCapabilities(t *testing.T) {
+	srv, _, _ := newTestServer(t)
+	handler := srv.setupRoutes()
+
+	disabled := serveLocal(handler, http.MethodGet, "/api/keys/next.png", "").Header().Get("ETag")
+	srv.handleCapabilitiesEvent(smtc.ControlCapabilities{IsNextEnabled: true})
+	enabled := serveLocal(handler, http.MethodGet, "/api/keys/next.png", "")
+	if enabled.Header().Get("ETag") == disabled {
+		t.Fatal("next key did not change when next was enabled")
+	}
+
+	img, err := png.Decode(enabled.Body)
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	// The middle of the triangle is white only while next is enabled.
+	if r, g, b, _ := img.At(30, 36).RGBA(); r>>8 != 0xff || g>>8 != 0xff || b>>8 != 0xff {
+		t.Fatalf("enabled icon pixel = %v, want white", img.At(30, 36))
+	}
+}
+
+func TestKeyFrame(t *testing.T) {
+	srv, _, _ := newTestServer(t)
+	srv.handleInfoEvent(domain.InfoData{Artist: "Artist", Title: "A title far too long to fit on a key"})
+	now := time.UnixMilli(1_000_000)
+	srv.handleProgressEvent(domain.ProgressData{Position: 30, Duration: 240, Status: smtc.StatusPlaying, LastUpdatedTime: now.UnixMilli()})
+	state := srv.snapshot()
+
+	frames := srv.titleFrames(newCardText(state).title, 72)
+	if frames <= 1 {
+		t.Fatalf("long title has %d frames, want it to scroll", frames)
+	}
+	if got := srv.keyFrame(state, keyRequest{kind: keyTitle, size: 72, frame: frames + 2}, now); got != 2 {
+		t.Fatalf("title frame = %d, want it wrapped to 2", got)
+	}
+	if got := srv.keyFrame(state, keyRequest{kind: keyProgress, size: 72, frame: -1}, now.Add(5*time.Second)); got != 35 {
+		t.Fatalf("progress frame = %d, want the interpolated 35s", got)
+	}
+	if got := srv.keyFrame(state, keyRequest{kind: keyProgress, size: 72, frame: -1}, now.Add(time.Hour)); got != 240 {
+		t.Fatalf("progress frame = %d, want it clamped to the 240s duration", got)
+	}
+
+	srv.handleInfoEvent(domain.InfoData{Artist: "Artist", Title: "Short"})
+	if got := srv.keyFrame(srv.snapshot(), keyRequest{kind: keyTitle, size: 72, frame: 7}, now); got != 0 {
+		t.Fatalf("title that fits has frame %d, want 0", got)
+	}
+}
@@ -0,0 +1,68 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"smtc-now-playing/internal/palette"
+	"smtc-now-playing/internal/wsproto"
+)
+
+// artPalette picks the palette of decoded album art.
+func artPalette(img image.Image) *wsproto.PalettePayload {
+	p := palette.Extract(img)
+	return &wsproto.PalettePayload{
+		Dominant:     palette.Hex(p.Dominant),
+		Vibrant:      palette.Hex(p.Vibrant),
+		Muted:        palette.Hex(p.Muted),
+		LightVibrant: palette.Hex(p.LightVibrant),
+		DarkVibrant:  palette.Hex(p.DarkVibrant),
+		LightMuted:   palette.Hex(p.LightMuted),
+		DarkMuted:    palette.Hex(p.DarkMuted),
+		Text:         palette.Hex(p.Text),
+		TextContrast: p.TextContrast,
+	}
+}
+
+// paletteCSS renders p as CSS custom properties on :root.
+func paletteCSS(p *wsproto.PalettePayload) string {
+	var b strings.Builder
+	b.WriteString(":root {\n")
+	for _, prop := range []struct{ name, value string }{
+		{"dominant", p.Dominant},
+		{"vibrant", p.Vibrant},
+		{"muted", p.Muted},
+		{"light-vibrant", p.LightVibrant},
+		{"dark-vibrant", p.DarkVibrant},
+		{"light-muted", p.LightMuted},
+		{"dark-muted", p.DarkMuted},
+		{"text", p.Text},
+		{"text-contrast", strconv.FormatFloat(p.TextContrast, 'f', -1, 64)},
+	} {
+		fmt.Fprintf(&b, "  --art-%s: %s;\n", prop.name, prop.value)
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+func (s *Server) handlePaletteCSS(w http.ResponseWriter, r *http.Request) {
+	rec, ok := s.lookupArt(w, r)
+	if !ok {
+		return
+	}
+	if rec.palette == nil {
+		// Art indexed from the disk cache gets its palette on first use.
+		img, _, err := image.Decode(bytes.NewReader(rec.data))
+		if err != nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		rec.palette = artPalette(img)
+		s.artHistory.setPalette(rec.hash, rec.palette)
+	}
+	serveArt(w, r, rec.hash+"/palette", "text/css; charset=utf-8", []byte(paletteCSS(rec.palette)))
+}
@@ -0,0 +1,117 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"smtc-now-playing/internal/domain"
+	"smtc-now-playing/internal/smtc"
+)
+
+func TestHandleInfoEvent_Palette(t *testing.T) {
+	srv, _, _ := newTestServer(t)
+	srv.handleInfoEvent(domain.InfoData{Artist: "Artist", Title: "Title", ThumbnailData: testPNG(t, 40, 20)})
+
+	p := waitArtDerived(t, srv).currentPalette()
+	if p == nil {
+		t.Fatal("palette not computed for decodable art")
+	}
+	if p.Dominant != "#0000ff" && p.Dominant != "#ff0000" {
+		t.Fatalf("dominant = %s, want red or blue", p.Dominant)
+	}
+	if p.Text != "#ffffff" || p.TextContrast < 4.5 {
+		t.Fatalf("text = %s at %.2f, want readable white", p.Text, p.TextContrast)
+	}
+
+	srv.handleInfoEvent(domain.InfoData{Artist: "Artist", Title: "Next", ThumbnailData: testPNG(t, 40, 20)})
+	if srv.snapshot().currentPalette() != p {
+		t.Fatal("palette recomputed although the art did not change")
+	}
+
+	srv.handleInfoEvent(domain.InfoData{Artist: "Artist", Title: "No art"})
+	if srv.snapshot().currentPalette() != nil {
+		t.Fatal("palette kept after the art was removed")
+	}
+
+	srv.handleInfoEvent(domain.InfoData{Artist: "Artist", Title: "Broken", ThumbnailData: []byte{0x01, 0x02}})
+	if waitArtDerived(t, srv).currentPalette() != nil {
+		t.Fatal("palette computed for undecodable art")
+	}
+}
+
+func TestProcessEvents_RepublishesInfoWithPalette(t *testing.T) {
+	srv, svc, _ := newTestServer(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go srv.processEvents(ctx, svc.events)
+
+	svc.events <- smtc.InfoEvent{Data: domain.InfoData{Artist: "Artist", Title: "Title", ThumbnailData: testPNG(t, 40, 20)}}
+	deadline := time.Now().Add(5 * time.Second)
+	for !bytes.Contains(srv.snapshot().infoJSON, []byte(`"palette"`)) {
+		if time.Now().After(deadline) {
+			t.Fatalf("info not republished with the palette: %s", srv.snapshot().infoJSON)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestHandleNowPlaying_IncludesPalette(t *testing.T) {
+	srv, _, _ := newTestServer(t)
+	srv.handleInfoEvent(domain.InfoData{Artist: "Artist", Title: "Title", ThumbnailData: testPNG(t, 40, 20)})
+	waitArtDerived(t, srv)
+
+	w := serveLocal(srv.setupRoutes(), http.MethodGet, "/api/now-playing", "")
+	var body struct {
+		Info struct {
+			Palette *struct {
+				Dominant string `json:"dominant"`
+				Text     string `json:"text"`
+			} `json:"palette"`
+		} `json:"info"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if body.Info.Palette == nil || body.Info.Palette.Dominant == "" || body.Info.Palette.Text == "" {
+		t.Fatalf("palette missing from %s", w.Body.String())
+	}
+}
+
+func TestHandlePaletteCSS(t *testing.T) {
+	srv, _, _ := newTestServer(t)
+	srv.handleInfoEvent(domain.InfoData{Artist: "Artist", Title: "Title", ThumbnailData: testPNG(t, 40, 20)})
+	handler := srv.setupRoutes()
+	state := waitArtDerived(t, srv)
+
+	w := serveLocal(handler, http.MethodGet, srv.albumArtURL(state.artHash())+"/palette.css", "")
+	if w.Code != http.StatusOK || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/css") {
+		t.Fatalf("got %d %q", w.Code, w.Header().Get("Content-Type"))
+	}
+	css := w.Body.String()
+	for _, want := range []string{
+		":root {",
+		"--art-dominant: " + state.art.palette.Dominant + ";",
+		"--art-light-vibrant: " + state.art.palette.LightVibrant + ";",
+		"--art-text: #ffffff;",
+		"--art-text-contrast: ",
+	} {
+		if !strings.Contains(css, want) {
+			t.Errorf("css missing %q:\n%s", want, css)
+		}
+	}
+
+	if w := serveLocal(handler, http.MethodGet, "/albumArt/deadbeef/palette.css", ""); w.Code != http.StatusNotFound {
+		t.Fatalf("unknown hash: got %d want %d", w.Code, http.StatusNotFound)
+	}
+
+	srv.handleInfoEvent(domain.InfoData{Artist: "Artist", Title: "Broken", ThumbnailData: []byte{0x01, 0x02}})
+	path := srv.albumArtURL(srv.snapshot().artHash()) + "/palette.css"
+	if w := serveLocal(handler, http.MethodGet, path, ""); w.Code != http.StatusNotFound {
+		t.Fatalf("undecodable art: got %d want %d", w.Code, http.StatusNotFound)
+	}
+}
@@ -0,0 +1,210 @@
+package server
+
+import (
+	"log/slog"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+
+	"smtc-now-playing/internal/config"
+	"smtc-now-playing/internal/smtc"
+)
+
+// policyAction is a control the exclusive playback policy issues to a session.
+type policyAction struct {
+	appID  string
+	action string // "pause" or "play"
+}
+
+// interruption records the sessions paused when a session started playing.
+type interruption struct {
+	by     string
+	paused []string
+}
+
+// exclusivePolicy tracks the playback status of every session and decides
+// which sessions to pause or resume under the exclusive playback policy.
+type exclusivePolicy struct {
+	mu       sync.Mutex
+	statuses map[string]int
+	// interruptions is ordered oldest first, so nested interrupters unwind
+	// in reverse.
+	interruptions []interruption
+}
+
+func newExclusivePolicy() *exclusivePolicy {
+	return &exclusivePolicy{statuses: make(map[string]int)}
+}
+
+// observe records a session status change and returns the controls cfg
+// calls for. Status is always tracked so enabling the policy at runtime
+// acts on the current state.
+func (p *exclusivePolicy) observe(cfg config.ExclusivePlaybackConfig, appID string, status int) []policyAction {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	prev, known := p.statuses[appID]
+	if status == smtc.StatusClosed {
+		delete(p.statuses, appID)
+		// Runs after release so a closing interrupter still resumes others.
+		defer p.forget(appID)
+	} else {
+		p.statuses[appID] = status
+	}
+
+	if !cfg.Enabled || (known && prev == status) || policyExempt(cfg, appID) {
+		return nil
+	}
+	switch status {
+	case smtc.StatusPlaying:
+		return p.interrupt(cfg, appID)
+	case smtc.StatusPaused, smtc.StatusStopped, smtc.StatusClosed:
+		return p.release(cfg, appID, status)
+	}
+	return nil
+}
+
+// interrupt pauses every other playing, non-exempt session on behalf of appID.
+// Must be called with p.mu held.
+func (p *exclusivePolicy) interrupt(cfg config.ExclusivePlaybackConfig, appID string) []policyAction {
+	// A session that resumes on its own is no longer waiting to be resumed.
+	p.dropPaused(appID)
+
+	var paused []string
+	for other, status := range p.statuses {
+		if other != appID && status == smtc.StatusPlaying && !policyExempt(cfg, other) {
+			paused = append(paused, other)
+		}
+	}
+	if len(paused) == 0 {
+		return nil
+	}
+	slices.Sort(paused)
+
+	actions := make([]policyAction, len(paused))
+	for i, other := range paused {
+		actions[i] = policyAction{appID: other, action: "pause"}
+	}
+	if prev, ok := p.removeInterruption(appID); ok {
+		paused = append(prev.paused, paused...)
+	}
+	p.interruptions = append(p.interruptions, interruption{by: appID, paused: paused})
+	return actions
+}
+
+// release resumes the sessions appID paused, when auto-resume is enabled and
+// they are still paused. If appID was itself paused by another interrupter,
+// its sessions keep waiting and are handed over to that interrupter should
+// appID close. Must be called with p.mu held.
+func (p *exclusivePolicy) release(cfg config.ExclusivePlaybackConfig, appID string, status int) []policyAction {
+	if holder, ok := p.pausedBy(appID); ok {
+		if status == smtc.StatusClosed {
+			if in, ok := p.removeInterruption(appID); ok {
+				for i := range p.interruptions {
+					if p.interruptions[i].by == holder {
+						p.interruptions[i].paused = append(p.interruptions[i].paused, in.paused...)
+					}
+				}
+			}
+		}
+		return nil
+	}
+
+	in, ok := p.removeInterruption(appID)
+	if !ok || !cfg.AutoResume {
+		return nil
+	}
+	var actions []policyAction
+	for _, other := range in.paused {
+		if p.statuses[other] == smtc.StatusPaused {
+			actions = append(actions, policyAction{appID: other, action: "play"})
+		}
+	}
+	return actions
+}
+
+// forget drops everything recorded about a session that went away.
+// Must be called with p.mu held.
+func (p *exclusivePolicy) forget(appID string) {
+	p.removeInterruption(appID)
+	p.dropPaused(appID)
+}
+
+// removeInterruption removes and returns the interruption made by appID.
+func (p *exclusivePolicy) removeInterruption(appID string) (interruption, bool) {
+	for i, in := range p.interruptions {
+		if in.by == appID {
+			p.interruptions = append(p.interruptions[:i], p.interruptions[i+1:]...)
+			return in, true
+		}
+	}
+	return interruption{}, false
+}
+
+// dropPaused removes appID from the paused lists of all interruptions,
+// discarding interruptions left with nothing to resume.
+func (p *exclusivePolicy) dropPaused(appID string) {
+	kept := p.interruptions[:0]
+	for _, in := range p.interruptions {
+		paused := in.paused[:0]
+		for _, other := range in.paused {
+			if other != appID {
+				paused = append(paused, other)
+			}
+		}
+		if len(paused) > 0 {
+			kept = append(kept, interruption{by: in.by, paused: paused})
+		}
+	}
+	p.interruptions = kept
+}
+
+// pausedBy returns the interrupter that paused appID, if any.
+func (p *exclusivePolicy) pausedBy(appID string) (string, bool) {
+	for _, in := range p.interruptions {
+		if slices.Contains(in.paused, appID) {
+			return in.by, true
+		}
+	}
+	return "", false
+}
+
+// policyExempt reports whether appID matches one of the configured exceptions.
+func policyExempt(cfg config.ExclusivePlaybackConfig, appID string) bool {
+	id := strings.ToLower(appID)
+	for _, pattern := range cfg.Exceptions {
+		if ok, _ := path.Match(strings.ToLower(pattern), id); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// handleSessionStatusEvent feeds the exclusive playback policy and issues the
+// resulting controls. They run on their own goroutine because each one
+// round-trips through the SMTC goroutine, which must not stall event delivery.
+func (s *Server) handleSessionStatusEvent(appID string, status int) {
+	actions := s.policy.observe(s.cfg.Policy.ExclusivePlayback, appID, status)
+	if len(actions) > 0 {
+		go s.applyPolicyActions(actions)
+	}
+}
+
+// applyPolicyActions issues the controls decided by the exclusive playback policy.
+func (s *Server) applyPolicyActions(actions []policyAction) {
+	for _, a := range actions {
+		ctl := s.svc.Session(a.appID)
+		var err error
+		if a.action == "pause" {
+			err = ctl.Pause()
+		} else {
+			err = ctl.Play()
+		}
+		if err != nil {
+			slog.Warn("exclusive playback control failed", "appID", a.appID, "action", a.action, "err", err)
+			continue
+		}
+		slog.Debug("exclusive playback control", "appID", a.appID, "action", a.action)
+	}
+}
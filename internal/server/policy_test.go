@@ -0,0 +1,159 @@
+package server
+
+import (
+	"reflect"
+	"testing"
+
+	"smtc-now-playing/internal/config"
+	"smtc-now-playing/internal/smtc"
+)
+
+func TestExclusivePolicy(t *testing.T) {
+	type step struct {
+		appID  string
+		status int
+		want   []policyAction
+	}
+	enabled := config.ExclusivePlaybackConfig{Enabled: true, AutoResume: true}
+
+	tests := []struct {
+		name  string
+		cfg   config.ExclusivePlaybackConfig
+		steps []step
+	}{
+		{
+			name: "disabled",
+			cfg:  config.ExclusivePlaybackConfig{},
+			steps: []step{
+				{"Spotify.exe", smtc.StatusPlaying, nil},
+				{"Chrome", smtc.StatusPlaying, nil},
+			},
+		},
+		{
+			name: "pause_others_and_resume",
+			cfg:  enabled,
+			steps: []step{
+				{"Spotify.exe", smtc.StatusPlaying, nil},
+				{"Chrome", smtc.StatusPlaying, []policyAction{{"Spotify.exe", "pause"}}},
+				{"Spotify.exe", smtc.StatusPaused, nil},
+				{"Chrome", smtc.StatusPaused, []policyAction{{"Spotify.exe", "play"}}},
+			},
+		},
+		{
+			name: "no_resume_without_auto_resume",
+			cfg:  config.ExclusivePlaybackConfig{Enabled: true},
+			steps: []step{
+				{"Spotify.exe", smtc.StatusPlaying, nil},
+				{"Chrome", smtc.StatusPlaying, []policyAction{{"Spotify.exe", "pause"}}},
+				{"Spotify.exe", smtc.StatusPaused, nil},
+				{"Chrome", smtc.StatusStopped, nil},
+			},
+		},
+		{
+			name: "resume_when_interrupter_closes",
+			cfg:  enabled,
+			steps: []step{
+				{"Spotify.exe", smtc.StatusPlaying, nil},
+				{"Chrome", smtc.StatusPlaying, []policyAction{{"Spotify.exe", "pause"}}},
+				{"Spotify.exe", smtc.StatusPaused, nil},
+				{"Chrome", smtc.StatusClosed, []policyAction{{"Spotify.exe", "play"}}},
+			},
+		},
+		{
+			name: "manually_resumed_session_is_not_resumed_again",
+			cfg:  enabled,
+			steps: []step{
+				{"Spotify.exe", smtc.StatusPlaying, nil},
+				{"Chrome", smtc.StatusPlaying, []policyAction{{"Spotify.exe", "pause"}}},
+				{"Spotify.exe", smtc.StatusPaused, nil},
+				{"Spotify.exe", smtc.StatusPlaying, []policyAction{{"Chrome", "pause"}}},
+				{"Chrome", smtc.StatusPaused, nil},
+				{"Spotify.exe", smtc.StatusPaused, []policyAction{{"Chrome", "play"}}},
+			},
+		},
+		{
+			name: "nested_interrupters_unwind",
+			cfg:  enabled,
+			steps: []step{
+				{"A", smtc.StatusPlaying, nil},
+				{"B", smtc.StatusPlaying, []policyAction{{"A", "pause"}}},
+				{"A", smtc.StatusPaused, nil},
+				{"C", smtc.StatusPlaying, []policyAction{{"B", "pause"}}},
+				{"B", smtc.StatusPaused, nil},
+				{"C", smtc.StatusPaused, []policyAction{{"B", "play"}}},
+				{"B", smtc.StatusPlaying, nil},
+				{"B", smtc.StatusStopped, []policyAction{{"A", "play"}}},
+			},
+		},
+		{
+			name: "closed_interrupter_hands_over_paused_sessions",
+			cfg:  enabled,
+			steps: []step{
+				{"A", smtc.StatusPlaying, nil},
+				{"B", smtc.StatusPlaying, []policyAction{{"A", "pause"}}},
+				{"A", smtc.StatusPaused, nil},
+				{"C", smtc.StatusPlaying, []policyAction{{"B", "pause"}}},
+				{"B", smtc.StatusPaused, nil},
+				{"B", smtc.StatusClosed, nil},
+				{"C", smtc.StatusPaused, []policyAction{{"A", "play"}}},
+			},
+		},
+		{
+			name: "exceptions_neither_pause_nor_get_paused",
+			cfg:  config.ExclusivePlaybackConfig{Enabled: true, Exceptions: []string{"discord*"}},
+			steps: []step{
+				{"Discord.exe", smtc.StatusPlaying, nil},
+				{"Spotify.exe", smtc.StatusPlaying, nil},
+				{"Discord.exe", smtc.StatusPaused, nil},
+				{"Discord.exe", smtc.StatusPlaying, nil},
+			},
+		},
+		{
+			name: "repeated_status_is_ignored",
+			cfg:  enabled,
+			steps: []step{
+				{"Spotify.exe", smtc.StatusPlaying, nil},
+				{"Chrome", smtc.StatusPlaying, []policyAction{{"Spotify.exe", "pause"}}},
+				{"Chrome", smtc.StatusPlaying, nil},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newExclusivePolicy()
+			for i, st := range tt.steps {
+				got := p.observe(tt.cfg, st.appID, st.status)
+				if !reflect.DeepEqual(got, st.want) {
+					t.Fatalf("step %d (%s → %d): got %v want %v", i, st.appID, st.status, got, st.want)
+				}
+			}
+		})
+	}
+}
+
+func TestExclusivePolicy_PausesAllOthersInOrder(t *testing.T) {
+	p := newExclusivePolicy()
+	// Statuses are tracked while disabled, so enabling acts on them.
+	var disabled config.ExclusivePlaybackConfig
+	p.observe(disabled, "C", smtc.StatusPlaying)
+	p.observe(disabled, "A", smtc.StatusPlaying)
+	p.observe(disabled, "B", smtc.StatusPaused)
+
+	got := p.observe(config.ExclusivePlaybackConfig{Enabled: true}, "D", smtc.StatusPlaying)
+	want := []policyAction{{"A", "pause"}, {"C", "pause"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v want %v", got, want)
+	}
+}
+
+func TestApplyPolicyActions_TargetsSessions(t *testing.T) {
+	srv, svc, _ := newTestServer(t)
+	svc.pauseErr = smtc.ErrSessionNotFound
+
+	srv.applyPolicyActions([]policyAction{{"Spotify.exe", "pause"}, {"Chrome", "play"}})
+
+	if want := []string{"Spotify.exe", "Chrome"}; !reflect.DeepEqual(svc.sessionTargets, want) {
+		t.Fatalf("sessionTargets = %v, want %v", svc.sessionTargets, want)
+	}
+}
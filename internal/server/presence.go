@@ -0,0 +1,133 @@
+package server
+
+import (
+	"sync"
+	"time"
+
+	"smtc-now-playing/internal/smtc"
+	"smtc-now-playing/internal/wsproto"
+)
+
+// presenceTracker owns the presence state machine of the displayed session.
+// Playback status moves it between active, paused and closed; a timer moves
+// paused to idle once the configured threshold passes.
+type presenceTracker struct {
+	mu     sync.Mutex
+	state  wsproto.PresenceState
+	since  time.Time
+	status int // playback status that led to state
+	timer  *time.Timer
+	gen    uint64 // bumped on every status change to retire stale timers
+}
+
+// presenceFor maps a playback status to its presence state. ok is false for
+// Changing, which is a transition between tracks and keeps the current state.
+func presenceFor(status int) (state wsproto.PresenceState, ok bool) {
+	switch status {
+	case smtc.StatusPlaying:
+		return wsproto.PresenceActive, true
+	case smtc.StatusPaused, smtc.StatusStopped, smtc.StatusOpened:
+		return wsproto.PresencePaused, true
+	case smtc.StatusChanging:
+		return "", false
+	}
+	return wsproto.PresenceClosed, true
+}
+
+// idleAfter returns how long status may last before the session is idle,
+// or 0 when it never goes idle.
+func (s *Server) idleAfter(status int) time.Duration {
+	cfg := s.cfg.Presence
+	switch status {
+	case smtc.StatusPaused:
+		return time.Duration(cfg.IdleAfterPaused) * time.Second
+	case smtc.StatusStopped, smtc.StatusOpened:
+		return time.Duration(cfg.IdleAfterStopped) * time.Second
+	}
+	return 0
+}
+
+// Presence returns the current presence state.
+func (s *Server) Presence() wsproto.PresencePayload {
+	p := &s.presence
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.payload()
+}
+
+// payload returns the current state. Must be called with mu held.
+func (p *presenceTracker) payload() wsproto.PresencePayload {
+	if p.state == "" {
+		return wsproto.PresencePayload{State: wsproto.PresenceClosed}
+	}
+	return wsproto.PresencePayload{State: p.state, Since: p.since.UnixMilli()}
+}
+
+// updatePresence feeds a playback status into the state machine and
+// broadcasts the new state when it changes. A paused or stopped status arms
+// the idle timer; repeated reports of the same status leave it running.
+func (s *Server) updatePresence(status int) {
+	state, ok := presenceFor(status)
+	if !ok {
+		return
+	}
+	p := &s.presence
+	p.mu.Lock()
+	if p.state != "" && p.status == status {
+		p.mu.Unlock()
+		return
+	}
+	// Paused and stopped share a state but may have different thresholds,
+	// so switching between them restarts the timer without a new state.
+	changed := p.state != state && !(p.state == wsproto.PresenceIdle && state == wsproto.PresencePaused)
+	p.status = status
+	p.gen++
+	if p.timer != nil {
+		p.timer.Stop()
+		p.timer = nil
+	}
+	now := time.Now()
+	if changed {
+		p.state = state
+		p.since = now
+	}
+	if wait := s.idleAfter(status); wait > 0 && p.state != wsproto.PresenceIdle {
+		gen := p.gen
+		p.timer = time.AfterFunc(wait, func() { s.enterIdle(gen) })
+	}
+	payload := p.payload()
+	p.mu.Unlock()
+
+	if changed {
+		s.broadcastEnvelope(wsproto.NewPresence(payload))
+	}
+}
+
+// enterIdle moves the session to idle unless the status changed since the
+// timer of gen was armed.
+func (s *Server) enterIdle(gen uint64) {
+	p := &s.presence
+	p.mu.Lock()
+	if p.gen != gen || p.state != wsproto.PresencePaused {
+		p.mu.Unlock()
+		return
+	}
+	p.state = wsproto.PresenceIdle
+	p.since = time.Now()
+	p.timer = nil
+	payload := p.payload()
+	p.mu.Unlock()
+
+	s.broadcastEnvelope(wsproto.NewPresence(payload))
+}
+
+// stopPresence stops the idle timer.
+func (s *Server) stopPresence() {
+	p := &s.presence
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.timer != nil {
+		p.timer.Stop()
+		p.timer = nil
+	}
+}
@@ -0,0 +1,114 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"smtc-now-playing/internal/config"
+	"smtc-now-playing/internal/domain"
+	"smtc-now-playing/internal/smtc"
+	"smtc-now-playing/internal/wsproto"
+)
+
+func newPresenceTestServer(t *testing.T, cfg config.PresenceConfig) *Server {
+	t.Helper()
+	srv, _, _ := newTestServer(t)
+	t.Cleanup(srv.stopPresence)
+	srv.cfg.Presence = cfg
+	return srv
+}
+
+func setStatus(srv *Server, status int) {
+	srv.handleProgressEvent(domain.ProgressData{Position: 10, Duration: 200, Status: status})
+}
+
+func TestPresence_Transitions(t *testing.T) {
+	srv := newPresenceTestServer(t, config.PresenceConfig{IdleAfterStopped: 60})
+	if got := srv.Presence().State; got != wsproto.PresenceClosed {
+		t.Fatalf("initial state = %q, want closed", got)
+	}
+
+	steps := []struct {
+		status int
+		idle   bool // fire the idle timer, if armed, after the status
+		want   wsproto.PresenceState
+	}{
+		{smtc.StatusPlaying, false, wsproto.PresenceActive},
+		{smtc.StatusChanging, false, wsproto.PresenceActive},
+		{smtc.StatusStopped, false, wsproto.PresencePaused},
+		{smtc.StatusStopped, true, wsproto.PresenceIdle},
+		// Pausing an idle session does not bring it back.
+		{smtc.StatusPaused, false, wsproto.PresenceIdle},
+		{smtc.StatusPlaying, false, wsproto.PresenceActive},
+		// idleAfterPaused is 0: a paused session never goes idle.
+		{smtc.StatusPaused, true, wsproto.PresencePaused},
+		{smtc.StatusClosed, false, wsproto.PresenceClosed},
+	}
+	for i, step := range steps {
+		setStatus(srv, step.status)
+		if step.idle {
+			srv.presence.mu.Lock()
+			timer, gen := srv.presence.timer, srv.presence.gen
+			srv.presence.mu.Unlock()
+			if (timer != nil) != (step.want == wsproto.PresenceIdle) {
+				t.Fatalf("step %d: idle timer armed = %v", i+1, timer != nil)
+			}
+			if timer != nil {
+				srv.enterIdle(gen)
+			}
+		}
+		if got := srv.Presence().State; got != step.want {
+			t.Fatalf("step %d (status %d): state = %q, want %q", i+1, step.status, got, step.want)
+		}
+	}
+}
+
+func TestPresence_StaleTimerIgnored(t *testing.T) {
+	srv := newPresenceTestServer(t, config.PresenceConfig{IdleAfterStopped: 60})
+	setStatus(srv, smtc.StatusStopped)
+	srv.presence.mu.Lock()
+	stale := srv.presence.gen
+	srv.presence.mu.Unlock()
+
+	setStatus(srv, smtc.StatusPlaying)
+	setStatus(srv, smtc.StatusStopped)
+	srv.enterIdle(stale)
+	if got := srv.Presence().State; got != wsproto.PresencePaused {
+		t.Fatalf("state = %q, want paused after a stale timer", got)
+	}
+}
+
+func TestPresence_BroadcastAndNowPlaying(t *testing.T) {
+	srv := newPresenceTestServer(t, config.PresenceConfig{IdleAfterStopped: 60})
+	srv.handleInfoEvent(domain.InfoData{Artist: "Artist", Title: "Song"})
+	httpSrv := startWSTestServer(t, srv)
+	_, ws := connectWSClient(t, httpSrv.URL)
+	_ = mustReadEnvelope(t, ws.msgs) // hello
+	_ = mustReadEnvelope(t, ws.msgs) // info
+
+	setStatus(srv, smtc.StatusPlaying)
+	_ = mustReadEnvelope(t, ws.msgs) // progress
+	env := mustReadEnvelope(t, ws.msgs)
+	if env.Type != wsproto.MsgPresence {
+		t.Fatalf("type = %q, want %q", env.Type, wsproto.MsgPresence)
+	}
+	var payload wsproto.PresencePayload
+	if err := json.Unmarshal(env.Data, &payload); err != nil {
+		t.Fatalf("decode presence: %v", err)
+	}
+	if payload.State != wsproto.PresenceActive || payload.Since == 0 {
+		t.Fatalf("presence = %+v", payload)
+	}
+
+	w := serveLocal(srv.setupRoutes(), http.MethodGet, "/api/now-playing", "")
+	var resp struct {
+		Presence wsproto.PresencePayload `json:"presence"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode now-playing: %v", err)
+	}
+	if resp.Presence != payload {
+		t.Fatalf("now-playing presence = %+v, want %+v", resp.Presence, payload)
+	}
+}
@@ -0,0 +1,157 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"smtc-now-playing/internal/domain"
+	"smtc-now-playing/internal/smtc"
+)
+
+// Sentinel errors for seek resolution.
+var (
+	ErrInvalidSeek = errors.New("server: invalid seek request")
+	ErrNoProgress  = errors.New("server: no playback progress available")
+)
+
+// seekRequest is the body of a seek control. Exactly one field must be set.
+type seekRequest struct {
+	Position *int64   `json:"position"` // absolute target in milliseconds
+	Offset   *int64   `json:"offset"`   // milliseconds relative to the current position
+	Percent  *float64 `json:"percent"`  // 0–100 of the track duration
+}
+
+// validate checks that exactly one field is set and that a percentage is in range.
+func (r seekRequest) validate() error {
+	set := 0
+	for _, present := range []bool{r.Position != nil, r.Offset != nil, r.Percent != nil} {
+		if present {
+			set++
+		}
+	}
+	if set != 1 {
+		return fmt.Errorf("%w: exactly one of position, offset or percent is required", ErrInvalidSeek)
+	}
+	if r.Percent != nil && (*r.Percent < 0 || *r.Percent > 100) {
+		return fmt.Errorf("%w: percent %g out of range [0, 100]", ErrInvalidSeek, *r.Percent)
+	}
+	return nil
+}
+
+// stepRequest is the optional body of the forward/backward step controls.
+type stepRequest struct {
+	Step *int64 `json:"step"` // milliseconds, defaults to defaultSeekStep
+}
+
+// offset converts a step request into a relative seek of the given direction.
+func (r stepRequest) offset(direction int64) (seekRequest, error) {
+	step := defaultSeekStep.Milliseconds()
+	if r.Step != nil {
+		if *r.Step <= 0 {
+			return seekRequest{}, fmt.Errorf("%w: step must be positive", ErrInvalidSeek)
+		}
+		step = *r.Step
+	}
+	offset := direction * step
+	return seekRequest{Offset: &offset}, nil
+}
+
+// stepDirection maps the forward/backward control actions to an offset sign.
+func stepDirection(action string) int64 {
+	if action == "backward" {
+		return -1
+	}
+	return 1
+}
+
+// seek resolves req against the target session's progress and issues SeekTo,
+// returning the target in milliseconds. The displayed session uses the
+// progress snapshot; other sessions have their timeline read from the provider.
+func (s *Server) seek(t controlTarget, req seekRequest) (int64, error) {
+	progress := s.snapshot().progress
+	if t.appID != "" {
+		p, err := s.svc.SessionProgress(t.appID)
+		if err != nil {
+			return 0, err
+		}
+		progress = &p
+	}
+	target, err := resolveSeekTarget(progress, req, time.Now())
+	if err != nil {
+		return 0, err
+	}
+	return target, t.ctl.SeekTo(target)
+}
+
+// resolveSeekTarget turns req into an absolute position in milliseconds.
+// Relative and percentage requests need progress; all targets are clamped to
+// the track's seekable range when progress is known. An absolute position
+// without progress is passed through unchanged, as before.
+func resolveSeekTarget(p *domain.ProgressData, req seekRequest, now time.Time) (int64, error) {
+	if err := req.validate(); err != nil {
+		return 0, err
+	}
+
+	if p == nil || p.Status == smtc.StatusClosed {
+		if req.Position != nil {
+			return *req.Position, nil
+		}
+		return 0, ErrNoProgress
+	}
+
+	lo, hi := seekBoundsMs(p)
+	var target int64
+	switch {
+	case req.Position != nil:
+		target = *req.Position
+	case req.Offset != nil:
+		target = interpolatedPositionMs(p, now) + *req.Offset
+	case req.Percent != nil:
+		if p.Duration <= 0 {
+			return 0, fmt.Errorf("%w: track duration unknown", ErrNoProgress)
+		}
+		target = int64(*req.Percent / 100 * float64(p.Duration) * 1000)
+	}
+
+	if target < lo {
+		target = lo
+	}
+	if hi > 0 && target > hi {
+		target = hi
+	}
+	return target, nil
+}
+
+// interpolatedPositionMs estimates the current position from the last reported
+// one, advancing it by the elapsed time scaled by the playback rate while playing.
+// It starts from the millisecond position when the source reports one.
+func interpolatedPositionMs(p *domain.ProgressData, now time.Time) int64 {
+	pos := p.PositionMs
+	if pos == 0 {
+		pos = int64(p.Position) * 1000
+	}
+	if p.Status != smtc.StatusPlaying || p.LastUpdatedTime <= 0 {
+		return pos
+	}
+	elapsed := now.UnixMilli() - p.LastUpdatedTime
+	if elapsed <= 0 {
+		return pos
+	}
+	rate := p.PlaybackRate
+	if rate <= 0 {
+		rate = 1
+	}
+	return pos + int64(float64(elapsed)*rate)
+}
+
+// seekBoundsMs returns the seekable range in milliseconds. hi is 0 when
+// neither the duration nor a maximum seek time is known.
+func seekBoundsMs(p *domain.ProgressData) (lo, hi int64) {
+	lo = int64(p.MinSeekTime) * 1000
+	hi = int64(p.Duration) * 1000
+	if maxSeek := int64(p.MaxSeekTime) * 1000; maxSeek > 0 && (hi == 0 || maxSeek < hi) {
+		hi = maxSeek
+	}
+	return lo, hi
+}
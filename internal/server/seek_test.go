@@ -0,0 +1,154 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"smtc-now-playing/internal/domain"
+	"smtc-now-playing/internal/smtc"
+)
+
+func int64Ptr(v int64) *int64       { return &v }
+func float64Ptr(v float64) *float64 { return &v }
+
+func TestResolveSeekTarget(t *testing.T) {
+	now := time.UnixMilli(1700000010000)
+	playing := &domain.ProgressData{
+		Position:        60,
+		Duration:        180,
+		Status:          smtc.StatusPlaying,
+		PlaybackRate:    1.5,
+		LastUpdatedTime: 1700000008000, // 2s ago → +3s at 1.5x
+	}
+	paused := &domain.ProgressData{
+		Position:        60,
+		Duration:        180,
+		Status:          smtc.StatusPaused,
+		PlaybackRate:    1,
+		LastUpdatedTime: 1700000000000,
+	}
+	subSecond := &domain.ProgressData{
+		Position:   60,
+		PositionMs: 60750,
+		Duration:   180,
+		Status:     smtc.StatusPaused,
+	}
+	bounded := &domain.ProgressData{
+		Position:    60,
+		Duration:    180,
+		Status:      smtc.StatusPaused,
+		MinSeekTime: 10,
+		MaxSeekTime: 120,
+	}
+
+	tests := []struct {
+		name    string
+		p       *domain.ProgressData
+		req     seekRequest
+		want    int64
+		wantErr error
+	}{
+		{"absolute", paused, seekRequest{Position: int64Ptr(5000)}, 5000, nil},
+		{"absolute_clamped_to_duration", paused, seekRequest{Position: int64Ptr(999000)}, 180000, nil},
+		{"absolute_without_progress", nil, seekRequest{Position: int64Ptr(5000)}, 5000, nil},
+		{"offset_forward_paused", paused, seekRequest{Offset: int64Ptr(10000)}, 70000, nil},
+		{"offset_back_paused", paused, seekRequest{Offset: int64Ptr(-30000)}, 30000, nil},
+		{"offset_interpolated_while_playing", playing, seekRequest{Offset: int64Ptr(10000)}, 73000, nil},
+		{"offset_from_millisecond_position", subSecond, seekRequest{Offset: int64Ptr(10000)}, 70750, nil},
+		{"offset_clamped_to_zero", paused, seekRequest{Offset: int64Ptr(-600000)}, 0, nil},
+		{"offset_clamped_to_end", paused, seekRequest{Offset: int64Ptr(600000)}, 180000, nil},
+		{"percent", paused, seekRequest{Percent: float64Ptr(50)}, 90000, nil},
+		{"percent_clamped_to_max_seek", bounded, seekRequest{Percent: float64Ptr(100)}, 120000, nil},
+		{"offset_clamped_to_min_seek", bounded, seekRequest{Offset: int64Ptr(-60000)}, 10000, nil},
+		{"offset_without_progress", nil, seekRequest{Offset: int64Ptr(1000)}, 0, ErrNoProgress},
+		{"percent_without_duration", &domain.ProgressData{Status: smtc.StatusPlaying}, seekRequest{Percent: float64Ptr(50)}, 0, ErrNoProgress},
+		{"percent_out_of_range", paused, seekRequest{Percent: float64Ptr(150)}, 0, ErrInvalidSeek},
+		{"none_set", paused, seekRequest{}, 0, ErrInvalidSeek},
+		{"two_set", paused, seekRequest{Position: int64Ptr(1), Offset: int64Ptr(1)}, 0, ErrInvalidSeek},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := resolveSeekTarget(tt.p, tt.req, now)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("err = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Fatalf("got %d want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandleControl_RelativeSeekAndSteps(t *testing.T) {
+	tests := []struct {
+		action string
+		body   string
+		want   int64
+	}{
+		{"seek", `{"offset": -30000}`, 30000},
+		{"seek", `{"percent": 25}`, 45000},
+		{"forward", ``, 70000},
+		{"backward", `{"step": 5000}`, 55000},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.action+tt.body, func(t *testing.T) {
+			srv, svc, _ := newTestServer(t)
+			srv.handleProgressEvent(domain.ProgressData{Position: 60, Duration: 180, Status: smtc.StatusPaused})
+
+			req := httptest.NewRequest(http.MethodPost, "/api/control/"+tt.action, strings.NewReader(tt.body))
+			req.RemoteAddr = "127.0.0.1:1234"
+			req.SetPathValue("action", tt.action)
+			w := httptest.NewRecorder()
+			localhostOnly(srv.handleControl, false)(w, req)
+			if w.Code != http.StatusOK {
+				t.Fatalf("got %d want %d: %s", w.Code, http.StatusOK, w.Body.String())
+			}
+			if len(svc.seekCalls) != 1 || svc.seekCalls[0] != tt.want {
+				t.Fatalf("seekCalls = %v, want [%d]", svc.seekCalls, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandleControl_InvalidSeekIsBadRequest(t *testing.T) {
+	srv, svc, _ := newTestServer(t)
+	req := httptest.NewRequest(http.MethodPost, "/api/control/seek", strings.NewReader(`{"percent": 200}`))
+	req.RemoteAddr = "127.0.0.1:1234"
+	req.SetPathValue("action", "seek")
+	w := httptest.NewRecorder()
+	localhostOnly(srv.handleControl, false)(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("got %d want %d", w.Code, http.StatusBadRequest)
+	}
+	if len(svc.seekCalls) != 0 {
+		t.Fatalf("seekCalls = %v, want none", svc.seekCalls)
+	}
+}
+
+func TestExecuteWSControl_Steps(t *testing.T) {
+	srv, svc, _ := newTestServer(t)
+	srv.handleProgressEvent(domain.ProgressData{Position: 60, Duration: 180, Status: smtc.StatusPaused})
+
+	if _, err := srv.executeWSControl(srv.targetFor(""), "backward", nil); err != nil {
+		t.Fatalf("backward: unexpected error %v", err)
+	}
+	if _, err := srv.executeWSControl(srv.targetFor(""), "forward", json.RawMessage(`{"step":0}`)); !errors.Is(err, ErrInvalidSeek) {
+		t.Fatalf("forward step 0: got %v, want ErrInvalidSeek", err)
+	}
+	if len(svc.seekCalls) != 1 || svc.seekCalls[0] != 50000 {
+		t.Fatalf("seek calls = %v, want [50000]", svc.seekCalls)
+	}
+}
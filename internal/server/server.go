@@ -1,6 +1,7 @@
 package server
 
 import (
+	"cmp"
 	"context"
 	"crypto/sha256"
 	"encoding/hex"
@@ -11,11 +12,14 @@ import (
 	"net/http"
 	"path/filepath"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/fsnotify/fsnotify"
 	"github.com/lxzan/gws"
+	"smtc-now-playing/internal/bitmapfont"
+	"smtc-now-playing/internal/bookmarks"
 	"smtc-now-playing/internal/config"
 	"smtc-now-playing/internal/domain"
 	"smtc-now-playing/internal/smtc"
@@ -27,24 +31,15 @@ var log = slog.With("subsystem", "server")
 
 // Sentinel errors for server operations.
 var (
-	ErrServerShutdown = errors.New("server: shut down")
+	ErrServerShutdown      = errors.New("server: shut down")
+	ErrInvalidPlaybackRate = errors.New("server: invalid playback rate")
 )
 
-// ControlError represents an error during media control execution.
-type ControlError struct {
-	Action string
-	Err    error
-}
-
-// Error implements the error interface.
-func (e *ControlError) Error() string {
-	return fmt.Sprintf("server: control %s failed: %v", e.Action, e.Err)
-}
-
-// Unwrap returns the underlying error.
-func (e *ControlError) Unwrap() error {
-	return e.Err
-}
+// Playback rate bounds accepted by the rate control.
+const (
+	minPlaybackRate = 0.25
+	maxPlaybackRate = 4.0
+)
 
 type SMTCService interface {
 	Subscribe(bufSize int) <-chan smtc.Event
@@ -52,25 +47,24 @@ type SMTCService interface {
 	GetSessions() []smtc.SessionInfo
 	SelectDevice(appID string)
 	GetCapabilities() smtc.ControlCapabilities
-	Play() error
-	Pause() error
-	StopPlayback() error
-	TogglePlayPause() error
-	SkipNext() error
-	SkipPrevious() error
-	SeekTo(positionMs int64) error
-	SetShuffle(active bool) error
-	SetRepeat(mode int) error
+	smtc.Controller
+	Session(appID string) smtc.Controller
+	SessionProgress(appID string) (domain.ProgressData, error)
 }
 
+// stateSnapshot is the server state published through Server.state. A
+// snapshot and everything it points to is immutable once stored: updates
+// clone the snapshot shallowly and replace fields, so album art and the
+// pre-serialized messages are shared between snapshots rather than copied.
 type stateSnapshot struct {
 	info         *domain.InfoData
 	progress     *domain.ProgressData
-	infoJSON     []byte
-	progressJSON []byte
-	albumArtHash string
-	albumArtData []byte
-	albumArtCT   string
+	infoJSON     []byte // serialized info message
+	progressJSON []byte // serialized progress message
+	art          *artBlob
+	caps         smtc.ControlCapabilities
+	activeAppID  string
+	rev          uint64 // set by storeState; identifies the state in caches
 }
 
 type Server struct {
@@ -80,6 +74,37 @@ type Server struct {
 	httpSrv *http.Server
 
 	state atomic.Pointer[stateSnapshot]
+
+	// changed is closed and replaced on every state store; see storeState.
+	changedMu sync.Mutex
+	changed   chan struct{}
+	rev       uint64 // revision of the last stored state, guarded by changedMu
+
+	policy     *exclusivePolicy
+	timers     *timerScheduler
+	bookmarks  *bookmarks.Store
+	loop       loopState
+	votes      *voteTally
+	presence   presenceTracker
+	artCache   *artCache
+	artHistory *artHistory
+	cardCache  *artCache
+	cardArt    cardArtCache
+	cardFonts  []*bitmapfont.Font
+	keyCache   *artCache
+	keyArt     cardArtCache
+	badgeCache *artCache
+	badgeArt   cardArtCache
+
+	// glyphsChecked is the title and artist last checked for characters
+	// the card fonts lack; see checkCardGlyphs.
+	glyphsChecked atomic.Pointer[string]
+
+	// artDerived signals the event loop that the palette of new art has
+	// been computed; see handleArtDerived.
+	artDerived chan struct{}
+
+	batchLocks sessionLocks
 }
 
 const heartbeatStateKey = "heartbeatState"
@@ -88,10 +113,6 @@ type heartbeatState struct {
 	lastPongUnixMilli atomic.Int64
 }
 
-type wsControlSeekArgs struct {
-	Position int64 `json:"position"`
-}
-
 type wsControlShuffleArgs struct {
 	Active bool `json:"active"`
 }
@@ -100,6 +121,10 @@ type wsControlRepeatArgs struct {
 	Mode int `json:"mode"`
 }
 
+type wsControlRateArgs struct {
+	Rate float64 `json:"rate"`
+}
+
 func newHeartbeatState(now time.Time) *heartbeatState {
 	state := &heartbeatState{}
 	state.Touch(now)
@@ -123,9 +148,20 @@ func New(cfg *config.Config, smtcSvc SMTCService) (*Server, error) {
 	}
 
 	s := &Server{
-		cfg: cfg,
-		svc: smtcSvc,
-		hub: newHub(),
+		cfg:        cfg,
+		svc:        smtcSvc,
+		hub:        newHub(),
+		changed:    make(chan struct{}),
+		policy:     newExclusivePolicy(),
+		timers:     newTimerScheduler(),
+		bookmarks:  bookmarks.NewMemory(),
+		votes:      newVoteTally(),
+		artCache:   newArtCache(artCacheBytes),
+		artHistory: newArtHistory(cfg.AlbumArt.History),
+		cardCache:  newArtCache(cardCacheBytes),
+		keyCache:   newArtCache(keyCacheBytes),
+		badgeCache: newArtCache(badgeCacheBytes),
+		artDerived: make(chan struct{}, 1),
 	}
 	s.state.Store(&stateSnapshot{})
 	s.httpSrv = s.newHTTPServer(s.setupRoutes())
@@ -139,8 +175,34 @@ func (s *Server) setupRoutes() http.Handler {
 	mux.HandleFunc("GET /api/devices", s.handleSessions)
 	mux.HandleFunc("GET /api/sessions", s.handleSessions)
 	mux.HandleFunc("GET /api/capabilities", s.handleCapabilities)
+	mux.HandleFunc("GET /api/controls", s.handleControls)
 	mux.HandleFunc("POST /api/control/{action}", localhostOnly(s.handleControl, s.cfg.Server.AllowRemote))
+	mux.HandleFunc("POST /api/sessions/{appId}/control/{action}", localhostOnly(s.handleSessionControl, s.cfg.Server.AllowRemote))
+	mux.HandleFunc("POST /api/control/batch", localhostOnly(s.handleBatch, s.cfg.Server.AllowRemote))
+	mux.HandleFunc("POST /api/sessions/{appId}/control/batch", localhostOnly(s.handleBatch, s.cfg.Server.AllowRemote))
+	mux.HandleFunc("GET /api/macros", s.handleMacros)
+	mux.HandleFunc("GET /api/timers", s.handleListTimers)
+	mux.HandleFunc("POST /api/timers", localhostOnly(s.handleCreateTimer, s.cfg.Server.AllowRemote))
+	mux.HandleFunc("DELETE /api/timers/{id}", localhostOnly(s.handleCancelTimer, s.cfg.Server.AllowRemote))
+	mux.HandleFunc("GET /api/bookmarks", s.handleListBookmarks)
+	mux.HandleFunc("POST /api/bookmarks", localhostOnly(s.handleCreateBookmark, s.cfg.Server.AllowRemote))
+	mux.HandleFunc("DELETE /api/bookmarks/{id}", localhostOnly(s.handleDeleteBookmark, s.cfg.Server.AllowRemote))
+	mux.HandleFunc("GET /api/loop", s.handleGetLoop)
+	mux.HandleFunc("PUT /api/loop", localhostOnly(s.handleSetLoop, s.cfg.Server.AllowRemote))
+	mux.HandleFunc("DELETE /api/loop", localhostOnly(s.handleClearLoop, s.cfg.Server.AllowRemote))
+	mux.HandleFunc("GET /api/votes", s.handleGetVotes)
+	mux.HandleFunc("POST /api/votes/skip", localhostOnly(s.handleVoteSkip, s.cfg.Server.AllowRemote))
+	mux.HandleFunc("GET /api/albumArt", s.handleAlbumArtIndex)
+	mux.HandleFunc("GET /api/metrics", s.handleMetrics)
 	mux.HandleFunc("GET /albumArt/{hash}", s.handleAlbumArt)
+	mux.HandleFunc("GET /albumArt/{hash}/palette.css", s.handlePaletteCSS)
+	mux.HandleFunc("GET /albumArt/{hash}/blur", s.handleArtStyle(artStyleBlur))
+	mux.HandleFunc("GET /albumArt/{hash}/grayscale", s.handleArtStyle(artStyleGrayscale))
+	mux.HandleFunc("GET /albumArt/{hash}/square", s.handleArtStyle(artStyleSquare))
+	mux.HandleFunc("GET /api/card.png", s.handleCard("png"))
+	mux.HandleFunc("GET /api/card.jpg", s.handleCard("jpeg"))
+	mux.HandleFunc("GET /api/keys/{file}", s.handleKey)
+	mux.HandleFunc("GET /badge.svg", s.handleBadge)
 	mux.HandleFunc("GET /script/{file}", s.handleScript)
 	mux.HandleFunc("GET /ws", s.handleWebSocket)
 	mux.HandleFunc("GET /", s.handleTheme)
@@ -169,11 +231,15 @@ func (s *Server) shutdownHTTPServer() {
 
 func (s *Server) Run(ctx context.Context) error {
 	go s.hub.Run(ctx)
+	defer s.stopTimers()
+	defer s.stopVotes()
+	defer s.stopPresence()
 
 	eventCh := s.svc.Subscribe(subscribeBufSize)
 	defer s.svc.Unsubscribe(eventCh)
 
 	go s.processEvents(ctx, eventCh)
+	go s.runLoopWatcher(ctx)
 
 	watcherErrCh := make(chan error, 1)
 	if s.cfg.Server.HotReload {
@@ -213,6 +279,8 @@ func (s *Server) processEvents(ctx context.Context, eventCh <-chan smtc.Event) {
 				return
 			}
 			s.handleEvent(ev)
+		case <-s.artDerived:
+			s.handleArtDerived()
 		}
 	}
 }
@@ -226,30 +294,62 @@ func (s *Server) handleEvent(ev smtc.Event) {
 	case smtc.SessionsChangedEvent:
 		s.broadcastEnvelope(wsproto.NewSessions(e.Sessions))
 	case smtc.DeviceChangedEvent:
-		slog.Debug("active SMTC device changed", "appID", e.AppID)
+		s.handleDeviceChangedEvent(e.AppID)
+	case smtc.CapabilitiesChangedEvent:
+		s.handleCapabilitiesEvent(e.Caps)
+	case smtc.SessionStatusEvent:
+		s.handleSessionStatusEvent(e.AppID, e.Status)
+	}
+}
+
+// handleDeviceChangedEvent records the displayed session. Which controls are
+// enabled depends on it as well as on the capabilities, so the capabilities
+// message is sent again even when the new session reports the same ones.
+func (s *Server) handleDeviceChangedEvent(appID string) {
+	slog.Debug("active SMTC device changed", "appID", appID)
+	prev := s.snapshot()
+	if prev.activeAppID == appID {
+		return
+	}
+	next := s.cloneState(prev)
+	next.activeAppID = appID
+	s.storeState(next)
+	s.broadcastEnvelope(wsproto.NewCapabilities(s.capabilitiesToMap(), s.controlSpecs()))
+}
+
+func (s *Server) handleCapabilitiesEvent(caps smtc.ControlCapabilities) {
+	prev := s.snapshot()
+	if prev.caps == caps {
+		return
 	}
+	next := s.cloneState(prev)
+	next.caps = caps
+	s.storeState(next)
+	s.broadcastEnvelope(wsproto.NewCapabilities(s.capabilitiesToMap(), s.controlSpecs()))
 }
 
 func (s *Server) handleInfoEvent(data domain.InfoData) {
 	prev := s.snapshot()
 	next := s.cloneState(prev)
 
-	infoCopy := cloneInfoData(data)
+	infoCopy := cloneInfoData(data.Cleaned(s.textOptions()))
 	next.info = infoCopy
 
+	next.art = nil
+	infoCopy.ThumbnailSource = ""
 	if len(data.ThumbnailData) > 0 {
-		thumb := append([]byte(nil), data.ThumbnailData...)
-		next.albumArtData = thumb
-		next.albumArtCT = data.ThumbnailContentType
-		checksum := sha256.Sum256(thumb)
-		next.albumArtHash = hex.EncodeToString(checksum[:])
-	} else {
-		next.albumArtData = nil
-		next.albumArtCT = ""
-		next.albumArtHash = ""
-	}
-
-	env := wsproto.NewInfo(*infoCopy, s.albumArtURL(next.albumArtHash))
+		infoCopy.ThumbnailSource = cmp.Or(data.ThumbnailSource, domain.ArtSourcePlayer)
+		checksum := sha256.Sum256(data.ThumbnailData)
+		hash := hex.EncodeToString(checksum[:])
+		if prev.art != nil && prev.art.hash == hash && prev.art.contentType == data.ThumbnailContentType && prev.art.source == infoCopy.ThumbnailSource {
+			next.art = prev.art
+		} else {
+			next.art = newArtBlob(hash, data.ThumbnailData, data.ThumbnailContentType, infoCopy.ThumbnailSource)
+			go s.notifyArtDerived(next.art)
+		}
+	}
+
+	env := wsproto.NewInfo(s.clientInfo(*infoCopy), s.albumArtURL(next.artHash()), next.currentPalette())
 	msg, err := json.Marshal(env)
 	if err != nil {
 		slog.Warn("failed to marshal info update", "err", err)
@@ -260,7 +360,57 @@ func (s *Server) handleInfoEvent(data domain.InfoData) {
 		return
 	}
 	next.infoJSON = msg
-	s.state.Store(next)
+	if art := next.art; art != nil {
+		s.artHistory.add(artRecord{
+			hash:        art.hash,
+			data:        art.data,
+			original:    infoCopy.ThumbnailOriginal,
+			contentType: art.contentType,
+			source:      art.source,
+			palette:     next.currentPalette(),
+			title:       infoCopy.Title,
+			artist:      infoCopy.Artist,
+			albumTitle:  infoCopy.AlbumTitle,
+			seenAt:      time.Now(),
+		})
+	}
+	s.storeState(next)
+	s.hub.Broadcast(msg)
+	s.advanceTrackTimers(infoCopy)
+	s.resetVotes(infoCopy)
+}
+
+// notifyArtDerived wakes the event loop once the palette of b is ready. A
+// signal already pending covers b too, since handleArtDerived looks at
+// whatever art is displayed by then.
+func (s *Server) notifyArtDerived(b *artBlob) {
+	<-b.derived
+	select {
+	case s.artDerived <- struct{}{}:
+	default:
+	}
+}
+
+// handleArtDerived republishes the info of the displayed art with its
+// palette, which is computed off the event loop after the art changes.
+func (s *Server) handleArtDerived() {
+	prev := s.snapshot()
+	art := prev.art
+	if prev.info == nil || art == nil || !art.isDerived() || art.palette == nil {
+		return
+	}
+	s.artHistory.setPalette(art.hash, art.palette)
+	msg, err := json.Marshal(wsproto.NewInfo(s.clientInfo(*prev.info), s.albumArtURL(art.hash), art.palette))
+	if err != nil {
+		slog.Warn("failed to marshal info update", "err", err)
+		return
+	}
+	if bytesEqual(prev.infoJSON, msg) {
+		return
+	}
+	next := s.cloneState(prev)
+	next.infoJSON = msg
+	s.storeState(next)
 	s.hub.Broadcast(msg)
 }
 
@@ -281,8 +431,9 @@ func (s *Server) handleProgressEvent(data domain.ProgressData) {
 		return
 	}
 	next.progressJSON = msg
-	s.state.Store(next)
+	s.storeState(next)
 	s.hub.Broadcast(msg)
+	s.updatePresence(data.Status)
 }
 
 func (s *Server) runHotReload(ctx context.Context, errCh chan<- error) {
@@ -378,7 +529,7 @@ func (h *wsHandler) OnOpen(socket *gws.Conn) {
 	heartbeat := newHeartbeatState(time.Now())
 	socket.Session().Store(heartbeatStateKey, heartbeat)
 
-	if msg, err := json.Marshal(wsproto.NewHello(version.Version, h.srv.capabilitiesToMap())); err == nil {
+	if msg, err := json.Marshal(wsproto.NewHello(version.Version, h.srv.capabilitiesToMap(), h.srv.controlSpecs())); err == nil {
 		_ = socket.WriteMessage(gws.OpcodeText, msg)
 	}
 
@@ -388,12 +539,25 @@ func (h *wsHandler) OnOpen(socket *gws.Conn) {
 	}
 	if len(snapshot.progressJSON) > 0 {
 		_ = socket.WriteMessage(gws.OpcodeText, snapshot.progressJSON)
+		if msg, err := json.Marshal(wsproto.NewPresence(h.srv.Presence())); err == nil {
+			_ = socket.WriteMessage(gws.OpcodeText, msg)
+		}
 	}
 	if sessions := h.srv.svc.GetSessions(); len(sessions) > 0 {
 		if msg, err := json.Marshal(wsproto.NewSessions(sessionInfosToDomain(sessions))); err == nil {
 			_ = socket.WriteMessage(gws.OpcodeText, msg)
 		}
 	}
+	if timers := h.srv.Timers(); len(timers) > 0 {
+		if msg, err := json.Marshal(wsproto.NewTimers(timers)); err == nil {
+			_ = socket.WriteMessage(gws.OpcodeText, msg)
+		}
+	}
+	if votes := h.srv.Votes(); votes.Votes > 0 {
+		if msg, err := json.Marshal(wsproto.NewVotes(votes)); err == nil {
+			_ = socket.WriteMessage(gws.OpcodeText, msg)
+		}
+	}
 	go h.srv.runHeartbeat(socket)
 	slog.Info("WS client connected")
 }
@@ -433,10 +597,17 @@ func (h *wsHandler) OnMessage(socket *gws.Conn, message *gws.Message) {
 	case wsproto.MsgControl:
 		ctrl, err := env.ParseControl()
 		if err != nil || ctrl.Action == "" {
-			h.srv.writeControlAck(socket, env.ID, errors.New("invalid control payload"))
+			h.srv.writeControlAck(socket, env.ID, controlTarget{}, errInvalidControl)
 			return
 		}
-		go h.srv.handleWSControl(socket, env.ID, ctrl.Action, ctrl.Args)
+		go h.srv.handleWSControl(socket, env.ID, ctrl)
+	case wsproto.MsgBatch:
+		batch, err := env.ParseBatch()
+		if err != nil {
+			h.srv.writeControlAck(socket, env.ID, controlTarget{}, errInvalidBatchPayload)
+			return
+		}
+		go h.srv.handleWSBatch(socket, env.ID, batch)
 	default:
 		h.srv.handleUnknownMessage(socket, env)
 	}
@@ -444,7 +615,7 @@ func (h *wsHandler) OnMessage(socket *gws.Conn, message *gws.Message) {
 
 func (s *Server) handleUnknownMessage(conn *gws.Conn, env wsproto.Envelope) {
 	if env.ID != "" {
-		s.writeControlAck(conn, env.ID, fmt.Errorf("unsupported message type: %s", env.Type))
+		s.writeControlAck(conn, env.ID, controlTarget{}, fmt.Errorf("%w: %s", errUnsupportedMessage, env.Type))
 		return
 	}
 	s.closeUnsupportedProtocol(conn)
@@ -504,71 +675,180 @@ func (s *Server) heartbeatState(conn *gws.Conn) *heartbeatState {
 	return state
 }
 
-func (s *Server) handleWSControl(conn *gws.Conn, id string, action string, args json.RawMessage) {
-	err := s.executeWSControl(action, args)
-	s.writeControlAck(conn, id, err)
+// controlTarget is the session a control acts on. appID is empty for the
+// displayed session, including when it is named explicitly.
+type controlTarget struct {
+	appID string
+	ctl   smtc.Controller
+}
+
+// errWaitNeedsDisplayedSession rejects wait mode for other sessions: waiting
+// observes the server's state, which only tracks the displayed session.
+var errWaitNeedsDisplayedSession = errors.New("wait is only supported for the displayed session")
+
+// targetFor resolves appID to the controller that should execute a control.
+func (s *Server) targetFor(appID string) controlTarget {
+	if appID == "" || appID == s.snapshot().activeAppID {
+		return controlTarget{ctl: s.svc}
+	}
+	return controlTarget{appID: appID, ctl: s.svc.Session(appID)}
+}
+
+func (s *Server) handleWSControl(conn *gws.Conn, id string, ctrl wsproto.ControlPayload) {
+	target := s.targetFor(ctrl.Session)
+	if ctrl.Wait && target.appID != "" {
+		s.writeControlAck(conn, id, target, errWaitNeedsDisplayedSession)
+		return
+	}
+	prev := s.snapshot()
+	goal, err := s.executeWSControl(target, ctrl.Action, ctrl.Args)
+	if err != nil || !ctrl.Wait {
+		s.writeControlAck(conn, id, target, err)
+		return
+	}
+	result := s.awaitControl(context.Background(), ctrl.Action, prev, goal, newControlWait(true, ctrl.Timeout))
+	msg, err := json.Marshal(wsproto.NewAckPayload(id, wsproto.AckPayload{
+		Success:  true,
+		Info:     result.info,
+		Progress: result.progress,
+		TimedOut: result.timedOut,
+	}))
+	if err != nil {
+		slog.Warn("failed to marshal websocket ack", "err", err)
+		return
+	}
+	if err := conn.WriteMessage(gws.OpcodeText, msg); err != nil {
+		slog.Debug("failed to write websocket ack", "err", err)
+	}
+}
+
+// controlArgs holds the decoded args of a control; only the fields of its
+// action are set.
+type controlArgs struct {
+	seek     seekRequest // seek, forward, backward
+	bookmark string
+	shuffle  bool
+	repeat   int
+	rate     float64
 }
 
-func (s *Server) executeWSControl(action string, args json.RawMessage) error {
+// decodeControlArgs decodes and validates the JSON args of action, so they
+// can also be checked before the control runs, as when scheduling a timer.
+func decodeControlArgs(action string, args json.RawMessage) (controlArgs, error) {
+	var a controlArgs
 	switch action {
-	case "play":
-		return s.svc.Play()
-	case "pause":
-		return s.svc.Pause()
-	case "stop":
-		return s.svc.StopPlayback()
-	case "toggle":
-		return s.svc.TogglePlayPause()
-	case "next":
-		return s.svc.SkipNext()
-	case "previous":
-		return s.svc.SkipPrevious()
+	case "play", "pause", "stop", "toggle", "next", "previous":
 	case "seek":
-		var body wsControlSeekArgs
+		if err := json.Unmarshal(args, &a.seek); err != nil {
+			return a, err
+		}
+		return a, a.seek.validate()
+	case "forward", "backward":
+		var body stepRequest
+		if len(args) > 0 {
+			if err := json.Unmarshal(args, &body); err != nil {
+				return a, err
+			}
+		}
+		var err error
+		a.seek, err = body.offset(stepDirection(action))
+		return a, err
+	case "bookmark":
+		var body bookmarkJumpRequest
 		if err := json.Unmarshal(args, &body); err != nil {
-			return err
+			return a, err
 		}
-		return s.svc.SeekTo(body.Position)
+		a.bookmark = body.ID
 	case "shuffle":
 		var body wsControlShuffleArgs
 		if err := json.Unmarshal(args, &body); err != nil {
-			return err
+			return a, err
 		}
-		return s.svc.SetShuffle(body.Active)
+		a.shuffle = body.Active
 	case "repeat":
 		var body wsControlRepeatArgs
 		if err := json.Unmarshal(args, &body); err != nil {
-			return err
+			return a, err
+		}
+		a.repeat = body.Mode
+		return a, validateRepeatMode(body.Mode)
+	case "rate":
+		var body wsControlRateArgs
+		if err := json.Unmarshal(args, &body); err != nil {
+			return a, err
 		}
-		return s.svc.SetRepeat(body.Mode)
+		a.rate = body.Rate
+		return a, validatePlaybackRate(body.Rate)
 	default:
-		return fmt.Errorf("unknown action: %s", action)
+		return a, fmt.Errorf("%w: %s", errUnknownAction, action)
 	}
+	return a, nil
 }
 
-func (s *Server) writeControlAck(conn *gws.Conn, id string, controlErr error) {
-	msg, err := json.Marshal(wsproto.NewAck(id, controlErr))
+// executeWSControl runs action with its JSON args on t. The returned goal
+// records what the control asked for, for awaitControl.
+func (s *Server) executeWSControl(t controlTarget, action string, args json.RawMessage) (controlGoal, error) {
+	var goal controlGoal
+	if err := s.preflight(t, action); err != nil {
+		return goal, err
+	}
+	a, err := decodeControlArgs(action, args)
 	if err != nil {
-		slog.Warn("failed to marshal websocket ack", "err", err)
-		return
+		return goal, err
 	}
-	if err := conn.WriteMessage(gws.OpcodeText, msg); err != nil {
-		slog.Debug("failed to write websocket ack", "err", err)
+	switch action {
+	case "play":
+		err = t.ctl.Play()
+	case "pause":
+		err = t.ctl.Pause()
+	case "stop":
+		err = t.ctl.StopPlayback()
+	case "toggle":
+		err = t.ctl.TogglePlayPause()
+	case "next":
+		err = t.ctl.SkipNext()
+	case "previous":
+		err = t.ctl.SkipPrevious()
+	case "seek", "forward", "backward":
+		goal.positionMs, err = s.seek(t, a.seek)
+	case "bookmark":
+		goal.positionMs, err = s.jumpToBookmark(t, a.bookmark)
+	case "shuffle":
+		goal.shuffle = a.shuffle
+		err = t.ctl.SetShuffle(a.shuffle)
+	case "repeat":
+		goal.repeat = a.repeat
+		err = t.ctl.SetRepeat(a.repeat)
+	case "rate":
+		goal.rate = a.rate
+		err = t.ctl.SetPlaybackRate(a.rate)
 	}
+	return goal, err
 }
 
-func (s *Server) handleAlbumArt(w http.ResponseWriter, r *http.Request) {
-	state := s.snapshot()
-	if state.albumArtHash == "" || r.PathValue("hash") != state.albumArtHash || len(state.albumArtData) == 0 {
-		w.WriteHeader(http.StatusNotFound)
+// validatePlaybackRate rejects rates outside [minPlaybackRate, maxPlaybackRate].
+func validatePlaybackRate(rate float64) error {
+	if rate < minPlaybackRate || rate > maxPlaybackRate {
+		return fmt.Errorf("%w: %g (must be between %g and %g)", ErrInvalidPlaybackRate, rate, minPlaybackRate, maxPlaybackRate)
+	}
+	return nil
+}
+
+// writeControlAck acknowledges a control, classifying controlErr for t.
+func (s *Server) writeControlAck(conn *gws.Conn, id string, t controlTarget, controlErr error) {
+	payload := wsproto.AckPayload{Success: controlErr == nil}
+	if controlErr != nil {
+		payload.Error = controlErr.Error()
+		payload.Code, _ = s.controlErrorCode(t, controlErr)
+	}
+	msg, err := json.Marshal(wsproto.NewAckPayload(id, payload))
+	if err != nil {
+		slog.Warn("failed to marshal websocket ack", "err", err)
 		return
 	}
-	contentType := state.albumArtCT
-	if contentType == "" {
-		contentType = "application/octet-stream"
+	if err := conn.WriteMessage(gws.OpcodeText, msg); err != nil {
+		slog.Debug("failed to write websocket ack", "err", err)
 	}
-	w.Header().Set("Content-Type", contentType)
-	_, _ = w.Write(state.albumArtData)
 }
 
 func safeThemePath(theme, urlPath string) (string, bool) {
@@ -653,9 +933,6 @@ func (s *Server) cloneState(prev *stateSnapshot) *stateSnapshot {
 		return &stateSnapshot{}
 	}
 	next := *prev
-	next.infoJSON = append([]byte(nil), prev.infoJSON...)
-	next.progressJSON = append([]byte(nil), prev.progressJSON...)
-	next.albumArtData = append([]byte(nil), prev.albumArtData...)
 	return &next
 }
 
@@ -687,9 +964,32 @@ func bytesEqual(a, b []byte) bool {
 	return true
 }
 
+// textOptions returns the metadata cleanup options from the config. Legacy
+// escaping keeps control characters, so line breaks and tabs reach clients
+// as \n and \t as they did in older versions.
+func (s *Server) textOptions() domain.TextOptions {
+	m := s.cfg.Metadata
+	return domain.TextOptions{
+		NormalizeNFC:   m.NormalizeNFC,
+		StripControl:   m.StripControl && !m.LegacyEscape,
+		StripZeroWidth: m.StripZeroWidth,
+	}
+}
+
+// clientInfo returns info as it should be presented to clients, applying the
+// legacy escaping when metadata.legacyEscape is enabled.
+func (s *Server) clientInfo(info domain.InfoData) domain.InfoData {
+	if s.cfg.Metadata.LegacyEscape {
+		return info.Escaped()
+	}
+	return info
+}
+
 func cloneInfoData(data domain.InfoData) *domain.InfoData {
 	copyData := data
-	copyData.ThumbnailData = append([]byte(nil), data.ThumbnailData...)
+	if data.Genres != nil {
+		copyData.Genres = append([]string(nil), data.Genres...)
+	}
 	return &copyData
 }
 
@@ -718,7 +1018,7 @@ func sessionInfosToDomain(sessions []smtc.SessionInfo) []domain.SessionInfo {
 }
 
 func (s *Server) capabilitiesToMap() map[string]bool {
-	caps := s.svc.GetCapabilities()
+	caps := s.snapshot().caps
 	return map[string]bool{
 		"control":          true,
 		"heartbeat":        true,
@@ -730,6 +1030,7 @@ func (s *Server) capabilitiesToMap() map[string]bool {
 		"seek":             caps.IsSeekEnabled,
 		"shuffle":          caps.IsShuffleEnabled,
 		"repeat":           caps.IsRepeatEnabled,
+		"rate":             caps.IsPlaybackRateEnabled,
 		"sessions":         true,
 		"reload":           s.cfg.Server.HotReload,
 		"albumArtEndpoint": true,
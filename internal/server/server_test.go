@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"strings"
@@ -34,9 +35,16 @@ type fakeSMTCService struct {
 	seekErr      error
 	shuffleErr   error
 	repeatErr    error
+	rateErr      error
 	seekCalls    []int64
 	shuffleCalls []bool
 	repeatCalls  []int
+	rateCalls    []float64
+	nextCalls    int
+	// sessionTargets records the appIDs passed to Session; the returned
+	// controller is the fake itself so calls land in the slices above.
+	sessionTargets  []string
+	sessionProgress map[string]domain.ProgressData
 }
 
 func newFakeSMTCService() *fakeSMTCService {
@@ -63,6 +71,7 @@ func (f *fakeSMTCService) TogglePlayPause() error {
 	return f.toggleErr
 }
 func (f *fakeSMTCService) SkipNext() error {
+	f.nextCalls++
 	return f.nextErr
 }
 func (f *fakeSMTCService) SkipPrevious() error {
@@ -80,8 +89,22 @@ func (f *fakeSMTCService) SetRepeat(mode int) error {
 	f.repeatCalls = append(f.repeatCalls, mode)
 	return f.repeatErr
 }
+func (f *fakeSMTCService) SetPlaybackRate(rate float64) error {
+	f.rateCalls = append(f.rateCalls, rate)
+	return f.rateErr
+}
+func (f *fakeSMTCService) Session(appID string) smtc.Controller {
+	f.sessionTargets = append(f.sessionTargets, appID)
+	return f
+}
+func (f *fakeSMTCService) SessionProgress(appID string) (domain.ProgressData, error) {
+	if p, ok := f.sessionProgress[appID]; ok {
+		return p, nil
+	}
+	return domain.ProgressData{}, smtc.ErrSessionNotFound
+}
 
-func newTestServer(t *testing.T) (*Server, *fakeSMTCService, context.CancelFunc) {
+func newTestServer(t testing.TB) (*Server, *fakeSMTCService, context.CancelFunc) {
 	t.Helper()
 	svc := newFakeSMTCService()
 	srv, err := New(&config.Config{
@@ -350,6 +373,9 @@ func TestHandleWebSocket_HelloOnConnect(t *testing.T) {
 	if !payload.Capabilities["control"] || !payload.Capabilities["heartbeat"] {
 		t.Fatalf("hello capabilities = %+v, want control+heartbeat", payload.Capabilities)
 	}
+	if len(payload.Controls) != len(srv.controlSpecs()) {
+		t.Fatalf("hello controls = %+v, want every control action", payload.Controls)
+	}
 
 	info := mustReadEnvelope(t, handler.msgs)
 	if info.Type != wsproto.MsgInfo {
@@ -431,7 +457,7 @@ func TestHandleWebSocket_UnknownMessageWithIDGetsAck(t *testing.T) {
 	if err := json.Unmarshal(ack.Data, &payload); err != nil {
 		t.Fatalf("decode ack payload: %v", err)
 	}
-	if payload.Success || payload.Error == "" {
+	if payload.Success || payload.Error == "" || payload.Code != wsproto.CodeInvalidArgument {
 		t.Fatalf("ack payload = %+v, want unsuccessful ack with error", payload)
 	}
 }
@@ -456,6 +482,37 @@ func TestHandleEvent_SessionsChangedBroadcasts(t *testing.T) {
 	}
 }
 
+func TestHandleEvent_CapabilitiesChangedBroadcastsAndCaches(t *testing.T) {
+	srv, _, _ := newTestServer(t)
+	httpSrv := startWSTestServer(t, srv)
+	_, handler := connectWSClient(t, httpSrv.URL)
+	_ = mustReadEnvelope(t, handler.msgs)
+
+	caps := smtc.ControlCapabilities{IsPlayEnabled: true, IsNextEnabled: true}
+	srv.handleEvent(smtc.CapabilitiesChangedEvent{Caps: caps})
+	env := mustReadEnvelope(t, handler.msgs)
+	if env.Type != wsproto.MsgCapabilities {
+		t.Fatalf("capabilities envelope type = %q, want %q", env.Type, wsproto.MsgCapabilities)
+	}
+	var payload wsproto.CapabilitiesPayload
+	if err := json.Unmarshal(env.Data, &payload); err != nil {
+		t.Fatalf("decode capabilities payload: %v", err)
+	}
+	if !payload.Capabilities["next"] || payload.Capabilities["previous"] || !payload.Capabilities["control"] {
+		t.Fatalf("capabilities payload = %+v", payload)
+	}
+	if got := snapshotForTest(t, srv).caps; got != caps {
+		t.Fatalf("cached caps = %+v, want %+v", got, caps)
+	}
+
+	// An identical set is not re-broadcast; the next message seen is the sessions update.
+	srv.handleEvent(smtc.CapabilitiesChangedEvent{Caps: caps})
+	srv.handleEvent(smtc.SessionsChangedEvent{})
+	if env := mustReadEnvelope(t, handler.msgs); env.Type != wsproto.MsgSessions {
+		t.Fatalf("envelope type = %q, want %q", env.Type, wsproto.MsgSessions)
+	}
+}
+
 func TestHandleWebSocket_UnsupportedVersionClosesConnection(t *testing.T) {
 	srv, _, _ := newTestServer(t)
 	httpSrv := startWSTestServer(t, srv)
@@ -535,6 +592,20 @@ func TestControlHelpersRecordArguments(t *testing.T) {
 	}
 }
 
+func TestExecuteWSControl_Rate(t *testing.T) {
+	srv, svc, _ := newTestServer(t)
+
+	if _, err := srv.executeWSControl(srv.targetFor(""), "rate", json.RawMessage(`{"rate":1.25}`)); err != nil {
+		t.Fatalf("rate 1.25: unexpected error %v", err)
+	}
+	if _, err := srv.executeWSControl(srv.targetFor(""), "rate", json.RawMessage(`{"rate":10}`)); !errors.Is(err, ErrInvalidPlaybackRate) {
+		t.Fatalf("rate 10: got %v, want ErrInvalidPlaybackRate", err)
+	}
+	if len(svc.rateCalls) != 1 || svc.rateCalls[0] != 1.25 {
+		t.Fatalf("rate calls = %v, want [1.25]", svc.rateCalls)
+	}
+}
+
 func TestHandleControl_ServiceErrorReturnsSuccessFalse(t *testing.T) {
 	srv, svc, _ := newTestServer(t)
 	svc.playErr = errors.New("boom")
@@ -551,4 +622,87 @@ func TestHandleControl_ServiceErrorReturnsSuccessFalse(t *testing.T) {
 	if body["success"] != false {
 		t.Fatalf("success = %v, want false", body["success"])
 	}
+	if w.Code != http.StatusBadGateway || body["code"] != string(wsproto.CodeProviderError) {
+		t.Fatalf("got %d with code %v, want %d with %q", w.Code, body["code"], http.StatusBadGateway, wsproto.CodeProviderError)
+	}
+}
+
+func TestHandleWebSocket_ControlWithSession(t *testing.T) {
+	srv, svc, _ := newTestServer(t)
+	httpSrv := startWSTestServer(t, srv)
+	conn, handler := connectWSClient(t, httpSrv.URL)
+	_ = mustReadEnvelope(t, handler.msgs)
+
+	control := wsproto.Envelope{Type: wsproto.MsgControl, V: wsproto.ProtocolVersion, ID: "sess-1"}
+	control.Data, _ = json.Marshal(wsproto.ControlPayload{Action: "pause", Session: "chrome.exe"})
+	msg, _ := json.Marshal(control)
+	if err := conn.WriteMessage(gws.OpcodeText, msg); err != nil {
+		t.Fatalf("write control: %v", err)
+	}
+	ack := mustReadEnvelope(t, handler.msgs)
+	var payload wsproto.AckPayload
+	if err := json.Unmarshal(ack.Data, &payload); err != nil {
+		t.Fatalf("decode ack payload: %v", err)
+	}
+	if ack.ID != "sess-1" || !payload.Success {
+		t.Fatalf("ack = %s %+v", ack.ID, payload)
+	}
+	if len(svc.sessionTargets) != 1 || svc.sessionTargets[0] != "chrome.exe" {
+		t.Fatalf("sessionTargets = %v, want [chrome.exe]", svc.sessionTargets)
+	}
+}
+
+// progressWithArt returns a server showing a track with size bytes of album
+// art, and a function that feeds it a new progress event on each call. The
+// hub is not running; each broadcast is drained inline so the measurement
+// covers only the event handling.
+func progressWithArt(tb testing.TB, size int) func() {
+	tb.Helper()
+	srv, err := New(&config.Config{
+		Server: config.ServerConfig{Port: 11451},
+		UI:     config.UIConfig{Theme: "default"},
+	}, newFakeSMTCService())
+	if err != nil {
+		tb.Fatalf("New returned error: %v", err)
+	}
+	var art []byte
+	if size > 0 {
+		art = make([]byte, size)
+	}
+	srv.handleInfoEvent(domain.InfoData{Artist: "Artist", Title: "Title", ThumbnailData: art})
+	<-srv.hub.ch
+	if st := srv.snapshot(); st.art != nil {
+		<-st.art.derived // keep the background decode out of the measurement
+	}
+	position := 0
+	return func() {
+		position++
+		srv.handleProgressEvent(domain.ProgressData{Position: position, Duration: 1 << 30, Status: int(domain.StatusPlaying)})
+		<-srv.hub.ch
+	}
+}
+
+func TestHandleProgressEvent_AllocsIndependentOfArtSize(t *testing.T) {
+	allocs := func(size int) float64 {
+		progress := progressWithArt(t, size)
+		progress()
+		return testing.AllocsPerRun(200, progress)
+	}
+	without, with := allocs(0), allocs(4<<20)
+	if with > without {
+		t.Fatalf("progress event allocates %.1f times with 4 MiB of art, %.1f without", with, without)
+	}
+}
+
+func BenchmarkHandleProgressEvent(b *testing.B) {
+	for _, size := range []int{0, 64 << 10, 4 << 20} {
+		b.Run(fmt.Sprintf("art=%dKiB", size>>10), func(b *testing.B) {
+			progress := progressWithArt(b, size)
+			b.ReportAllocs()
+			b.ResetTimer()
+			for b.Loop() {
+				progress()
+			}
+		})
+	}
 }
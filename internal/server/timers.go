@@ -0,0 +1,318 @@
+package server
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"smtc-now-playing/internal/config"
+	"smtc-now-playing/internal/domain"
+	"smtc-now-playing/internal/wsproto"
+)
+
+// Sentinel errors for timers.
+var (
+	ErrInvalidTimer  = errors.New("server: invalid timer request")
+	ErrTimerNotFound = errors.New("server: timer not found")
+)
+
+// TimerRequest schedules a control to run later. Action, Args and Session
+// mean the same as in a WebSocket control. Exactly one trigger — After, At or
+// Tracks — must be set.
+type TimerRequest struct {
+	Action  string          `json:"action"`
+	Args    json.RawMessage `json:"args,omitempty"`
+	Session string          `json:"session,omitempty"`
+	// After fires the timer this many seconds from now.
+	After int `json:"after,omitempty"`
+	// At fires the timer at a wall-clock time.
+	At *time.Time `json:"at,omitempty"`
+	// Tracks fires the timer once this many track changes have been seen;
+	// 1 means "at the end of the current track".
+	Tracks int `json:"tracks,omitempty"`
+}
+
+// timerEntry is a pending timer. A track-based timer counts the tracks of
+// session, the session displayed when it was scheduled; "" counts those of
+// whichever session is displayed.
+type timerEntry struct {
+	seq     uint64
+	payload wsproto.TimerPayload
+	timer   *time.Timer // nil for track-based timers
+	session string
+}
+
+// timerScheduler holds the pending timers. lastTrack identifies the track
+// last seen by handleInfoEvent for each session, for counting track changes.
+type timerScheduler struct {
+	mu        sync.Mutex
+	seq       uint64
+	entries   map[string]*timerEntry
+	lastTrack map[string]string
+}
+
+func newTimerScheduler() *timerScheduler {
+	return &timerScheduler{entries: make(map[string]*timerEntry), lastTrack: make(map[string]string)}
+}
+
+// list returns the pending timers in creation order. Must be called with mu held.
+func (ts *timerScheduler) list() []wsproto.TimerPayload {
+	entries := make([]*timerEntry, 0, len(ts.entries))
+	for _, e := range ts.entries {
+		entries = append(entries, e)
+	}
+	slices.SortFunc(entries, compareTimerEntries)
+	timers := make([]wsproto.TimerPayload, len(entries))
+	for i, e := range entries {
+		timers[i] = e.payload
+	}
+	return timers
+}
+
+// compareTimerEntries orders timers by creation.
+func compareTimerEntries(a, b *timerEntry) int { return cmp.Compare(a.seq, b.seq) }
+
+// validateTimer checks req and returns the delay of a time-based timer.
+func validateTimer(req TimerRequest, now time.Time) (time.Duration, error) {
+	if !isControlAction(req.Action) {
+		return 0, fmt.Errorf("%w: unknown action %q", ErrInvalidTimer, req.Action)
+	}
+	// Catch bad args now rather than when the timer fires unattended.
+	if _, err := decodeControlArgs(req.Action, req.Args); err != nil {
+		return 0, fmt.Errorf("%w: %w", ErrInvalidTimer, err)
+	}
+	set := 0
+	for _, present := range []bool{req.After != 0, req.At != nil, req.Tracks != 0} {
+		if present {
+			set++
+		}
+	}
+	if set != 1 {
+		return 0, fmt.Errorf("%w: exactly one of after, at or tracks is required", ErrInvalidTimer)
+	}
+
+	var delay time.Duration
+	switch {
+	case req.Tracks != 0:
+		if req.Tracks < 0 {
+			return 0, fmt.Errorf("%w: tracks must be positive", ErrInvalidTimer)
+		}
+		return 0, nil
+	case req.After != 0:
+		if req.After < 0 {
+			return 0, fmt.Errorf("%w: after must be positive", ErrInvalidTimer)
+		}
+		delay = time.Duration(req.After) * time.Second
+	default:
+		delay = req.At.Sub(now)
+		if delay <= 0 {
+			return 0, fmt.Errorf("%w: at %s is in the past", ErrInvalidTimer, req.At.Format(time.RFC3339))
+		}
+	}
+	if delay > maxTimerDelay {
+		return 0, fmt.Errorf("%w: timers cannot be set more than %s ahead", ErrInvalidTimer, maxTimerDelay)
+	}
+	return delay, nil
+}
+
+// isControlAction reports whether action is understood by executeWSControl.
+func isControlAction(action string) bool {
+	return slices.Contains(config.ControlActions, action)
+}
+
+// ScheduleTimer adds a timer that runs req's control when it fires.
+func (s *Server) ScheduleTimer(req TimerRequest) (wsproto.TimerPayload, error) {
+	now := time.Now()
+	delay, err := validateTimer(req, now)
+	if err != nil {
+		return wsproto.TimerPayload{}, err
+	}
+	active := s.snapshot().activeAppID
+	if req.Tracks != 0 && req.Session != "" && req.Session != active {
+		// Only the displayed session's track changes are observed.
+		return wsproto.TimerPayload{}, fmt.Errorf("%w: tracks can only be counted on the displayed session", ErrInvalidTimer)
+	}
+
+	ts := s.timers
+	ts.mu.Lock()
+	ts.seq++
+	e := &timerEntry{
+		seq: ts.seq,
+		payload: wsproto.TimerPayload{
+			ID:              strconv.FormatUint(ts.seq, 10),
+			Action:          req.Action,
+			Args:            req.Args,
+			Session:         req.Session,
+			CreatedAt:       now.UnixMilli(),
+			TracksRemaining: req.Tracks,
+		},
+	}
+	if req.Tracks != 0 {
+		e.session = active
+	} else {
+		e.payload.FiresAt = now.Add(delay).UnixMilli()
+		id := e.payload.ID
+		e.timer = time.AfterFunc(delay, func() { s.fireTimer(id) })
+	}
+	ts.entries[e.payload.ID] = e
+	timers := ts.list()
+	ts.mu.Unlock()
+
+	s.broadcastEnvelope(wsproto.NewTimers(timers))
+	return e.payload, nil
+}
+
+// Timers returns the pending timers in creation order.
+func (s *Server) Timers() []wsproto.TimerPayload {
+	s.timers.mu.Lock()
+	defer s.timers.mu.Unlock()
+	return s.timers.list()
+}
+
+// CancelTimer removes a pending timer.
+func (s *Server) CancelTimer(id string) error {
+	ts := s.timers
+	ts.mu.Lock()
+	e, ok := ts.entries[id]
+	if !ok {
+		ts.mu.Unlock()
+		return ErrTimerNotFound
+	}
+	if e.timer != nil {
+		e.timer.Stop()
+	}
+	delete(ts.entries, id)
+	timers := ts.list()
+	ts.mu.Unlock()
+
+	s.broadcastEnvelope(wsproto.NewTimers(timers))
+	return nil
+}
+
+// stopTimers stops all time-based timers without firing them.
+func (s *Server) stopTimers() {
+	s.timers.mu.Lock()
+	defer s.timers.mu.Unlock()
+	for _, e := range s.timers.entries {
+		if e.timer != nil {
+			e.timer.Stop()
+		}
+	}
+}
+
+// fireTimer removes the timer and runs its control. It is a no-op when the
+// timer was canceled in the meantime.
+func (s *Server) fireTimer(id string) {
+	ts := s.timers
+	ts.mu.Lock()
+	e, ok := ts.entries[id]
+	if !ok {
+		ts.mu.Unlock()
+		return
+	}
+	delete(ts.entries, id)
+	timers := ts.list()
+	ts.mu.Unlock()
+
+	s.broadcastEnvelope(wsproto.NewTimers(timers))
+	s.runTimer(e.payload)
+}
+
+// runTimer executes a fired timer's control.
+func (s *Server) runTimer(t wsproto.TimerPayload) {
+	if _, err := s.executeWSControl(s.targetFor(t.Session), t.Action, t.Args); err != nil {
+		slog.Warn("timer control failed", "id", t.ID, "action", t.Action, "err", err)
+		return
+	}
+	slog.Info("timer fired", "id", t.ID, "action", t.Action)
+}
+
+// advanceTrackTimers counts a track change against the track-based timers
+// of info's session when info identifies a different track from the last one
+// seen there, and runs the timers that reach zero. Switching the displayed
+// session is not a track change. Empty info, as sent between tracks or when a
+// session closes, is ignored.
+func (s *Server) advanceTrackTimers(info *domain.InfoData) {
+	if info == nil || (info.Title == "" && info.Artist == "") {
+		return
+	}
+	key := trackKey(info)
+
+	ts := s.timers
+	ts.mu.Lock()
+	prev := ts.lastTrack[info.SourceApp]
+	ts.lastTrack[info.SourceApp] = key
+	if prev == "" || prev == key {
+		ts.mu.Unlock()
+		return
+	}
+	var fired []*timerEntry
+	changed := false
+	for id, e := range ts.entries {
+		if e.timer != nil || (e.session != "" && e.session != info.SourceApp) {
+			continue
+		}
+		changed = true
+		e.payload.TracksRemaining--
+		if e.payload.TracksRemaining <= 0 {
+			fired = append(fired, e)
+			delete(ts.entries, id)
+		}
+	}
+	slices.SortFunc(fired, compareTimerEntries)
+	if !changed {
+		ts.mu.Unlock()
+		return
+	}
+	timers := ts.list()
+	ts.mu.Unlock()
+
+	s.broadcastEnvelope(wsproto.NewTimers(timers))
+	if len(fired) > 0 {
+		// Controls round-trip through the SMTC goroutine; keep them off the
+		// event goroutine.
+		go func() {
+			for _, e := range fired {
+				s.runTimer(e.payload)
+			}
+		}()
+	}
+}
+
+// trackKey identifies a track within a session for counting track changes.
+func trackKey(info *domain.InfoData) string {
+	return info.Artist + "\x00" + info.Title + "\x00" + info.AlbumTitle
+}
+
+func (s *Server) handleListTimers(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.Timers())
+}
+
+func (s *Server) handleCreateTimer(w http.ResponseWriter, r *http.Request) {
+	var req TimerRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.writeControlError(w, controlTarget{}, errInvalidBody)
+		return
+	}
+	timer, err := s.ScheduleTimer(req)
+	if err != nil {
+		s.writeControlError(w, controlTarget{}, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, timer)
+}
+
+func (s *Server) handleCancelTimer(w http.ResponseWriter, r *http.Request) {
+	if err := s.CancelTimer(r.PathValue("id")); err != nil {
+		s.writeControlError(w, controlTarget{}, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"success": true})
+}
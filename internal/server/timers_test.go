@@ -0,0 +1,226 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"smtc-now-playing/internal/domain"
+	"smtc-now-playing/internal/smtc"
+	"smtc-now-playing/internal/wsproto"
+)
+
+func TestValidateTimer(t *testing.T) {
+	now := time.Date(2026, 10, 18, 20, 0, 0, 0, time.UTC)
+	future := now.Add(45 * time.Minute)
+	past := now.Add(-time.Minute)
+	tooFar := now.Add(48 * time.Hour)
+
+	tests := []struct {
+		name      string
+		req       TimerRequest
+		wantDelay time.Duration
+		wantErr   bool
+	}{
+		{"after", TimerRequest{Action: "pause", After: 90}, 90 * time.Second, false},
+		{"at", TimerRequest{Action: "stop", At: &future}, 45 * time.Minute, false},
+		{"tracks", TimerRequest{Action: "pause", Tracks: 1}, 0, false},
+		{"unknown_action", TimerRequest{Action: "explode", After: 1}, 0, true},
+		{"no_trigger", TimerRequest{Action: "pause"}, 0, true},
+		{"two_triggers", TimerRequest{Action: "pause", After: 1, Tracks: 1}, 0, true},
+		{"negative_after", TimerRequest{Action: "pause", After: -5}, 0, true},
+		{"negative_tracks", TimerRequest{Action: "pause", Tracks: -1}, 0, true},
+		{"at_in_past", TimerRequest{Action: "pause", At: &past}, 0, true},
+		{"too_far_ahead", TimerRequest{Action: "pause", At: &tooFar}, 0, true},
+		{"seek_args", TimerRequest{Action: "seek", Args: json.RawMessage(`{"offset":-5000}`), After: 1}, time.Second, false},
+		{"bad_repeat_mode", TimerRequest{Action: "repeat", Args: json.RawMessage(`{"mode":7}`), After: 1}, 0, true},
+		{"bad_rate", TimerRequest{Action: "rate", Args: json.RawMessage(`{"rate":10}`), After: 1}, 0, true},
+		{"seek_without_target", TimerRequest{Action: "seek", Args: json.RawMessage(`{}`), After: 1}, 0, true},
+		{"malformed_args", TimerRequest{Action: "shuffle", Args: json.RawMessage(`{"active":"yes"}`), After: 1}, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			delay, err := validateTimer(tt.req, now)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidTimer) {
+					t.Fatalf("err = %v, want ErrInvalidTimer", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if delay != tt.wantDelay {
+				t.Fatalf("delay = %v, want %v", delay, tt.wantDelay)
+			}
+		})
+	}
+}
+
+func TestTimersEndpoints(t *testing.T) {
+	srv, _, _ := newTestServer(t)
+	t.Cleanup(srv.stopTimers)
+	handler := srv.setupRoutes()
+
+	do := func(method, target, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.RemoteAddr = "127.0.0.1:1234"
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	w := do(http.MethodPost, "/api/timers", `{"action":"pause","after":2700}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create: got %d want %d: %s", w.Code, http.StatusCreated, w.Body.String())
+	}
+	var created wsproto.TimerPayload
+	if err := json.NewDecoder(w.Body).Decode(&created); err != nil {
+		t.Fatalf("decode created timer: %v", err)
+	}
+	if created.ID == "" || created.Action != "pause" || created.FiresAt-created.CreatedAt != 2700*1000 {
+		t.Fatalf("created = %+v", created)
+	}
+
+	// Failures carry the same codes as control failures.
+	code := func(w *httptest.ResponseRecorder) any {
+		var body map[string]any
+		if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+			t.Fatalf("decode error response: %v", err)
+		}
+		return body["code"]
+	}
+	for _, body := range []string{`{"action":"pause"}`, `{"action":"seek","args":{"percent":200},"after":60}`, `{`} {
+		w := do(http.MethodPost, "/api/timers", body)
+		if c := code(w); w.Code != http.StatusBadRequest || c != string(wsproto.CodeInvalidArgument) {
+			t.Fatalf("create %s: got %d with code %v, want %d with %q", body, w.Code, c, http.StatusBadRequest, wsproto.CodeInvalidArgument)
+		}
+	}
+
+	w = do(http.MethodGet, "/api/timers", "")
+	var listed []wsproto.TimerPayload
+	if err := json.NewDecoder(w.Body).Decode(&listed); err != nil {
+		t.Fatalf("decode timers: %v", err)
+	}
+	if len(listed) != 1 || listed[0].ID != created.ID {
+		t.Fatalf("listed = %+v, want the created timer", listed)
+	}
+
+	if w := do(http.MethodDelete, "/api/timers/"+created.ID, ""); w.Code != http.StatusOK {
+		t.Fatalf("cancel: got %d want %d", w.Code, http.StatusOK)
+	}
+	if w := do(http.MethodDelete, "/api/timers/"+created.ID, ""); w.Code != http.StatusNotFound || code(w) != string(wsproto.CodeNotFound) {
+		t.Fatalf("cancel again: got %d want %d with %q", w.Code, http.StatusNotFound, wsproto.CodeNotFound)
+	}
+	if timers := srv.Timers(); len(timers) != 0 {
+		t.Fatalf("timers after cancel = %+v, want none", timers)
+	}
+}
+
+func TestTimersEndpoints_RemoteRejected(t *testing.T) {
+	srv, _, _ := newTestServer(t)
+	req := httptest.NewRequest(http.MethodPost, "/api/timers", strings.NewReader(`{"action":"pause","tracks":1}`))
+	req.RemoteAddr = "192.168.1.20:1234"
+	w := httptest.NewRecorder()
+	srv.setupRoutes().ServeHTTP(w, req)
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("got %d want %d", w.Code, http.StatusForbidden)
+	}
+}
+
+func TestFireTimer_RunsControlOnce(t *testing.T) {
+	srv, svc, _ := newTestServer(t)
+	t.Cleanup(srv.stopTimers)
+	timer, err := srv.ScheduleTimer(TimerRequest{Action: "seek", Args: json.RawMessage(`{"position":5000}`), After: 600})
+	if err != nil {
+		t.Fatalf("ScheduleTimer: %v", err)
+	}
+
+	srv.fireTimer(timer.ID)
+	srv.fireTimer(timer.ID)
+
+	if len(svc.seekCalls) != 1 || svc.seekCalls[0] != 5000 {
+		t.Fatalf("seekCalls = %v, want [5000]", svc.seekCalls)
+	}
+	if timers := srv.Timers(); len(timers) != 0 {
+		t.Fatalf("timers after firing = %+v, want none", timers)
+	}
+}
+
+func TestAdvanceTrackTimers(t *testing.T) {
+	srv, _, _ := newTestServer(t)
+	srv.handleInfoEvent(domain.InfoData{Artist: "Artist", Title: "First"})
+
+	after1, _ := srv.ScheduleTimer(TimerRequest{Action: "pause", Tracks: 1})
+	after2, _ := srv.ScheduleTimer(TimerRequest{Action: "pause", Tracks: 2})
+
+	// Cleared info and a thumbnail-only update are not track changes.
+	srv.handleInfoEvent(domain.InfoData{})
+	srv.handleInfoEvent(domain.InfoData{Artist: "Artist", Title: "First", ThumbnailData: []byte{1}})
+	if timers := srv.Timers(); len(timers) != 2 || timers[0].TracksRemaining != 1 {
+		t.Fatalf("timers = %+v, want both pending", timers)
+	}
+
+	srv.handleInfoEvent(domain.InfoData{Artist: "Artist", Title: "Second"})
+	timers := srv.Timers()
+	if len(timers) != 1 || timers[0].ID != after2.ID || timers[0].TracksRemaining != 1 {
+		t.Fatalf("timers = %+v, want only %s with 1 track left (fired %s)", timers, after2.ID, after1.ID)
+	}
+}
+
+func TestTimers_BroadcastOverWebSocket(t *testing.T) {
+	srv, _, _ := newTestServer(t)
+	t.Cleanup(srv.stopTimers)
+	httpSrv := startWSTestServer(t, srv)
+	_, handler := connectWSClient(t, httpSrv.URL)
+	_ = mustReadEnvelope(t, handler.msgs) // hello
+
+	if _, err := srv.ScheduleTimer(TimerRequest{Action: "stop", After: 60}); err != nil {
+		t.Fatalf("ScheduleTimer: %v", err)
+	}
+
+	env := mustReadEnvelope(t, handler.msgs)
+	if env.Type != wsproto.MsgTimers {
+		t.Fatalf("type = %q, want %q", env.Type, wsproto.MsgTimers)
+	}
+	var payload wsproto.TimersPayload
+	if err := json.Unmarshal(env.Data, &payload); err != nil {
+		t.Fatalf("decode timers: %v", err)
+	}
+	if len(payload.Timers) != 1 || payload.Timers[0].Action != "stop" || payload.Timers[0].FiresAt == 0 {
+		t.Fatalf("timers = %+v", payload.Timers)
+	}
+}
+
+func TestAdvanceTrackTimers_CountsOnlyTheScheduledSession(t *testing.T) {
+	srv, _, _ := newTestServer(t)
+	srv.handleEvent(smtc.DeviceChangedEvent{AppID: "A"})
+	srv.handleInfoEvent(domain.InfoData{SourceApp: "A", Artist: "Artist", Title: "First"})
+
+	if _, err := srv.ScheduleTimer(TimerRequest{Action: "pause", Tracks: 1, Session: "B"}); !errors.Is(err, ErrInvalidTimer) {
+		t.Fatalf("tracks timer on another session: err = %v, want ErrInvalidTimer", err)
+	}
+	if _, err := srv.ScheduleTimer(TimerRequest{Action: "pause", Tracks: 1}); err != nil {
+		t.Fatalf("ScheduleTimer: %v", err)
+	}
+
+	// Switching to another session, and tracks changing there, do not count.
+	srv.handleEvent(smtc.DeviceChangedEvent{AppID: "B"})
+	srv.handleInfoEvent(domain.InfoData{SourceApp: "B", Artist: "Other", Title: "One"})
+	srv.handleInfoEvent(domain.InfoData{SourceApp: "B", Artist: "Other", Title: "Two"})
+	srv.handleEvent(smtc.DeviceChangedEvent{AppID: "A"})
+	srv.handleInfoEvent(domain.InfoData{SourceApp: "A", Artist: "Artist", Title: "First"})
+	if timers := srv.Timers(); len(timers) != 1 || timers[0].TracksRemaining != 1 {
+		t.Fatalf("timers = %+v, want one with 1 track left", timers)
+	}
+
+	srv.handleInfoEvent(domain.InfoData{SourceApp: "A", Artist: "Artist", Title: "Second"})
+	if timers := srv.Timers(); len(timers) != 0 {
+		t.Fatalf("timers = %+v, want none after the track changed", timers)
+	}
+}
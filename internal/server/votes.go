@@ -0,0 +1,249 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"smtc-now-playing/internal/config"
+	"smtc-now-playing/internal/domain"
+	"smtc-now-playing/internal/wsproto"
+)
+
+// Sentinel errors for vote-to-skip.
+var (
+	ErrVotesDisabled = errors.New("server: vote-to-skip is disabled")
+	ErrInvalidVote   = errors.New("server: invalid vote")
+)
+
+// SkipVote is one viewer's vote to skip the current track. Voter IDs are
+// scoped by Source, so the same name on two chat platforms counts twice.
+type SkipVote struct {
+	Voter  string `json:"voter"`
+	Source string `json:"source"`
+}
+
+// VoteResult is the tally after a vote. Counted is false for a repeat vote
+// by the same voter on the same track.
+type VoteResult struct {
+	Counted bool `json:"counted"`
+	wsproto.VotesPayload
+}
+
+// voteTally holds the skip votes on the current track. Votes and voters
+// expire after the configured windows; expiry re-broadcasts the tally so
+// progress bars shrink without a new vote.
+type voteTally struct {
+	mu    sync.Mutex
+	track string               // trackKey of the track the votes apply to
+	votes map[string]time.Time // voter → time of their vote on track
+	seen  map[string]time.Time // voter → time of their last vote on any track
+	timer *time.Timer
+}
+
+func newVoteTally() *voteTally {
+	return &voteTally{votes: make(map[string]time.Time), seen: make(map[string]time.Time)}
+}
+
+// prune drops expired votes and voters. Must be called with mu held.
+func (v *voteTally) prune(cfg config.VotesConfig, now time.Time) {
+	window := time.Duration(cfg.Window) * time.Second
+	for voter, at := range v.votes {
+		if now.Sub(at) >= window {
+			delete(v.votes, voter)
+		}
+	}
+	active := time.Duration(cfg.ActiveWindow) * time.Second
+	for voter, at := range v.seen {
+		if now.Sub(at) >= active {
+			delete(v.seen, voter)
+		}
+	}
+}
+
+// payload returns the current tally. Must be called with mu held.
+func (v *voteTally) payload(cfg config.VotesConfig) wsproto.VotesPayload {
+	return wsproto.VotesPayload{
+		Votes:  len(v.votes),
+		Needed: votesNeeded(cfg, len(v.seen)),
+		Active: len(v.seen),
+	}
+}
+
+// votesNeeded returns the number of votes that skips a track given the
+// number of active voters. It is never less than one.
+func votesNeeded(cfg config.VotesConfig, active int) int {
+	needed := cfg.Threshold
+	if cfg.ThresholdPercent > 0 {
+		needed = max(needed, (active*cfg.ThresholdPercent+99)/100)
+	}
+	return max(needed, 1)
+}
+
+// VoteSkip records a vote to skip the current track and skips it once the
+// threshold is reached. Votes then start over for the next track. The skip
+// is a next control on the displayed session and fails the way one would.
+func (s *Server) VoteSkip(vote SkipVote) (VoteResult, error) {
+	cfg := s.cfg.Votes
+	if !cfg.Enabled {
+		return VoteResult{}, ErrVotesDisabled
+	}
+	voter := strings.TrimSpace(vote.Voter)
+	if voter == "" {
+		return VoteResult{}, fmt.Errorf("%w: voter is required", ErrInvalidVote)
+	}
+	source := strings.ToLower(strings.TrimSpace(vote.Source))
+	if source == "" {
+		source = "api"
+	}
+	state := s.snapshot()
+	if state.info == nil || state.info.Title == "" {
+		return VoteResult{}, ErrNoTrack
+	}
+
+	now := time.Now()
+	v := s.votes
+	v.mu.Lock()
+	if track := trackKey(state.info); v.track != track {
+		v.track = track
+		clear(v.votes)
+	}
+	v.prune(cfg, now)
+	key := source + ":" + voter
+	_, repeat := v.votes[key]
+	if !repeat {
+		v.votes[key] = now
+	}
+	v.seen[key] = now
+	result := VoteResult{Counted: !repeat, VotesPayload: v.payload(cfg)}
+	if result.Votes >= result.Needed {
+		result.Skipped = true
+		clear(v.votes)
+	}
+	s.scheduleVoteExpiry(cfg, now)
+	v.mu.Unlock()
+
+	if result.Counted || result.Skipped {
+		s.broadcastEnvelope(wsproto.NewVotes(result.VotesPayload))
+	}
+	if result.Skipped {
+		slog.Info("vote-to-skip passed", "votes", result.Votes, "needed", result.Needed)
+		if _, err := s.executeWSControl(s.targetFor(""), "next", nil); err != nil {
+			return result, err
+		}
+	}
+	return result, nil
+}
+
+// Votes returns the tally on the current track.
+func (s *Server) Votes() wsproto.VotesPayload {
+	cfg := s.cfg.Votes
+	s.votes.mu.Lock()
+	defer s.votes.mu.Unlock()
+	s.votes.prune(cfg, time.Now())
+	return s.votes.payload(cfg)
+}
+
+// scheduleVoteExpiry arms the timer for the next vote to expire. Must be
+// called with s.votes.mu held.
+func (s *Server) scheduleVoteExpiry(cfg config.VotesConfig, now time.Time) {
+	v := s.votes
+	if v.timer != nil {
+		v.timer.Stop()
+		v.timer = nil
+	}
+	var oldest time.Time
+	for _, at := range v.votes {
+		if oldest.IsZero() || at.Before(oldest) {
+			oldest = at
+		}
+	}
+	if oldest.IsZero() {
+		return
+	}
+	delay := oldest.Add(time.Duration(cfg.Window) * time.Second).Sub(now)
+	v.timer = time.AfterFunc(delay, s.expireVotes)
+}
+
+// expireVotes drops expired votes and broadcasts the smaller tally.
+func (s *Server) expireVotes() {
+	cfg := s.cfg.Votes
+	now := time.Now()
+	v := s.votes
+	v.mu.Lock()
+	before := len(v.votes)
+	v.prune(cfg, now)
+	tally := v.payload(cfg)
+	s.scheduleVoteExpiry(cfg, now)
+	v.mu.Unlock()
+
+	if tally.Votes != before {
+		s.broadcastEnvelope(wsproto.NewVotes(tally))
+	}
+}
+
+// stopVotes stops the vote expiry timer.
+func (s *Server) stopVotes() {
+	s.votes.mu.Lock()
+	defer s.votes.mu.Unlock()
+	if s.votes.timer != nil {
+		s.votes.timer.Stop()
+		s.votes.timer = nil
+	}
+}
+
+// resetVotes clears the votes when info identifies a different track from
+// the one voted on. Empty info, as sent between tracks, is ignored.
+func (s *Server) resetVotes(info *domain.InfoData) {
+	if info == nil || (info.Title == "" && info.Artist == "") {
+		return
+	}
+	cfg := s.cfg.Votes
+	v := s.votes
+	v.mu.Lock()
+	track := trackKey(info)
+	if v.track == track {
+		v.mu.Unlock()
+		return
+	}
+	v.track = track
+	hadVotes := len(v.votes) > 0
+	clear(v.votes)
+	tally := v.payload(cfg)
+	s.scheduleVoteExpiry(cfg, time.Now())
+	v.mu.Unlock()
+
+	if hadVotes {
+		s.broadcastEnvelope(wsproto.NewVotes(tally))
+	}
+}
+
+func (s *Server) handleGetVotes(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.Votes())
+}
+
+func (s *Server) handleVoteSkip(w http.ResponseWriter, r *http.Request) {
+	var vote SkipVote
+	if err := json.NewDecoder(r.Body).Decode(&vote); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]any{"success": false, "error": "invalid request body"})
+		return
+	}
+	result, err := s.VoteSkip(vote)
+	switch {
+	case errors.Is(err, ErrVotesDisabled):
+		writeJSON(w, http.StatusForbidden, map[string]any{"success": false, "error": err.Error()})
+	case errors.Is(err, ErrInvalidVote):
+		writeJSON(w, http.StatusBadRequest, map[string]any{"success": false, "error": err.Error()})
+	case errors.Is(err, ErrNoTrack):
+		writeJSON(w, http.StatusNotFound, map[string]any{"success": false, "error": err.Error()})
+	case err != nil:
+		s.writeControlError(w, controlTarget{}, err)
+	default:
+		writeJSON(w, http.StatusOK, result)
+	}
+}
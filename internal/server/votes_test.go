@@ -0,0 +1,171 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"smtc-now-playing/internal/config"
+	"smtc-now-playing/internal/domain"
+	"smtc-now-playing/internal/smtc"
+	"smtc-now-playing/internal/wsproto"
+)
+
+func newVoteTestServer(t *testing.T, cfg config.VotesConfig) (*Server, *fakeSMTCService) {
+	t.Helper()
+	srv, svc, _ := newTestServer(t)
+	t.Cleanup(srv.stopVotes)
+	srv.cfg.Votes = cfg
+	srv.handleInfoEvent(domain.InfoData{Artist: "Artist", Title: "Song"})
+	return srv, svc
+}
+
+func TestVotesNeeded(t *testing.T) {
+	tests := []struct {
+		name   string
+		cfg    config.VotesConfig
+		active int
+		want   int
+	}{
+		{"absolute", config.VotesConfig{Threshold: 3}, 10, 3},
+		{"percent_rounds_up", config.VotesConfig{ThresholdPercent: 50}, 5, 3},
+		{"threshold_is_floor", config.VotesConfig{Threshold: 3, ThresholdPercent: 50}, 2, 3},
+		{"percent_above_floor", config.VotesConfig{Threshold: 3, ThresholdPercent: 50}, 10, 5},
+		{"never_zero", config.VotesConfig{ThresholdPercent: 50}, 0, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := votesNeeded(tt.cfg, tt.active); got != tt.want {
+				t.Fatalf("votesNeeded = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVoteSkip_SkipsAtThreshold(t *testing.T) {
+	srv, svc := newVoteTestServer(t, config.VotesConfig{Enabled: true, Threshold: 2, Window: 60, ActiveWindow: 600})
+
+	r, err := srv.VoteSkip(SkipVote{Voter: "alice", Source: "twitch"})
+	if err != nil || !r.Counted || r.Votes != 1 || r.Needed != 2 || r.Skipped {
+		t.Fatalf("first vote = %+v, %v", r, err)
+	}
+	// The same voter again does not count; the same name elsewhere does.
+	if r, _ := srv.VoteSkip(SkipVote{Voter: "alice", Source: "Twitch"}); r.Counted || r.Votes != 1 {
+		t.Fatalf("repeat vote = %+v", r)
+	}
+	if svc.nextCalls != 0 {
+		t.Fatalf("skipped before threshold")
+	}
+	r, err = srv.VoteSkip(SkipVote{Voter: "alice", Source: "youtube"})
+	if err != nil || !r.Skipped || r.Votes != 2 {
+		t.Fatalf("deciding vote = %+v, %v", r, err)
+	}
+	if svc.nextCalls != 1 {
+		t.Fatalf("nextCalls = %d, want 1", svc.nextCalls)
+	}
+	if got := srv.Votes(); got.Votes != 0 || got.Active != 2 {
+		t.Fatalf("tally after skip = %+v, want no votes from 2 active voters", got)
+	}
+}
+
+func TestVoteSkip_Errors(t *testing.T) {
+	srv, _ := newVoteTestServer(t, config.VotesConfig{Threshold: 1, Window: 60, ActiveWindow: 600})
+	if _, err := srv.VoteSkip(SkipVote{Voter: "alice"}); !errors.Is(err, ErrVotesDisabled) {
+		t.Fatalf("disabled: err = %v", err)
+	}
+	srv.cfg.Votes.Enabled = true
+	if _, err := srv.VoteSkip(SkipVote{Voter: "  "}); !errors.Is(err, ErrInvalidVote) {
+		t.Fatalf("blank voter: err = %v", err)
+	}
+	srv.handleInfoEvent(domain.InfoData{})
+	if _, err := srv.VoteSkip(SkipVote{Voter: "alice"}); !errors.Is(err, ErrNoTrack) {
+		t.Fatalf("no track: err = %v", err)
+	}
+}
+
+func TestVoteSkip_NextDisabled(t *testing.T) {
+	srv, svc := newVoteTestServer(t, config.VotesConfig{Enabled: true, Threshold: 1, Window: 60, ActiveWindow: 600})
+	srv.handleEvent(smtc.DeviceChangedEvent{AppID: "Spotify.exe"})
+	srv.handleCapabilitiesEvent(smtc.ControlCapabilities{IsPlayEnabled: true})
+
+	w := serveLocal(srv.setupRoutes(), http.MethodPost, "/api/votes/skip", `{"voter":"alice"}`)
+	var resp struct {
+		Code wsproto.ErrorCode `json:"code"`
+	}
+	_ = json.NewDecoder(w.Body).Decode(&resp)
+	if w.Code != http.StatusUnprocessableEntity || resp.Code != wsproto.CodeNotSupported {
+		t.Fatalf("vote with next disabled: got %d %q", w.Code, resp.Code)
+	}
+	if svc.nextCalls != 0 {
+		t.Fatalf("nextCalls = %d, want the disabled skip refused", svc.nextCalls)
+	}
+}
+
+func TestVoteSkip_Window(t *testing.T) {
+	srv, _ := newVoteTestServer(t, config.VotesConfig{Enabled: true, Threshold: 5, Window: 60, ActiveWindow: 600})
+	_, _ = srv.VoteSkip(SkipVote{Voter: "alice"})
+	_, _ = srv.VoteSkip(SkipVote{Voter: "bob"})
+
+	srv.votes.mu.Lock()
+	srv.votes.votes["api:alice"] = time.Now().Add(-2 * time.Minute)
+	srv.votes.mu.Unlock()
+
+	if got := srv.Votes(); got.Votes != 1 || got.Active != 2 {
+		t.Fatalf("tally = %+v, want alice's vote expired but alice still active", got)
+	}
+}
+
+func TestVoteSkip_ResetOnTrackChange(t *testing.T) {
+	srv, _ := newVoteTestServer(t, config.VotesConfig{Enabled: true, Threshold: 5, Window: 60, ActiveWindow: 600})
+	_, _ = srv.VoteSkip(SkipVote{Voter: "alice"})
+
+	// A thumbnail-only update and cleared info are not track changes.
+	srv.handleInfoEvent(domain.InfoData{Artist: "Artist", Title: "Song", ThumbnailData: []byte{1}})
+	srv.handleInfoEvent(domain.InfoData{})
+	if got := srv.Votes(); got.Votes != 1 {
+		t.Fatalf("votes = %d, want 1", got.Votes)
+	}
+
+	srv.handleInfoEvent(domain.InfoData{Artist: "Artist", Title: "Next"})
+	if got := srv.Votes(); got.Votes != 0 {
+		t.Fatalf("votes after track change = %d, want 0", got.Votes)
+	}
+}
+
+func TestVoteSkipEndpoint(t *testing.T) {
+	srv, _ := newVoteTestServer(t, config.VotesConfig{Enabled: true, Threshold: 3, Window: 60, ActiveWindow: 600})
+	handler := srv.setupRoutes()
+	httpSrv := startWSTestServer(t, srv)
+	_, ws := connectWSClient(t, httpSrv.URL)
+	_ = mustReadEnvelope(t, ws.msgs) // hello
+	_ = mustReadEnvelope(t, ws.msgs) // info
+
+	w := serveLocal(handler, http.MethodPost, "/api/votes/skip", `{"voter":"alice","source":"twitch"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("vote: got %d: %s", w.Code, w.Body.String())
+	}
+	var result VoteResult
+	if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+		t.Fatalf("decode result: %v", err)
+	}
+	if !result.Counted || result.Votes != 1 || result.Needed != 3 {
+		t.Fatalf("result = %+v", result)
+	}
+	if w := serveLocal(handler, http.MethodPost, "/api/votes/skip", `{"source":"twitch"}`); w.Code != http.StatusBadRequest {
+		t.Fatalf("vote without voter: got %d want %d", w.Code, http.StatusBadRequest)
+	}
+
+	env := mustReadEnvelope(t, ws.msgs)
+	if env.Type != wsproto.MsgVotes {
+		t.Fatalf("type = %q, want %q", env.Type, wsproto.MsgVotes)
+	}
+	var payload wsproto.VotesPayload
+	if err := json.Unmarshal(env.Data, &payload); err != nil {
+		t.Fatalf("decode votes: %v", err)
+	}
+	if payload != (wsproto.VotesPayload{Votes: 1, Needed: 3, Active: 1}) {
+		t.Fatalf("votes = %+v", payload)
+	}
+}
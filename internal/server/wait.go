@@ -0,0 +1,176 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"smtc-now-playing/internal/smtc"
+	"smtc-now-playing/internal/wsproto"
+)
+
+// controlWait holds the options of a control sent in wait mode.
+type controlWait struct {
+	enabled bool
+	timeout time.Duration
+}
+
+// newControlWait clamps timeoutMs to (0, controlWaitMax], using
+// controlWaitDefault when it is zero or negative.
+func newControlWait(enabled bool, timeoutMs int) controlWait {
+	timeout := time.Duration(timeoutMs) * time.Millisecond
+	if timeout <= 0 {
+		timeout = controlWaitDefault
+	}
+	if timeout > controlWaitMax {
+		timeout = controlWaitMax
+	}
+	return controlWait{enabled: enabled, timeout: timeout}
+}
+
+// parseControlWait reads the wait and timeout query parameters of a REST control.
+func parseControlWait(r *http.Request) (controlWait, error) {
+	q := r.URL.Query()
+	if q.Get("wait") == "" {
+		return controlWait{}, nil
+	}
+	enabled, err := strconv.ParseBool(q.Get("wait"))
+	if err != nil {
+		return controlWait{}, fmt.Errorf("invalid wait parameter %q", q.Get("wait"))
+	}
+	timeoutMs := 0
+	if raw := q.Get("timeout"); raw != "" {
+		if timeoutMs, err = strconv.Atoi(raw); err != nil {
+			return controlWait{}, fmt.Errorf("invalid timeout parameter %q", raw)
+		}
+	}
+	return newControlWait(enabled, timeoutMs), nil
+}
+
+// controlResult is the state reported back for a control sent in wait mode.
+type controlResult struct {
+	info     *wsproto.InfoPayload
+	progress *wsproto.ProgressPayload
+	timedOut bool
+}
+
+// storeState publishes next and wakes everyone blocked in waitForState.
+func (s *Server) storeState(next *stateSnapshot) {
+	s.changedMu.Lock()
+	s.rev++
+	next.rev = s.rev
+	s.state.Store(next)
+	close(s.changed)
+	s.changed = make(chan struct{})
+	s.changedMu.Unlock()
+}
+
+// stateChanged returns a channel that is closed on the next storeState.
+func (s *Server) stateChanged() <-chan struct{} {
+	s.changedMu.Lock()
+	defer s.changedMu.Unlock()
+	return s.changed
+}
+
+// waitForState blocks until done reports true for the current snapshot, the
+// timeout expires or ctx is canceled. It returns the last snapshot seen and
+// whether done was satisfied.
+func (s *Server) waitForState(ctx context.Context, timeout time.Duration, done func(*stateSnapshot) bool) (*stateSnapshot, bool) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		// Grab the channel before reading state so a store in between is not missed.
+		changed := s.stateChanged()
+		state := s.snapshot()
+		if done(state) {
+			return state, true
+		}
+		select {
+		case <-changed:
+		case <-timer.C:
+			return s.snapshot(), false
+		case <-ctx.Done():
+			return s.snapshot(), false
+		}
+	}
+}
+
+// controlGoal is what a control asked for, so a wait can tell its effect
+// apart from unrelated updates. Only the field of the control's kind is set.
+type controlGoal struct {
+	positionMs int64 // seek, forward, backward, bookmark
+	shuffle    bool
+	repeat     int
+	rate       float64
+}
+
+// awaitControl waits for the effect expected of action, relative to prev and
+// goal, and returns the resulting state.
+func (s *Server) awaitControl(ctx context.Context, action string, prev *stateSnapshot, goal controlGoal, wait controlWait) controlResult {
+	state, ok := s.waitForState(ctx, wait.timeout, controlExpectation(action, prev, goal))
+	result := controlResult{timedOut: !ok}
+	if state.info != nil {
+		info := wsproto.NewInfoPayload(s.clientInfo(*state.info), s.albumArtURL(state.artHash()), state.currentPalette())
+		result.info = &info
+	}
+	if state.progress != nil {
+		progress := wsproto.NewProgressPayload(*state.progress)
+		result.progress = &progress
+	}
+	return result
+}
+
+// controlExpectation returns the condition that signals action has taken
+// effect, given the state captured just before it was issued and the goal
+// it asked for.
+func controlExpectation(action string, prev *stateSnapshot, goal controlGoal) func(*stateSnapshot) bool {
+	status := func(st *stateSnapshot) int {
+		if st.progress == nil {
+			return smtc.StatusClosed
+		}
+		return st.progress.Status
+	}
+	prevStatus := status(prev)
+
+	switch action {
+	case "next", "previous":
+		return func(st *stateSnapshot) bool {
+			return st.info != nil && (prev.info == nil || !st.info.Equal(prev.info))
+		}
+	case "play":
+		return func(st *stateSnapshot) bool { return status(st) == smtc.StatusPlaying }
+	case "pause":
+		return func(st *stateSnapshot) bool { return status(st) == smtc.StatusPaused }
+	case "stop":
+		return func(st *stateSnapshot) bool {
+			return status(st) == smtc.StatusStopped || status(st) == smtc.StatusClosed
+		}
+	case "toggle":
+		return func(st *stateSnapshot) bool { return status(st) != prevStatus }
+	case "seek", "forward", "backward", "bookmark":
+		return func(st *stateSnapshot) bool {
+			if st.progress == nil {
+				return false
+			}
+			off := interpolatedPositionMs(st.progress, time.Now()) - goal.positionMs
+			return max(off, -off) <= seekWaitTolerance.Milliseconds()
+		}
+	case "shuffle":
+		return func(st *stateSnapshot) bool {
+			return st.progress != nil && st.progress.IsShuffleActive != nil && *st.progress.IsShuffleActive == goal.shuffle
+		}
+	case "repeat":
+		return func(st *stateSnapshot) bool {
+			return st.progress != nil && st.progress.AutoRepeatMode == goal.repeat
+		}
+	case "rate":
+		return func(st *stateSnapshot) bool {
+			return st.progress != nil && math.Abs(st.progress.PlaybackRate-goal.rate) <= rateWaitTolerance
+		}
+	default:
+		return func(*stateSnapshot) bool { return true }
+	}
+}
@@ -0,0 +1,214 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lxzan/gws"
+	"smtc-now-playing/internal/domain"
+	"smtc-now-playing/internal/smtc"
+	"smtc-now-playing/internal/wsproto"
+)
+
+type waitResponse struct {
+	Success  bool                     `json:"success"`
+	Error    string                   `json:"error"`
+	Code     wsproto.ErrorCode        `json:"code"`
+	Info     *wsproto.InfoPayload     `json:"info"`
+	Progress *wsproto.ProgressPayload `json:"progress"`
+	TimedOut bool                     `json:"timedOut"`
+}
+
+func postControlWait(t *testing.T, srv *Server, action, query string) (int, waitResponse) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/api/control/"+action+"?"+query, nil)
+	req.RemoteAddr = "127.0.0.1:1234"
+	req.SetPathValue("action", action)
+	w := httptest.NewRecorder()
+	localhostOnly(srv.handleControl, false)(w, req)
+	var resp waitResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	return w.Code, resp
+}
+
+func TestHandleControl_WaitForNextTrack(t *testing.T) {
+	srv, _, _ := newTestServer(t)
+	srv.handleInfoEvent(domain.InfoData{Artist: "Artist", Title: "First"})
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		srv.handleInfoEvent(domain.InfoData{Artist: "Artist", Title: "Second"})
+	}()
+
+	code, resp := postControlWait(t, srv, "next", "wait=true&timeout=2000")
+	if code != http.StatusOK || !resp.Success {
+		t.Fatalf("got %d %+v, want 200 success", code, resp)
+	}
+	if resp.TimedOut {
+		t.Fatal("timedOut = true, want false")
+	}
+	if resp.Info == nil || resp.Info.Title != "Second" {
+		t.Fatalf("info = %+v, want title Second", resp.Info)
+	}
+}
+
+func TestHandleControl_WaitAlreadySatisfied(t *testing.T) {
+	srv, _, _ := newTestServer(t)
+	srv.handleProgressEvent(domain.ProgressData{Position: 5, Duration: 60, Status: smtc.StatusPlaying})
+
+	start := time.Now()
+	code, resp := postControlWait(t, srv, "play", "wait=1")
+	if code != http.StatusOK || !resp.Success || resp.TimedOut {
+		t.Fatalf("got %d %+v, want immediate success", code, resp)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("play wait took %v, want immediate return", elapsed)
+	}
+	if resp.Progress == nil || resp.Progress.Status != smtc.StatusPlaying {
+		t.Fatalf("progress = %+v, want status playing", resp.Progress)
+	}
+}
+
+func TestHandleControl_WaitTimesOut(t *testing.T) {
+	srv, _, _ := newTestServer(t)
+	srv.handleProgressEvent(domain.ProgressData{Position: 5, Duration: 60, Status: smtc.StatusPlaying})
+
+	code, resp := postControlWait(t, srv, "pause", "wait=true&timeout=50")
+	if code != http.StatusOK || !resp.Success {
+		t.Fatalf("got %d %+v, want 200 success", code, resp)
+	}
+	if !resp.TimedOut {
+		t.Fatal("timedOut = false, want true")
+	}
+	if resp.Progress == nil || resp.Progress.Status != smtc.StatusPlaying {
+		t.Fatalf("progress = %+v, want unchanged playing state", resp.Progress)
+	}
+}
+
+func TestHandleControl_WaitInvalidParameter(t *testing.T) {
+	srv, _, _ := newTestServer(t)
+	for _, query := range []string{"wait=maybe", "wait=true&timeout=soon"} {
+		code, resp := postControlWait(t, srv, "play", query)
+		if code != http.StatusBadRequest || resp.Success {
+			t.Fatalf("%s: got %d %+v, want 400", query, code, resp)
+		}
+	}
+}
+
+func TestHandleControl_WaitSkippedOnError(t *testing.T) {
+	srv, svc, _ := newTestServer(t)
+	svc.nextErr = smtc.ErrNoSession
+
+	code, resp := postControlWait(t, srv, "next", "wait=true&timeout=2000")
+	if code != http.StatusConflict || resp.Success || resp.Code != wsproto.CodeNoSession || resp.Info != nil {
+		t.Fatalf("got %d %+v, want failure without state", code, resp)
+	}
+}
+
+func TestHandleWebSocket_ControlWaitAck(t *testing.T) {
+	srv, _, _ := newTestServer(t)
+	srv.handleProgressEvent(domain.ProgressData{Position: 5, Duration: 60, Status: smtc.StatusPaused})
+	httpSrv := startWSTestServer(t, srv)
+	conn, handler := connectWSClient(t, httpSrv.URL)
+	_ = mustReadEnvelope(t, handler.msgs) // hello
+	_ = mustReadEnvelope(t, handler.msgs) // progress
+
+	control := wsproto.Envelope{Type: wsproto.MsgControl, V: wsproto.ProtocolVersion, ID: "wait-1"}
+	control.Data, _ = json.Marshal(wsproto.ControlPayload{Action: "play", Wait: true, Timeout: 2000})
+	msg, _ := json.Marshal(control)
+	if err := conn.WriteMessage(gws.OpcodeText, msg); err != nil {
+		t.Fatalf("write control: %v", err)
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	srv.handleProgressEvent(domain.ProgressData{Position: 5, Duration: 60, Status: smtc.StatusPlaying})
+
+	for {
+		env := mustReadEnvelope(t, handler.msgs)
+		if env.Type != wsproto.MsgAck {
+			continue
+		}
+		var ack wsproto.AckPayload
+		if err := json.Unmarshal(env.Data, &ack); err != nil {
+			t.Fatalf("decode ack: %v", err)
+		}
+		if env.ID != "wait-1" || !ack.Success || ack.TimedOut {
+			t.Fatalf("ack = %s %+v", env.ID, ack)
+		}
+		if ack.Progress == nil || ack.Progress.Status != smtc.StatusPlaying {
+			t.Fatalf("ack progress = %+v, want status playing", ack.Progress)
+		}
+		return
+	}
+}
+
+func TestWaitForState_ContextCanceled(t *testing.T) {
+	srv, _, _ := newTestServer(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, ok := srv.waitForState(ctx, time.Minute, func(*stateSnapshot) bool { return false })
+	if ok {
+		t.Fatal("waitForState reported success after cancel")
+	}
+}
+
+func TestHandleControl_WaitForSeekTarget(t *testing.T) {
+	srv, _, _ := newTestServer(t)
+	srv.handleProgressEvent(domain.ProgressData{Position: 5, Duration: 300, Status: smtc.StatusPaused})
+
+	go func() {
+		time.Sleep(30 * time.Millisecond)
+		// An unrelated update must not end the wait.
+		srv.handleProgressEvent(domain.ProgressData{Position: 6, Duration: 300, Status: smtc.StatusPaused})
+		time.Sleep(30 * time.Millisecond)
+		srv.handleProgressEvent(domain.ProgressData{Position: 120, Duration: 300, Status: smtc.StatusPaused})
+	}()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/control/seek?wait=true&timeout=2000", strings.NewReader(`{"position":120000}`))
+	req.RemoteAddr = "127.0.0.1:1234"
+	req.SetPathValue("action", "seek")
+	w := httptest.NewRecorder()
+	localhostOnly(srv.handleControl, false)(w, req)
+	var resp waitResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if !resp.Success || resp.TimedOut || resp.Progress == nil || resp.Progress.Position != 120 {
+		t.Fatalf("got %+v, want success at position 120", resp)
+	}
+}
+
+func TestControlExpectation_ComparesRequestedValue(t *testing.T) {
+	on, off := true, false
+	prev := &stateSnapshot{progress: &domain.ProgressData{Position: 5, PlaybackRate: 1, IsShuffleActive: &off}}
+	tests := []struct {
+		action string
+		goal   controlGoal
+		state  domain.ProgressData
+		want   bool
+	}{
+		{"shuffle", controlGoal{shuffle: true}, domain.ProgressData{Position: 6, PlaybackRate: 1, IsShuffleActive: &off}, false},
+		{"shuffle", controlGoal{shuffle: true}, domain.ProgressData{Position: 6, PlaybackRate: 1, IsShuffleActive: &on}, true},
+		{"repeat", controlGoal{repeat: 2}, domain.ProgressData{Position: 6, PlaybackRate: 1, AutoRepeatMode: 1}, false},
+		{"repeat", controlGoal{repeat: 2}, domain.ProgressData{Position: 6, PlaybackRate: 1, AutoRepeatMode: 2}, true},
+		{"rate", controlGoal{rate: 1.5}, domain.ProgressData{Position: 6, PlaybackRate: 1}, false},
+		{"rate", controlGoal{rate: 1.5}, domain.ProgressData{Position: 6, PlaybackRate: 1.5}, true},
+		{"rate", controlGoal{rate: 1.1}, domain.ProgressData{Position: 6, PlaybackRate: 1.0999999}, true},
+		{"seek", controlGoal{positionMs: 60000}, domain.ProgressData{Position: 6}, false},
+		{"seek", controlGoal{positionMs: 60000}, domain.ProgressData{Position: 61}, true},
+	}
+	for _, tt := range tests {
+		done := controlExpectation(tt.action, prev, tt.goal)
+		if got := done(&stateSnapshot{progress: &tt.state}); got != tt.want {
+			t.Errorf("%s %+v with %+v = %v, want %v", tt.action, tt.goal, tt.state, got, tt.want)
+		}
+	}
+}
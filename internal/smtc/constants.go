@@ -7,12 +7,18 @@ import "time"
 const (
 	// progressTickInterval is the period between progress timeline reads.
 	progressTickInterval = 200 * time.Millisecond
+	// sessionStatusPollInterval is the period between playback status reads
+	// of all sessions, used to fire SessionStatusEvent.
+	sessionStatusPollInterval = 500 * time.Millisecond
 	// thumbnailRetryDelay is the wait before retrying thumbnail reads on song change.
 	thumbnailRetryDelay = 50 * time.Millisecond
 	// thumbnailRetryMaxAttempts caps how many times readThumbnail is retried
 	// per song change before the InfoEvent is fired with the current (possibly
 	// empty) thumbnail state. Total retry window: thumbnailRetryDelay * thumbnailRetryMaxAttempts.
 	thumbnailRetryMaxAttempts = 10
+	// maxThumbnailStreamSize is the largest thumbnail stream read at all,
+	// whatever Options.ThumbnailLimits allows after downscaling.
+	maxThumbnailStreamSize = 64 << 20
 	// cmdChanCapacity is the size of the internal command channel.
 	cmdChanCapacity = 32
 )
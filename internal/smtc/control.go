@@ -3,13 +3,15 @@
 package smtc
 
 import (
-	"errors"
 	"fmt"
 
 	"github.com/go-ole/go-ole"
 	winrt "github.com/saltosystems/winrt-go"
 	"github.com/saltosystems/winrt-go/windows/foundation"
 	"github.com/saltosystems/winrt-go/windows/media"
+	"github.com/saltosystems/winrt-go/windows/media/control"
+
+	"smtc-now-playing/internal/domain"
 )
 
 // iidBoolAsyncCompletedHandler is the parameterized IID for
@@ -37,8 +39,31 @@ const (
 	ControlSeek
 	ControlShuffle
 	ControlRepeat
+	ControlRate
 )
 
+// controlActionNames names the actions in ControlError, matching the server's
+// control action names.
+var controlActionNames = [...]string{
+	ControlPlay:            "play",
+	ControlPause:           "pause",
+	ControlStop:            "stop",
+	ControlTogglePlayPause: "toggle",
+	ControlSkipNext:        "next",
+	ControlSkipPrevious:    "previous",
+	ControlSeek:            "seek",
+	ControlShuffle:         "shuffle",
+	ControlRepeat:          "repeat",
+	ControlRate:            "rate",
+}
+
+func (a ControlAction) String() string {
+	if a >= 0 && int(a) < len(controlActionNames) {
+		return controlActionNames[a]
+	}
+	return fmt.Sprintf("ControlAction(%d)", int(a))
+}
+
 // controlCommand is sent through cmdChan to execute a media control action
 // on the SMTC goroutine. ResultChan receives the outcome once the WinRT call completes.
 type controlCommand struct {
@@ -46,12 +71,11 @@ type controlCommand struct {
 	seekPosition  int64      // ControlSeek: position in milliseconds
 	shuffleActive bool       // ControlShuffle: desired shuffle state
 	repeatMode    int        // ControlRepeat: 0=None, 1=Track, 2=List
+	playbackRate  float64    // ControlRate: requested playback rate (1.0 = normal)
+	appID         string     // target session; empty means the displayed session
 	resultChan    chan error // receives nil on success or an error
 }
 
-// ErrNoSession is returned when a control command is issued but no SMTC session is active.
-var ErrNoSession = errors.New("smtc: no active session")
-
 // Play sends a play request to the current SMTC session.
 // Blocks until the WinRT async call completes.
 func (s *Smtc) Play() error {
@@ -109,6 +133,98 @@ func (s *Smtc) SetRepeat(mode int) error {
 	return s.sendControl(controlCommand{action: ControlRepeat, repeatMode: mode})
 }
 
+// SetPlaybackRate requests a playback rate change on the current SMTC session.
+// rate is a multiplier of normal speed (1.0 = normal, 1.5 = 50% faster).
+// Blocks until the WinRT async call completes.
+func (s *Smtc) SetPlaybackRate(rate float64) error {
+	return s.sendControl(controlCommand{action: ControlRate, playbackRate: rate})
+}
+
+// sessionController sends control commands to one session by appID.
+type sessionController struct {
+	s     *Smtc
+	appID string
+}
+
+// Session returns a Controller whose commands act on the session identified by
+// appID, leaving the displayed session unchanged. Commands fail with
+// ErrSessionNotFound if no such session exists when they execute.
+func (s *Smtc) Session(appID string) Controller {
+	return sessionController{s: s, appID: appID}
+}
+
+func (c sessionController) send(cmd controlCommand) error {
+	cmd.appID = c.appID
+	return c.s.sendControl(cmd)
+}
+
+func (c sessionController) Play() error  { return c.send(controlCommand{action: ControlPlay}) }
+func (c sessionController) Pause() error { return c.send(controlCommand{action: ControlPause}) }
+func (c sessionController) StopPlayback() error {
+	return c.send(controlCommand{action: ControlStop})
+}
+func (c sessionController) TogglePlayPause() error {
+	return c.send(controlCommand{action: ControlTogglePlayPause})
+}
+func (c sessionController) SkipNext() error { return c.send(controlCommand{action: ControlSkipNext}) }
+func (c sessionController) SkipPrevious() error {
+	return c.send(controlCommand{action: ControlSkipPrevious})
+}
+func (c sessionController) SeekTo(positionMs int64) error {
+	return c.send(controlCommand{action: ControlSeek, seekPosition: positionMs})
+}
+func (c sessionController) SetShuffle(active bool) error {
+	return c.send(controlCommand{action: ControlShuffle, shuffleActive: active})
+}
+func (c sessionController) SetRepeat(mode int) error {
+	return c.send(controlCommand{action: ControlRepeat, repeatMode: mode})
+}
+func (c sessionController) SetPlaybackRate(rate float64) error {
+	return c.send(controlCommand{action: ControlRate, playbackRate: rate})
+}
+
+// SessionProgress reads the timeline of the session identified by appID.
+// Blocks briefly while routing through cmdChan for thread safety.
+func (s *Smtc) SessionProgress(appID string) (domain.ProgressData, error) {
+	type result struct {
+		data domain.ProgressData
+		err  error
+	}
+	resultChan := make(chan result, 1)
+	select {
+	case s.cmdChan <- func() {
+		sess := s.findSession(appID)
+		if sess == nil {
+			resultChan <- result{err: ErrSessionNotFound}
+			return
+		}
+		data, ok := readSessionProgress(sess)
+		if !ok {
+			resultChan <- result{err: fmt.Errorf("smtc: timeline unavailable for %q", appID)}
+			return
+		}
+		resultChan <- result{data: data}
+	}:
+	default:
+		return domain.ProgressData{}, ErrBusy
+	}
+	r := <-resultChan
+	return r.data, r.err
+}
+
+// findSession returns the session object for appID, or nil if none matches.
+// Must only be called from within the cmdChan event loop.
+func (s *Smtc) findSession(appID string) *control.GlobalSystemMediaTransportControlsSession {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, sess := range s.sessions {
+		if sess.AppID == appID && i < len(s.sessionObjects) {
+			return s.sessionObjects[i]
+		}
+	}
+	return nil
+}
+
 // GetCapabilities returns which controls are currently enabled for the active session.
 // Blocks briefly while routing through cmdChan for thread safety.
 // Returns a zero-value ControlCapabilities when no session is active.
@@ -130,7 +246,7 @@ func (s *Smtc) sendControl(cmd controlCommand) error {
 	select {
 	case s.cmdChan <- func() { s.executeControl(cmd) }:
 	default:
-		return fmt.Errorf("smtc: command channel full")
+		return ErrBusy
 	}
 	return <-cmd.resultChan
 }
@@ -138,7 +254,14 @@ func (s *Smtc) sendControl(cmd controlCommand) error {
 // executeControl performs the WinRT control call on the smtc goroutine.
 // Must only be called from within the cmdChan event loop.
 func (s *Smtc) executeControl(cmd controlCommand) {
-	if s.currentSession == nil {
+	session := s.currentSession
+	if cmd.appID != "" {
+		if session = s.findSession(cmd.appID); session == nil {
+			cmd.resultChan <- ErrSessionNotFound
+			return
+		}
+	}
+	if session == nil {
 		cmd.resultChan <- ErrNoSession
 		return
 	}
@@ -150,32 +273,34 @@ func (s *Smtc) executeControl(cmd controlCommand) {
 
 	switch cmd.action {
 	case ControlPlay:
-		op, err = s.currentSession.TryPlayAsync()
+		op, err = session.TryPlayAsync()
 	case ControlPause:
-		op, err = s.currentSession.TryPauseAsync()
+		op, err = session.TryPauseAsync()
 	case ControlStop:
-		op, err = s.currentSession.TryStopAsync()
+		op, err = session.TryStopAsync()
 	case ControlTogglePlayPause:
-		op, err = s.currentSession.TryTogglePlayPauseAsync()
+		op, err = session.TryTogglePlayPauseAsync()
 	case ControlSkipNext:
-		op, err = s.currentSession.TrySkipNextAsync()
+		op, err = session.TrySkipNextAsync()
 	case ControlSkipPrevious:
-		op, err = s.currentSession.TrySkipPreviousAsync()
+		op, err = session.TrySkipPreviousAsync()
 	case ControlSeek:
 		// WinRT uses 100-nanosecond ticks; convert ms → ticks.
 		ticks := cmd.seekPosition * 10000
-		op, err = s.currentSession.TryChangePlaybackPositionAsync(ticks)
+		op, err = session.TryChangePlaybackPositionAsync(ticks)
 	case ControlShuffle:
-		op, err = s.currentSession.TryChangeShuffleActiveAsync(cmd.shuffleActive)
+		op, err = session.TryChangeShuffleActiveAsync(cmd.shuffleActive)
 	case ControlRepeat:
-		op, err = s.currentSession.TryChangeAutoRepeatModeAsync(media.MediaPlaybackAutoRepeatMode(cmd.repeatMode))
+		op, err = session.TryChangeAutoRepeatModeAsync(media.MediaPlaybackAutoRepeatMode(cmd.repeatMode))
+	case ControlRate:
+		op, err = session.TryChangePlaybackRateAsync(cmd.playbackRate)
 	default:
 		cmd.resultChan <- fmt.Errorf("smtc: unknown control action %d", cmd.action)
 		return
 	}
 
 	if err != nil {
-		cmd.resultChan <- err
+		cmd.resultChan <- &ControlError{Action: cmd.action.String(), Err: err}
 		return
 	}
 
@@ -183,13 +308,30 @@ func (s *Smtc) executeControl(cmd controlCommand) {
 	// Status == AsyncStatusCompleted means the request was accepted by the session.
 	_, status := waitForAsync(op, iidBoolAsyncCompletedHandler)
 	if status != foundation.AsyncStatusCompleted {
-		cmd.resultChan <- fmt.Errorf("smtc: control async failed: status %d", status)
+		cmd.resultChan <- &ControlError{
+			Action:   cmd.action.String(),
+			Status:   int(status),
+			TimedOut: status == foundation.AsyncStatusStarted,
+		}
 		return
 	}
 
 	cmd.resultChan <- nil
 }
 
+// publishCapabilities reads the current session's controls and fires
+// CapabilitiesChangedEvent when they differ from the last published set, or
+// unconditionally when force is true (used on session switches).
+// Must only be called from within the cmdChan event loop.
+func (s *Smtc) publishCapabilities(force bool) {
+	caps := s.readCapabilities()
+	if !force && caps == s.currentCaps {
+		return
+	}
+	s.currentCaps = caps
+	s.fanOut(CapabilitiesChangedEvent{Caps: caps})
+}
+
 // readCapabilities reads playback controls from the current session synchronously.
 // Must only be called from within the cmdChan event loop.
 func (s *Smtc) readCapabilities() ControlCapabilities {
@@ -216,5 +358,6 @@ func (s *Smtc) readCapabilities() ControlCapabilities {
 	caps.IsSeekEnabled, _ = controls.GetIsPlaybackPositionEnabled()
 	caps.IsShuffleEnabled, _ = controls.GetIsShuffleEnabled()
 	caps.IsRepeatEnabled, _ = controls.GetIsRepeatEnabled()
+	caps.IsPlaybackRateEnabled, _ = controls.GetIsPlaybackRateEnabled()
 	return caps
 }
@@ -36,24 +36,28 @@ func TestControlCapabilities_ZeroValue(t *testing.T) {
 	if caps.IsRepeatEnabled {
 		t.Error("IsRepeatEnabled should default to false")
 	}
+	if caps.IsPlaybackRateEnabled {
+		t.Error("IsPlaybackRateEnabled should default to false")
+	}
 }
 
 // TestControlCapabilities_AllFields verifies all ControlCapabilities fields
 // can be set independently — confirming the struct has the expected shape.
 func TestControlCapabilities_AllFields(t *testing.T) {
 	caps := ControlCapabilities{
-		IsPlayEnabled:     true,
-		IsPauseEnabled:    true,
-		IsStopEnabled:     true,
-		IsNextEnabled:     true,
-		IsPreviousEnabled: true,
-		IsSeekEnabled:     true,
-		IsShuffleEnabled:  true,
-		IsRepeatEnabled:   true,
+		IsPlayEnabled:         true,
+		IsPauseEnabled:        true,
+		IsStopEnabled:         true,
+		IsNextEnabled:         true,
+		IsPreviousEnabled:     true,
+		IsSeekEnabled:         true,
+		IsShuffleEnabled:      true,
+		IsRepeatEnabled:       true,
+		IsPlaybackRateEnabled: true,
 	}
 	if !caps.IsPlayEnabled || !caps.IsPauseEnabled || !caps.IsStopEnabled ||
 		!caps.IsNextEnabled || !caps.IsPreviousEnabled || !caps.IsSeekEnabled ||
-		!caps.IsShuffleEnabled || !caps.IsRepeatEnabled {
+		!caps.IsShuffleEnabled || !caps.IsRepeatEnabled || !caps.IsPlaybackRateEnabled {
 		t.Error("all ControlCapabilities fields should be settable to true")
 	}
 }
@@ -108,6 +112,17 @@ func TestSeek_NoSession(t *testing.T) {
 	}
 }
 
+// TestSetPlaybackRate_NoSession verifies that SetPlaybackRate() returns ErrNoSession when no session is active.
+func TestSetPlaybackRate_NoSession(t *testing.T) {
+	s := New(Options{})
+	go func() { fn := <-s.cmdChan; fn() }()
+
+	err := s.SetPlaybackRate(1.5)
+	if !errors.Is(err, ErrNoSession) {
+		t.Errorf("SetPlaybackRate() with no session: got %v, want ErrNoSession", err)
+	}
+}
+
 // TestGetCapabilities_NoSession verifies that GetCapabilities() returns
 // zero-value when no session is active — exercising the cmdChan round-trip.
 func TestGetCapabilities_NoSession(t *testing.T) {
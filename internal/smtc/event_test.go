@@ -147,7 +147,45 @@ func compareEvents(t *testing.T, got Event, want Event) {
 		if gotTyped != wantTyped {
 			t.Fatalf("got %#v, want %#v", gotTyped, wantTyped)
 		}
+	case CapabilitiesChangedEvent:
+		gotTyped, ok := got.(CapabilitiesChangedEvent)
+		if !ok {
+			t.Fatalf("got %T, want %T", got, want)
+		}
+		if gotTyped != wantTyped {
+			t.Fatalf("got %#v, want %#v", gotTyped, wantTyped)
+		}
 	default:
 		t.Fatalf("unsupported event type %T", want)
 	}
 }
+
+func TestPollSessionStatuses_ReportsRemovedSessionClosed(t *testing.T) {
+	s := New(Options{})
+	ch := s.Subscribe(1)
+	t.Cleanup(func() { s.Unsubscribe(ch) })
+
+	s.sessionStatuses["Spotify.exe"] = StatusPlaying
+
+	s.pollSessionStatuses()
+	assertEventReceived(t, ch, SessionStatusEvent{AppID: "Spotify.exe", Status: StatusClosed})
+
+	s.pollSessionStatuses()
+	assertNoEvent(t, ch)
+}
+
+func TestApplySessionList_LastSessionClosedClearsDevice(t *testing.T) {
+	s := New(Options{})
+	ch := s.Subscribe(8)
+	t.Cleanup(func() { s.Unsubscribe(ch) })
+
+	s.currentCaps = ControlCapabilities{IsPlayEnabled: true}
+	s.applySessionList(nil, nil)
+
+	assertEventReceived(t, ch, SessionsChangedEvent{})
+	assertEventReceived(t, ch, InfoEvent{Data: domain.InfoData{}})
+	assertEventReceived(t, ch, ProgressEvent{Data: domain.ProgressData{Status: StatusClosed}})
+	assertEventReceived(t, ch, DeviceChangedEvent{AppID: ""})
+	assertEventReceived(t, ch, CapabilitiesChangedEvent{})
+	assertNoEvent(t, ch)
+}
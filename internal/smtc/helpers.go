@@ -9,6 +9,7 @@ import (
 
 	"github.com/go-ole/go-ole"
 	"github.com/saltosystems/winrt-go/windows/foundation"
+	"github.com/saltosystems/winrt-go/windows/foundation/collections"
 )
 
 var (
@@ -79,9 +80,10 @@ func asyncOperationStatus(op *foundation.IAsyncOperation) foundation.AsyncStatus
 // Returns the raw result pointer (caller must cast) and the final AsyncStatus.
 // Replicates WaitForAsyncOperation<T> from c/smtc.cpp:96-121.
 //
-// If SetCompleted() fails or the wait times out, the async operation is
-// considered failed and we return (nil, AsyncStatusError) rather than
-// blocking the dedicated SMTC goroutine indefinitely.
+// If SetCompleted() fails, the async operation is considered failed and we
+// return (nil, AsyncStatusError); if the wait times out we return
+// (nil, AsyncStatusStarted). Either way the dedicated SMTC goroutine is not
+// blocked indefinitely.
 func waitForAsync(op *foundation.IAsyncOperation, handlerIID *ole.GUID) (unsafe.Pointer, foundation.AsyncStatus) {
 	if asyncOperationStatus(op) != foundation.AsyncStatusCompleted {
 		hEvent := createEvent()
@@ -108,8 +110,10 @@ func waitForAsync(op *foundation.IAsyncOperation, handlerIID *ole.GUID) (unsafe.
 		closeHandle(hEvent)
 		handler.Release()
 		if !signaled {
+			// The operation is still running; report it as such so callers
+			// can tell a timeout from a failure.
 			log.Warn("waitForAsync: timed out waiting for completion")
-			return nil, foundation.AsyncStatusError
+			return nil, foundation.AsyncStatusStarted
 		}
 	}
 	status := asyncOperationStatus(op)
@@ -171,6 +175,31 @@ func readNullableInt32(ref *foundation.IReference) (int32, bool) {
 	return val, true
 }
 
+// readStringVector copies the elements of a WinRT IVectorView<String> into a Go
+// slice. Returns nil if view is nil, empty, or cannot be read. Elements that
+// fail to read are skipped.
+func readStringVector(view *collections.IVectorView) []string {
+	if view == nil {
+		return nil
+	}
+	size, err := view.GetSize()
+	if err != nil || size == 0 {
+		return nil
+	}
+	out := make([]string, 0, size)
+	for i := uint32(0); i < size; i++ {
+		ptr, err := view.GetAt(i)
+		if err != nil {
+			continue
+		}
+		// IVectorView<String>.GetAt() stores the HSTRING handle in the pointer itself.
+		hstr := ole.HString(uintptr(ptr))
+		out = append(out, hstr.String())
+		ole.DeleteHString(hstr)
+	}
+	return out
+}
+
 // friendlyAppName extracts a user-friendly application name from an appUserModelId.
 // For UWP apps (format: "PackageFamilyName!AppId"), extracts the part after the last "!".
 // For Win32 apps (format: "app.exe"), strips the ".exe" suffix (case-insensitive).
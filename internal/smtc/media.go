@@ -37,19 +37,17 @@ func (s *Smtc) handleMediaPropertiesChanged() {
 	artist, _ := props.GetArtist()
 	title, _ := props.GetTitle()
 
-	escapedArtist := escape(artist)
-	escapedTitle := escape(title)
-
 	// Store properties for thumbnail access.
 	s.currentProperties = props
 
 	// Only fire callback if artist, title, or thumbnail actually changed.
-	artistChanged := escapedArtist != s.currentArtist || escapedTitle != s.currentTitle
+	artistChanged := artist != s.currentArtist || title != s.currentTitle
 	// Reset dedup state when song changes so readThumbnail always does a fresh read.
 	if artistChanged {
 		s.currentThumbnailSize = 0
 		s.currentThumbnailData = nil
 		s.currentThumbnailContentType = ""
+		s.currentThumbnailOriginal = 0
 	}
 	// Snapshot BEFORE readThumbnail() mutates s.currentThumbnailData.
 	oldThumbLen := len(s.currentThumbnailData)
@@ -76,10 +74,10 @@ func (s *Smtc) handleMediaPropertiesChanged() {
 	// to allow SMTC time to write the thumbnail. This prevents the cover art from
 	// briefly disappearing when the track changes.
 	if artistChanged && thumbData == nil {
-		s.currentArtist = escapedArtist
-		s.currentTitle = escapedTitle
+		s.currentArtist = artist
+		s.currentTitle = title
 		s.thumbnailRetryCount = 0
-		s.scheduleThumbnailRetry(escapedArtist, escapedTitle, props)
+		s.scheduleThumbnailRetry(artist, title, props)
 		return
 	}
 
@@ -88,24 +86,48 @@ func (s *Smtc) handleMediaPropertiesChanged() {
 	if !artistChanged && !thumbChanged {
 		return
 	}
-	s.currentArtist = escapedArtist
-	s.currentTitle = escapedTitle
+	s.currentArtist = artist
+	s.currentTitle = title
+
+	// Extract album info, playback type and extended metadata just before firing the event.
+	s.fanOut(InfoEvent{Data: s.buildInfoData(s.currentArtist, s.currentTitle, contentType, thumbData, props)})
+}
 
-	// Extract album info and playback type just before firing the event.
+// buildInfoData assembles an InfoEvent payload for the given artist/title and
+// thumbnail, reading the album, playback type and extended track metadata
+// (subtitle, genres, track number, album track count) from props. Strings are
+// passed through raw; any normalization or escaping is up to the consumer.
+func (s *Smtc) buildInfoData(artist, title, contentType string, thumbData []byte, props *control.GlobalSystemMediaTransportControlsSessionMediaProperties) domain.InfoData {
 	albumTitle, _ := props.GetAlbumTitle()
 	albumArtist, _ := props.GetAlbumArtist()
 	playbackTypeRef, _ := props.GetPlaybackType()
 	playbackType, _ := readNullableInt32(playbackTypeRef)
-	s.fanOut(InfoEvent{Data: domain.InfoData{
-		Artist:               s.currentArtist,
-		Title:                s.currentTitle,
+	subtitle, _ := props.GetSubtitle()
+	trackNumber, _ := props.GetTrackNumber()
+	albumTrackCount, _ := props.GetAlbumTrackCount()
+	genresView, _ := props.GetGenres()
+	var thumbSource string
+	var thumbOriginal int
+	if thumbData != nil {
+		thumbSource = domain.ArtSourcePlayer
+		thumbOriginal = s.currentThumbnailOriginal
+	}
+	return domain.InfoData{
+		Artist:               artist,
+		Title:                title,
 		ThumbnailContentType: contentType,
 		ThumbnailData:        thumbData,
-		AlbumTitle:           domain.Escape(albumTitle),
-		AlbumArtist:          domain.Escape(albumArtist),
+		ThumbnailSource:      thumbSource,
+		ThumbnailOriginal:    thumbOriginal,
+		AlbumTitle:           albumTitle,
+		AlbumArtist:          albumArtist,
 		PlaybackType:         int(playbackType),
 		SourceApp:            s.selectedAppID,
-	}})
+		Subtitle:             subtitle,
+		Genres:               readStringVector(genresView),
+		TrackNumber:          int(trackNumber),
+		AlbumTrackCount:      int(albumTrackCount),
+	}
 }
 
 // scheduleThumbnailRetry arms a one-shot timer that retries readThumbnail
@@ -131,8 +153,10 @@ func (s *Smtc) scheduleThumbnailRetry(artist, title string, props *control.Globa
 // retryThumbnailAndFireInfo is called ~50ms after a song change when the initial
 // readThumbnail returned nil. By this time SMTC has usually written the thumbnail.
 // Fires OnInfo regardless of whether a thumbnail is available, so the client
-// always receives the new track info (with or without cover art).
-// Must be called from the smtc goroutine (via cmdChan).
+// always receives the new track info (with or without cover art). When the
+// retries run out without a thumbnail, Options.FallbackArt may supply one
+// later; see resolveFallbackArt. Must be called from the smtc goroutine (via
+// cmdChan).
 func (s *Smtc) retryThumbnailAndFireInfo(artist, title string, props *control.GlobalSystemMediaTransportControlsSessionMediaProperties) {
 	s.timerMu.Lock()
 	s.thumbnailRetryTimer = nil
@@ -147,20 +171,39 @@ func (s *Smtc) retryThumbnailAndFireInfo(artist, title string, props *control.Gl
 		s.scheduleThumbnailRetry(artist, title, props)
 		return
 	}
-	albumTitle, _ := props.GetAlbumTitle()
-	albumArtist, _ := props.GetAlbumArtist()
-	playbackTypeRef, _ := props.GetPlaybackType()
-	playbackType, _ := readNullableInt32(playbackTypeRef)
-	s.fanOut(InfoEvent{Data: domain.InfoData{
-		Artist:               artist,
-		Title:                title,
-		ThumbnailContentType: contentType,
-		ThumbnailData:        thumbData,
-		AlbumTitle:           domain.Escape(albumTitle),
-		AlbumArtist:          domain.Escape(albumArtist),
-		PlaybackType:         int(playbackType),
-		SourceApp:            s.selectedAppID,
-	}})
+	info := s.buildInfoData(artist, title, contentType, thumbData, props)
+	s.fanOut(InfoEvent{Data: info})
+	if thumbData == nil && s.opts.FallbackArt != nil {
+		s.resolveFallbackArt(info)
+	}
+}
+
+// resolveFallbackArt runs Options.FallbackArt for info on its own goroutine,
+// since it reads files and renders images that would stall progress ticks
+// and controls here. Art it finds is published with info again, unless the
+// track has changed or the player has published art of its own meanwhile.
+func (s *Smtc) resolveFallbackArt(info domain.InfoData) {
+	limits := s.opts.ThumbnailLimits
+	go func() {
+		if !s.opts.FallbackArt(&info) {
+			return
+		}
+		limitFallbackArt(&info, limits)
+		if info.ThumbnailData == nil {
+			return
+		}
+		select {
+		case s.cmdChan <- func() {
+			if s.currentArtist != info.Artist || s.currentTitle != info.Title || s.currentThumbnailData != nil {
+				return
+			}
+			s.fanOut(InfoEvent{Data: info})
+		}:
+		default:
+			s.droppedEvents.Add(1)
+			log.Warn("SMTC event dropped", "type", "FallbackArt", "dropped_total", s.droppedEvents.Load())
+		}
+	}()
 }
 
 // clearMediaInfo clears artist/title/properties state and fires an empty OnInfo callback.
@@ -176,6 +219,7 @@ func (s *Smtc) clearMediaInfo() {
 	s.currentThumbnailSize = 0
 	s.currentThumbnailData = nil
 	s.currentThumbnailContentType = ""
+	s.currentThumbnailOriginal = 0
 	s.fanOut(InfoEvent{Data: domain.InfoData{}})
 }
 
@@ -202,4 +246,7 @@ func (s *Smtc) handlePlaybackInfoChanged() {
 	// didn't (e.g. rate/shuffle/repeat tweaks), the next progress tick will pick
 	// the delta up within 200ms.
 	s.readTimelineAndProgress()
+	// Controls live on PlaybackInfo too, so this is also where players
+	// toggle e.g. "next" mid-session.
+	s.publishCapabilities(false)
 }
@@ -1,13 +1,14 @@
-//go:build smtc_test
-
 package smtc
 
 import (
 	"context"
 	"sync"
+
+	"smtc-now-playing/internal/domain"
 )
 
-// MockProvider implements Provider for testing without real WinRT.
+// MockProvider is an in-memory Provider for tests. It needs no WinRT, so
+// packages using the provider can be tested on any platform.
 type MockProvider struct {
 	mu            sync.Mutex
 	subscribers   map[chan Event]*struct{}
@@ -89,12 +90,21 @@ func (m *MockProvider) SelectDevice(appID string) {
 // GetCapabilities returns an empty capability set for tests.
 func (m *MockProvider) GetCapabilities() ControlCapabilities { return ControlCapabilities{} }
 
-func (m *MockProvider) Play() error                   { return ErrNoSession }
-func (m *MockProvider) Pause() error                  { return ErrNoSession }
-func (m *MockProvider) StopPlayback() error           { return ErrNoSession }
-func (m *MockProvider) TogglePlayPause() error        { return ErrNoSession }
-func (m *MockProvider) SkipNext() error               { return ErrNoSession }
-func (m *MockProvider) SkipPrevious() error           { return ErrNoSession }
-func (m *MockProvider) SeekTo(positionMs int64) error { return ErrNoSession }
-func (m *MockProvider) SetShuffle(active bool) error  { return ErrNoSession }
-func (m *MockProvider) SetRepeat(mode int) error      { return ErrNoSession }
+func (m *MockProvider) Play() error                        { return ErrNoSession }
+func (m *MockProvider) Pause() error                       { return ErrNoSession }
+func (m *MockProvider) StopPlayback() error                { return ErrNoSession }
+func (m *MockProvider) TogglePlayPause() error             { return ErrNoSession }
+func (m *MockProvider) SkipNext() error                    { return ErrNoSession }
+func (m *MockProvider) SkipPrevious() error                { return ErrNoSession }
+func (m *MockProvider) SeekTo(positionMs int64) error      { return ErrNoSession }
+func (m *MockProvider) SetShuffle(active bool) error       { return ErrNoSession }
+func (m *MockProvider) SetRepeat(mode int) error           { return ErrNoSession }
+func (m *MockProvider) SetPlaybackRate(rate float64) error { return ErrNoSession }
+
+// Session returns the mock itself; targeted commands behave like untargeted ones.
+func (m *MockProvider) Session(appID string) Controller { return m }
+
+// SessionProgress reports ErrSessionNotFound for tests.
+func (m *MockProvider) SessionProgress(appID string) (domain.ProgressData, error) {
+	return domain.ProgressData{}, ErrSessionNotFound
+}
@@ -5,6 +5,8 @@ package smtc
 import (
 	"smtc-now-playing/internal/domain"
 	"time"
+
+	"github.com/saltosystems/winrt-go/windows/media/control"
 )
 
 // readTimelineAndProgress reads position/duration/status from the current session
@@ -16,29 +18,65 @@ func (s *Smtc) readTimelineAndProgress() {
 		return
 	}
 
+	data, ok := readSessionProgress(s.currentSession)
+	if !ok {
+		return
+	}
+
+	// Only fire callback if position/duration/status or the shuffle, repeat
+	// or rate settings changed.
+	s.mu.Lock()
+	if data.Position == s.currentPosition && data.Duration == s.currentDuration && data.Status == s.currentStatus &&
+		data.PlaybackRate == s.currentRate && data.AutoRepeatMode == s.currentRepeat && sameShuffle(data.IsShuffleActive, s.currentShuffle) {
+		s.mu.Unlock()
+		return
+	}
+	s.currentPosition = data.Position
+	s.currentDuration = data.Duration
+	s.currentStatus = data.Status
+	s.currentRate = data.PlaybackRate
+	s.currentRepeat = data.AutoRepeatMode
+	s.currentShuffle = data.IsShuffleActive
+	s.mu.Unlock()
+
+	s.fanOut(ProgressEvent{Data: data})
+}
+
+// sameShuffle reports whether two shuffle states, nil when unknown, match.
+func sameShuffle(a, b *bool) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// readSessionProgress reads the timeline and playback info of sess. ok is
+// false when any required property could not be read.
+// Must only be called from the smtc goroutine.
+func readSessionProgress(sess *control.GlobalSystemMediaTransportControlsSession) (data domain.ProgressData, ok bool) {
 	// Get timeline properties
-	timeline, err := s.currentSession.GetTimelineProperties()
+	timeline, err := sess.GetTimelineProperties()
 	if err != nil || timeline == nil {
 		if err != nil {
 			log.Debug("failed to get timeline properties", "err", err)
 		}
-		return
+		return data, false
 	}
 
 	// Get playback info
-	playbackInfo, err := s.currentSession.GetPlaybackInfo()
+	playbackInfo, err := sess.GetPlaybackInfo()
 	if err != nil || playbackInfo == nil {
 		if err != nil {
 			log.Debug("failed to get playback info", "err", err)
 		}
-		return
+		return data, false
 	}
 
 	// Get playback status (WinRT enum: Closed=0, Opened=1, Changing=2, Stopped=3, Playing=4, Paused=5)
 	status, err := playbackInfo.GetPlaybackStatus()
 	if err != nil {
 		log.Debug("failed to get playback status", "err", err)
-		return
+		return data, false
 	}
 	newStatus := int(status)
 
@@ -46,23 +84,27 @@ func (s *Smtc) readTimelineAndProgress() {
 	positionSpan, err := timeline.GetPosition()
 	if err != nil {
 		log.Debug("failed to get timeline position", "err", err)
-		return
+		return data, false
 	}
 
 	// Get lastUpdatedTime (WinRT DateTime.UniversalTime = 100ns ticks since 1601-01-01)
 	lastUpdated, err := timeline.GetLastUpdatedTime()
 	if err != nil {
 		log.Debug("failed to get last updated time", "err", err)
-		return
+		return data, false
 	}
 
 	// Get end time / duration (WinRT TimeSpan.Duration = 100ns ticks)
 	endTimeSpan, err := timeline.GetEndTime()
 	if err != nil {
 		log.Debug("failed to get end time", "err", err)
-		return
+		return data, false
 	}
 
+	// Seek bounds are optional; players that don't report them leave both at 0.
+	minSeekSpan, _ := timeline.GetMinSeekTime()
+	maxSeekSpan, _ := timeline.GetMaxSeekTime()
+
 	// Read playback rate via helper (default 1.0 if unavailable).
 	// Matches C++: playbackRatePtr ? playbackRatePtr.Value() : 1.0
 	newPlaybackRate := 1.0
@@ -95,6 +137,7 @@ func (s *Smtc) readTimelineAndProgress() {
 	}
 
 	var newPosition, newDuration int
+	var newPositionMs int64
 
 	if lastUpdated.UniversalTime == 0 {
 		// Edge case: no valid timestamp — position and duration are unknown.
@@ -106,30 +149,23 @@ func (s *Smtc) readTimelineAndProgress() {
 		// The frontend (functions.js) performs client-side interpolation using
 		// lastUpdatedTime and playbackRate, so adding a server-side delta here
 		// would cause double-interpolation and make the progress bar run too fast.
-		newPosition = int(positionSpan.Duration / 10_000_000)
+		newPositionMs = positionSpan.Duration / 10_000
+		newPosition = int(newPositionMs / 1000)
 		newDuration = int(endTimeSpan.Duration / 10_000_000)
 	}
 
-	// Only fire callback if position/duration/status changed.
-	s.mu.Lock()
-	if newPosition == s.currentPosition && newDuration == s.currentDuration && newStatus == s.currentStatus {
-		s.mu.Unlock()
-		return
-	}
-	s.currentPosition = newPosition
-	s.currentDuration = newDuration
-	s.currentStatus = newStatus
-	s.mu.Unlock()
-
-	s.fanOut(ProgressEvent{Data: domain.ProgressData{
+	return domain.ProgressData{
 		Position:        newPosition,
+		PositionMs:      newPositionMs,
 		Duration:        newDuration,
 		Status:          newStatus,
 		PlaybackRate:    newPlaybackRate,
 		IsShuffleActive: newIsShuffleActive,
 		AutoRepeatMode:  newAutoRepeatMode,
 		LastUpdatedTime: newLastUpdatedMs,
-	}})
+		MinSeekTime:     int(minSeekSpan.Duration / 10_000_000),
+		MaxSeekTime:     int(maxSeekSpan.Duration / 10_000_000),
+	}, true
 }
 
 // startProgressTimer starts a 200ms ticker that calls readTimelineAndProgress on each tick.
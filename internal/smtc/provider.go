@@ -1,6 +1,65 @@
 package smtc
 
-import "context"
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"smtc-now-playing/internal/domain"
+)
+
+// Sentinel errors for control calls.
+var (
+	// ErrNoSession is returned when a control command is issued but no SMTC
+	// session is active.
+	ErrNoSession = errors.New("smtc: no active session")
+	// ErrSessionNotFound is returned when a session-targeted call names an
+	// appID that is not among the current SMTC sessions.
+	ErrSessionNotFound = errors.New("smtc: session not found")
+	// ErrBusy is returned when the SMTC goroutine's command queue is full.
+	ErrBusy = errors.New("smtc: command channel full")
+)
+
+// ControlError reports a control call that the player rejected or that
+// failed inside WinRT.
+type ControlError struct {
+	// Action names the control, e.g. "seek".
+	Action string
+	// Status is the WinRT AsyncStatus the operation ended with, or 0 when
+	// the call failed before an operation was started.
+	Status int
+	// TimedOut is set when the operation did not complete in time.
+	TimedOut bool
+	// Err is the underlying WinRT error, if any.
+	Err error
+}
+
+func (e *ControlError) Error() string {
+	switch {
+	case e.Err != nil:
+		return fmt.Sprintf("smtc: %s failed: %v", e.Action, e.Err)
+	case e.TimedOut:
+		return fmt.Sprintf("smtc: %s timed out", e.Action)
+	}
+	return fmt.Sprintf("smtc: %s failed: status %d", e.Action, e.Status)
+}
+
+func (e *ControlError) Unwrap() error { return e.Err }
+
+// Controller is the set of media control calls. *Smtc implements it for the
+// displayed session; Provider.Session returns one bound to a specific session.
+type Controller interface {
+	Play() error
+	Pause() error
+	StopPlayback() error
+	TogglePlayPause() error
+	SkipNext() error
+	SkipPrevious() error
+	SeekTo(positionMs int64) error
+	SetShuffle(active bool) error
+	SetRepeat(mode int) error
+	SetPlaybackRate(rate float64) error
+}
 
 // Provider abstracts the SMTC integration for testing.
 // The real implementation is *Smtc; tests use MockProvider.
@@ -17,14 +76,11 @@ type Provider interface {
 	SelectDevice(appID string)
 	// GetCapabilities returns which controls the current session supports.
 	GetCapabilities() ControlCapabilities
-	// Control methods.
-	Play() error
-	Pause() error
-	StopPlayback() error
-	TogglePlayPause() error
-	SkipNext() error
-	SkipPrevious() error
-	SeekTo(positionMs int64) error
-	SetShuffle(active bool) error
-	SetRepeat(mode int) error
+	// Control methods act on the displayed session.
+	Controller
+	// Session returns a Controller acting on the session identified by appID
+	// without changing the displayed one.
+	Session(appID string) Controller
+	// SessionProgress reads the current timeline of the session identified by appID.
+	SessionProgress(appID string) (domain.ProgressData, error)
 }
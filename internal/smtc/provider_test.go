@@ -0,0 +1,28 @@
+package smtc
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestControlError(t *testing.T) {
+	cause := errors.New("E_ACCESSDENIED")
+	tests := []struct {
+		err  *ControlError
+		want string
+	}{
+		{&ControlError{Action: "seek", Err: cause}, "smtc: seek failed: E_ACCESSDENIED"},
+		{&ControlError{Action: "next", Status: 3}, "smtc: next failed: status 3"},
+		{&ControlError{Action: "play", TimedOut: true}, "smtc: play timed out"},
+	}
+	for _, tt := range tests {
+		if got := tt.err.Error(); got != tt.want {
+			t.Errorf("Error() = %q, want %q", got, tt.want)
+		}
+	}
+
+	var ce *ControlError
+	if err := error(tests[0].err); !errors.As(err, &ce) || !errors.Is(err, cause) {
+		t.Errorf("ControlError does not unwrap to its cause")
+	}
+}
@@ -201,6 +201,10 @@ func (s *Smtc) applySessionList(sessions []SessionInfo, objects []*control.Globa
 		s.mu.Unlock()
 		s.fanOut(InfoEvent{Data: infoDataToDomain(InfoData{})})
 		s.fanOut(ProgressEvent{Data: progressDataToDomain(ProgressData{Status: StatusClosed})})
+		// The closed app's ID would otherwise stay active, and its cleared
+		// capabilities would refuse every control instead of ErrNoSession.
+		s.fanOut(DeviceChangedEvent{AppID: ""})
+		s.publishCapabilities(false)
 		return
 	}
 
@@ -225,7 +229,8 @@ func (s *Smtc) selectDevice(appID string) {
 
 // switchToSession switches SMTC monitoring to the session at the given index.
 // Unsubscribes old property events, subscribes new ones, reads initial media properties,
-// and fires DeviceChangedEvent. Must be called from the smtc goroutine.
+// fires DeviceChangedEvent and then publishes the capabilities, so subscribers judge them
+// against the new session. Must be called from the smtc goroutine.
 func (s *Smtc) switchToSession(index int) {
 	if s.currentSession != nil {
 		s.unsubscribePropertyEvents()
@@ -249,6 +254,7 @@ func (s *Smtc) switchToSession(index int) {
 		log.Info("SMTC session changed", "app", appID)
 		s.fanOut(DeviceChangedEvent{AppID: appID})
 	}
+	s.publishCapabilities(true)
 }
 
 // subscribePropertyEvents subscribes MediaPropertiesChanged and PlaybackInfoChanged events
@@ -298,3 +304,53 @@ func (s *Smtc) unsubscribePropertyEvents() {
 	_ = s.currentSession.RemovePlaybackInfoChanged(s.playbackInfoChangedToken)
 	s.playbackInfoChangedToken = foundation.EventRegistrationToken{}
 }
+
+// pollSessionStatuses reads the playback status of every session and fires
+// SessionStatusEvent for each one that changed since the last poll. Sessions
+// that went away are reported as StatusClosed. When several sessions share an
+// AppID only the first is tracked, matching how controls resolve AppIDs.
+// Must only be called from the smtc goroutine.
+func (s *Smtc) pollSessionStatuses() {
+	s.mu.Lock()
+	sessions := s.sessions
+	objects := s.sessionObjects
+	s.mu.Unlock()
+
+	seen := make(map[string]bool, len(sessions))
+	for i, info := range sessions {
+		if seen[info.AppID] || i >= len(objects) || objects[i] == nil {
+			continue
+		}
+		seen[info.AppID] = true
+		status, ok := readPlaybackStatus(objects[i])
+		if !ok {
+			continue
+		}
+		if prev, known := s.sessionStatuses[info.AppID]; known && prev == status {
+			continue
+		}
+		s.sessionStatuses[info.AppID] = status
+		s.fanOut(SessionStatusEvent{AppID: info.AppID, Status: status})
+	}
+
+	for appID := range s.sessionStatuses {
+		if !seen[appID] {
+			delete(s.sessionStatuses, appID)
+			s.fanOut(SessionStatusEvent{AppID: appID, Status: StatusClosed})
+		}
+	}
+}
+
+// readPlaybackStatus returns the playback status of sess. ok is false when it
+// could not be read.
+func readPlaybackStatus(sess *control.GlobalSystemMediaTransportControlsSession) (int, bool) {
+	playbackInfo, err := sess.GetPlaybackInfo()
+	if err != nil || playbackInfo == nil {
+		return 0, false
+	}
+	status, err := playbackInfo.GetPlaybackStatus()
+	if err != nil {
+		return 0, false
+	}
+	return int(status), true
+}
@@ -26,7 +26,7 @@ type Smtc struct {
 	opts          Options
 	cmdChan       chan func()
 	droppedEvents atomic.Int64
-	mu            sync.Mutex // protects sessions, sessionObjects, currentStatus, currentPosition, currentDuration, currentArtist, currentTitle, currentThumbnailSize, currentProperties
+	mu            sync.Mutex // protects sessions, sessionObjects, currentStatus, currentPosition, currentDuration, currentRate, currentRepeat, currentShuffle, currentArtist, currentTitle, currentThumbnailSize, currentProperties
 
 	// Subscriber state — protected by subsMu.
 	subsMu      sync.Mutex
@@ -53,10 +53,21 @@ type Smtc struct {
 	currentThumbnailSize        uint64
 	currentThumbnailContentType string
 	currentThumbnailData        []byte
+	currentThumbnailOriginal    int // see domain.InfoData.ThumbnailOriginal
+	// currentCaps is the last capability set fired in CapabilitiesChangedEvent.
+	// Accessed only from the SMTC goroutine.
+	currentCaps ControlCapabilities
+
+	// sessionStatuses is the last playback status reported per session AppID
+	// in SessionStatusEvent. Accessed only from the SMTC goroutine.
+	sessionStatuses map[string]int
 
 	// Progress tracking
 	currentPosition int
 	currentDuration int
+	currentRate     float64
+	currentRepeat   int
+	currentShuffle  *bool
 	progressTicker  *time.Ticker
 
 	// currentProperties holds the latest media properties object for thumbnail reading.
@@ -83,9 +94,10 @@ type subscriber struct {
 // New creates a new Smtc instance with the given options
 func New(opts Options) *Smtc {
 	return &Smtc{
-		opts:          opts,
-		cmdChan:       make(chan func(), cmdChanCapacity),
-		selectedAppID: opts.InitialDevice,
+		opts:            opts,
+		cmdChan:         make(chan func(), cmdChanCapacity),
+		selectedAppID:   opts.InitialDevice,
+		sessionStatuses: make(map[string]int),
 	}
 }
 
@@ -113,6 +125,9 @@ func (s *Smtc) Run(ctx context.Context) error {
 	s.startProgressTimer()
 	defer s.stopProgressTimer()
 
+	statusTicker := time.NewTicker(sessionStatusPollInterval)
+	defer statusTicker.Stop()
+
 	for {
 		select {
 		case <-ctx.Done():
@@ -122,6 +137,8 @@ func (s *Smtc) Run(ctx context.Context) error {
 			cmd()
 		case <-s.progressTicker.C:
 			s.readTimelineAndProgress()
+		case <-statusTicker.C:
+			s.pollSessionStatuses()
 		}
 	}
 }
@@ -11,6 +11,7 @@ import (
 	winrt "github.com/saltosystems/winrt-go"
 	"github.com/saltosystems/winrt-go/windows/foundation"
 	"github.com/saltosystems/winrt-go/windows/storage/streams"
+	"smtc-now-playing/internal/thumbnail"
 )
 
 // WinRT interface IIDs for the thumbnail extraction pipeline.
@@ -233,7 +234,8 @@ func getAsyncWithProgressResult(opPtr unsafe.Pointer) (unsafe.Pointer, error) {
 
 // readThumbnail reads thumbnail bytes from s.currentProperties.
 // Returns (contentType, data). Returns ("", nil) on any error or when the
-// thumbnail size is unchanged (size-based deduplication).
+// thumbnail size is unchanged (size-based deduplication). Thumbnails over
+// Options.ThumbnailLimits are downscaled here, once per stream size.
 //
 // Replicates C++ checkUpdateOfThumbnail() at c/smtc.cpp:263-302.
 // Pipeline: GetThumbnail → OpenReadAsync → size dedup → ReadAsync → DataReaderFromBuffer → ReadBytes.
@@ -243,8 +245,8 @@ func (s *Smtc) readThumbnail() (contentType string, data []byte) {
 	}
 
 	// Step 1: Get IRandomAccessStreamReference from media properties.
-	thumbnail, err := s.currentProperties.GetThumbnail()
-	if err != nil || thumbnail == nil {
+	thumbRef, err := s.currentProperties.GetThumbnail()
+	if err != nil || thumbRef == nil {
 		if err != nil {
 			log.Debug("failed to get thumbnail", "err", err)
 		}
@@ -252,7 +254,7 @@ func (s *Smtc) readThumbnail() (contentType string, data []byte) {
 	}
 
 	// Step 2: OpenReadAsync → IAsyncOperation<IRandomAccessStreamWithContentType>
-	op, err := thumbnail.OpenReadAsync()
+	op, err := thumbRef.OpenReadAsync()
 	if err != nil {
 		log.Debug("failed to open read async", "err", err)
 		return "", nil
@@ -292,6 +294,14 @@ func (s *Smtc) readThumbnail() (contentType string, data []byte) {
 		return s.currentThumbnailContentType, s.currentThumbnailData
 	}
 
+	if size > maxThumbnailStreamSize {
+		log.Warn("album art stream too large, ignoring it", "bytes", size)
+		s.currentThumbnailSize = size
+		s.currentThumbnailContentType = ""
+		s.currentThumbnailData = nil
+		return "", nil
+	}
+
 	// Step 5: Get content type via IContentTypeProvider.
 	// Use defer-based release so a panic inside getContentType() can't
 	// leak the interface pointer.
@@ -382,6 +392,24 @@ func (s *Smtc) readThumbnail() (contentType string, data []byte) {
 		return "", nil
 	}
 
+	// Step 13: Downscale art over the configured limits. The dedup state
+	// keeps the stream size, so the same art is not decoded again.
+	limited, err := thumbnail.Limit(contentType, data, s.opts.ThumbnailLimits)
+	switch {
+	case err != nil:
+		log.Warn("album art over the size limit, ignoring it", "bytes", len(data), "err", err)
+		contentType, data = "", nil
+	case limited.Downscaled:
+		log.Info("downscaled album art",
+			"bytes", limited.OriginalSize, "width", limited.OriginalWidth, "height", limited.OriginalHeight,
+			"toBytes", len(limited.Data))
+		contentType, data = limited.ContentType, limited.Data
+	}
+	s.currentThumbnailOriginal = 0
+	if limited.Downscaled {
+		s.currentThumbnailOriginal = limited.OriginalSize
+	}
+
 	// Update dedup state with the successfully read size and data.
 	s.currentThumbnailSize = size
 	s.currentThumbnailContentType = contentType
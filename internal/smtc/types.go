@@ -4,6 +4,7 @@ import (
 	"log/slog"
 
 	"smtc-now-playing/internal/domain"
+	"smtc-now-playing/internal/thumbnail"
 )
 
 var log = slog.With("subsystem", "smtc")
@@ -28,29 +29,37 @@ type InfoData struct {
 	AlbumArtist          string
 	PlaybackType         int // 0=Unknown, 1=Music, 2=Video, 3=Image
 	SourceApp            string
+	Subtitle             string
+	Genres               []string
+	TrackNumber          int
+	AlbumTrackCount      int
 }
 
 // ProgressData holds playback progress used internally for deduplication.
 type ProgressData struct {
-	Position        int
+	Position        int   // seconds
+	PositionMs      int64 // milliseconds
 	Duration        int
 	Status          int
 	PlaybackRate    float64
 	IsShuffleActive *bool // nil=unavailable, &true=on, &false=off
 	AutoRepeatMode  int   // 0=None, 1=Track, 2=List
 	LastUpdatedTime int64 // Unix milliseconds
+	MinSeekTime     int   // seconds
+	MaxSeekTime     int   // seconds, 0 when unknown
 }
 
 // ControlCapabilities reports which media controls the current session supports.
 type ControlCapabilities struct {
-	IsPlayEnabled     bool `json:"isPlayEnabled"`
-	IsPauseEnabled    bool `json:"isPauseEnabled"`
-	IsStopEnabled     bool `json:"isStopEnabled"`
-	IsNextEnabled     bool `json:"isNextEnabled"`
-	IsPreviousEnabled bool `json:"isPreviousEnabled"`
-	IsSeekEnabled     bool `json:"isSeekEnabled"` // position control
-	IsShuffleEnabled  bool `json:"isShuffleEnabled"`
-	IsRepeatEnabled   bool `json:"isRepeatEnabled"`
+	IsPlayEnabled         bool `json:"isPlayEnabled"`
+	IsPauseEnabled        bool `json:"isPauseEnabled"`
+	IsStopEnabled         bool `json:"isStopEnabled"`
+	IsNextEnabled         bool `json:"isNextEnabled"`
+	IsPreviousEnabled     bool `json:"isPreviousEnabled"`
+	IsSeekEnabled         bool `json:"isSeekEnabled"` // position control
+	IsShuffleEnabled      bool `json:"isShuffleEnabled"`
+	IsRepeatEnabled       bool `json:"isRepeatEnabled"`
+	IsPlaybackRateEnabled bool `json:"isPlaybackRateEnabled"`
 }
 
 // SessionInfo holds metadata about an available SMTC session
@@ -84,22 +93,71 @@ type DeviceChangedEvent struct{ AppID string }
 
 func (DeviceChangedEvent) smtcEvent() {}
 
+// CapabilitiesChangedEvent is emitted when the active session's playback
+// controls change, and whenever the active session switches.
+type CapabilitiesChangedEvent struct{ Caps ControlCapabilities }
+
+func (CapabilitiesChangedEvent) smtcEvent() {}
+
+// SessionStatusEvent is emitted when the playback status of any session,
+// displayed or not, changes. Status is one of the Status* constants;
+// StatusClosed is reported when a session goes away.
+type SessionStatusEvent struct {
+	AppID  string
+	Status int
+}
+
+func (SessionStatusEvent) smtcEvent() {}
+
 // Options configures the Smtc instance.
 type Options struct {
 	InitialDevice string
+	// FallbackArt, when set, is given tracks that still have no thumbnail
+	// once the thumbnail retries run out, and may fill one in.
+	FallbackArt func(info *domain.InfoData) bool
+	// ThumbnailLimits bounds the thumbnails read from players. Larger ones
+	// are downscaled once, as they are read.
+	ThumbnailLimits thumbnail.Limits
+}
+
+// limitFallbackArt keeps art filled in by Options.FallbackArt within l, as
+// readThumbnail does for the player's own art. Art that cannot be brought
+// within l is dropped.
+func limitFallbackArt(info *domain.InfoData, l thumbnail.Limits) {
+	limited, err := thumbnail.Limit(info.ThumbnailContentType, info.ThumbnailData, l)
+	switch {
+	case err != nil:
+		log.Warn("fallback album art over the size limit, ignoring it", "source", info.ThumbnailSource, "bytes", len(info.ThumbnailData), "err", err)
+		info.ThumbnailContentType, info.ThumbnailData, info.ThumbnailSource = "", nil, ""
+	case limited.Downscaled:
+		log.Info("downscaled fallback album art", "source", info.ThumbnailSource,
+			"bytes", limited.OriginalSize, "width", limited.OriginalWidth, "height", limited.OriginalHeight,
+			"toBytes", len(limited.Data))
+		info.ThumbnailContentType, info.ThumbnailData = limited.ContentType, limited.Data
+		info.ThumbnailOriginal = limited.OriginalSize
+	}
 }
 
+// infoDataToDomain shares the thumbnail bytes rather than copying them; see
+// domain.InfoData.ThumbnailData.
 func infoDataToDomain(data InfoData) domain.InfoData {
-	thumb := append([]byte(nil), data.ThumbnailData...)
+	var genres []string
+	if len(data.Genres) > 0 {
+		genres = append([]string(nil), data.Genres...)
+	}
 	return domain.InfoData{
 		Artist:               data.Artist,
 		Title:                data.Title,
 		ThumbnailContentType: data.ThumbnailContentType,
-		ThumbnailData:        thumb,
+		ThumbnailData:        data.ThumbnailData,
 		AlbumTitle:           data.AlbumTitle,
 		AlbumArtist:          data.AlbumArtist,
 		PlaybackType:         data.PlaybackType,
 		SourceApp:            data.SourceApp,
+		Subtitle:             data.Subtitle,
+		Genres:               genres,
+		TrackNumber:          data.TrackNumber,
+		AlbumTrackCount:      data.AlbumTrackCount,
 	}
 }
 
@@ -111,12 +169,15 @@ func progressDataToDomain(data ProgressData) domain.ProgressData {
 	}
 	return domain.ProgressData{
 		Position:        data.Position,
+		PositionMs:      data.PositionMs,
 		Duration:        data.Duration,
 		Status:          data.Status,
 		PlaybackRate:    data.PlaybackRate,
 		IsShuffleActive: shuffle,
 		AutoRepeatMode:  data.AutoRepeatMode,
 		LastUpdatedTime: data.LastUpdatedTime,
+		MinSeekTime:     data.MinSeekTime,
+		MaxSeekTime:     data.MaxSeekTime,
 	}
 }
 
@@ -138,32 +199,3 @@ func sessionInfosToDomain(data []SessionInfo) []domain.SessionInfo {
 	}
 	return out
 }
-
-// escape replicates C++ escape() — escapes special characters in artist/title strings
-// Matches c/smtc.cpp:26-59 exactly
-func escape(s string) string {
-	var result []rune
-	for _, c := range s {
-		switch c {
-		case '\n':
-			result = append(result, '\\', 'n')
-		case '\r':
-			result = append(result, '\\', 'r')
-		case '\t':
-			result = append(result, '\\', 't')
-		case '\\':
-			result = append(result, '\\', '\\')
-		case '\v':
-			result = append(result, '\\', 'v')
-		case '\b':
-			result = append(result, '\\', 'b')
-		case '\f':
-			result = append(result, '\\', 'f')
-		case '\a':
-			result = append(result, '\\', 'a')
-		default:
-			result = append(result, c)
-		}
-	}
-	return string(result)
-}
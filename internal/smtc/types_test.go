@@ -1,44 +1,15 @@
 package smtc
 
 import (
+	"bytes"
+	"image"
+	"image/png"
 	"testing"
 
 	"smtc-now-playing/internal/domain"
+	"smtc-now-playing/internal/thumbnail"
 )
 
-// TestEscape verifies that escape() correctly escapes all special characters
-// while passing through regular text and Unicode unchanged.
-func TestEscape(t *testing.T) {
-	tests := []struct {
-		name  string
-		input string
-		want  string
-	}{
-		{name: "empty string", input: "", want: ""},
-		{name: "no special chars", input: "Hello World", want: "Hello World"},
-		{name: "newline", input: "\n", want: `\n`},
-		{name: "carriage return", input: "\r", want: `\r`},
-		{name: "tab", input: "\t", want: `\t`},
-		{name: "backslash", input: "\\", want: `\\`},
-		{name: "vertical tab", input: "\v", want: `\v`},
-		{name: "backspace", input: "\b", want: `\b`},
-		{name: "form feed", input: "\f", want: `\f`},
-		{name: "alert/bell", input: "\a", want: `\a`},
-		{name: "multiple specials", input: "line1\nline2\ttab", want: `line1\nline2\ttab`},
-		{name: "unicode passthrough", input: "日本語アーティスト", want: "日本語アーティスト"},
-		{name: "mixed unicode and special", input: "アーティスト\nタイトル", want: `アーティスト\nタイトル`},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			got := escape(tt.input)
-			if got != tt.want {
-				t.Errorf("escape(%q) = %q, want %q", tt.input, got, tt.want)
-			}
-		})
-	}
-}
-
 func TestEventTypesImplementSealedInterface(t *testing.T) {
 	var _ Event = InfoEvent{}
 	var _ Event = ProgressEvent{}
@@ -56,6 +27,10 @@ func TestInfoDataToDomain(t *testing.T) {
 		AlbumArtist:          "Album Artist",
 		PlaybackType:         2,
 		SourceApp:            "Spotify.exe",
+		Subtitle:             "Subtitle",
+		Genres:               []string{"Pop"},
+		TrackNumber:          5,
+		AlbumTrackCount:      11,
 	}
 
 	got := infoDataToDomain(src)
@@ -68,13 +43,46 @@ func TestInfoDataToDomain(t *testing.T) {
 		AlbumArtist:          "Album Artist",
 		PlaybackType:         2,
 		SourceApp:            "Spotify.exe",
+		Subtitle:             "Subtitle",
+		Genres:               []string{"Pop"},
+		TrackNumber:          5,
+		AlbumTrackCount:      11,
 	}
 
 	if !got.Equal(&want) {
 		t.Fatalf("infoDataToDomain() = %+v, want %+v", got, want)
 	}
-	src.ThumbnailData[0] = 9
-	if got.ThumbnailData[0] != 1 {
-		t.Fatal("thumbnail data was not copied")
+	if &got.ThumbnailData[0] != &src.ThumbnailData[0] {
+		t.Fatal("thumbnail data was copied instead of shared")
+	}
+	src.Genres[0] = "Jazz"
+	if got.Genres[0] != "Pop" {
+		t.Fatal("genres were not copied")
+	}
+}
+
+func TestLimitFallbackArt(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 300, 200))
+	for i := range img.Pix {
+		img.Pix[i] = 0xff
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	info := domain.InfoData{ThumbnailContentType: "image/png", ThumbnailData: buf.Bytes(), ThumbnailSource: domain.ArtSourceFolder}
+	limitFallbackArt(&info, thumbnail.Limits{MaxDimension: 100})
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(info.ThumbnailData))
+	if err != nil || max(cfg.Width, cfg.Height) != 100 {
+		t.Fatalf("fallback art is %dx%d (%v), want it fitted to 100 pixels", cfg.Width, cfg.Height, err)
+	}
+	if info.ThumbnailOriginal != buf.Len() || info.ThumbnailSource != domain.ArtSourceFolder {
+		t.Fatalf("info = original %d, source %q", info.ThumbnailOriginal, info.ThumbnailSource)
+	}
+
+	info = domain.InfoData{ThumbnailContentType: "image/png", ThumbnailData: buf.Bytes(), ThumbnailSource: domain.ArtSourceFolder}
+	limitFallbackArt(&info, thumbnail.Limits{MaxBytes: 10})
+	if info.ThumbnailData != nil || info.ThumbnailSource != "" {
+		t.Fatalf("art over an unreachable limit was kept: %d bytes from %q", len(info.ThumbnailData), info.ThumbnailSource)
 	}
 }
@@ -0,0 +1,229 @@
+// Package thumbnail keeps album art published by players within size limits.
+// It is pure Go so the decoding path can be tested on any platform.
+package thumbnail
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	_ "image/gif" // register decoders for the formats players publish
+	"image/jpeg"
+	"image/png"
+	"sync"
+)
+
+// jpegQuality is used when downscaled art is encoded as JPEG.
+const jpegQuality = 90
+
+// minEdge is the smallest longest side Limit shrinks art to while trying to
+// meet the byte limit.
+const minEdge = 64
+
+// maxPixels refuses to decode images whose header claims more pixels than
+// any cover needs, so a broken player cannot make us allocate gigabytes.
+const maxPixels = 64 << 20
+
+// ErrTooLarge is returned for art over the byte limit that cannot be brought
+// under it.
+var ErrTooLarge = errors.New("thumbnail: album art over the size limit")
+
+// Limits bounds album art. Zero fields mean no limit.
+type Limits struct {
+	MaxBytes     int // encoded size
+	MaxDimension int // longest side in pixels
+}
+
+// Result is album art after Limit, with what it was before.
+type Result struct {
+	ContentType string
+	Data        []byte
+	Downscaled  bool
+
+	OriginalSize   int // bytes
+	OriginalWidth  int // 0 when the image was not decoded
+	OriginalHeight int
+}
+
+// Limit returns data unchanged when it is within l, and otherwise decodes it
+// once and downscales it until it is. Downscaled art is encoded as JPEG, or
+// as PNG when it has transparency. Art within the byte limit that cannot be
+// decoded is passed through; art over it returns ErrTooLarge. Every call is
+// counted in the Metrics.
+func Limit(contentType string, data []byte, l Limits) (Result, error) {
+	res, err := limit(contentType, data, l)
+	recordMetrics(res, err)
+	return res, err
+}
+
+func limit(contentType string, data []byte, l Limits) (Result, error) {
+	res := Result{ContentType: contentType, Data: data, OriginalSize: len(data)}
+	overBytes := l.MaxBytes > 0 && len(data) > l.MaxBytes
+	if !overBytes && l.MaxDimension <= 0 {
+		return res, nil
+	}
+
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		if overBytes {
+			return res, fmt.Errorf("%w: %d bytes: %v", ErrTooLarge, len(data), err)
+		}
+		return res, nil
+	}
+	res.OriginalWidth, res.OriginalHeight = cfg.Width, cfg.Height
+	edge := max(cfg.Width, cfg.Height)
+	overDimension := l.MaxDimension > 0 && edge > l.MaxDimension
+	if !overBytes && !overDimension {
+		return res, nil
+	}
+	if cfg.Width*cfg.Height > maxPixels {
+		return res, fmt.Errorf("%w: %dx%d pixels", ErrTooLarge, cfg.Width, cfg.Height)
+	}
+
+	img, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		if overBytes {
+			return res, fmt.Errorf("%w: %v", ErrTooLarge, err)
+		}
+		return res, nil
+	}
+	if overDimension {
+		edge = l.MaxDimension
+	}
+	for {
+		scaled := Fit(img, edge)
+		out, ct, err := encode(scaled, format)
+		if err != nil {
+			return res, err
+		}
+		if l.MaxBytes <= 0 || len(out) <= l.MaxBytes {
+			res.ContentType, res.Data, res.Downscaled = ct, out, true
+			return res, nil
+		}
+		if edge <= minEdge {
+			return res, fmt.Errorf("%w: %d bytes at %dpx", ErrTooLarge, len(out), edge)
+		}
+		edge = max(minEdge, edge*3/4)
+	}
+}
+
+// Original describes album art as it was published, before Limit.
+type Original struct {
+	Size   int `json:"size"`   // bytes
+	Width  int `json:"width"`  // 0 when the image was not decoded
+	Height int `json:"height"` // 0 when the image was not decoded
+}
+
+// Metrics counts what Limit did to album art since the process started.
+type Metrics struct {
+	Checked    int64 `json:"checked"`    // images passed to Limit
+	Downscaled int64 `json:"downscaled"` // images brought within the limits
+	Rejected   int64 `json:"rejected"`   // images Limit returned an error for
+	// OriginalBytes totals the published size of the downscaled images.
+	OriginalBytes int64 `json:"originalBytes"`
+	// Last and Largest are the most recent and the largest image that was
+	// downscaled or rejected, as published.
+	Last    Original `json:"last"`
+	Largest Original `json:"largest"`
+}
+
+var (
+	metricsMu sync.Mutex
+	metrics   Metrics
+)
+
+// ReadMetrics returns the counters of Limit.
+func ReadMetrics() Metrics {
+	metricsMu.Lock()
+	defer metricsMu.Unlock()
+	return metrics
+}
+
+// recordMetrics counts one call of Limit.
+func recordMetrics(res Result, err error) {
+	metricsMu.Lock()
+	defer metricsMu.Unlock()
+	metrics.Checked++
+	switch {
+	case err != nil:
+		metrics.Rejected++
+	case res.Downscaled:
+		metrics.Downscaled++
+		metrics.OriginalBytes += int64(res.OriginalSize)
+	default:
+		return
+	}
+	metrics.Last = Original{Size: res.OriginalSize, Width: res.OriginalWidth, Height: res.OriginalHeight}
+	if metrics.Last.Size > metrics.Largest.Size {
+		metrics.Largest = metrics.Last
+	}
+}
+
+// encode writes img as JPEG, or as PNG when it came from a format that can
+// carry transparency and is not opaque.
+func encode(img *image.RGBA, format string) ([]byte, string, error) {
+	var buf bytes.Buffer
+	if format != "jpeg" && !img.Opaque() {
+		if err := png.Encode(&buf, img); err != nil {
+			return nil, "", fmt.Errorf("encode album art: %w", err)
+		}
+		return buf.Bytes(), "image/png", nil
+	}
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: jpegQuality}); err != nil {
+		return nil, "", fmt.Errorf("encode album art: %w", err)
+	}
+	return buf.Bytes(), "image/jpeg", nil
+}
+
+// Fit scales src so its longest side is at most edge, keeping its aspect
+// ratio. Images that already fit are only converted.
+func Fit(src image.Image, edge int) *image.RGBA {
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	dw, dh := w, h
+	if w > edge || h > edge {
+		if w > h {
+			dw, dh = edge, max(1, h*edge/w)
+		} else {
+			dw, dh = max(1, w*edge/h), edge
+		}
+	}
+	return Scale(src, b, dw, dh)
+}
+
+// Scale downsamples the region r of src to dw×dh by averaging the source
+// pixels that cover each destination pixel.
+func Scale(src image.Image, r image.Rectangle, dw, dh int) *image.RGBA {
+	rgba, ok := src.(*image.RGBA)
+	if !ok || rgba.Rect != src.Bounds() {
+		rgba = image.NewRGBA(src.Bounds())
+		draw.Draw(rgba, rgba.Rect, src, src.Bounds().Min, draw.Src)
+	}
+	sw, sh := r.Dx(), r.Dy()
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for dy := 0; dy < dh; dy++ {
+		y0 := r.Min.Y + dy*sh/dh
+		y1 := max(r.Min.Y+(dy+1)*sh/dh, y0+1)
+		for dx := 0; dx < dw; dx++ {
+			x0 := r.Min.X + dx*sw/dw
+			x1 := max(r.Min.X+(dx+1)*sw/dw, x0+1)
+			var sum [4]int
+			for y := y0; y < y1; y++ {
+				row := rgba.Pix[rgba.PixOffset(x0, y):rgba.PixOffset(x1, y)]
+				for i := 0; i < len(row); i += 4 {
+					sum[0] += int(row[i])
+					sum[1] += int(row[i+1])
+					sum[2] += int(row[i+2])
+					sum[3] += int(row[i+3])
+				}
+			}
+			n := (x1 - x0) * (y1 - y0)
+			o := dst.PixOffset(dx, dy)
+			for c := range sum {
+				dst.Pix[o+c] = uint8(sum[c] / n)
+			}
+		}
+	}
+	return dst
+}
@@ -0,0 +1,149 @@
+package thumbnail
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"math/rand/v2"
+	"testing"
+)
+
+// testPNG encodes a w×h image. Noisy images compress badly, for byte limit
+// tests; alpha below 255 makes the image transparent.
+func testPNG(t *testing.T, w, h int, noisy bool, alpha uint8) []byte {
+	t.Helper()
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	rng := rand.New(rand.NewPCG(1, 2))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			c := color.NRGBA{0x20, 0x80, 0xc0, alpha}
+			if noisy {
+				c.R, c.G, c.B = uint8(rng.IntN(256)), uint8(rng.IntN(256)), uint8(rng.IntN(256))
+			}
+			img.SetNRGBA(x, y, c)
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func decodeSize(t *testing.T, data []byte) (int, int) {
+	t.Helper()
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("decode result: %v", err)
+	}
+	return cfg.Width, cfg.Height
+}
+
+func TestLimit_WithinLimits(t *testing.T) {
+	data := testPNG(t, 40, 20, false, 0xff)
+	for _, l := range []Limits{{}, {MaxBytes: len(data), MaxDimension: 40}} {
+		res, err := Limit("image/png", data, l)
+		if err != nil {
+			t.Fatalf("%+v: %v", l, err)
+		}
+		if res.Downscaled || &res.Data[0] != &data[0] || res.ContentType != "image/png" || res.OriginalSize != len(data) {
+			t.Fatalf("%+v: got %+v, want the art passed through", l, res)
+		}
+	}
+}
+
+func TestLimit_Dimension(t *testing.T) {
+	data := testPNG(t, 200, 100, false, 0xff)
+	res, err := Limit("image/png", data, Limits{MaxDimension: 50})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.Downscaled || res.ContentType != "image/jpeg" {
+		t.Fatalf("got %q, downscaled %v; want opaque art as JPEG", res.ContentType, res.Downscaled)
+	}
+	if res.OriginalWidth != 200 || res.OriginalHeight != 100 || res.OriginalSize != len(data) {
+		t.Fatalf("original = %dx%d, %d bytes; want 200x100, %d bytes", res.OriginalWidth, res.OriginalHeight, res.OriginalSize, len(data))
+	}
+	if w, h := decodeSize(t, res.Data); w != 50 || h != 25 {
+		t.Fatalf("downscaled to %dx%d, want 50x25", w, h)
+	}
+}
+
+func TestLimit_KeepsTransparency(t *testing.T) {
+	res, err := Limit("image/png", testPNG(t, 100, 100, false, 0x80), Limits{MaxDimension: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.ContentType != "image/png" {
+		t.Fatalf("content type = %q, want transparent art kept as PNG", res.ContentType)
+	}
+}
+
+func TestLimit_Bytes(t *testing.T) {
+	data := testPNG(t, 400, 400, true, 0xff)
+	limit := len(data) / 20
+	res, err := Limit("image/png", data, Limits{MaxBytes: limit})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.Downscaled || len(res.Data) > limit {
+		t.Fatalf("got %d bytes, want at most %d", len(res.Data), limit)
+	}
+	if w, h := decodeSize(t, res.Data); w != h || w > 400 {
+		t.Fatalf("downscaled to %dx%d, want a smaller square", w, h)
+	}
+}
+
+func TestLimit_TooLarge(t *testing.T) {
+	if _, err := Limit("image/png", testPNG(t, 400, 400, true, 0xff), Limits{MaxBytes: 10}); !errors.Is(err, ErrTooLarge) {
+		t.Fatalf("unreachable limit: err = %v, want ErrTooLarge", err)
+	}
+
+	garbage := bytes.Repeat([]byte{0x01}, 100)
+	if _, err := Limit("image/webp", garbage, Limits{MaxBytes: 50}); !errors.Is(err, ErrTooLarge) {
+		t.Fatalf("undecodable art over the limit: err = %v, want ErrTooLarge", err)
+	}
+	res, err := Limit("image/webp", garbage, Limits{MaxBytes: 100, MaxDimension: 10})
+	if err != nil || res.Downscaled || !bytes.Equal(res.Data, garbage) {
+		t.Fatalf("undecodable art within the limit: got %+v, %v; want it passed through", res, err)
+	}
+}
+
+func TestLimit_Metrics(t *testing.T) {
+	data := testPNG(t, 400, 300, true, 0xff)
+	before := ReadMetrics()
+	if _, err := Limit("image/png", data, Limits{MaxDimension: 100}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Limit("image/png", data, Limits{MaxBytes: 10}); err == nil {
+		t.Fatal("unreachable limit accepted")
+	}
+	after := ReadMetrics()
+	if after.Checked-before.Checked != 2 || after.Downscaled-before.Downscaled != 1 || after.Rejected-before.Rejected != 1 {
+		t.Fatalf("metrics went from %+v to %+v", before, after)
+	}
+	if after.OriginalBytes-before.OriginalBytes != int64(len(data)) {
+		t.Fatalf("originalBytes grew by %d, want %d", after.OriginalBytes-before.OriginalBytes, len(data))
+	}
+	if want := (Original{Size: len(data), Width: 400, Height: 300}); after.Last != want {
+		t.Fatalf("last = %+v, want %+v", after.Last, want)
+	}
+}
+
+func TestFit(t *testing.T) {
+	src := image.NewRGBA(image.Rect(10, 10, 110, 60)) // 100x50 away from the origin
+	tests := []struct {
+		edge, w, h int
+	}{
+		{200, 100, 50},
+		{20, 20, 10},
+		{1, 1, 1},
+	}
+	for _, tt := range tests {
+		if b := Fit(src, tt.edge).Bounds(); b != image.Rect(0, 0, tt.w, tt.h) {
+			t.Errorf("Fit(%d) = %v, want %dx%d at the origin", tt.edge, b, tt.w, tt.h)
+		}
+	}
+}
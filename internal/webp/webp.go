@@ -0,0 +1,524 @@
+// Package webp encodes images as lossless WebP (VP8L).
+//
+// The encoder applies the subtract-green transform and LZ77 backward
+// references with a single set of prefix codes. It trades some size against
+// libwebp for simplicity, which is fine for album art variants that are
+// rendered once and cached.
+package webp
+
+import (
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/draw"
+	"io"
+	"slices"
+)
+
+// ErrInvalidSize rejects images VP8L cannot describe: empty ones and ones
+// wider or taller than 16384 pixels.
+var ErrInvalidSize = errors.New("webp: image size out of range")
+
+const (
+	maxDimension = 1 << 14
+
+	numLiterals      = 256
+	numLengthCodes   = 24
+	numDistanceCodes = 40
+	numCodeLengths   = 19
+
+	maxCodeLength       = 15
+	maxCodeLengthLength = 7
+
+	minMatch    = 3
+	maxMatch    = 4096
+	maxDistance = 1<<20 - 120
+	hashBits    = 18
+	maxChain    = 32
+
+	transformSubtractGreen = 2
+)
+
+// codeLengthOrder is the order code length code lengths are written in.
+var codeLengthOrder = [numCodeLengths]int{17, 18, 0, 1, 2, 3, 4, 5, 16, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}
+
+// Encode writes img to w as a lossless WebP image.
+func Encode(w io.Writer, img image.Image) error {
+	b := img.Bounds()
+	width, height := b.Dx(), b.Dy()
+	if width < 1 || height < 1 || width > maxDimension || height > maxDimension {
+		return ErrInvalidSize
+	}
+	argb, alpha := pixels(img)
+
+	var bw bitWriter
+	bw.write(0x2f, 8)
+	bw.write(uint32(width-1), 14)
+	bw.write(uint32(height-1), 14)
+	bw.write(boolBit(alpha), 1)
+	bw.write(0, 3)
+
+	bw.write(1, 1)
+	bw.write(transformSubtractGreen, 2)
+	subtractGreen(argb)
+	bw.write(0, 1)
+
+	bw.write(0, 1) // no colour cache
+	bw.write(0, 1) // one group of prefix codes for the whole image
+	writeImage(&bw, argb, width)
+
+	data := bw.bytes()
+	chunk := len(data) + len(data)&1
+	header := make([]byte, 20, 20+chunk)
+	copy(header, "RIFF")
+	binary.LittleEndian.PutUint32(header[4:], uint32(12+chunk))
+	copy(header[8:], "WEBPVP8L")
+	binary.LittleEndian.PutUint32(header[16:], uint32(len(data)))
+	out := append(header, data...)
+	if len(data)&1 == 1 {
+		out = append(out, 0)
+	}
+	_, err := w.Write(out)
+	return err
+}
+
+// pixels returns the non-premultiplied ARGB pixels of img in row order and
+// whether any of them is not fully opaque.
+func pixels(img image.Image) ([]uint32, bool) {
+	b := img.Bounds()
+	src, ok := img.(*image.NRGBA)
+	if !ok || src.Rect.Min != (image.Point{}) || src.Stride != 4*b.Dx() {
+		src = image.NewNRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+		draw.Draw(src, src.Rect, img, b.Min, draw.Src)
+	}
+	argb := make([]uint32, b.Dx()*b.Dy())
+	alpha := false
+	for i := range argb {
+		p := src.Pix[4*i : 4*i+4 : 4*i+4]
+		argb[i] = uint32(p[3])<<24 | uint32(p[0])<<16 | uint32(p[1])<<8 | uint32(p[2])
+		alpha = alpha || p[3] != 0xff
+	}
+	return argb, alpha
+}
+
+// subtractGreen subtracts the green channel from red and blue, which leaves
+// the two mostly near zero in greyish images.
+func subtractGreen(argb []uint32) {
+	for i, p := range argb {
+		g := p >> 8 & 0xff
+		r := (p>>16 - g) & 0xff
+		b := (p - g) & 0xff
+		argb[i] = p&0xff00ff00 | r<<16 | b
+	}
+}
+
+// token is a literal pixel, or a backward reference when length is set.
+type token struct {
+	argb     uint32
+	length   int
+	distance int // distance code, not the distance in pixels
+}
+
+// writeImage writes the prefix codes and entropy-coded data of argb.
+func writeImage(bw *bitWriter, argb []uint32, width int) {
+	tokens := backwardReferences(argb, width)
+
+	green := make([]uint32, numLiterals+numLengthCodes)
+	red := make([]uint32, numLiterals)
+	blue := make([]uint32, numLiterals)
+	alpha := make([]uint32, numLiterals)
+	dist := make([]uint32, numDistanceCodes)
+	for _, t := range tokens {
+		if t.length == 0 {
+			green[t.argb>>8&0xff]++
+			red[t.argb>>16&0xff]++
+			blue[t.argb&0xff]++
+			alpha[t.argb>>24]++
+			continue
+		}
+		code, _, _ := prefixEncode(t.length)
+		green[numLiterals+code]++
+		code, _, _ = prefixEncode(t.distance)
+		dist[code]++
+	}
+	codes := [5]prefixCode{}
+	for i, hist := range [][]uint32{green, red, blue, alpha, dist} {
+		codes[i] = writePrefixCode(bw, hist)
+	}
+	greenCode, redCode, blueCode, alphaCode, distCode := codes[0], codes[1], codes[2], codes[3], codes[4]
+
+	for _, t := range tokens {
+		if t.length == 0 {
+			greenCode.write(bw, int(t.argb>>8&0xff))
+			redCode.write(bw, int(t.argb>>16&0xff))
+			blueCode.write(bw, int(t.argb&0xff))
+			alphaCode.write(bw, int(t.argb>>24))
+			continue
+		}
+		code, n, extra := prefixEncode(t.length)
+		greenCode.write(bw, numLiterals+code)
+		bw.write(extra, n)
+		code, n, extra = prefixEncode(t.distance)
+		distCode.write(bw, code)
+		bw.write(extra, n)
+	}
+}
+
+// backwardReferences splits argb into literals and greedy LZ77 matches
+// found through hash chains of pixel pairs.
+func backwardReferences(argb []uint32, width int) []token {
+	n := len(argb)
+	head := make([]int32, 1<<hashBits)
+	for i := range head {
+		head[i] = -1
+	}
+	prev := make([]int32, n)
+	hash := func(i int) uint32 {
+		return (argb[i]*0x1e35a7bd ^ argb[i+1]*0x9e3779b1) >> (32 - hashBits)
+	}
+	insert := func(i int) {
+		if i+1 < n {
+			h := hash(i)
+			prev[i] = head[h]
+			head[h] = int32(i)
+		}
+	}
+
+	var tokens []token
+	for i := 0; i < n; {
+		bestLen, bestDist := 0, 0
+		if i+minMatch <= n {
+			limit := min(maxMatch, n-i)
+			try := func(j int) {
+				// Most candidates are hash collisions; reject them before
+				// comparing pixel by pixel.
+				if argb[j] != argb[i] || argb[j+bestLen] != argb[i+bestLen] {
+					return
+				}
+				if l := matchLength(argb, j, i, limit); l > bestLen {
+					bestLen, bestDist = l, i-j
+				}
+			}
+			// The pixel above is the most common match in images; try it
+			// even when the chain would not reach it.
+			if i >= width {
+				try(i - width)
+			}
+			for j, chain := int(head[hash(i)]), 0; j >= 0 && i-j <= maxDistance && chain < maxChain && bestLen < limit; j, chain = int(prev[j]), chain+1 {
+				try(j)
+			}
+		}
+		if bestLen < minMatch {
+			tokens = append(tokens, token{argb: argb[i]})
+			insert(i)
+			i++
+			continue
+		}
+		tokens = append(tokens, token{length: bestLen, distance: distanceCode(bestDist, width)})
+		for k := range bestLen {
+			insert(i + k)
+		}
+		i += bestLen
+	}
+	return tokens
+}
+
+// matchLength is how many pixels from j repeat at i, up to limit.
+func matchLength(argb []uint32, j, i, limit int) int {
+	l := 0
+	for l < limit && argb[j+l] == argb[i+l] {
+		l++
+	}
+	return l
+}
+
+// distanceCode maps a distance in pixels to its distance code. The two
+// closest neighbours have short codes of their own; every other distance is
+// offset past the 120 codes reserved for the neighbourhood.
+func distanceCode(distance, width int) int {
+	switch distance {
+	case width:
+		return 1
+	case 1:
+		return 2
+	}
+	return distance + 120
+}
+
+// prefixEncode splits a length or distance code v into its prefix symbol
+// and the extra bits that follow it.
+func prefixEncode(v int) (code int, nbits uint, extra uint32) {
+	if v <= 4 {
+		return v - 1, 0, 0
+	}
+	v--
+	high := 0
+	for v>>(high+1) != 0 {
+		high++
+	}
+	second := v >> (high - 1) & 1
+	nbits = uint(high - 1)
+	return 2*high + second, nbits, uint32(v) & (1<<nbits - 1)
+}
+
+// prefixCode is a canonical prefix code, its codes bit-reversed for the
+// LSB-first bit stream. A code with a single symbol takes no bits at all.
+type prefixCode struct {
+	lengths []uint8
+	codes   []uint16
+}
+
+func (c prefixCode) write(bw *bitWriter, symbol int) {
+	bw.write(uint32(c.codes[symbol]), uint(c.lengths[symbol]))
+}
+
+// newPrefixCode assigns canonical codes to lengths.
+func newPrefixCode(lengths []uint8) prefixCode {
+	var count [maxCodeLength + 1]uint16
+	used := 0
+	for _, l := range lengths {
+		if l > 0 {
+			count[l]++
+			used++
+		}
+	}
+	c := prefixCode{lengths: lengths, codes: make([]uint16, len(lengths))}
+	if used == 1 {
+		c.lengths = make([]uint8, len(lengths))
+		return c
+	}
+	var next [maxCodeLength + 1]uint16
+	code := uint16(0)
+	for l := 1; l <= maxCodeLength; l++ {
+		code = (code + count[l-1]) << 1
+		next[l] = code
+	}
+	for s, l := range lengths {
+		if l == 0 {
+			continue
+		}
+		c.codes[s] = reverseBits(next[l], l)
+		next[l]++
+	}
+	return c
+}
+
+func reverseBits(v uint16, n uint8) uint16 {
+	var r uint16
+	for range n {
+		r = r<<1 | v&1
+		v >>= 1
+	}
+	return r
+}
+
+// writePrefixCode writes the prefix code for hist and returns it. Up to two
+// symbols below 256 use the simple form; everything else writes its code
+// lengths, run-length coded with a code length code.
+func writePrefixCode(bw *bitWriter, hist []uint32) prefixCode {
+	var symbols []int
+	for s, n := range hist {
+		if n > 0 {
+			symbols = append(symbols, s)
+		}
+	}
+	if len(symbols) == 0 {
+		symbols = []int{0}
+	}
+	if len(symbols) <= 2 && symbols[len(symbols)-1] < numLiterals {
+		bw.write(1, 1)
+		bw.write(uint32(len(symbols)-1), 1)
+		if symbols[0] <= 1 {
+			bw.write(0, 1)
+			bw.write(uint32(symbols[0]), 1)
+		} else {
+			bw.write(1, 1)
+			bw.write(uint32(symbols[0]), 8)
+		}
+		lengths := make([]uint8, len(hist))
+		for _, s := range symbols {
+			lengths[s] = 1
+		}
+		if len(symbols) == 2 {
+			bw.write(uint32(symbols[1]), 8)
+		}
+		return newPrefixCode(lengths)
+	}
+
+	lengths := huffmanLengths(hist, maxCodeLength)
+	runs := runLengths(lengths)
+	clHist := make([]uint32, numCodeLengths)
+	for _, r := range runs {
+		clHist[r.symbol]++
+	}
+	clLengths := huffmanLengths(clHist, maxCodeLengthLength)
+	n := numCodeLengths
+	for n > 4 && clLengths[codeLengthOrder[n-1]] == 0 {
+		n--
+	}
+	bw.write(0, 1)
+	bw.write(uint32(n-4), 4)
+	for _, s := range codeLengthOrder[:n] {
+		bw.write(uint32(clLengths[s]), 3)
+	}
+	bw.write(0, 1) // code lengths for every symbol follow
+	clCode := newPrefixCode(clLengths)
+	for _, r := range runs {
+		clCode.write(bw, r.symbol)
+		bw.write(r.extra, r.nbits)
+	}
+	return newPrefixCode(lengths)
+}
+
+// codeLengthRun is one symbol of the code length code: a length, or a
+// repeat (16) or run of zeros (17, 18) with its extra bits.
+type codeLengthRun struct {
+	symbol int
+	nbits  uint
+	extra  uint32
+}
+
+// runLengths run-length codes lengths. Repeats only follow the length they
+// repeat, so they never depend on the decoder's initial previous length.
+func runLengths(lengths []uint8) []codeLengthRun {
+	var runs []codeLengthRun
+	for i := 0; i < len(lengths); {
+		l := lengths[i]
+		n := 1
+		for i+n < len(lengths) && lengths[i+n] == l {
+			n++
+		}
+		i += n
+		if l == 0 {
+			for n >= 3 {
+				if n >= 11 {
+					k := min(n, 138)
+					runs = append(runs, codeLengthRun{18, 7, uint32(k - 11)})
+					n -= k
+				} else {
+					k := min(n, 10)
+					runs = append(runs, codeLengthRun{17, 3, uint32(k - 3)})
+					n -= k
+				}
+			}
+		} else {
+			runs = append(runs, codeLengthRun{symbol: int(l)})
+			n--
+			for n >= 3 {
+				k := min(n, 6)
+				runs = append(runs, codeLengthRun{16, 2, uint32(k - 3)})
+				n -= k
+			}
+		}
+		for range n {
+			runs = append(runs, codeLengthRun{symbol: int(l)})
+		}
+	}
+	return runs
+}
+
+// huffmanLengths returns Huffman code lengths for hist of at most maxLen
+// bits. When the optimal code is too deep, rare symbols are counted as more
+// frequent until it fits.
+func huffmanLengths(hist []uint32, maxLen int) []uint8 {
+	lengths := make([]uint8, len(hist))
+	for floor := uint64(1); ; floor *= 2 {
+		if huffmanTree(hist, floor, lengths) <= maxLen {
+			return lengths
+		}
+	}
+}
+
+// huffmanTree fills lengths with the depths of a Huffman tree over hist,
+// counting every used symbol at least floor times, and returns the deepest.
+func huffmanTree(hist []uint32, floor uint64, lengths []uint8) int {
+	type node struct {
+		count       uint64
+		symbol      int
+		left, right int
+	}
+	var nodes []node
+	for s, n := range hist {
+		lengths[s] = 0
+		if n > 0 {
+			nodes = append(nodes, node{count: max(uint64(n), floor), symbol: s, left: -1})
+		}
+	}
+	leaves := len(nodes)
+	switch leaves {
+	case 0:
+		return 0
+	case 1:
+		lengths[nodes[0].symbol] = 1
+		return 1
+	}
+	slices.SortFunc(nodes, func(a, b node) int {
+		if a.count != b.count {
+			if a.count < b.count {
+				return -1
+			}
+			return 1
+		}
+		return a.symbol - b.symbol
+	})
+	// Leaves and merged nodes both come out in ascending order, so two
+	// queues stand in for a heap.
+	leaf, merged := 0, leaves
+	pick := func() int {
+		if leaf < leaves && (merged >= len(nodes) || nodes[leaf].count <= nodes[merged].count) {
+			leaf++
+			return leaf - 1
+		}
+		merged++
+		return merged - 1
+	}
+	for range leaves - 1 {
+		a, b := pick(), pick()
+		nodes = append(nodes, node{count: nodes[a].count + nodes[b].count, left: a, right: b})
+	}
+	depth := make([]int, len(nodes))
+	deepest := 0
+	for i := len(nodes) - 1; i >= leaves; i-- {
+		depth[nodes[i].left] = depth[i] + 1
+		depth[nodes[i].right] = depth[i] + 1
+	}
+	for _, i := range depth[:leaves] {
+		deepest = max(deepest, i)
+	}
+	for i, n := range nodes[:leaves] {
+		lengths[n.symbol] = uint8(depth[i])
+	}
+	return deepest
+}
+
+// bitWriter packs bits LSB first, as VP8L reads them.
+type bitWriter struct {
+	buf  []byte
+	acc  uint64
+	nacc uint
+}
+
+func (w *bitWriter) write(v uint32, n uint) {
+	w.acc |= uint64(v) << w.nacc
+	w.nacc += n
+	for w.nacc >= 8 {
+		w.buf = append(w.buf, byte(w.acc))
+		w.acc >>= 8
+		w.nacc -= 8
+	}
+}
+
+func (w *bitWriter) bytes() []byte {
+	if w.nacc > 0 {
+		w.buf = append(w.buf, byte(w.acc))
+		w.acc, w.nacc = 0, 0
+	}
+	return w.buf
+}
+
+func boolBit(b bool) uint32 {
+	if b {
+		return 1
+	}
+	return 0
+}
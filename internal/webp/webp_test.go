@@ -0,0 +1,361 @@
+package webp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"math/rand/v2"
+	"testing"
+
+	xwebp "golang.org/x/image/webp"
+)
+
+// decoder reads back the subset of VP8L the encoder writes. It is written
+// from the format description rather than shared with the encoder, so the
+// two check each other.
+type decoder struct {
+	data []byte
+	pos  int // in bits
+}
+
+func (d *decoder) bits(n int) uint32 {
+	var v uint32
+	for i := range n {
+		if d.pos/8 >= len(d.data) {
+			panic("read past end of data")
+		}
+		v |= uint32(d.data[d.pos/8]>>(d.pos%8)&1) << i
+		d.pos++
+	}
+	return v
+}
+
+// huffman decodes a canonical code one bit at a time.
+type huffman struct {
+	single  int // the only symbol, which takes no bits, or -1
+	symbols map[[2]int]int
+}
+
+func newHuffman(lengths []int) (huffman, error) {
+	h := huffman{single: -1, symbols: map[[2]int]int{}}
+	var count [16]int
+	used := 0
+	for s, l := range lengths {
+		if l > 0 {
+			count[l]++
+			used++
+			h.single = s
+		}
+	}
+	switch used {
+	case 0:
+		return h, errors.New("empty code")
+	case 1:
+		return h, nil
+	}
+	h.single = -1
+	code, left := 0, 1
+	var next [16]int
+	for l := 1; l < 16; l++ {
+		code = (code + count[l-1]) << 1
+		next[l] = code
+		left = left<<1 - count[l]
+		if left < 0 {
+			return h, errors.New("over-subscribed code")
+		}
+	}
+	if left != 0 {
+		return h, errors.New("incomplete code")
+	}
+	for s, l := range lengths {
+		if l > 0 {
+			h.symbols[[2]int{l, next[l]}] = s
+			next[l]++
+		}
+	}
+	return h, nil
+}
+
+func (d *decoder) symbol(h huffman) int {
+	if h.single >= 0 {
+		return h.single
+	}
+	code := 0
+	for l := 1; l < 16; l++ {
+		code = code<<1 | int(d.bits(1))
+		if s, ok := h.symbols[[2]int{l, code}]; ok {
+			return s
+		}
+	}
+	panic("invalid code")
+}
+
+func (d *decoder) prefixCode(size int) (huffman, error) {
+	lengths := make([]int, size)
+	if d.bits(1) == 1 {
+		n := int(d.bits(1)) + 1
+		first := d.bits(1)
+		lengths[d.bits(1+7*int(first))] = 1
+		if n == 2 {
+			lengths[d.bits(8)] = 1
+		}
+		return newHuffman(lengths)
+	}
+	clLengths := make([]int, numCodeLengths)
+	for _, s := range codeLengthOrder[:4+d.bits(4)] {
+		clLengths[s] = int(d.bits(3))
+	}
+	cl, err := newHuffman(clLengths)
+	if err != nil {
+		return huffman{}, fmt.Errorf("code length code: %w", err)
+	}
+	if d.bits(1) != 0 {
+		return huffman{}, errors.New("max_symbol is not used by the encoder")
+	}
+	prev := 8
+	for i := 0; i < size; {
+		switch s := d.symbol(cl); {
+		case s < 16:
+			lengths[i] = s
+			i++
+			if s != 0 {
+				prev = s
+			}
+		default:
+			repeat, value := 0, 0
+			switch s {
+			case 16:
+				repeat, value = 3+int(d.bits(2)), prev
+			case 17:
+				repeat = 3 + int(d.bits(3))
+			case 18:
+				repeat = 11 + int(d.bits(7))
+			}
+			if i+repeat > size {
+				return huffman{}, errors.New("code lengths overflow the alphabet")
+			}
+			for range repeat {
+				lengths[i] = value
+				i++
+			}
+		}
+	}
+	return newHuffman(lengths)
+}
+
+func (d *decoder) prefixValue(code int) int {
+	if code < 4 {
+		return code + 1
+	}
+	n := (code - 2) >> 1
+	return (2+code&1)<<n + int(d.bits(n)) + 1
+}
+
+func decode(t *testing.T, data []byte) (*image.NRGBA, bool) {
+	t.Helper()
+	if len(data) < 20 || string(data[:4]) != "RIFF" || string(data[8:16]) != "WEBPVP8L" {
+		t.Fatalf("not a VP8L WebP file: % x", data[:min(len(data), 20)])
+	}
+	if size := binary.LittleEndian.Uint32(data[4:]); int(size) != len(data)-8 {
+		t.Fatalf("RIFF size = %d, file has %d bytes after the header", size, len(data)-8)
+	}
+	chunk := int(binary.LittleEndian.Uint32(data[16:]))
+	if 20+chunk+chunk&1 != len(data) {
+		t.Fatalf("VP8L chunk size = %d, file is %d bytes", chunk, len(data))
+	}
+	d := &decoder{data: data[20 : 20+chunk]}
+	if d.bits(8) != 0x2f {
+		t.Fatal("missing VP8L signature")
+	}
+	width, height := int(d.bits(14))+1, int(d.bits(14))+1
+	alpha := d.bits(1) == 1
+	if v := d.bits(3); v != 0 {
+		t.Fatalf("version = %d", v)
+	}
+	subtract := false
+	for d.bits(1) == 1 {
+		if kind := d.bits(2); kind != transformSubtractGreen {
+			t.Fatalf("unexpected transform %d", kind)
+		}
+		subtract = true
+	}
+	if d.bits(1) != 0 || d.bits(1) != 0 {
+		t.Fatal("colour cache or meta prefix codes are not used by the encoder")
+	}
+	var codes [5]huffman
+	for i, size := range []int{numLiterals + numLengthCodes, numLiterals, numLiterals, numLiterals, numDistanceCodes} {
+		var err error
+		if codes[i], err = d.prefixCode(size); err != nil {
+			t.Fatalf("prefix code %d: %v", i, err)
+		}
+	}
+
+	argb := make([]uint32, width*height)
+	for i := 0; i < len(argb); {
+		g := d.symbol(codes[0])
+		if g < numLiterals {
+			r, b, a := d.symbol(codes[1]), d.symbol(codes[2]), d.symbol(codes[3])
+			argb[i] = uint32(a)<<24 | uint32(r)<<16 | uint32(g)<<8 | uint32(b)
+			i++
+			continue
+		}
+		length := d.prefixValue(g - numLiterals)
+		dist := d.prefixValue(d.symbol(codes[4]))
+		switch {
+		case dist == 1:
+			dist = width
+		case dist == 2:
+			dist = 1
+		case dist > 120:
+			dist -= 120
+		default:
+			t.Fatalf("distance code %d is not used by the encoder", dist)
+		}
+		if dist > i || i+length > len(argb) {
+			t.Fatalf("backward reference of %d pixels from %d at %d is out of bounds", length, dist, i)
+		}
+		for range length {
+			argb[i] = argb[i-dist]
+			i++
+		}
+	}
+	if rest := len(d.data)*8 - d.pos; rest >= 8 {
+		t.Fatalf("%d bits left over", rest)
+	}
+
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for i, p := range argb {
+		g := p >> 8 & 0xff
+		r, b := p>>16&0xff, p&0xff
+		if subtract {
+			r, b = (r+g)&0xff, (b+g)&0xff
+		}
+		img.Pix[4*i], img.Pix[4*i+1], img.Pix[4*i+2], img.Pix[4*i+3] = byte(r), byte(g), byte(b), byte(p>>24)
+	}
+	return img, alpha
+}
+
+func TestEncode_RoundTrip(t *testing.T) {
+	rng := rand.New(rand.NewPCG(1, 2))
+	noise := image.NewNRGBA(image.Rect(0, 0, 61, 37))
+	for i := range noise.Pix {
+		noise.Pix[i] = byte(rng.IntN(256))
+	}
+	gradient := image.NewRGBA(image.Rect(10, 20, 138, 148))
+	for y := 20; y < 148; y++ {
+		for x := 10; x < 138; x++ {
+			gradient.SetRGBA(x, y, color.RGBA{R: uint8(x), G: uint8(y), B: uint8(x + y), A: 255})
+		}
+	}
+	stripes := image.NewNRGBA(image.Rect(0, 0, 300, 200))
+	for y := range 200 {
+		for x := range 300 {
+			c := color.NRGBA{R: 200, G: 40, B: 40, A: 255}
+			if (x/7+y/5)%2 == 0 {
+				c = color.NRGBA{R: 20, G: 20, B: 120, A: 128}
+			}
+			stripes.SetNRGBA(x, y, c)
+		}
+	}
+	flat := image.NewNRGBA(image.Rect(0, 0, 2048, 3))
+	for i := range flat.Pix {
+		flat.Pix[i] = 0xff
+	}
+
+	tests := []struct {
+		name  string
+		img   image.Image
+		alpha bool
+	}{
+		{"1x1", image.NewNRGBA(image.Rect(0, 0, 1, 1)), true},
+		{"noise", noise, true},
+		{"gradient", gradient, false},
+		{"stripes", stripes, true},
+		{"flat", flat, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := Encode(&buf, tt.img); err != nil {
+				t.Fatalf("Encode: %v", err)
+			}
+			got, alpha := decode(t, buf.Bytes())
+			if alpha != tt.alpha {
+				t.Errorf("alpha_is_used = %v, want %v", alpha, tt.alpha)
+			}
+			comparePixels(t, got, tt.img)
+
+			// The reader above shares the encoder's reading of the format, so
+			// also check the output against an independent decoder.
+			ref, err := xwebp.Decode(bytes.NewReader(buf.Bytes()))
+			if err != nil {
+				t.Fatalf("x/image/webp: %v", err)
+			}
+			comparePixels(t, ref, tt.img)
+		})
+	}
+}
+
+// comparePixels fails t unless got holds want's pixels, from the origin.
+func comparePixels(t *testing.T, got, want image.Image) {
+	t.Helper()
+	b := want.Bounds()
+	if got.Bounds().Size() != b.Size() {
+		t.Fatalf("decoded size %v, want %v", got.Bounds().Size(), b.Size())
+	}
+	g := got.Bounds().Min
+	for y := range b.Dy() {
+		for x := range b.Dx() {
+			w := color.NRGBAModel.Convert(want.At(b.Min.X+x, b.Min.Y+y))
+			if c := color.NRGBAModel.Convert(got.At(g.X+x, g.Y+y)); c != w {
+				t.Fatalf("pixel (%d, %d) = %v, want %v", x, y, c, w)
+			}
+		}
+	}
+}
+
+func TestEncode_CompressesRepetition(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 512, 512))
+	for i := range img.Pix {
+		img.Pix[i] = byte(i / 4 % 16 * 16)
+	}
+	var buf bytes.Buffer
+	if err := Encode(&buf, img); err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	if buf.Len() > 2000 {
+		t.Fatalf("repeating 512x512 image encoded to %d bytes", buf.Len())
+	}
+}
+
+func TestEncode_InvalidSize(t *testing.T) {
+	for _, r := range []image.Rectangle{image.Rect(0, 0, 0, 10), image.Rect(0, 0, maxDimension+1, 1)} {
+		if err := Encode(&bytes.Buffer{}, image.NewNRGBA(r)); !errors.Is(err, ErrInvalidSize) {
+			t.Errorf("Encode(%v) = %v, want ErrInvalidSize", r, err)
+		}
+	}
+}
+
+func TestHuffmanLengths_LimitsDepth(t *testing.T) {
+	// Fibonacci counts make the optimal code as deep as it gets.
+	hist := make([]uint32, 40)
+	a, b := uint32(1), uint32(1)
+	for i := range hist {
+		hist[i] = a
+		a, b = b, a+b
+	}
+	lengths := huffmanLengths(hist, maxCodeLength)
+	kraft := 0.0
+	for _, l := range lengths {
+		if l == 0 || l > maxCodeLength {
+			t.Fatalf("lengths = %v, want every symbol coded in at most %d bits", lengths, maxCodeLength)
+		}
+		kraft += 1 / float64(uint(1)<<l)
+	}
+	if kraft != 1 {
+		t.Fatalf("lengths %v do not form a complete code", lengths)
+	}
+}
@@ -32,6 +32,54 @@ const (
 	MsgPing     MessageType = "ping"
 	MsgPong     MessageType = "pong"
 	MsgAck      MessageType = "ack"
+
+	MsgCapabilities MessageType = "capabilities"
+	MsgTimers       MessageType = "timers"
+	MsgVotes        MessageType = "votes"
+	MsgBatch        MessageType = "batch"
+	MsgPresence     MessageType = "presence"
+)
+
+// PresenceState is the server-computed visibility state of the displayed
+// session.
+type PresenceState string
+
+// Presence states.
+const (
+	// PresenceActive: the session is playing.
+	PresenceActive PresenceState = "active"
+	// PresencePaused: playback is paused or stopped, not yet for long
+	// enough to be idle.
+	PresencePaused PresenceState = "paused"
+	// PresenceIdle: playback has been paused or stopped past the configured
+	// threshold.
+	PresenceIdle PresenceState = "idle"
+	// PresenceClosed: no session is displayed.
+	PresenceClosed PresenceState = "closed"
+)
+
+// ErrorCode classifies a failed control so clients can react without parsing
+// the error text.
+type ErrorCode string
+
+// Error code constants
+const (
+	// CodeNoSession: there is no active session, or the targeted one is gone.
+	CodeNoSession ErrorCode = "no_session"
+	// CodeNotSupported: the player does not support the control right now.
+	CodeNotSupported ErrorCode = "not_supported"
+	// CodeBusy: the server is overloaded with controls; retry later.
+	CodeBusy ErrorCode = "busy"
+	// CodeInvalidArgument: the control or its arguments are malformed or out
+	// of range.
+	CodeInvalidArgument ErrorCode = "invalid_argument"
+	// CodeNotFound: a bookmark, macro or track the control refers to does
+	// not exist.
+	CodeNotFound ErrorCode = "not_found"
+	// CodeTimeout: the player did not answer in time.
+	CodeTimeout ErrorCode = "timeout"
+	// CodeProviderError: the player or Windows rejected the control.
+	CodeProviderError ErrorCode = "provider_error"
 )
 
 // Envelope is the top-level WebSocket message container
@@ -45,9 +93,79 @@ type Envelope struct {
 
 // HelloPayload is the data for a hello message
 type HelloPayload struct {
-	ServerVersion     string        `json:"serverVersion"`
-	SupportedMessages []MessageType `json:"supportedMessages"`
+	ServerVersion     string          `json:"serverVersion"`
+	SupportedMessages []MessageType   `json:"supportedMessages"`
 	Capabilities      map[string]bool `json:"capabilities"`
+	Controls          []ControlSpec   `json:"controls"`
+}
+
+// CapabilitiesPayload is the data for a capabilities message. The map has the
+// same keys as HelloPayload.Capabilities.
+type CapabilitiesPayload struct {
+	Capabilities map[string]bool `json:"capabilities"`
+	Controls     []ControlSpec   `json:"controls"`
+}
+
+// ControlSpec describes a control action and the arguments the server
+// accepts for it. Enabled is false when the server would reject the action
+// for the displayed session.
+type ControlSpec struct {
+	Action  string    `json:"action"`
+	Enabled bool      `json:"enabled"`
+	Args    []ArgSpec `json:"args,omitempty"`
+	OneOf   bool      `json:"oneOf,omitempty"` // exactly one of Args must be given
+}
+
+// ArgSpec describes one argument of a control. Min and Max bound numeric
+// arguments inclusively; Enum lists the only accepted values.
+type ArgSpec struct {
+	Name     string    `json:"name"`
+	Type     string    `json:"type"` // "integer", "number", "boolean" or "string"
+	Unit     string    `json:"unit,omitempty"`
+	Required bool      `json:"required,omitempty"`
+	Min      *float64  `json:"min,omitempty"`
+	Max      *float64  `json:"max,omitempty"`
+	Default  *float64  `json:"default,omitempty"`
+	Enum     []float64 `json:"enum,omitempty"`
+}
+
+// TimerPayload describes a scheduled control. Exactly one of FiresAt and
+// TracksRemaining is set, depending on the timer's trigger.
+type TimerPayload struct {
+	ID        string          `json:"id"`
+	Action    string          `json:"action"`
+	Args      json.RawMessage `json:"args,omitempty"`
+	Session   string          `json:"session,omitempty"`
+	CreatedAt int64           `json:"createdAt"` // Unix milliseconds
+	// FiresAt is when a time-based timer fires, in Unix milliseconds.
+	FiresAt int64 `json:"firesAt,omitempty"`
+	// TracksRemaining is how many track changes a track-based timer still
+	// waits for.
+	TracksRemaining int `json:"tracksRemaining,omitempty"`
+}
+
+// TimersPayload is the data for a timers message
+type TimersPayload struct {
+	Timers []TimerPayload `json:"timers"`
+}
+
+// VotesPayload is the data for a votes message: the vote-to-skip tally of
+// the current track.
+type VotesPayload struct {
+	Votes  int `json:"votes"`
+	Needed int `json:"needed"`
+	// Active is the number of voters seen within the active window, the base
+	// of a percentage threshold.
+	Active int `json:"active"`
+	// Skipped is set on the tally that reached the threshold.
+	Skipped bool `json:"skipped,omitempty"`
+}
+
+// PresencePayload is the data for a presence message. Since is when the
+// state was entered, in Unix milliseconds.
+type PresencePayload struct {
+	State PresenceState `json:"state"`
+	Since int64         `json:"since"`
 }
 
 // InfoPayload is the data for an info message
@@ -59,6 +177,30 @@ type InfoPayload struct {
 	PlaybackType int    `json:"playbackType"`
 	SourceApp    string `json:"sourceApp"`
 	AlbumArt     string `json:"albumArt"`
+	// AlbumArtSource says where the album art came from: "player",
+	// "folder", "app" or "generated". Omitted without art.
+	AlbumArtSource  string   `json:"albumArtSource,omitempty"`
+	Subtitle        string   `json:"subtitle"`
+	Genres          []string `json:"genres"`
+	TrackNumber     int      `json:"trackNumber"`
+	AlbumTrackCount int      `json:"albumTrackCount"`
+	// Palette holds colours picked from the album art; nil without art.
+	Palette *PalettePayload `json:"palette,omitempty"`
+}
+
+// PalettePayload holds colours picked from the album art as #rrggbb strings.
+// Text is black or white, whichever reads better on Dominant, and
+// TextContrast is its WCAG contrast ratio against Dominant.
+type PalettePayload struct {
+	Dominant     string  `json:"dominant"`
+	Vibrant      string  `json:"vibrant"`
+	Muted        string  `json:"muted"`
+	LightVibrant string  `json:"lightVibrant"`
+	DarkVibrant  string  `json:"darkVibrant"`
+	LightMuted   string  `json:"lightMuted"`
+	DarkMuted    string  `json:"darkMuted"`
+	Text         string  `json:"text"`
+	TextContrast float64 `json:"textContrast"`
 }
 
 // ProgressPayload is the data for a progress message
@@ -88,23 +230,74 @@ type SessionsPayload struct {
 type ControlPayload struct {
 	Action string          `json:"action"`
 	Args   json.RawMessage `json:"args,omitempty"`
+	// Wait asks the server to hold the ack until the control's effect is
+	// observed (or Timeout milliseconds pass) and include the resulting state.
+	Wait    bool `json:"wait,omitempty"`
+	Timeout int  `json:"timeout,omitempty"`
+	// Session targets the session with this appID instead of the displayed one.
+	Session string `json:"session,omitempty"`
+}
+
+// BatchStep is one control of a batch or macro.
+type BatchStep struct {
+	Action string          `json:"action"`
+	Args   json.RawMessage `json:"args,omitempty"`
+	// Delay pauses this many milliseconds before the step runs.
+	Delay int `json:"delay,omitempty"`
+	// Wait holds the next step until this one's effect is observed (or
+	// Timeout milliseconds pass), as for a control sent with wait.
+	Wait    bool `json:"wait,omitempty"`
+	Timeout int  `json:"timeout,omitempty"`
+	// IfCapability skips the step unless the named capability is enabled.
+	IfCapability string `json:"ifCapability,omitempty"`
+	// IfStatus skips the step unless the playback status is "playing",
+	// "paused" or "stopped"; a leading "!" negates it.
+	IfStatus string `json:"ifStatus,omitempty"`
+}
+
+// BatchPayload is the data for a batch message. Exactly one of Steps and
+// Macro, the name of a macro from the config, is set.
+type BatchPayload struct {
+	Steps   []BatchStep `json:"steps,omitempty"`
+	Macro   string      `json:"macro,omitempty"`
+	Session string      `json:"session,omitempty"`
+}
+
+// StepResult reports one step of a batch. Skipped steps did not run, either
+// because their condition did not hold or because an earlier step failed.
+type StepResult struct {
+	Action   string    `json:"action"`
+	Success  bool      `json:"success"`
+	Error    string    `json:"error,omitempty"`
+	Code     ErrorCode `json:"code,omitempty"`
+	Skipped  bool      `json:"skipped,omitempty"`
+	TimedOut bool      `json:"timedOut,omitempty"`
 }
 
-// AckPayload is the data for an ack message
+// AckPayload is the data for an ack message. Code classifies Error. Info,
+// Progress and TimedOut are only set for controls sent with wait; Steps only
+// for batches.
 type AckPayload struct {
-	Success bool   `json:"success"`
-	Error   string `json:"error,omitempty"`
+	Success  bool             `json:"success"`
+	Error    string           `json:"error,omitempty"`
+	Code     ErrorCode        `json:"code,omitempty"`
+	Info     *InfoPayload     `json:"info,omitempty"`
+	Progress *ProgressPayload `json:"progress,omitempty"`
+	TimedOut bool             `json:"timedOut,omitempty"`
+	Steps    []StepResult     `json:"steps,omitempty"`
 }
 
 // NewHello creates a hello message
-func NewHello(version string, caps map[string]bool) Envelope {
+func NewHello(version string, caps map[string]bool, controls []ControlSpec) Envelope {
 	payload := HelloPayload{
 		ServerVersion: version,
 		SupportedMessages: []MessageType{
 			MsgHello, MsgInfo, MsgProgress, MsgSessions,
 			MsgReload, MsgControl, MsgPing, MsgPong, MsgAck,
+			MsgCapabilities, MsgTimers, MsgVotes, MsgBatch, MsgPresence,
 		},
 		Capabilities: caps,
+		Controls:     controls,
 	}
 	data, _ := json.Marshal(payload)
 	return Envelope{
@@ -115,18 +308,51 @@ func NewHello(version string, caps map[string]bool) Envelope {
 	}
 }
 
-// NewInfo creates an info message
-func NewInfo(d domain.InfoData, albumArtURL string) Envelope {
-	payload := InfoPayload{
-		Artist:       d.Artist,
-		Title:        d.Title,
-		AlbumTitle:   d.AlbumTitle,
-		AlbumArtist:  d.AlbumArtist,
-		PlaybackType: d.PlaybackType,
-		SourceApp:    d.SourceApp,
-		AlbumArt:     albumArtURL,
+// NewCapabilities creates a capabilities message
+func NewCapabilities(caps map[string]bool, controls []ControlSpec) Envelope {
+	payload := CapabilitiesPayload{
+		Capabilities: caps,
+		Controls:     controls,
 	}
 	data, _ := json.Marshal(payload)
+	return Envelope{
+		Type: MsgCapabilities,
+		V:    ProtocolVersion,
+		TS:   time.Now().UnixMilli(),
+		Data: data,
+	}
+}
+
+// NewInfoPayload converts domain info into its wire representation.
+// Genres is always a non-nil slice so clients receive [] rather than null.
+func NewInfoPayload(d domain.InfoData, albumArtURL string, palette *PalettePayload) InfoPayload {
+	genres := make([]string, len(d.Genres))
+	copy(genres, d.Genres)
+	var artSource string
+	if albumArtURL != "" {
+		artSource = d.ThumbnailSource
+	}
+	return InfoPayload{
+		Artist:          d.Artist,
+		Title:           d.Title,
+		AlbumTitle:      d.AlbumTitle,
+		AlbumArtist:     d.AlbumArtist,
+		PlaybackType:    d.PlaybackType,
+		SourceApp:       d.SourceApp,
+		AlbumArt:        albumArtURL,
+		AlbumArtSource:  artSource,
+		Subtitle:        d.Subtitle,
+		Genres:          genres,
+		TrackNumber:     d.TrackNumber,
+		AlbumTrackCount: d.AlbumTrackCount,
+		Palette:         palette,
+	}
+}
+
+// NewInfo creates an info message
+func NewInfo(d domain.InfoData, albumArtURL string, palette *PalettePayload) Envelope {
+	payload := NewInfoPayload(d, albumArtURL, palette)
+	data, _ := json.Marshal(payload)
 	return Envelope{
 		Type: MsgInfo,
 		V:    ProtocolVersion,
@@ -135,9 +361,9 @@ func NewInfo(d domain.InfoData, albumArtURL string) Envelope {
 	}
 }
 
-// NewProgress creates a progress message
-func NewProgress(d domain.ProgressData) Envelope {
-	payload := ProgressPayload{
+// NewProgressPayload converts domain progress into its wire representation.
+func NewProgressPayload(d domain.ProgressData) ProgressPayload {
+	return ProgressPayload{
 		Position:        d.Position,
 		Duration:        d.Duration,
 		Status:          d.Status,
@@ -146,6 +372,11 @@ func NewProgress(d domain.ProgressData) Envelope {
 		AutoRepeatMode:  d.AutoRepeatMode,
 		LastUpdatedTime: d.LastUpdatedTime,
 	}
+}
+
+// NewProgress creates a progress message
+func NewProgress(d domain.ProgressData) Envelope {
+	payload := NewProgressPayload(d)
 	data, _ := json.Marshal(payload)
 	return Envelope{
 		Type: MsgProgress,
@@ -177,6 +408,42 @@ func NewSessions(sessions []domain.SessionInfo) Envelope {
 	}
 }
 
+// NewTimers creates a timers message listing all pending timers
+func NewTimers(timers []TimerPayload) Envelope {
+	if timers == nil {
+		timers = []TimerPayload{}
+	}
+	data, _ := json.Marshal(TimersPayload{Timers: timers})
+	return Envelope{
+		Type: MsgTimers,
+		V:    ProtocolVersion,
+		TS:   time.Now().UnixMilli(),
+		Data: data,
+	}
+}
+
+// NewVotes creates a votes message
+func NewVotes(payload VotesPayload) Envelope {
+	data, _ := json.Marshal(payload)
+	return Envelope{
+		Type: MsgVotes,
+		V:    ProtocolVersion,
+		TS:   time.Now().UnixMilli(),
+		Data: data,
+	}
+}
+
+// NewPresence creates a presence message
+func NewPresence(payload PresencePayload) Envelope {
+	data, _ := json.Marshal(payload)
+	return Envelope{
+		Type: MsgPresence,
+		V:    ProtocolVersion,
+		TS:   time.Now().UnixMilli(),
+		Data: data,
+	}
+}
+
 // NewReload creates a reload message
 func NewReload() Envelope {
 	return Envelope{
@@ -212,6 +479,12 @@ func NewAck(id string, err error) Envelope {
 	if err != nil {
 		payload.Error = err.Error()
 	}
+	return NewAckPayload(id, payload)
+}
+
+// NewAckPayload creates an ack message with a fully populated payload, used
+// for controls sent with wait.
+func NewAckPayload(id string, payload AckPayload) Envelope {
 	data, _ := json.Marshal(payload)
 	return Envelope{
 		Type: MsgAck,
@@ -248,3 +521,12 @@ func (e Envelope) ParseControl() (ControlPayload, error) {
 	}
 	return payload, nil
 }
+
+// ParseBatch decodes the batch payload from an envelope
+func (e Envelope) ParseBatch() (BatchPayload, error) {
+	var payload BatchPayload
+	if err := json.Unmarshal(e.Data, &payload); err != nil {
+		return BatchPayload{}, err
+	}
+	return payload, nil
+}
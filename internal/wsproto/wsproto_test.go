@@ -18,7 +18,7 @@ func TestEnvelopeRoundTrip(t *testing.T) {
 			env: NewHello("1.0", map[string]bool{
 				"play":  true,
 				"pause": true,
-			}),
+			}, []ControlSpec{{Action: "play", Enabled: true}}),
 		},
 		{
 			name: "info",
@@ -29,7 +29,7 @@ func TestEnvelopeRoundTrip(t *testing.T) {
 				AlbumArtist:  "Album Artist",
 				PlaybackType: 1,
 				SourceApp:    "TestApp.exe",
-			}, "/albumArt/a3f2c1"),
+			}, "/albumArt/a3f2c1", &PalettePayload{Dominant: "#141e5a", Text: "#ffffff", TextContrast: 15.2}),
 		},
 		{
 			name: "progress",
@@ -53,6 +53,14 @@ func TestEnvelopeRoundTrip(t *testing.T) {
 				},
 			}),
 		},
+		{
+			name: "capabilities",
+			env:  NewCapabilities(map[string]bool{"next": false}, nil),
+		},
+		{
+			name: "presence",
+			env:  NewPresence(PresencePayload{State: PresenceIdle, Since: 1711900000000}),
+		},
 		{
 			name: "reload",
 			env:  NewReload(),
@@ -177,6 +185,22 @@ func TestParseControl(t *testing.T) {
 	}
 }
 
+func TestParseBatch(t *testing.T) {
+	env := Envelope{
+		Type: MsgBatch,
+		V:    ProtocolVersion,
+		Data: json.RawMessage(`{"steps":[{"action":"previous","wait":true},{"action":"seek","args":{"position":0},"ifCapability":"seek"}],"session":"Spotify.exe"}`),
+	}
+
+	got, err := env.ParseBatch()
+	if err != nil {
+		t.Fatalf("parse batch failed: %v", err)
+	}
+	if len(got.Steps) != 2 || !got.Steps[0].Wait || got.Steps[1].IfCapability != "seek" || got.Session != "Spotify.exe" {
+		t.Errorf("batch mismatch: got %+v", got)
+	}
+}
+
 func TestNewAckSuccess(t *testing.T) {
 	env := NewAck("msg-123", nil)
 
@@ -213,6 +237,94 @@ func TestNewAckError(t *testing.T) {
 	}
 }
 
+func TestNewInfoExtendedFields(t *testing.T) {
+	env := NewInfo(domain.InfoData{
+		Title:           "Title",
+		Subtitle:        "Live",
+		Genres:          []string{"Rock", "Blues"},
+		TrackNumber:     3,
+		AlbumTrackCount: 12,
+	}, "", nil)
+
+	var payload InfoPayload
+	if err := json.Unmarshal(env.Data, &payload); err != nil {
+		t.Fatalf("unmarshal failed: %v", err)
+	}
+
+	if payload.Subtitle != "Live" {
+		t.Errorf("subtitle mismatch: got %q, want %q", payload.Subtitle, "Live")
+	}
+	if len(payload.Genres) != 2 || payload.Genres[0] != "Rock" || payload.Genres[1] != "Blues" {
+		t.Errorf("genres mismatch: got %v", payload.Genres)
+	}
+	if payload.TrackNumber != 3 || payload.AlbumTrackCount != 12 {
+		t.Errorf("track numbers mismatch: got %d/%d, want 3/12", payload.TrackNumber, payload.AlbumTrackCount)
+	}
+}
+
+func TestNewInfoEmptyGenresIsArray(t *testing.T) {
+	env := NewInfo(domain.InfoData{Title: "Title"}, "", nil)
+
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(env.Data, &raw); err != nil {
+		t.Fatalf("unmarshal failed: %v", err)
+	}
+	if string(raw["genres"]) != "[]" {
+		t.Errorf("genres = %s, want []", raw["genres"])
+	}
+	if _, ok := raw["palette"]; ok {
+		t.Errorf("palette = %s, want it omitted without album art", raw["palette"])
+	}
+}
+
+func TestNewInfoAlbumArtSource(t *testing.T) {
+	d := domain.InfoData{Title: "Title", ThumbnailSource: domain.ArtSourceGenerated}
+
+	if p := NewInfoPayload(d, "/albumArt/abc", nil); p.AlbumArtSource != domain.ArtSourceGenerated {
+		t.Errorf("albumArtSource = %q, want %q", p.AlbumArtSource, domain.ArtSourceGenerated)
+	}
+	if p := NewInfoPayload(d, "", nil); p.AlbumArtSource != "" {
+		t.Errorf("albumArtSource = %q without art, want it empty", p.AlbumArtSource)
+	}
+}
+
+func TestNewCapabilities(t *testing.T) {
+	maxRate := 4.0
+	env := NewCapabilities(map[string]bool{"next": true, "seek": false}, []ControlSpec{
+		{Action: "rate", Enabled: true, Args: []ArgSpec{{Name: "rate", Type: "number", Required: true, Max: &maxRate}}},
+	})
+
+	if env.Type != MsgCapabilities {
+		t.Errorf("type mismatch: got %q, want %q", env.Type, MsgCapabilities)
+	}
+
+	var payload CapabilitiesPayload
+	if err := json.Unmarshal(env.Data, &payload); err != nil {
+		t.Fatalf("unmarshal failed: %v", err)
+	}
+	if !payload.Capabilities["next"] || payload.Capabilities["seek"] {
+		t.Errorf("capabilities mismatch: got %v", payload.Capabilities)
+	}
+	if len(payload.Controls) != 1 || payload.Controls[0].Args[0].Max == nil || *payload.Controls[0].Args[0].Max != maxRate {
+		t.Errorf("controls mismatch: got %+v", payload.Controls)
+	}
+}
+
+func TestNewTimersEmptyIsArray(t *testing.T) {
+	env := NewTimers(nil)
+
+	if env.Type != MsgTimers {
+		t.Errorf("type mismatch: got %q, want %q", env.Type, MsgTimers)
+	}
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(env.Data, &raw); err != nil {
+		t.Fatalf("unmarshal failed: %v", err)
+	}
+	if string(raw["timers"]) != "[]" {
+		t.Errorf("timers = %s, want []", raw["timers"])
+	}
+}
+
 func TestNewPong(t *testing.T) {
 	pingTS := int64(1711900000000)
 	env := NewPong(pingTS)
@@ -230,9 +342,10 @@ func TestMessageTypeConstants(t *testing.T) {
 	types := []MessageType{
 		MsgHello, MsgInfo, MsgProgress, MsgSessions,
 		MsgReload, MsgControl, MsgPing, MsgPong, MsgAck,
+		MsgCapabilities, MsgTimers, MsgVotes, MsgBatch, MsgPresence,
 	}
 
-	expectedCount := 9
+	expectedCount := 14
 	if len(types) != expectedCount {
 		t.Errorf("expected %d message types, got %d", expectedCount, len(types))
 	}
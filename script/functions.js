@@ -117,10 +117,6 @@ document.addEventListener('DOMContentLoaded', function () {
         }
     }
 
-    // Parse hideDelay URL param: ms of grace period before idle class (default 5000)
-    var params = new URLSearchParams(window.location.search);
-    var hideDelay = parseInt(params.get('hideDelay') || '5000', 10);
-
     // Playback state for client-side position interpolation
     var playbackState = {
         position: 0,
@@ -130,7 +126,11 @@ document.addEventListener('DOMContentLoaded', function () {
         status: 0
     };
     var rafId = null;
-    var idleTimer = null;
+    // Status class from the last progress message, and whether the server's
+    // presence state says the overlay should hide. The server owns the idle
+    // threshold so every overlay hides at the same moment.
+    var statusClass = 'stopped';
+    var presenceIdle = false;
 
     // Current track info for song-change transition detection
     var currentTitle = null;
@@ -148,10 +148,12 @@ document.addEventListener('DOMContentLoaded', function () {
     var transitionTimer = null;
     var pendingTrackInfo = null;
 
-    // Apply a single status CSS class to the root <html> element
+    // Apply a single status CSS class to the root <html> element;
+    // idle takes precedence while the server reports it
     function setStatusClass(className) {
+        statusClass = className;
         document.documentElement.classList.remove('playing', 'paused', 'stopped', 'idle');
-        document.documentElement.classList.add(className);
+        document.documentElement.classList.add(presenceIdle ? 'idle' : className);
     }
 
     // Start requestAnimationFrame loop for smooth progress bar interpolation
@@ -239,7 +241,11 @@ document.addEventListener('DOMContentLoaded', function () {
                 albumTitle: data.albumTitle || '',
                 albumArtist: data.albumArtist || '',
                 playbackType: data.playbackType || 0,
-                sourceApp: data.sourceApp || ''
+                sourceApp: data.sourceApp || '',
+                subtitle: data.subtitle || '',
+                genres: data.genres || [],
+                trackNumber: data.trackNumber || 0,
+                albumTrackCount: data.albumTrackCount || 0
             });
         }
     }
@@ -262,32 +268,14 @@ document.addEventListener('DOMContentLoaded', function () {
             playbackState.status = status;
             window.setPlayingStatus(status);
 
-            // Update status CSS class and manage idle grace-period timer
+            // Update status CSS class; idle comes from presence messages
             if (status === STATUS_PLAYING) {
-                // Playing: cancel idle timer, apply playing class
-                if (idleTimer !== null) {
-                    clearTimeout(idleTimer);
-                    idleTimer = null;
-                }
                 setStatusClass('playing');
             } else if (status === STATUS_PAUSED) {
-                // Paused: cancel idle timer, apply paused class
-                if (idleTimer !== null) {
-                    clearTimeout(idleTimer);
-                    idleTimer = null;
-                }
                 setStatusClass('paused');
             } else {
-                // Stopped/Closed/Opened/Changing (0-3): apply stopped,
-                // then schedule idle class after grace period
+                // Stopped/Closed/Opened/Changing (0-3)
                 setStatusClass('stopped');
-                if (idleTimer !== null) {
-                    clearTimeout(idleTimer);
-                }
-                idleTimer = setTimeout(function () {
-                    setStatusClass('idle');
-                    idleTimer = null;
-                }, hideDelay);
             }
         }
 
@@ -344,6 +332,16 @@ document.addEventListener('DOMContentLoaded', function () {
             case 'progress':
                 handleProgress(env.data);
                 break;
+            case 'presence': {
+                // Server-computed presence: idle and closed hide the overlay.
+                var state = (env.data || {}).state;
+                presenceIdle = (state === 'idle' || state === 'closed');
+                setStatusClass(statusClass);
+                if (typeof window.setPresence === 'function') {
+                    window.setPresence(state);
+                }
+                break;
+            }
             case 'sessions':
                 // Theme doesn't need session enumeration; ignore silently.
                 break;